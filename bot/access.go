@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// isAllowed 判斷使用者在此聊天中能否使用 Bot
+// 管理員永遠允許；明確封鎖優先；設定了白名單（環境變數或 /allow）時只允許名單內的使用者或群組
+func (b *Bot) isAllowed(userID int64, chat *tgbotapi.Chat) bool {
+	if b.config.IsAdmin(userID) {
+		return true
+	}
+
+	var chatID int64
+	if chat != nil && !chat.IsPrivate() {
+		chatID = chat.ID
+	}
+
+	userRule, userFound, err := b.db.GetAccessRule(userID)
+	if err != nil {
+		log.Printf("Failed to load access rule: %v", err)
+	}
+	if userFound && !userRule {
+		return false
+	}
+	chatRule, chatFound := false, false
+	if chatID != 0 {
+		chatRule, chatFound, err = b.db.GetAccessRule(chatID)
+		if err != nil {
+			log.Printf("Failed to load access rule: %v", err)
+		}
+		if chatFound && !chatRule {
+			return false
+		}
+	}
+
+	if (userFound && userRule) || (chatFound && chatRule) {
+		return true
+	}
+	if containsID(b.config.AllowedUsers, userID) || (chatID != 0 && containsID(b.config.AllowedChats, chatID)) {
+		return true
+	}
+
+	// 沒有任何白名單時不限制
+	hasAllowRules, _ := b.db.HasAllowRules()
+	return len(b.config.AllowedUsers) == 0 && len(b.config.AllowedChats) == 0 && !hasAllowRules
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// cmdAllow /allow <id>：允許使用者（正數）或群組（負數）
+func (b *Bot) cmdAllow(msg *tgbotapi.Message) {
+	b.setAccessRule(msg, true)
+}
+
+// cmdDeny /deny <id>：封鎖使用者（正數）或群組（負數）
+func (b *Bot) cmdDeny(msg *tgbotapi.Message) {
+	b.setAccessRule(msg, false)
+}
+
+func (b *Bot) setAccessRule(msg *tgbotapi.Message, allowed bool) {
+	if !b.config.IsAdmin(msg.From.ID) {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 只有管理員可以使用此指令"))
+		return
+	}
+
+	targetID, err := strconv.ParseInt(strings.TrimSpace(msg.CommandArguments()), 10, 64)
+	if err != nil || targetID == 0 {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/"+msg.Command()+" <使用者 ID 或群組 ID>"))
+		return
+	}
+
+	if err := b.db.SetAccessRule(targetID, allowed); err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 設定失敗："+err.Error()))
+		return
+	}
+
+	target := "使用者"
+	if targetID < 0 {
+		target = "群組"
+	}
+	action := "允許"
+	if !allowed {
+		action = "封鎖"
+	}
+	b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已%s%s %d", action, target, targetID)))
+}
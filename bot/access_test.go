@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"testing"
+
+	"tg-bawer/config"
+	"tg-bawer/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestIsAllowed(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	b := &Bot{db: db, config: &config.Config{AdminIDs: []int64{1}}}
+	private := &tgbotapi.Chat{ID: 2, Type: "private"}
+	group := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+
+	if !b.isAllowed(2, private) {
+		t.Fatalf("expected open access without allowlist")
+	}
+
+	if err := db.SetAccessRule(-100, true); err != nil {
+		t.Fatalf("SetAccessRule failed: %v", err)
+	}
+	if b.isAllowed(2, private) {
+		t.Fatalf("expected unlisted user to be rejected once allowlist exists")
+	}
+	if !b.isAllowed(2, group) {
+		t.Fatalf("expected user in allowed group to be accepted")
+	}
+	if !b.isAllowed(1, private) {
+		t.Fatalf("expected admin to always be allowed")
+	}
+
+	if err := db.SetAccessRule(3, false); err != nil {
+		t.Fatalf("SetAccessRule failed: %v", err)
+	}
+	if b.isAllowed(3, group) {
+		t.Fatalf("expected denied user to be rejected even in allowed group")
+	}
+}
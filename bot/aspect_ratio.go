@@ -8,31 +8,91 @@ import (
 
 const defaultAspectRatio = "1:1"
 
-func resolveAspectRatio(requested string, downloadedImages []gemini.DownloadedImage) string {
+// ratioTolerance 自動偵測比例的容許誤差（比例），0 代表一律套用最接近的比例
+func (b *Bot) ratioTolerance() float64 {
+	return float64(b.config.RatioTolerancePercent) / 100
+}
+
+// resolveAspectRatio 決定實際使用的比例：@ratio > 圖片偵測 > 使用者預設 > 1:1；
+// 圖片比例與所有支援比例都差超過 tolerance 時回傳空字串，交給模型決定
+func resolveAspectRatio(requested, userDefault string, downloadedImages []gemini.DownloadedImage, tolerance float64) string {
 	requested = strings.TrimSpace(requested)
 	if requested != "" {
 		return requested
 	}
 
 	if len(downloadedImages) == 0 {
+		if userDefault = strings.TrimSpace(userDefault); userDefault != "" {
+			return userDefault
+		}
 		return defaultAspectRatio
 	}
 
-	imageInfo, err := gemini.GetImageInfo(downloadedImages[0].Data)
-	if err != nil || imageInfo == nil || imageInfo.AspectRatio == "" {
+	imageInfo, err := gemini.GetImageInfoWithTolerance(downloadedImages[0].Data, tolerance)
+	if err != nil || imageInfo == nil {
 		return defaultAspectRatio
 	}
 
 	return imageInfo.AspectRatio
 }
 
-func ratioDisplayText(requested, resolved string, imageCount int) string {
+// ratioDisplayText 狀態訊息中的比例，自動偵測且實際比例與套用比例不同時兩者都顯示
+func ratioDisplayText(lang, requested, resolved, detected string, imageCount int) string {
+	if resolved == "" {
+		if detected != "" {
+			return "Auto" + tr(lang, "label.detected_auto", detected)
+		}
+		return "Auto" + tr(lang, "label.auto_detected")
+	}
 	requested = strings.TrimSpace(requested)
 	if requested != "" {
 		return resolved
 	}
 	if imageCount > 0 {
-		return resolved + " (自動偵測)"
+		if detected != "" && detected != resolved {
+			return resolved + tr(lang, "label.detected_applied", detected, resolved)
+		}
+		return resolved + tr(lang, "label.auto_detected")
+	}
+	if resolved != defaultAspectRatio {
+		return resolved + tr(lang, "label.user_default")
+	}
+	return resolved + tr(lang, "label.default")
+}
+
+// detectRawRatio 第一張圖片的實際比例文字，無法解析時回傳空字串
+func detectRawRatio(downloadedImages []gemini.DownloadedImage) string {
+	if len(downloadedImages) == 0 {
+		return ""
+	}
+	info, err := gemini.GetImageInfo(downloadedImages[0].Data)
+	if err != nil {
+		return ""
+	}
+	return info.RawRatioText
+}
+
+// ratioNoteText 結果說明中的比例提示：只在自動偵測的比例被換成其他比例（或不指定）時提醒，避免使用者對裁切感到意外
+func ratioNoteText(lang, requested, resolved, detected string) string {
+	if strings.TrimSpace(requested) != "" || detected == "" || detected == resolved {
+		return ""
+	}
+	if resolved == "" {
+		return tr(lang, "ratio.note_auto", detected)
+	}
+	return tr(lang, "ratio.note_applied", detected, resolved)
+}
+
+// addResultNote 在結果說明最前面加上提示
+func addResultNote(results []*gemini.ImageResult, note string) {
+	if note == "" {
+		return
+	}
+	for _, result := range results {
+		if result.Text == "" {
+			result.Text = note
+		} else {
+			result.Text = note + "\n" + result.Text
+		}
 	}
-	return resolved + " (預設)"
 }
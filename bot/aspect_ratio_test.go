@@ -4,20 +4,21 @@ import (
 	"bytes"
 	"image"
 	"image/png"
+	"strings"
 	"testing"
 
 	"tg-bawer/gemini"
 )
 
 func TestResolveAspectRatio_DefaultWhenNoImage(t *testing.T) {
-	got := resolveAspectRatio("", nil)
+	got := resolveAspectRatio("", "", nil, 0)
 	if got != defaultAspectRatio {
 		t.Fatalf("expected %s, got %s", defaultAspectRatio, got)
 	}
 }
 
 func TestResolveAspectRatio_UseRequested(t *testing.T) {
-	got := resolveAspectRatio("16:9", nil)
+	got := resolveAspectRatio("16:9", "4:3", nil, 0)
 	if got != "16:9" {
 		t.Fatalf("expected requested ratio 16:9, got %s", got)
 	}
@@ -25,14 +26,105 @@ func TestResolveAspectRatio_UseRequested(t *testing.T) {
 
 func TestResolveAspectRatio_DetectNearestFromImage(t *testing.T) {
 	imageBytes := mustMakePNG(t, 1000, 600) // 約 1.6667，最接近 16:9
-	got := resolveAspectRatio("", []gemini.DownloadedImage{
+	got := resolveAspectRatio("", "9:16", []gemini.DownloadedImage{
 		{Data: imageBytes, MimeType: "image/png"},
-	})
+	}, 0)
 	if got != "16:9" {
 		t.Fatalf("expected 16:9, got %s", got)
 	}
 }
 
+func TestResolveAspectRatio_UserDefaultWhenNoImage(t *testing.T) {
+	if got := resolveAspectRatio("", "4:3", nil, 0); got != "4:3" {
+		t.Fatalf("expected user default 4:3, got %s", got)
+	}
+}
+
+func TestResolveAspectRatio_LeavesOutliersToModel(t *testing.T) {
+	strip := []gemini.DownloadedImage{{Data: mustMakePNG(t, 1000, 100), MimeType: "image/png"}}
+	if got := resolveAspectRatio("", "4:3", strip, 0.2); got != "" {
+		t.Fatalf("expected empty ratio for 10:1 strip, got %s", got)
+	}
+	if got := resolveAspectRatio("", "", strip, 0); got != "21:9" {
+		t.Fatalf("expected nearest ratio 21:9 without tolerance, got %s", got)
+	}
+}
+
+func TestRatioDisplayText_Labels(t *testing.T) {
+	cases := []struct {
+		requested, resolved, detected string
+		images                        int
+		want                          string
+	}{
+		{"16:9", "16:9", "10:1", 1, "16:9"},
+		{"", "16:9", "16:9", 1, "16:9 (自動偵測)"},
+		{"", "16:9", "5:3", 1, "16:9 (偵測 5:3，套用 16:9)"},
+		{"", "4:3", "", 0, "4:3 (個人預設)"},
+		{"", defaultAspectRatio, "", 0, defaultAspectRatio + " (預設)"},
+		{"", "", "10:1", 1, "Auto (偵測 10:1，交給模型決定)"},
+	}
+	for _, c := range cases {
+		if got := ratioDisplayText(langZhHant, c.requested, c.resolved, c.detected, c.images); got != c.want {
+			t.Fatalf("ratioDisplayText(%q, %q, %q, %d) = %q, want %q", c.requested, c.resolved, c.detected, c.images, got, c.want)
+		}
+	}
+}
+
+func TestRatioNoteText(t *testing.T) {
+	if got := ratioNoteText(langZhHant, "", "16:9", "16:9"); got != "" {
+		t.Fatalf("expected no note when ratios match, got %q", got)
+	}
+	if got := ratioNoteText(langZhHant, "16:9", "16:9", "10:1"); got != "" {
+		t.Fatalf("expected no note for explicit @ratio, got %q", got)
+	}
+	if got := ratioNoteText(langZhHant, "", "21:9", "10:1"); !strings.Contains(got, "10:1") || !strings.Contains(got, "21:9") {
+		t.Fatalf("expected note with both ratios, got %q", got)
+	}
+
+	results := []*gemini.ImageResult{{Text: "說明"}, {}}
+	addResultNote(results, "📐 note")
+	if results[0].Text != "📐 note\n說明" || results[1].Text != "📐 note" {
+		t.Fatalf("unexpected annotated texts %q / %q", results[0].Text, results[1].Text)
+	}
+}
+
+func TestDetectRawRatio(t *testing.T) {
+	images := []gemini.DownloadedImage{{Data: mustMakePNG(t, 1000, 100), MimeType: "image/png"}}
+	if got := detectRawRatio(images); got != "10:1" {
+		t.Fatalf("detectRawRatio = %q, want 10:1", got)
+	}
+	if got := detectRawRatio(nil); got != "" {
+		t.Fatalf("expected empty ratio without images, got %q", got)
+	}
+}
+
+func TestSettingsRatioSection_MarksRatio(t *testing.T) {
+	_, keyboard := renderSettings(settingsRatio, settingsState{Quality: "2K", Ratio: "16:9"})
+	var marked, auto string
+	for _, row := range keyboard.InlineKeyboard {
+		for _, btn := range row {
+			if btn.CallbackData != nil && *btn.CallbackData == "settings:ratio:"+ratioAuto {
+				auto = btn.Text
+			}
+			if strings.HasPrefix(btn.Text, "● ") {
+				marked = *btn.CallbackData
+			}
+		}
+	}
+	if marked != "settings:ratio:16:9" {
+		t.Fatalf("expected 16:9 to be selected, got %q", marked)
+	}
+	if auto != "○ 自動" {
+		t.Fatalf("unexpected auto button %q", auto)
+	}
+
+	_, keyboard = renderSettings(settingsRatio, settingsState{Quality: "2K"})
+	auto = keyboard.InlineKeyboard[len(keyboard.InlineKeyboard)-2][0].Text
+	if auto != "● 自動" {
+		t.Fatalf("expected auto to be selected when unset, got %q", auto)
+	}
+}
+
 func mustMakePNG(t *testing.T, width, height int) []byte {
 	t.Helper()
 	buffer := &bytes.Buffer{}
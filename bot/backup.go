@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupDirName = "backups"
+	backupPrefix  = "bot-"
+	backupSuffix  = ".db"
+)
+
+// backupDatabaseDaily 每 24 小時備份一次資料庫到 DataDir/backups，並只保留最近 BackupRetention 份
+func (b *Bot) backupDatabaseDaily() {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		path, err := b.backupDatabase(time.Now())
+		if err != nil {
+			log.Printf("資料庫備份失敗: %v", err)
+			continue
+		}
+		log.Printf("資料庫已備份: %s", path)
+	}
+}
+
+func (b *Bot) backupDatabase(now time.Time) (string, error) {
+	dir := filepath.Join(b.config.DataDir, backupDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s%s%s", backupPrefix, now.Format("20060102-150405"), backupSuffix))
+	if err := b.db.BackupTo(path); err != nil {
+		return "", err
+	}
+
+	removed, err := pruneBackups(dir, b.config.BackupRetention)
+	if err != nil {
+		log.Printf("清理舊備份失敗: %v", err)
+	}
+	for _, name := range removed {
+		log.Printf("已刪除舊備份: %s", name)
+	}
+	return path, nil
+}
+
+// pruneBackups 只保留最新的 keep 份備份（依檔名中的時間排序），回傳被刪除的檔名
+func pruneBackups(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	if len(backups) <= keep {
+		return nil, nil
+	}
+
+	sort.Strings(backups)
+	var removed []string
+	for _, name := range backups[:len(backups)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
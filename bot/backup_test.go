@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tg-bawer/config"
+	"tg-bawer/database"
+)
+
+func TestBackupDatabase_KeepsLatestBackups(t *testing.T) {
+	dataDir := t.TempDir()
+	db, err := database.NewDatabase(dataDir)
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	b := &Bot{db: db, config: &config.Config{DataDir: dataDir, BackupRetention: 2}}
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	var last string
+	for i := 0; i < 3; i++ {
+		last, err = b.backupDatabase(start.Add(time.Duration(i) * 24 * time.Hour))
+		if err != nil {
+			t.Fatalf("backupDatabase failed: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dataDir, backupDirName))
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 backups kept, got %d", len(entries))
+	}
+	if entries[0].Name() != "bot-20240102-030000.db" || filepath.Base(last) != "bot-20240103-030000.db" {
+		t.Fatalf("unexpected backups kept: %s, %s", entries[0].Name(), entries[1].Name())
+	}
+
+	if info, err := os.Stat(last); err != nil || info.Size() == 0 {
+		t.Fatalf("expected non-empty backup file, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bawer/gemini"
+)
+
+// baseURLOverrideKey kv_store 中 env-default 服務的 Base URL 覆寫值，空字串代表沿用 GEMINI_BASE_URL
+const baseURLOverrideKey = "gemini_base_url"
+
+// validateBaseURL 確認是含主機的 http(s) 絕對網址，回傳去掉結尾斜線的版本
+func validateBaseURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("網址不可為空")
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("無法解析網址：%v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("網址必須以 http:// 或 https:// 開頭")
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("網址缺少主機名稱")
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", fmt.Errorf("網址不可包含查詢參數或 #")
+	}
+	return strings.TrimRight(raw, "/"), nil
+}
+
+// envBaseURL env-default 服務實際使用的 Base URL：優先使用 /setbaseurl 的覆寫值
+func (b *Bot) envBaseURL() string {
+	override, _, err := b.db.GetKV(baseURLOverrideKey)
+	if err != nil {
+		log.Printf("讀取 Base URL 覆寫值失敗: %v", err)
+	}
+	if strings.TrimSpace(override) != "" {
+		return override
+	}
+	return b.config.GeminiBaseURL
+}
+
+// cmdSetBaseURL /setbaseurl <url>|reset：不重新部署即可更換 env-default 服務的代理網址，限管理員
+func (b *Bot) cmdSetBaseURL(msg *tgbotapi.Message) {
+	if !b.config.IsAdmin(msg.From.ID) {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 只有管理員可以使用此指令"))
+		return
+	}
+
+	args := strings.TrimSpace(msg.CommandArguments())
+	switch strings.ToLower(args) {
+	case "":
+		current := b.envBaseURL()
+		if current == "" {
+			current = gemini.DefaultGeminiBaseURL + "（預設）"
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "🌐 env-default 服務目前的 Base URL："+current+
+			"\n用法：/setbaseurl <url> 設定，/setbaseurl reset 恢復為 GEMINI_BASE_URL"))
+	case "reset":
+		if err := b.db.SetKV(baseURLOverrideKey, ""); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 設定失敗："+err.Error()))
+			return
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 已清除 Base URL 覆寫，恢復使用 GEMINI_BASE_URL"))
+	default:
+		baseURL, err := validateBaseURL(args)
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 無效的 Base URL："+err.Error()))
+			return
+		}
+		if err := b.db.SetKV(baseURLOverrideKey, baseURL); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 設定失敗："+err.Error()))
+			return
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ env-default 服務的 Base URL 已設為 "+baseURL))
+	}
+}
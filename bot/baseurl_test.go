@@ -0,0 +1,34 @@
+package bot
+
+import "testing"
+
+func TestValidateBaseURL(t *testing.T) {
+	valid := map[string]string{
+		"https://generativelanguage.googleapis.com": "https://generativelanguage.googleapis.com",
+		"  http://localhost:8080/ ":                 "http://localhost:8080",
+		"https://proxy.example.com/gemini/":         "https://proxy.example.com/gemini",
+	}
+	for input, want := range valid {
+		got, err := validateBaseURL(input)
+		if err != nil {
+			t.Fatalf("validateBaseURL(%q) error = %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("validateBaseURL(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"proxy.example.com",
+		"ftp://proxy.example.com",
+		"https://",
+		"https://proxy.example.com/?key=abc",
+		"://bad",
+	}
+	for _, input := range invalid {
+		if _, err := validateBaseURL(input); err == nil {
+			t.Fatalf("validateBaseURL(%q) expected error", input)
+		}
+	}
+}
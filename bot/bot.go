@@ -2,10 +2,12 @@ package bot
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"math"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -34,10 +36,56 @@ type Bot struct {
 	db          *database.Database
 	config      *config.Config
 	mediaGroups *mediaGroupCache
+
+	// 全域生成名額（含重試佇列），容量為 MaxConcurrentGenerations
+	generationSlots *slotQueue
+
+	// 最近下載的圖片，依 FileID 快取
+	imageCache *imageCache
+
+	// 生成前的 Prompt 過濾，未設定規則時為 nil
+	contentFilter *contentFilter
+
+	// 生成事件 webhook，未設定 EVENT_WEBHOOK_URL 時為 nil
+	events *eventDispatcher
+
+	// @crop 等待選擇區域的請求
+	crops *cropSessions
+
+	// /models 查詢結果，依服務快取
+	modelLists *modelListCache
+
+	// 每位使用者的訊息佇列，確保依序處理
+	userQueues *userQueues
+
+	// 每則訊息最後一次編輯的內容，避免重複編輯
+	edits *editTracker
+
+	// 論壇群組中訊息所屬的主題
+	threads *threadIndex
+
+	// 生成結果轉存到紀錄頻道，未設定 LOG_CHAT_ID 時為 nil
+	archiver *resultArchiver
+
+	// 進行中的生成，供 /jobs 顯示與取消
+	jobs *jobRegistry
+
+	// 送出的結果訊息，對它們的反應可以評分或重新生成
+	results *resultMessageIndex
 }
 
 func NewBot(cfg *config.Config, db *database.Database) (*Bot, error) {
-	api, err := tgbotapi.NewBotAPI(cfg.BotToken)
+	filter, err := newContentFilter(cfg.ContentFilter)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := gemini.SafetyThreshold(cfg.SafetyLevel); !ok {
+		return nil, fmt.Errorf("無效的 SAFETY_LEVEL：%q（可用 OFF、LOW、MEDIUM、HIGH）", cfg.SafetyLevel)
+	}
+
+	threads := newThreadIndex()
+	httpClient := newForumClient(threads)
+	api, err := tgbotapi.NewBotAPIWithClient(cfg.BotToken, tgbotapi.APIEndpoint, httpClient)
 	if err != nil {
 		return nil, err
 	}
@@ -57,11 +105,27 @@ func NewBot(cfg *config.Config, db *database.Database) (*Bot, error) {
 		mediaGroups: &mediaGroupCache{
 			groups: make(map[string][]cachedImage),
 		},
-	}
+		generationSlots: newSlotQueue(cfg.MaxConcurrentGenerations),
+		crops:           &cropSessions{pending: make(map[string]*pendingCrop)},
+		modelLists:      newModelListCache(),
+		imageCache:      newImageCache(cfg.ImageCacheSize, cfg.ImageCacheBytes),
+		contentFilter:   filter,
+		events:          newEventDispatcher(cfg.EventWebhookURL),
+		edits:           newEditTracker(),
+		threads:         threads,
+		archiver:        newResultArchiver(api, cfg.LogChatID),
+		jobs:            newJobRegistry(),
+		results:         newResultMessageIndex(),
+	}
+	httpClient.reactions = bot.handleReaction
+
+	bot.userQueues = newUserQueues(cfg.UserQueueSize, bot.handleMessage, bot.notifyQueueExpired)
 
 	// 啟動清理過期快取的 goroutine
 	go bot.cleanupMediaGroupCache()
 	go bot.retryFailedGenerations()
+	go bot.runScheduledGenerations()
+	go bot.backupDatabaseDaily()
 
 	return bot, nil
 }
@@ -69,16 +133,10 @@ func NewBot(cfg *config.Config, db *database.Database) (*Bot, error) {
 func (b *Bot) Run() {
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
+	u.AllowedUpdates = allowedUpdates
 
-	updates := b.api.GetUpdatesChan(u)
-
-	for update := range updates {
-		if update.Message != nil {
-			go b.handleMessage(update.Message)
-		} else if update.CallbackQuery != nil {
-			go b.handleCallback(update.CallbackQuery)
-		}
-	}
+	err := pollUpdates(b.api.GetUpdates, u, b.dispatchUpdate, time.Sleep)
+	log.Fatalf("連續 %d 次無法取得更新，結束程序: %v", updatesMaxFailures, redactSecrets(err.Error()))
 }
 
 // cleanupMediaGroupCache 定期清理過期的 Media Group 快取
@@ -127,6 +185,24 @@ func (b *Bot) getMediaGroupImages(mediaGroupID string) []string {
 }
 
 func (b *Bot) handleMessage(msg *tgbotapi.Message) {
+	if msg.From == nil {
+		return
+	}
+	if !b.isAllowed(msg.From.ID, msg.Chat) {
+		// 群組中直接忽略，避免洗版
+		if msg.Chat.IsPrivate() {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "⛔ 未授權"))
+		}
+		return
+	}
+	if b.inMaintenance() && !b.config.IsAdmin(msg.From.ID) {
+		// 群組中只回應指令，避免洗版
+		if msg.Chat.IsPrivate() || msg.IsCommand() {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, maintenanceNotice))
+		}
+		return
+	}
+
 	// 處理指令（斜線指令在群組和私聊都生效）
 	if msg.IsCommand() {
 		b.handleCommand(msg)
@@ -136,12 +212,8 @@ func (b *Bot) handleMessage(msg *tgbotapi.Message) {
 	// 判斷是否在群組中
 	isGroup := msg.Chat.Type == "group" || msg.Chat.Type == "supergroup"
 
-	// 快取 Media Group 中的圖片
-	if len(msg.Photo) > 0 && msg.MediaGroupID != "" {
-		photo := msg.Photo[len(msg.Photo)-1]
-		b.cacheMediaGroupImage(msg.MediaGroupID, photo.FileID)
-		log.Printf("[收到圖片] MediaGroupID=%s, MessageID=%d", msg.MediaGroupID, msg.MessageID)
-	} else if len(msg.Photo) > 0 {
+	// Media Group 中的圖片已在 dispatchMessage 快取，不受使用者佇列影響
+	if len(msg.Photo) > 0 && msg.MediaGroupID == "" {
 		log.Printf("[收到圖片] 單張圖片（無 MediaGroupID）, MessageID=%d", msg.MessageID)
 	}
 
@@ -169,6 +241,16 @@ func (b *Bot) handleMessage(msg *tgbotapi.Message) {
 		return
 	}
 
+	// 處理 PDF 文件（逐頁轉圖後生成）
+	if isPDFDocument(msg.Document) {
+		// 在群組中，caption 必須以 . 開頭才會處理
+		if isGroup && !strings.HasPrefix(msg.Caption, ".") {
+			return
+		}
+		b.handlePDFDocument(msg)
+		return
+	}
+
 	// 處理文字訊息（非指令）
 	if msg.Text != "" {
 		// 在群組中，文字訊息必須以 . 開頭才會處理
@@ -204,62 +286,81 @@ func (b *Bot) handleCommand(msg *tgbotapi.Message) {
 		b.cmdSave(msg)
 	case "list":
 		b.cmdList(msg)
+	case "library":
+		b.cmdLibrary(msg)
 	case "history":
 		b.cmdHistory(msg)
 	case "setdefault":
 		b.cmdSetDefault(msg)
 	case "settings":
 		b.cmdSettings(msg)
+	case "setratio":
+		b.cmdSetRatio(msg)
+	case "setformat":
+		b.cmdSetFormat(msg)
 	case "delete":
 		b.cmdDelete(msg)
 	case "service":
 		b.cmdService(msg)
+	case "ocr":
+		b.cmdOCR(msg)
+	case "tts":
+		b.cmdTTS(msg)
+	case "translate":
+		b.cmdTranslate(msg)
+	case "voice":
+		b.cmdVoice(msg)
+	case "lang":
+		b.cmdLang(msg)
+	case "setprompt":
+		b.cmdSetPrompt(msg)
+	case "chatsettings":
+		b.cmdChatSettings(msg)
+	case "topicsettings":
+		b.cmdTopicSettings(msg)
+	case "deleteme":
+		b.cmdDeleteMe(msg)
+	case "whoami":
+		b.cmdWhoami(msg)
+	case "lasterror":
+		b.cmdLastError(msg)
+	case "schedule":
+		b.cmdSchedule(msg)
+	case "redo":
+		b.cmdRedo(msg)
+	case "allow":
+		b.cmdAllow(msg)
+	case "deny":
+		b.cmdDeny(msg)
+	case "maintenance":
+		b.cmdMaintenance(msg)
+	case "setbaseurl":
+		b.cmdSetBaseURL(msg)
+	case "duplicate":
+		b.cmdDuplicate(msg)
+	case "random":
+		b.cmdRandom(msg)
+	case "models":
+		b.cmdModels(msg)
+	case "compare", "compareservices":
+		b.cmdCompareServices(msg)
+	case "stats", "feedback":
+		b.cmdStats(msg)
+	case "flushqueue":
+		b.cmdFlushQueue(msg)
+	case "queuestats":
+		b.cmdQueueStats(msg)
+	case "purgehistory":
+		b.cmdPurgeHistory(msg)
+	case "diff":
+		b.cmdDiff(msg)
+	case "jobs":
+		b.cmdJobs(msg)
 	}
 }
 
 func (b *Bot) cmdStart(msg *tgbotapi.Message) {
-	text := `�✏️ *TG-Bawer*
-
-用 AI 畫你想要的圖！
-
-*基本用法：*
-• 直接輸入文字 → AI 根據描述生成圖片
-• 回覆圖片/貼圖並輸入文字 → AI 根據圖片進行編輯
-• 回覆文字並傳圖片/貼圖 → 同上，另一種操作方式
-• 上傳多張圖片後回覆其一 → AI 會抓取所有圖片處理
-
-*群組使用：*
-在群組中，文字訊息需以 ` + "`.`" + ` 開頭才會觸發
-例如：` + "`.幫我畫一隻貓 @16:9`" + `
-
-*參數設定（用 @ 符號，前後需有空格）：*
-• ` + "`@1:1`" + ` ` + "`@16:9`" + ` ` + "`@9:16`" + ` → 設定比例
-• ` + "`@4K`" + ` ` + "`@2K`" + ` ` + "`@1K`" + ` → 設定畫質
-• ` + "`@s`" + ` → 回覆群組圖片時只使用單張，不抓整組
-
-*支援的比例：*
-` + "`@1:1`" + ` ` + "`@2:3`" + ` ` + "`@3:2`" + ` ` + "`@3:4`" + ` ` + "`@4:3`" + ` ` + "`@4:5`" + ` ` + "`@5:4`" + ` ` + "`@9:16`" + ` ` + "`@16:9`" + ` ` + "`@21:9`" + `
-
-💡 不指定比例時：
-• 有圖片時，使用最接近原圖的支援比例
-• 沒有圖片時，預設使用 1:1
-
-*範例：*
-` + "`畫一隻可愛的貓咪 @16:9 @4K`" + `
-
-*指令：*
-/save <名稱> <prompt> - 保存 Prompt
-/list - 列出已保存的 Prompt
-/history - 查看使用歷史
-/setdefault - 設定預設 Prompt
-/settings - 設定預設畫質
-/delete - 刪除已保存的 Prompt
-/service - 服務管理（standard/custom/vertex）
-/help - 顯示幫助`
-
-	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
-	reply.ParseMode = "Markdown"
-	b.api.Send(reply)
+	b.sendLongMessage(msg.Chat.ID, msg.MessageID, tr(b.userLang(msg.From), "help"), "Markdown")
 }
 
 func (b *Bot) cmdHelp(msg *tgbotapi.Message) {
@@ -288,20 +389,85 @@ func (b *Bot) cmdSave(msg *tgbotapi.Message) {
 	b.api.Send(reply)
 }
 
+// cmdDuplicate /duplicate <名稱> <新名稱>：複製已保存的 Prompt，方便修改出變化版
+func (b *Bot) cmdDuplicate(msg *tgbotapi.Message) {
+	parts := strings.Fields(msg.CommandArguments())
+	if len(parts) != 2 {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ 格式：/duplicate <名稱> <新名稱>\n例如：/duplicate 學習模式 學習模式2")
+		b.api.Send(reply)
+		return
+	}
+
+	name, newName := parts[0], parts[1]
+	var text string
+	switch err := b.db.DuplicatePrompt(msg.From.ID, name, newName); {
+	case errors.Is(err, sql.ErrNoRows):
+		text = fmt.Sprintf("❌ 找不到 Prompt「%s」", name)
+	case errors.Is(err, database.ErrPromptNameTaken):
+		text = fmt.Sprintf("❌ 已經有名為「%s」的 Prompt", newName)
+	case err != nil:
+		text = "❌ 複製失敗：" + err.Error()
+	default:
+		text = fmt.Sprintf("✅ 已將「%s」複製為「%s」", name, newName)
+	}
+	b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+}
+
 func (b *Bot) cmdList(msg *tgbotapi.Message) {
-	prompts, err := b.db.GetSavedPrompts(msg.From.ID)
+	// /list preview 改為發送各 Prompt 最近一次結果的縮圖
+	if arg := strings.TrimSpace(msg.CommandArguments()); strings.EqualFold(arg, "preview") {
+		b.sendPromptThumbnails(msg)
+		return
+	}
+
+	// /list sort=name|recent|created，選擇會保存下來供之後使用
+	if arg := strings.TrimSpace(msg.CommandArguments()); arg != "" {
+		order, ok := parseListSort(arg)
+		if !ok {
+			reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ 不支援的排序方式\n可用：/list sort=name、/list sort=recent、/list sort=created")
+			b.api.Send(reply)
+			return
+		}
+		if err := b.db.SetUserListSort(msg.From.ID, order); err != nil {
+			log.Printf("Failed to save list sort: %v", err)
+		}
+	}
+
+	text, keyboard, err := b.renderListPage(msg.From.ID, 1)
 	if err != nil {
 		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ 取得失敗："+err.Error())
 		b.api.Send(reply)
 		return
 	}
 
-	if len(prompts) == 0 {
+	if keyboard == nil {
 		reply := tgbotapi.NewMessage(msg.Chat.ID, "📝 尚未保存任何 Prompt\n使用 /save <名稱> <prompt> 來保存")
 		b.api.Send(reply)
 		return
 	}
 
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ParseMode = "Markdown"
+	reply.ReplyMarkup = keyboard
+	b.api.Send(reply)
+}
+
+// renderListPage 產生 /list 指定頁的內容，沒有任何 Prompt 時 keyboard 為 nil
+func (b *Bot) renderListPage(userID int64, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	total, err := b.db.CountSavedPrompts(userID)
+	if err != nil || total == 0 {
+		return "", nil, err
+	}
+
+	totalPages := pageCount(total, itemsPerPage)
+	page = clampPage(page, totalPages)
+
+	order, _ := b.db.GetUserListSort(userID)
+	prompts, err := b.db.GetSavedPromptsPage(userID, order, itemsPerPage, (page-1)*itemsPerPage)
+	if err != nil {
+		return "", nil, err
+	}
+
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, p := range prompts {
 		defaultMark := ""
@@ -314,46 +480,115 @@ func (b *Bot) cmdList(msg *tgbotapi.Message) {
 		)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
 	}
+	if nav := pageNavRow("listpage", page, totalPages); nav != nil {
+		rows = append(rows, nav)
+	}
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
-	reply := tgbotapi.NewMessage(msg.Chat.ID, "📋 *已保存的 Prompt*\n點擊可複製內容：")
-	reply.ParseMode = "Markdown"
-	reply.ReplyMarkup = keyboard
-	b.api.Send(reply)
+	text := "📋 *已保存的 Prompt*" + pageIndicator(page, totalPages) + listSortLabel(order) + "\n點擊可複製內容："
+	return text, &keyboard, nil
+}
+
+// parseListSort 解析 "sort=name" 形式的參數
+func parseListSort(arg string) (string, bool) {
+	value := strings.ToLower(strings.TrimPrefix(arg, "sort="))
+	switch value {
+	case database.PromptSortName, database.PromptSortRecent, database.PromptSortCreated:
+		return value, true
+	}
+	return "", false
+}
+
+func listSortLabel(order string) string {
+	switch order {
+	case database.PromptSortName:
+		return "\n排序：名稱"
+	case database.PromptSortRecent:
+		return "\n排序：最近使用"
+	}
+	return ""
 }
 
 func (b *Bot) cmdHistory(msg *tgbotapi.Message) {
-	history, err := b.db.GetHistory(msg.From.ID, 10)
+	text, keyboard, err := b.renderHistoryPage(msg.From.ID, 1)
 	if err != nil {
 		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ 取得失敗："+err.Error())
 		b.api.Send(reply)
 		return
 	}
 
-	if len(history) == 0 {
+	if keyboard == nil {
 		reply := tgbotapi.NewMessage(msg.Chat.ID, "📜 尚無使用記錄")
 		b.api.Send(reply)
 		return
 	}
 
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ParseMode = "Markdown"
+	reply.ReplyMarkup = keyboard
+	b.api.Send(reply)
+}
+
+// renderHistoryPage 產生 /history 指定頁的內容，沒有任何記錄時 keyboard 為 nil
+func (b *Bot) renderHistoryPage(userID int64, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	total, err := b.db.CountHistory(userID)
+	if err != nil || total == 0 {
+		return "", nil, err
+	}
+
+	totalPages := pageCount(total, itemsPerPage)
+	page = clampPage(page, totalPages)
+	offset := (page - 1) * itemsPerPage
+
+	history, err := b.db.GetHistoryPage(userID, itemsPerPage, offset)
+	if err != nil {
+		return "", nil, err
+	}
+
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for i, h := range history {
-		preview := h.Prompt
-		if len(preview) > 30 {
-			preview = preview[:30] + "..."
-		}
+		preview := truncateRunes(h.Prompt, 30, "...")
 		btn := tgbotapi.NewInlineKeyboardButtonData(
-			fmt.Sprintf("%d. %s", i+1, preview),
+			fmt.Sprintf("%d. %s", offset+i+1, preview),
 			fmt.Sprintf("hist:%d", h.ID),
 		)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
 	}
+	if nav := pageNavRow("histpage", page, totalPages); nav != nil {
+		rows = append(rows, nav)
+	}
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
-	reply := tgbotapi.NewMessage(msg.Chat.ID, "📜 *最近使用的 Prompt*\n點擊可複製：")
-	reply.ParseMode = "Markdown"
-	reply.ReplyMarkup = keyboard
-	b.api.Send(reply)
+	text := "📜 *最近使用的 Prompt*" + pageIndicator(page, totalPages) + "\n點擊可複製："
+	return text, &keyboard, nil
+}
+
+func (b *Bot) callbackListPage(callback *tgbotapi.CallbackQuery, pageStr string) {
+	page, _ := strconv.Atoi(pageStr)
+	text, keyboard, err := b.renderListPage(callback.From.ID, page)
+	b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
+	if err != nil || keyboard == nil {
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
+	edit.ParseMode = "Markdown"
+	edit.ReplyMarkup = keyboard
+	b.api.Send(edit)
+}
+
+func (b *Bot) callbackHistoryPage(callback *tgbotapi.CallbackQuery, pageStr string) {
+	page, _ := strconv.Atoi(pageStr)
+	text, keyboard, err := b.renderHistoryPage(callback.From.ID, page)
+	b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
+	if err != nil || keyboard == nil {
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
+	edit.ParseMode = "Markdown"
+	edit.ReplyMarkup = keyboard
+	b.api.Send(edit)
 }
 
 func (b *Bot) cmdSetDefault(msg *tgbotapi.Message) {
@@ -390,23 +625,78 @@ func (b *Bot) cmdSetDefault(msg *tgbotapi.Message) {
 	b.api.Send(reply)
 }
 
-func (b *Bot) cmdSettings(msg *tgbotapi.Message) {
-	currentQuality, _ := b.db.GetUserSettings(msg.From.ID)
+// resolveDefaultPrompt 在未指定 Prompt 時決定要用的預設：
+// 保存的預設 Prompt > /setprompt 自訂文字 > config.DefaultPrompt
+func (b *Bot) resolveDefaultPrompt(userID int64) string {
+	if defaultPrompt, _ := b.db.GetDefaultPrompt(userID); defaultPrompt != nil {
+		return defaultPrompt.Prompt
+	}
+	if custom, _ := b.db.GetUserDefaultPrompt(userID); strings.TrimSpace(custom) != "" {
+		return custom
+	}
+	return config.DefaultPrompt
+}
+
+// cmdSetPrompt 設定不綁定保存 Prompt 的自訂預設文字
+func (b *Bot) cmdSetPrompt(msg *tgbotapi.Message) {
+	text := strings.TrimSpace(msg.CommandArguments())
+	if text == "" {
+		b.sendUserDefaultPromptEditor(msg.Chat.ID, msg.From.ID)
+		return
+	}
+
+	if err := b.db.SetUserDefaultPrompt(msg.From.ID, text); err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 設定失敗："+err.Error()))
+		return
+	}
+
+	b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 已設定自訂預設 Prompt\n（若有用 /setdefault 選擇保存的 Prompt，會優先使用該 Prompt）"))
+}
+
+func (b *Bot) sendUserDefaultPromptEditor(chatID, userID int64) {
+	custom, _ := b.db.GetUserDefaultPrompt(userID)
+
+	text := "✏️ *自訂預設 Prompt*\n\n"
+	if strings.TrimSpace(custom) == "" {
+		text += "目前未設定，使用系統預設。\n\n"
+	} else {
+		text += "目前內容：\n" + markdownCode(custom) + "\n\n"
+	}
+	text += "用 `/setprompt <內容>` 設定新的預設"
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(qualityButton("1K", currentQuality), "quality:1K"),
-			tgbotapi.NewInlineKeyboardButtonData(qualityButton("2K", currentQuality), "quality:2K"),
-			tgbotapi.NewInlineKeyboardButtonData(qualityButton("4K", currentQuality), "quality:4K"),
+			tgbotapi.NewInlineKeyboardButtonData("📋 查看系統預設", "setprompt:system"),
+			tgbotapi.NewInlineKeyboardButtonData("🗑 清除", "setprompt:clear"),
 		),
 	)
 
-	reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("⚙️ *設定*\n\n目前預設畫質：*%s*\n\n點擊更改：", currentQuality))
+	reply := tgbotapi.NewMessage(chatID, text)
 	reply.ParseMode = "Markdown"
 	reply.ReplyMarkup = keyboard
 	b.api.Send(reply)
 }
 
+func (b *Bot) callbackSetPrompt(callback *tgbotapi.CallbackQuery, action string) {
+	switch action {
+	case "clear":
+		if err := b.db.SetUserDefaultPrompt(callback.From.ID, ""); err != nil {
+			b.api.Request(tgbotapi.NewCallback(callback.ID, "清除失敗"))
+			return
+		}
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "✅ 已清除自訂預設"))
+		b.api.Request(tgbotapi.NewDeleteMessage(callback.Message.Chat.ID, callback.Message.MessageID))
+		b.sendUserDefaultPromptEditor(callback.Message.Chat.ID, callback.From.ID)
+	case "system":
+		reply := tgbotapi.NewMessage(callback.Message.Chat.ID, "📋 *系統預設 Prompt*\n\n`"+config.DefaultPrompt+"`")
+		reply.ParseMode = "Markdown"
+		b.api.Send(reply)
+		b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
+	default:
+		b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
+	}
+}
+
 func qualityButton(q, current string) string {
 	if q == current {
 		return "● " + q
@@ -415,13 +705,26 @@ func qualityButton(q, current string) string {
 }
 
 func (b *Bot) cmdDelete(msg *tgbotapi.Message) {
-	prompts, err := b.db.GetSavedPrompts(msg.From.ID)
+	b.sendDeleteList(msg.Chat.ID, msg.From.ID)
+}
+
+// sendDeleteList 發送可刪除的 Prompt 列表
+func (b *Bot) sendDeleteList(chatID, userID int64) {
+	prompts, err := b.db.GetSavedPrompts(userID)
 	if err != nil || len(prompts) == 0 {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "📝 沒有可刪除的 Prompt")
+		reply := tgbotapi.NewMessage(chatID, "📝 沒有可刪除的 Prompt")
 		b.api.Send(reply)
 		return
 	}
 
+	keyboard := deleteListKeyboard(prompts)
+	reply := tgbotapi.NewMessage(chatID, "🗑 *選擇要刪除的 Prompt*：")
+	reply.ParseMode = "Markdown"
+	reply.ReplyMarkup = keyboard
+	b.api.Send(reply)
+}
+
+func deleteListKeyboard(prompts []database.SavedPrompt) tgbotapi.InlineKeyboardMarkup {
 	var rows [][]tgbotapi.InlineKeyboardButton
 	for _, p := range prompts {
 		btn := tgbotapi.NewInlineKeyboardButtonData(
@@ -430,15 +733,23 @@ func (b *Bot) cmdDelete(msg *tgbotapi.Message) {
 		)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
 	}
-
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
-	reply := tgbotapi.NewMessage(msg.Chat.ID, "🗑 *選擇要刪除的 Prompt*：")
-	reply.ParseMode = "Markdown"
-	reply.ReplyMarkup = keyboard
-	b.api.Send(reply)
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
 }
 
 func (b *Bot) handleCallback(callback *tgbotapi.CallbackQuery) {
+	var chat *tgbotapi.Chat
+	if callback.Message != nil {
+		chat = callback.Message.Chat
+	}
+	if !b.isAllowed(callback.From.ID, chat) {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "⛔ 未授權"))
+		return
+	}
+	if b.inMaintenance() && !b.config.IsAdmin(callback.From.ID) {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, maintenanceNotice))
+		return
+	}
+
 	data := callback.Data
 	parts := strings.SplitN(data, ":", 2)
 	if len(parts) != 2 {
@@ -453,12 +764,46 @@ func (b *Bot) handleCallback(callback *tgbotapi.CallbackQuery) {
 		b.callbackCopy(callback, value)
 	case "hist":
 		b.callbackHistory(callback, value)
+	case "listpage":
+		b.callbackListPage(callback, value)
+	case "histpage":
+		b.callbackHistoryPage(callback, value)
 	case "default":
 		b.callbackDefault(callback, value)
 	case "quality":
 		b.callbackQuality(callback, value)
+	case "ratio":
+		b.callbackRatio(callback, value)
 	case "del":
 		b.callbackDelete(callback, value)
+	case "delconfirm":
+		b.callbackDeleteConfirm(callback, value)
+	case "delcancel":
+		b.callbackDeleteCancel(callback, value)
+	case "undodel":
+		b.callbackUndoDelete(callback, value)
+	case "voice":
+		b.callbackVoice(callback, value)
+	case "lang":
+		b.callbackLang(callback, value)
+	case "setprompt":
+		b.callbackSetPrompt(callback, value)
+	case "fork":
+		b.callbackFork(callback, value)
+	case "chatset":
+		b.callbackChatSettings(callback, value)
+	case "deleteme":
+		b.callbackDeleteMe(callback, value)
+	case "crop":
+		b.callbackCrop(callback, value)
+	case "rate":
+		b.callbackRate(callback, value)
+	case "requality":
+		b.callbackRequality(callback, value)
+	case "job":
+		b.callbackCancelJob(callback, value)
+	case "settings":
+		b.callbackSettings(callback, value)
 	}
 }
 
@@ -470,7 +815,7 @@ func (b *Bot) callbackCopy(callback *tgbotapi.CallbackQuery, idStr string) {
 	for _, p := range prompts {
 		if p.ID == id {
 			// 發送 Prompt 內容讓使用者複製
-			reply := tgbotapi.NewMessage(callback.Message.Chat.ID, fmt.Sprintf("📋 *%s*\n\n`%s`", p.Name, p.Prompt))
+			reply := tgbotapi.NewMessage(callback.Message.Chat.ID, "📋 "+markdownBold(p.Name)+"\n\n"+markdownCode(p.Prompt))
 			reply.ParseMode = "Markdown"
 			b.api.Send(reply)
 			break
@@ -487,7 +832,7 @@ func (b *Bot) callbackHistory(callback *tgbotapi.CallbackQuery, idStr string) {
 	history, _ := b.db.GetHistory(callback.From.ID, 100)
 	for _, h := range history {
 		if h.ID == id {
-			reply := tgbotapi.NewMessage(callback.Message.Chat.ID, fmt.Sprintf("📜 *歷史 Prompt*\n\n`%s`", h.Prompt))
+			reply := tgbotapi.NewMessage(callback.Message.Chat.ID, "📜 *歷史 Prompt*\n\n"+markdownCode(h.Prompt))
 			reply.ParseMode = "Markdown"
 			b.api.Send(reply)
 			break
@@ -512,34 +857,46 @@ func (b *Bot) callbackDefault(callback *tgbotapi.CallbackQuery, idStr string) {
 	b.cmdSetDefault(callback.Message)
 }
 
+// callbackQuality 舊版 /settings 訊息上的畫質按鈕，改由 settings 選單的畫質區塊處理
 func (b *Bot) callbackQuality(callback *tgbotapi.CallbackQuery, quality string) {
-	if err := b.db.SetUserSettings(callback.From.ID, quality); err != nil {
-		b.api.Request(tgbotapi.NewCallback(callback.ID, "設定失敗"))
+	b.callbackSettings(callback, settingsQuality+":"+quality)
+}
+
+// callbackDelete 點選要刪除的 Prompt 後，先顯示確認按鈕
+func (b *Bot) callbackDelete(callback *tgbotapi.CallbackQuery, idStr string) {
+	var id int64
+	fmt.Sscanf(idStr, "%d", &id)
+
+	prompt := b.findSavedPrompt(callback.From.ID, id)
+	if prompt == nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "找不到該 Prompt"))
 		return
 	}
 
-	b.api.Request(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("✅ 預設畫質已設為 %s", quality)))
+	b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
 
-	// 更新訊息
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(qualityButton("1K", quality), "quality:1K"),
-			tgbotapi.NewInlineKeyboardButtonData(qualityButton("2K", quality), "quality:2K"),
-			tgbotapi.NewInlineKeyboardButtonData(qualityButton("4K", quality), "quality:4K"),
+			tgbotapi.NewInlineKeyboardButtonData("✅ 確定刪除", fmt.Sprintf("delconfirm:%d", id)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ 取消", fmt.Sprintf("delcancel:%d", id)),
 		),
 	)
-
 	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID,
-		fmt.Sprintf("⚙️ *設定*\n\n目前預設畫質：*%s*\n\n點擊更改：", quality))
-	edit.ParseMode = "Markdown"
+		fmt.Sprintf("確定刪除「%s」？", prompt.Name))
 	edit.ReplyMarkup = &keyboard
 	b.api.Send(edit)
 }
 
-func (b *Bot) callbackDelete(callback *tgbotapi.CallbackQuery, idStr string) {
+// callbackDeleteConfirm 確認後才真正刪除，並重新顯示列表
+func (b *Bot) callbackDeleteConfirm(callback *tgbotapi.CallbackQuery, idStr string) {
 	var id int64
 	fmt.Sscanf(idStr, "%d", &id)
 
+	name := ""
+	if prompt := b.findSavedPrompt(callback.From.ID, id); prompt != nil {
+		name = prompt.Name
+	}
+
 	if err := b.db.DeletePrompt(callback.From.ID, id); err != nil {
 		b.api.Request(tgbotapi.NewCallback(callback.ID, "刪除失敗"))
 		return
@@ -547,8 +904,62 @@ func (b *Bot) callbackDelete(callback *tgbotapi.CallbackQuery, idStr string) {
 
 	b.api.Request(tgbotapi.NewCallback(callback.ID, "✅ 已刪除"))
 
+	// 提供復原按鈕（軟刪除 24 小時內可復原）
+	undo := tgbotapi.NewMessage(callback.Message.Chat.ID, fmt.Sprintf("🗑 已刪除「%s」", name))
+	undo.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↩️ 復原", fmt.Sprintf("undodel:%d", id)),
+		),
+	)
+	b.api.Send(undo)
+
 	// 重新顯示列表
-	b.cmdDelete(callback.Message)
+	b.refreshDeleteList(callback)
+}
+
+// callbackDeleteCancel 取消刪除，回到列表
+func (b *Bot) callbackDeleteCancel(callback *tgbotapi.CallbackQuery, _ string) {
+	b.api.Request(tgbotapi.NewCallback(callback.ID, "已取消"))
+	b.refreshDeleteList(callback)
+}
+
+// refreshDeleteList 將原訊息改回最新的刪除列表
+func (b *Bot) refreshDeleteList(callback *tgbotapi.CallbackQuery) {
+	prompts, err := b.db.GetSavedPrompts(callback.From.ID)
+	if err != nil || len(prompts) == 0 {
+		b.updateMessage(*callback.Message, "📝 沒有可刪除的 Prompt")
+		return
+	}
+
+	keyboard := deleteListKeyboard(prompts)
+	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, "🗑 *選擇要刪除的 Prompt*：")
+	edit.ParseMode = "Markdown"
+	edit.ReplyMarkup = &keyboard
+	b.api.Send(edit)
+}
+
+// findSavedPrompt 在使用者的保存 Prompt 中找指定 ID
+func (b *Bot) findSavedPrompt(userID, promptID int64) *database.SavedPrompt {
+	prompts, _ := b.db.GetSavedPrompts(userID)
+	for _, p := range prompts {
+		if p.ID == promptID {
+			return &p
+		}
+	}
+	return nil
+}
+
+func (b *Bot) callbackUndoDelete(callback *tgbotapi.CallbackQuery, idStr string) {
+	var id int64
+	fmt.Sscanf(idStr, "%d", &id)
+
+	if err := b.db.UndoDeletePrompt(callback.From.ID, id); err != nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "無法復原（可能已超過保留時間）"))
+		return
+	}
+
+	b.api.Request(tgbotapi.NewCallback(callback.ID, "✅ 已復原"))
+	b.updateMessage(*callback.Message, "↩️ 已復原 Prompt，可用 /list 查看")
 }
 
 // 支援的比例列表
@@ -568,11 +979,32 @@ var supportedQualities = map[string]string{
 // ParsedParams 解析後的參數
 type ParsedParams struct {
 	Prompt               string
-	AspectRatio          string // 如果沒指定則為空
-	Quality              string // 如果沒指定則為空
-	SingleImageFromGroup bool   // @s：回覆群組圖時只取單張
-	RatioError           string // 比例錯誤訊息
-	QualityError         string // 畫質錯誤訊息
+	AspectRatio          string   // 如果沒指定則為空
+	Quality              string   // 如果沒指定則為空
+	SingleImageFromGroup bool     // @s：回覆群組圖時只取單張
+	WithVoice            bool     // @voice：另外擷取文字並生成語音
+	Upscale              bool     // @upscale：改用放大 Prompt 並固定 4K
+	Compare              bool     // @compare：另外發送原圖與結果的對照圖
+	Enhance              bool     // @enhance：先用文字模型擴寫 Prompt 再生成
+	Crop                 bool     // @crop：先選擇 3x3 區域再只對該區域生成
+	PageSelection        []int    // @pages=1-3 或 @pages=1,4,5：只處理群組圖中的指定頁（1 起算）
+	PageSpec             string   // @pages= 的原始值，用於錯誤訊息
+	Variants             int      // @variants=N：一次要求 N 張候選圖片，0 代表未指定
+	Temperature          *float64 // @temp=0.7：生成溫度（0–2），nil 代表沿用模型預設
+	Seed                 *int64   // @seed=42：固定種子以重現結果
+	Debug                bool     // @debug：管理員限定，回覆這次的請求與回應內容
+	Model                string   // @model=名稱：這次改用的圖片模型，空字串代表沿用服務設定
+	Format               string   // @format=jpeg：輸出格式（png / jpeg），空字串代表沿用使用者設定
+	JPEGQuality          int      // @jpegq=85：轉成 JPEG 時的品質（1–100），0 代表沿用使用者設定
+	RatioError           string   // 比例錯誤訊息
+	QualityError         string   // 畫質錯誤訊息
+	PagesError           string   // 頁數格式錯誤訊息
+	VariantsError        string   // 候選數格式錯誤訊息
+	TemperatureError     string   // 溫度格式或範圍錯誤訊息
+	SeedError            string   // 種子格式錯誤訊息
+	ModelError           string   // 模型名稱格式錯誤訊息
+	FormatError          string   // 輸出格式錯誤訊息
+	JPEGQualityError     string   // JPEG 品質格式或範圍錯誤訊息
 }
 
 // parseTextParams 解析文字中的 @ 參數
@@ -594,62 +1026,201 @@ func parseTextParams(text string) *ParsedParams {
 				continue
 			}
 
-			// 檢查是否為畫質
-			if q, ok := supportedQualities[value]; ok {
-				params.Quality = q
+			// 語音模式：擷取文字並朗讀
+			if lowerValue == "voice" || lowerValue == "v" {
+				params.WithVoice = true
 				continue
 			}
 
-			// 檢查是否為比例
-			if supportedRatios[value] {
-				params.AspectRatio = value
+			// 放大模式
+			if lowerValue == "upscale" {
+				params.Upscale = true
 				continue
 			}
 
-			// 檢查是否為無效的畫質格式 (數字+K)
-			upperValue := strings.ToUpper(value)
-			if strings.HasSuffix(upperValue, "K") && len(value) > 1 {
-				params.QualityError = value
+			// 對照模式
+			if lowerValue == "compare" {
+				params.Compare = true
 				continue
 			}
 
-			// 檢查是否為無效的比例格式 (包含冒號)
-			if strings.Contains(value, ":") {
-				params.RatioError = value
+			// Prompt 擴寫模式
+			if lowerValue == "enhance" {
+				params.Enhance = true
 				continue
 			}
 
-			// 其他情況視為 prompt 的一部分
-			promptParts = append(promptParts, part)
-		} else {
-			promptParts = append(promptParts, part)
-		}
-	}
+			// 除錯模式（是否生效由呼叫端依管理員身分決定）
+			if lowerValue == "debug" {
+				params.Debug = true
+				continue
+			}
 
-	params.Prompt = strings.Join(promptParts, " ")
-	return params
-}
+			// 裁切模式
+			if lowerValue == "crop" {
+				params.Crop = true
+				continue
+			}
 
-// truncateError 截斷錯誤訊息並折疊顯示
-func truncateError(err string) string {
-	const maxLen = 200
-	if len(err) > maxLen {
-		return err[:maxLen] + "...\n(錯誤訊息過長已截斷)"
-	}
-	return err
-}
+			// 頁數選擇
+			if strings.HasPrefix(lowerValue, "pages=") {
+				spec := value[len("pages="):]
+				pages, err := parsePageSelection(spec)
+				if err != nil {
+					params.PagesError = value
+				} else {
+					params.PageSelection = pages
+					params.PageSpec = spec
+				}
+				continue
+			}
 
-func (b *Bot) handleTextMessage(msg *tgbotapi.Message) {
-	// 取得文字內容
-	text := msg.Text
-	if text == "" {
-		text = msg.Caption
-	}
+			// 候選圖片數
+			if strings.HasPrefix(lowerValue, "variants=") {
+				n, err := strconv.Atoi(value[len("variants="):])
+				if err != nil || n < 1 {
+					params.VariantsError = value
+				} else {
+					params.Variants = n
+				}
+				continue
+			}
 
-	// 判斷是否在群組中，如果是則移除開頭的 .
-	isGroup := msg.Chat.Type == "group" || msg.Chat.Type == "supergroup"
-	if isGroup && strings.HasPrefix(text, ".") {
-		text = strings.TrimPrefix(text, ".")
+			// 生成溫度
+			if strings.HasPrefix(lowerValue, "temp=") {
+				t, err := strconv.ParseFloat(value[len("temp="):], 64)
+				// NaN 能通過範圍比較，需另外排除，否則之後 json.Marshal 會失敗
+				if err != nil || math.IsNaN(t) || math.IsInf(t, 0) || t < minTemperature || t > maxTemperature {
+					params.TemperatureError = value
+				} else {
+					params.Temperature = &t
+				}
+				continue
+			}
+
+			// 固定種子
+			if strings.HasPrefix(lowerValue, "seed=") {
+				seed, err := strconv.ParseInt(value[len("seed="):], 10, 32)
+				if err != nil {
+					params.SeedError = value
+				} else {
+					params.Seed = &seed
+				}
+				continue
+			}
+
+			// 指定模型
+			if strings.HasPrefix(lowerValue, "model=") {
+				model := strings.TrimPrefix(value[len("model="):], "models/")
+				if !modelNamePattern.MatchString(model) {
+					params.ModelError = value
+				} else {
+					params.Model = model
+				}
+				continue
+			}
+
+			// JPEG 品質
+			if strings.HasPrefix(lowerValue, "jpegq=") {
+				q, err := strconv.Atoi(value[len("jpegq="):])
+				if err != nil || q < minJPEGQuality || q > maxJPEGQuality {
+					params.JPEGQualityError = value
+				} else {
+					params.JPEGQuality = q
+				}
+				continue
+			}
+
+			// 輸出格式
+			if strings.HasPrefix(lowerValue, "format=") {
+				if format, ok := normalizeOutputFormat(value[len("format="):]); ok {
+					params.Format = format
+				} else {
+					params.FormatError = value
+				}
+				continue
+			}
+
+			// 檢查是否為畫質
+			if q, ok := supportedQualities[value]; ok {
+				params.Quality = q
+				continue
+			}
+
+			// 檢查是否為比例
+			if supportedRatios[value] {
+				params.AspectRatio = value
+				continue
+			}
+
+			// 檢查是否為無效的畫質格式 (數字+K)
+			upperValue := strings.ToUpper(value)
+			if strings.HasSuffix(upperValue, "K") && len(value) > 1 {
+				params.QualityError = value
+				continue
+			}
+
+			// 檢查是否為無效的比例格式 (包含冒號)
+			if strings.Contains(value, ":") {
+				params.RatioError = value
+				continue
+			}
+
+			// 其他情況視為 prompt 的一部分
+			promptParts = append(promptParts, part)
+		} else {
+			promptParts = append(promptParts, part)
+		}
+	}
+
+	params.Prompt = strings.Join(promptParts, " ")
+	return params
+}
+
+// resultCaption 將 Gemini 附帶的文字說明作為圖片 caption（Telegram 上限 1024 字）
+// 由備援模型產生時在最前面註明實際使用的模型
+func resultCaption(lang string, result *gemini.ImageResult) string {
+	if result == nil {
+		return ""
+	}
+	const maxLen = 1024
+	caption := strings.TrimSpace(result.Text)
+	if result.Fallback && result.Model != "" {
+		caption = strings.TrimSpace(tr(lang, "result.model_fallback", result.Model) + "\n" + caption)
+	}
+	text := []rune(caption)
+	if len(text) > maxLen {
+		return string(text[:maxLen-3]) + "..."
+	}
+	return string(text)
+}
+
+// truncateError 遮蔽金鑰後截斷錯誤訊息並折疊顯示
+func truncateError(err string) string {
+	const maxLen = 200
+	return truncateRunes(redactSecrets(err), maxLen, "...\n(錯誤訊息過長已截斷)")
+}
+
+// truncateRunes 以字元（rune）為單位截斷，避免切斷多位元組字元；有截斷時加上 suffix
+func truncateRunes(s string, limit int, suffix string) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + suffix
+}
+
+func (b *Bot) handleTextMessage(msg *tgbotapi.Message) {
+	// 取得文字內容
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+
+	// 判斷是否在群組中，如果是則移除開頭的 .
+	isGroup := msg.Chat.Type == "group" || msg.Chat.Type == "supergroup"
+	if isGroup && strings.HasPrefix(text, ".") {
+		text = strings.TrimPrefix(text, ".")
 		text = strings.TrimSpace(text) // 移除前導空白
 	}
 
@@ -660,24 +1231,13 @@ func (b *Bot) handleTextMessage(msg *tgbotapi.Message) {
 
 	// 解析參數
 	params := parseTextParams(text)
+	lang := b.userLang(msg.From)
 
 	// 檢查參數錯誤
-	if params.RatioError != "" || params.QualityError != "" {
-		errorText := "❌ *參數錯誤*\n\n"
-
-		if params.RatioError != "" {
-			errorText += fmt.Sprintf("無效的比例：`%s`\n", params.RatioError)
-			errorText += "支援的比例：`@1:1` `@2:3` `@3:2` `@3:4` `@4:3` `@4:5` `@5:4` `@9:16` `@16:9` `@21:9`\n\n"
-		}
-
-		if params.QualityError != "" {
-			errorText += fmt.Sprintf("無效的畫質：`%s`\n", params.QualityError)
-			errorText += "支援的畫質：`@1K` `@2K` `@4K`\n\n"
-		}
-
-		errorText += "*正確範例：*\n`翻譯這張漫畫 @16:9 @4K`"
-
-		reply := tgbotapi.NewMessage(msg.Chat.ID, errorText)
+	if params.RatioError != "" || params.QualityError != "" || params.PagesError != "" ||
+		params.VariantsError != "" || params.TemperatureError != "" || params.SeedError != "" ||
+		params.ModelError != "" || params.FormatError != "" || params.JPEGQualityError != "" {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, paramErrorText(lang, params))
 		reply.ParseMode = "Markdown"
 		reply.ReplyToMessageID = msg.MessageID
 		b.api.Send(reply)
@@ -686,12 +1246,12 @@ func (b *Bot) handleTextMessage(msg *tgbotapi.Message) {
 
 	serviceConfig, serviceName, err := b.resolveServiceConfig(msg.From.ID)
 	if err != nil {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n請先用 /service add 新增服務")
+		reply := tgbotapi.NewMessage(msg.Chat.ID, tr(lang, "error.no_service", err.Error()))
 		reply.ReplyToMessageID = msg.MessageID
 		b.api.Send(reply)
 		return
 	}
-	gClient := gemini.NewClientWithService(serviceConfig)
+	gClient := b.newGeminiClient(serviceConfig)
 
 	// 收集圖片
 	var images []imageData
@@ -723,7 +1283,12 @@ func (b *Bot) handleTextMessage(msg *tgbotapi.Message) {
 					groupImages := b.getMediaGroupImages(replyMsg.MediaGroupID)
 					log.Printf("[回覆圖片] 從快取取得 %d 張圖片", len(groupImages))
 					if len(groupImages) > 0 {
-						for _, fileID := range groupImages {
+						selected, pageErr := selectPages(groupImages, params.PageSelection)
+						if pageErr != nil {
+							b.sendReplyMessage(msg, pagesErrorText(params.PageSpec, pageErr))
+							return
+						}
+						for _, fileID := range selected {
 							images = append(images, imageData{FileID: fileID})
 						}
 					} else {
@@ -758,50 +1323,100 @@ func (b *Bot) handleTextMessage(msg *tgbotapi.Message) {
 				images = append(images, imageData{FileID: replyMsg.Document.FileID})
 			}
 		}
+
+		// 回覆的訊息是動畫或圓形影片，下載後取第一格畫面
+		if source, ok := videoFrameSource(replyMsg); ok {
+			images = append(images, source)
+		}
+	}
+
+	// 同一張圖可能從不同來源重複收集到
+	images = dedupeImages(images)
+
+	if params.Upscale && len(images) == 0 {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ `@upscale` 需要附上或回覆一張圖片")
+		reply.ParseMode = "Markdown"
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
+	if params.Crop && len(images) != 1 {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ `@crop` 需要附上或回覆一張圖片")
+		reply.ParseMode = "Markdown"
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
+	if errText := compareValidationError(params, len(images)); errText != "" {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, errText)
+		reply.ParseMode = "Markdown"
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
 	}
 
 	// 取得預設設定
 	quality := params.Quality
-	if quality == "" {
-		quality, _ = b.db.GetUserSettings(msg.From.ID)
-		if quality == "" {
-			quality = "2K"
-		}
+	if params.Upscale {
+		// 放大模式固定使用 4K
+		quality = "4K"
+	} else if quality == "" {
+		quality = b.resolveDefaultQuality(msg)
 	}
 
 	aspectRatio := params.AspectRatio
 
 	// 決定使用的 Prompt
 	prompt := params.Prompt
-	if prompt == "" {
-		// 檢查是否有使用者設定的預設
-		defaultPrompt, _ := b.db.GetDefaultPrompt(msg.From.ID)
-		if defaultPrompt != nil {
-			prompt = defaultPrompt.Prompt
-		} else {
-			prompt = config.DefaultPrompt
-		}
-	} else {
-		// 記錄到歷史
+	if params.Upscale {
+		prompt = config.UpscalePrompt
+	} else if prompt == "" {
+		// 依序使用：保存的預設 Prompt > 自訂預設文字 > 系統預設
+		prompt = b.resolveMessageDefaultPrompt(msg)
+	}
+
+	if b.rejectBlockedPrompt(msg, prompt, quality) {
+		return
+	}
+	if !params.Upscale && params.Prompt != "" {
+		// 通過內容過濾後才記錄到歷史
 		b.db.AddToHistory(msg.From.ID, prompt)
 	}
 
+	if params.Enhance && !params.Upscale && params.Prompt != "" {
+		prompt = b.enhancePrompt(msg, gClient, lang, prompt)
+		if b.rejectBlockedPrompt(msg, prompt, quality) {
+			return
+		}
+	}
+
+	// 裁切模式：先讓使用者選區域，之後在 callbackCrop 生成
+	if params.Crop {
+		b.startCropSelection(msg, images[0].FileID, prompt, quality, aspectRatio, b.generationOptions(params, msg.From.ID))
+		return
+	}
+
 	// 顯示參數資訊
 	ratioDisplay := "Auto"
 	if aspectRatio != "" {
 		ratioDisplay = aspectRatio
 	} else if len(images) == 0 {
-		ratioDisplay = defaultAspectRatio + " (預設)"
+		ratioDisplay = ratioDisplayText(lang, "", resolveAspectRatio("", b.userDefaultRatio(msg.From.ID), nil, 0), "", 0)
 	}
 
 	qualityDisplay := quality
-	if params.Quality == "" {
-		qualityDisplay = quality + " (預設)"
+	if params.Quality == "" && !params.Upscale {
+		qualityDisplay = quality + tr(lang, "label.default")
 	}
 
 	// 發送處理中訊息（回覆使用者的訊息）
-	statusText := fmt.Sprintf("⏳ *處理中...*\n\n🔌 服務：`%s`\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 圖片數量：%d",
-		serviceName, ratioDisplay, qualityDisplay, len(images))
+	statusText := tr(lang, "status.processing",
+		markdownCode(serviceName), ratioDisplay, qualityDisplay, len(images))
+	if params.Upscale {
+		statusText += tr(lang, "status.upscale")
+	}
 
 	processingMsg, err := b.sendReplyMessage(msg, statusText)
 	if err != nil {
@@ -811,98 +1426,148 @@ func (b *Bot) handleTextMessage(msg *tgbotapi.Message) {
 	// 下載所有圖片
 	var downloadedImages []gemini.DownloadedImage
 	for i, img := range images {
-		b.updateMessageMarkdown(processingMsg, fmt.Sprintf("⏳ *處理中...*\n\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 下載圖片 %d/%d...",
+		b.updateMessageMarkdown(processingMsg, tr(lang, "status.downloading",
 			ratioDisplay, qualityDisplay, i+1, len(images)))
 
-		fileConfig := tgbotapi.FileConfig{FileID: img.FileID}
-		file, err := b.api.GetFile(fileConfig)
-		if err != nil {
-			b.updateMessageHTML(processingMsg, fmt.Sprintf("❌ <b>處理失敗</b>\n\n無法取得圖片 %d\n\n<blockquote expandable>%s</blockquote>",
-				i+1, truncateError(err.Error())))
-			return
-		}
-
-		data, mimeType, err := b.downloadFile(file.FilePath)
+		downloaded, err := b.downloadCachedImage(img.FileID, img.FrameMimeType)
 		if err != nil {
-			b.updateMessageHTML(processingMsg, fmt.Sprintf("❌ <b>處理失敗</b>\n\n下載圖片 %d 失敗\n\n<blockquote expandable>%s</blockquote>",
-				i+1, truncateError(err.Error())))
+			b.updateMessageHTML(processingMsg, withErrorHint(lang,
+				downloadErrorText(lang, err, i+1, "error.get_image", "error.download_image"), err))
 			return
 		}
-
-		downloadedImages = append(downloadedImages, gemini.DownloadedImage{
-			Data:     data,
-			MimeType: mimeType,
-		})
+		downloadedImages = append(downloadedImages, downloaded)
 	}
 
 	// 比例規則：
 	// 1. 使用者有指定 -> 使用指定值
-	// 2. 有圖片但未指定 -> 使用最接近圖片比例的支援比例
-	// 3. 沒圖片且未指定 -> 預設 1:1
-	aspectRatio = resolveAspectRatio(params.AspectRatio, downloadedImages)
-	ratioDisplay = ratioDisplayText(params.AspectRatio, aspectRatio, len(downloadedImages))
-
-	b.updateMessageMarkdown(processingMsg, fmt.Sprintf("⏳ *生成圖片中...*\n\n🔌 服務：`%s`\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 圖片數量：%d",
-		serviceName, ratioDisplay, qualityDisplay, len(images)))
-
-	// 重試邏輯：固定同畫質重試 6 次
-	var result *gemini.ImageResult
-	qualities := buildRetryQualities(quality)
+	// 2. 有圖片但未指定 -> 使用最接近圖片比例的支援比例（差距過大時交給模型）
+	// 3. 沒圖片且未指定 -> 使用者預設比例，未設定時 1:1
+	aspectRatio = resolveAspectRatio(params.AspectRatio, b.userDefaultRatio(msg.From.ID), downloadedImages, b.ratioTolerance())
+	detectedRatio := detectRawRatio(downloadedImages)
+	ratioDisplay = ratioDisplayText(lang, params.AspectRatio, aspectRatio, detectedRatio, len(downloadedImages))
+	ratioNote := ratioNoteText(lang, params.AspectRatio, aspectRatio, detectedRatio)
+
+	b.updateMessageMarkdown(processingMsg, tr(lang, "status.generating",
+		markdownCode(serviceName), ratioDisplay, qualityDisplay, len(images)))
+
+	// 記下這次請求，供 /redo 與結果下方的畫質按鈕重新生成
+	generationPayload := failedGenerationPayload{
+		Prompt:         prompt,
+		Quality:        quality,
+		AspectRatio:    aspectRatio,
+		ImageFileIDs:   imageFileIDs(images),
+		FrameMimeTypes: imageFrameMimeTypes(images),
+	}
+	b.rememberLastGeneration(msg.From.ID, generationPayload)
+
+	// 重試邏輯：共 6 次，只有資源不足類的錯誤才降畫質
+	var results []*gemini.ImageResult
+	qualities := []string{quality}
+	genOpts := b.generationOptions(params, msg.From.ID)
+
+	// 相同圖片、Prompt 與參數近期生成過時直接回傳快取結果，不再呼叫 API
+	cacheKey := ""
+	if b.resultCacheable(params, genOpts) {
+		cacheKey = resultCacheKey(gClient.WrapPrompt(prompt), gClient.SystemInstruction(), quality, aspectRatio, gemini.ResolveImageModel(genOpts.Model, serviceConfig.Model), downloadedImages)
+		if cached := b.cachedResult(cacheKey); cached != nil {
+			b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
+			addResultNote([]*gemini.ImageResult{cached}, b.applyOutputFormat(lang, []*gemini.ImageResult{cached}, params, msg.From.ID))
+			addResultNote([]*gemini.ImageResult{cached}, ratioNote)
+			b.sendCachedResult(msg, msg.MessageID, prompt, quality, generationPayload, cached)
+			return
+		}
+	}
 
-	ctx := context.Background()
+	ctx, finishJob := b.startJob(msg, prompt, quality, aspectRatio)
+	defer finishJob()
 	var lastErr error
 
-	for i, q := range qualities {
-		b.updateMessageMarkdown(processingMsg, fmt.Sprintf("⏳ *生成圖片中...* (嘗試 %d/6，畫質 %s)\n\n🔌 服務：`%s`\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 圖片數量：%d",
-			i+1, q, serviceName, ratioDisplay, qualityDisplay, len(images)))
+	// 取得全域生成名額，避免同時送出太多請求給 Gemini；需要排隊時先回報順位
+	releaseSlot := b.acquireGenerationSlotWithStatus(processingMsg, lang)
+	stopChatAction := b.startChatAction(msg.Chat.ID)
+	startedAt := time.Now()
+
+	for i := 0; i < len(qualities); i++ {
+		q := qualities[i]
+		b.updateMessageMarkdown(processingMsg, tr(lang, "status.attempt",
+			i+1, q, markdownCode(serviceName), ratioDisplay, qualityDisplay, len(images)))
 
 		if len(downloadedImages) > 0 {
 			// 有圖片的情況
-			result, lastErr = gClient.GenerateImageWithContext(ctx, downloadedImages, prompt, q, aspectRatio)
+			results, lastErr = gClient.GenerateImageWithContext(ctx, downloadedImages, prompt, q, aspectRatio, genOpts)
 		} else {
 			// 純文字生成
-			result, lastErr = gClient.GenerateImageFromText(ctx, prompt, q, aspectRatio)
+			results, lastErr = gClient.GenerateImageFromText(ctx, prompt, q, aspectRatio, genOpts)
 		}
 
 		if lastErr == nil {
+			// 降畫質的結果不寫入快取，避免之後同畫質的請求拿到較低畫質
+			if q == quality {
+				b.storeCachedResult(cacheKey, results[0])
+			}
 			break
 		}
 
 		log.Printf("Attempt %d failed: %v", i+1, lastErr)
+		if ctx.Err() != nil {
+			// 使用者從 /jobs 取消
+			break
+		}
+		if i == 0 {
+			// 依第一次失敗的錯誤類型決定後續是否降畫質
+			qualities = append(qualities, planRetries(quality, lastErr)...)
+		}
 		time.Sleep(time.Second * 2)
 	}
+	releaseSlot()
+	stopChatAction()
+	if lastErr != nil && ctx.Err() != nil {
+		b.updateMessage(processingMsg, "🛑 已取消這次生成")
+		return
+	}
+	logID := b.recordGeneration(msg.From.ID, msg.Chat.ID, prompt, quality, startedAt, lastErr)
+	b.storeGenerationPayload(logID, generationPayload)
+	b.sendDebugDump(msg.Chat.ID, msg.MessageID, genOpts.Debug)
 
+	if gemini.IsSafetyBlocked(lastErr) {
+		b.updateMessageHTML(processingMsg, safetyBlockedText(lang, lastErr))
+		return
+	}
 	if lastErr != nil {
-		var imageFileIDs []string
-		for _, img := range images {
-			imageFileIDs = append(imageFileIDs, img.FileID)
-		}
 		b.enqueueFailedGeneration(msg, msg.MessageID, failedGenerationPayload{
-			Prompt:       prompt,
-			Quality:      quality,
-			AspectRatio:  aspectRatio,
-			ImageFileIDs: imageFileIDs,
-			Service:      serviceConfig,
+			Prompt:         prompt,
+			Quality:        quality,
+			AspectRatio:    aspectRatio,
+			ImageFileIDs:   imageFileIDs(images),
+			FrameMimeTypes: imageFrameMimeTypes(images),
+			Service:        serviceConfig,
 		}, lastErr)
 
-		b.updateMessageHTML(processingMsg, fmt.Sprintf("❌ <b>處理失敗</b>（已重試 6 次）\n已加入失敗重試佇列，系統每 15 分鐘會隨機挑一筆再試一次。\n\n<blockquote expandable>%s</blockquote>",
-			truncateError(lastErr.Error())))
+		b.updateMessageHTML(processingMsg, withErrorHint(lang, tr(lang, "error.generation",
+			truncateError(lastErr.Error())), lastErr))
 		return
 	}
 
+	removePlaceholder := b.sendPlaceholder(msg.Chat.ID, msg.MessageID, results[0])
+
+	// 需要語音時，從第一張原圖擷取文字並生成語音
+	var voiceAudio []byte
+	if params.WithVoice && len(downloadedImages) > 0 {
+		voiceAudio = b.generateVoiceForImage(ctx, gClient, processingMsg, downloadedImages[0], msg.From.ID)
+	}
+
 	// 刪除處理中訊息
 	b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
 
-	// 發送預覽圖（會被 Telegram 壓縮，方便快速查看）
-	photoMsg := tgbotapi.NewPhoto(msg.Chat.ID, tgbotapi.FileBytes{Name: "preview.png", Bytes: result.ImageData})
-	photoMsg.ReplyToMessageID = msg.MessageID
-	b.api.Send(photoMsg)
-
-	// 發送原檔案（不壓縮，完整畫質）
-	docMsg := tgbotapi.NewDocument(msg.Chat.ID, tgbotapi.FileBytes{Name: fmt.Sprintf("generated_%s.png", quality), Bytes: result.ImageData})
-	docMsg.ReplyToMessageID = msg.MessageID
-	docMsg.Caption = "📎 原畫質檔案"
-	b.api.Send(docMsg)
+	go b.savePromptThumbnail(msg.From.ID, prompt, results[0].ImageData)
+	b.archiveResults(msg.From.ID, prompt, quality, results...)
+	addResultNote(results, b.applyOutputFormat(lang, results, params, msg.From.ID))
+	addResultNote(results, ratioNote)
+	b.sendGeneratedResults(lang, msg.Chat.ID, msg.MessageID, quality, results, voiceAudio, logID)
+	removePlaceholder()
+	if params.Compare {
+		b.sendComparison(msg.Chat.ID, msg.MessageID, downloadedImages[0].Data, results[0].ImageData)
+	}
 }
 
 // handleImageReplyText 處理用圖片回覆文字訊息的情況
@@ -917,24 +1582,13 @@ func (b *Bot) handleImageReplyText(msg *tgbotapi.Message) {
 
 	// 解析參數（從被回覆的文字中）
 	params := parseTextParams(replyText)
+	lang := b.userLang(msg.From)
 
 	// 檢查參數錯誤
-	if params.RatioError != "" || params.QualityError != "" {
-		errorText := "❌ *參數錯誤*\n\n"
-
-		if params.RatioError != "" {
-			errorText += fmt.Sprintf("無效的比例：`%s`\n", params.RatioError)
-			errorText += "支援的比例：`@1:1` `@2:3` `@3:2` `@3:4` `@4:3` `@4:5` `@5:4` `@9:16` `@16:9` `@21:9`\n\n"
-		}
-
-		if params.QualityError != "" {
-			errorText += fmt.Sprintf("無效的畫質：`%s`\n", params.QualityError)
-			errorText += "支援的畫質：`@1K` `@2K` `@4K`\n\n"
-		}
-
-		errorText += "*正確範例：*\n`翻譯這張漫畫 @16:9 @4K`"
-
-		reply := tgbotapi.NewMessage(msg.Chat.ID, errorText)
+	if params.RatioError != "" || params.QualityError != "" || params.PagesError != "" ||
+		params.VariantsError != "" || params.TemperatureError != "" || params.SeedError != "" ||
+		params.ModelError != "" || params.FormatError != "" || params.JPEGQualityError != "" {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, paramErrorText(lang, params))
 		reply.ParseMode = "Markdown"
 		reply.ReplyToMessageID = msg.MessageID
 		b.api.Send(reply)
@@ -943,12 +1597,12 @@ func (b *Bot) handleImageReplyText(msg *tgbotapi.Message) {
 
 	serviceConfig, serviceName, err := b.resolveServiceConfig(msg.From.ID)
 	if err != nil {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n請先用 /service add 新增服務")
+		reply := tgbotapi.NewMessage(msg.Chat.ID, tr(lang, "error.no_service", err.Error()))
 		reply.ReplyToMessageID = msg.MessageID
 		b.api.Send(reply)
 		return
 	}
-	gClient := gemini.NewClientWithService(serviceConfig)
+	gClient := b.newGeminiClient(serviceConfig)
 
 	// 收集圖片（從當前訊息）
 	var images []imageData
@@ -963,7 +1617,12 @@ func (b *Bot) handleImageReplyText(msg *tgbotapi.Message) {
 				// 從快取中取得該 Media Group 的所有圖片
 				groupImages := b.getMediaGroupImages(msg.MediaGroupID)
 				if len(groupImages) > 0 {
-					for _, fileID := range groupImages {
+					selected, pageErr := selectPages(groupImages, params.PageSelection)
+					if pageErr != nil {
+						b.sendReplyMessage(msg, pagesErrorText(params.PageSpec, pageErr))
+						return
+					}
+					for _, fileID := range selected {
 						images = append(images, imageData{FileID: fileID})
 					}
 				} else {
@@ -979,30 +1638,49 @@ func (b *Bot) handleImageReplyText(msg *tgbotapi.Message) {
 		}
 	}
 
+	if errText := compareValidationError(params, len(images)); errText != "" {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, errText)
+		reply.ParseMode = "Markdown"
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
 	// 取得預設設定
 	quality := params.Quality
-	if quality == "" {
-		quality, _ = b.db.GetUserSettings(msg.From.ID)
-		if quality == "" {
-			quality = "2K"
-		}
+	if params.Upscale {
+		// 放大模式固定使用 4K
+		quality = "4K"
+	} else if quality == "" {
+		quality = b.resolveDefaultQuality(msg)
 	}
 
 	aspectRatio := params.AspectRatio
 
 	// 決定使用的 Prompt
 	prompt := params.Prompt
-	if prompt == "" {
-		defaultPrompt, _ := b.db.GetDefaultPrompt(msg.From.ID)
-		if defaultPrompt != nil {
-			prompt = defaultPrompt.Prompt
-		} else {
-			prompt = config.DefaultPrompt
-		}
-	} else {
+	if params.Upscale {
+		prompt = config.UpscalePrompt
+	} else if prompt == "" {
+		// 依序使用：保存的預設 Prompt > 自訂預設文字 > 系統預設
+		prompt = b.resolveMessageDefaultPrompt(msg)
+	}
+
+	if b.rejectBlockedPrompt(msg, prompt, quality) {
+		return
+	}
+	if !params.Upscale && params.Prompt != "" {
+		// 通過內容過濾後才記錄到歷史
 		b.db.AddToHistory(msg.From.ID, prompt)
 	}
 
+	if params.Enhance && !params.Upscale && params.Prompt != "" {
+		prompt = b.enhancePrompt(msg, gClient, lang, prompt)
+		if b.rejectBlockedPrompt(msg, prompt, quality) {
+			return
+		}
+	}
+
 	// 顯示參數資訊
 	ratioDisplay := "Auto"
 	if aspectRatio != "" {
@@ -1010,13 +1688,16 @@ func (b *Bot) handleImageReplyText(msg *tgbotapi.Message) {
 	}
 
 	qualityDisplay := quality
-	if params.Quality == "" {
-		qualityDisplay = quality + " (預設)"
+	if params.Quality == "" && !params.Upscale {
+		qualityDisplay = quality + tr(lang, "label.default")
 	}
 
 	// 發送處理中訊息（回覆被引用的文字訊息）
-	statusText := fmt.Sprintf("⏳ *處理中...*\n\n🔌 服務：`%s`\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 圖片數量：%d",
-		serviceName, ratioDisplay, qualityDisplay, len(images))
+	statusText := tr(lang, "status.processing",
+		markdownCode(serviceName), ratioDisplay, qualityDisplay, len(images))
+	if params.Upscale {
+		statusText += tr(lang, "status.upscale")
+	}
 
 	processingMsg, err := b.sendReplyToMessage(msg.ReplyToMessage, statusText)
 	if err != nil {
@@ -1026,91 +1707,141 @@ func (b *Bot) handleImageReplyText(msg *tgbotapi.Message) {
 	// 下載圖片
 	var downloadedImages []gemini.DownloadedImage
 	for i, img := range images {
-		b.updateMessageMarkdown(processingMsg, fmt.Sprintf("⏳ *處理中...*\n\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 下載圖片 %d/%d...",
+		b.updateMessageMarkdown(processingMsg, tr(lang, "status.downloading",
 			ratioDisplay, qualityDisplay, i+1, len(images)))
 
-		fileConfig := tgbotapi.FileConfig{FileID: img.FileID}
-		file, err := b.api.GetFile(fileConfig)
-		if err != nil {
-			b.updateMessageHTML(processingMsg, fmt.Sprintf("❌ <b>處理失敗</b>\n\n無法取得圖片 %d\n\n<blockquote expandable>%s</blockquote>",
-				i+1, truncateError(err.Error())))
-			return
-		}
-
-		data, mimeType, err := b.downloadFile(file.FilePath)
+		downloaded, err := b.downloadCachedImage(img.FileID, img.FrameMimeType)
 		if err != nil {
-			b.updateMessageHTML(processingMsg, fmt.Sprintf("❌ <b>處理失敗</b>\n\n下載圖片 %d 失敗\n\n<blockquote expandable>%s</blockquote>",
-				i+1, truncateError(err.Error())))
+			b.updateMessageHTML(processingMsg, withErrorHint(lang,
+				downloadErrorText(lang, err, i+1, "error.get_image", "error.download_image"), err))
 			return
 		}
-
-		downloadedImages = append(downloadedImages, gemini.DownloadedImage{
-			Data:     data,
-			MimeType: mimeType,
-		})
+		downloadedImages = append(downloadedImages, downloaded)
 	}
 
 	// 比例規則：
 	// 1. 使用者有指定 -> 使用指定值
-	// 2. 有圖片但未指定 -> 使用最接近圖片比例的支援比例
-	// 3. 沒圖片且未指定 -> 預設 1:1
-	aspectRatio = resolveAspectRatio(params.AspectRatio, downloadedImages)
-	ratioDisplay = ratioDisplayText(params.AspectRatio, aspectRatio, len(downloadedImages))
-
-	b.updateMessageMarkdown(processingMsg, fmt.Sprintf("⏳ *生成圖片中...*\n\n🔌 服務：`%s`\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 圖片數量：%d",
-		serviceName, ratioDisplay, qualityDisplay, len(images)))
+	// 2. 有圖片但未指定 -> 使用最接近圖片比例的支援比例（差距過大時交給模型）
+	// 3. 沒圖片且未指定 -> 使用者預設比例，未設定時 1:1
+	aspectRatio = resolveAspectRatio(params.AspectRatio, b.userDefaultRatio(msg.From.ID), downloadedImages, b.ratioTolerance())
+	detectedRatio := detectRawRatio(downloadedImages)
+	ratioDisplay = ratioDisplayText(lang, params.AspectRatio, aspectRatio, detectedRatio, len(downloadedImages))
+	ratioNote := ratioNoteText(lang, params.AspectRatio, aspectRatio, detectedRatio)
+
+	b.updateMessageMarkdown(processingMsg, tr(lang, "status.generating",
+		markdownCode(serviceName), ratioDisplay, qualityDisplay, len(images)))
+
+	// 記下這次請求，供 /redo 與結果下方的畫質按鈕重新生成
+	generationPayload := failedGenerationPayload{
+		Prompt:         prompt,
+		Quality:        quality,
+		AspectRatio:    aspectRatio,
+		ImageFileIDs:   imageFileIDs(images),
+		FrameMimeTypes: imageFrameMimeTypes(images),
+	}
+	b.rememberLastGeneration(msg.From.ID, generationPayload)
 
 	// 重試邏輯
-	var result *gemini.ImageResult
-	qualities := buildRetryQualities(quality)
+	var results []*gemini.ImageResult
+	qualities := []string{quality}
+	genOpts := b.generationOptions(params, msg.From.ID)
+
+	// 相同圖片、Prompt 與參數近期生成過時直接回傳快取結果，不再呼叫 API
+	cacheKey := ""
+	if b.resultCacheable(params, genOpts) {
+		cacheKey = resultCacheKey(gClient.WrapPrompt(prompt), gClient.SystemInstruction(), quality, aspectRatio, gemini.ResolveImageModel(genOpts.Model, serviceConfig.Model), downloadedImages)
+		if cached := b.cachedResult(cacheKey); cached != nil {
+			b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
+			addResultNote([]*gemini.ImageResult{cached}, b.applyOutputFormat(lang, []*gemini.ImageResult{cached}, params, msg.From.ID))
+			addResultNote([]*gemini.ImageResult{cached}, ratioNote)
+			b.sendCachedResult(msg, msg.ReplyToMessage.MessageID, prompt, quality, generationPayload, cached)
+			return
+		}
+	}
 
-	ctx := context.Background()
+	ctx, finishJob := b.startJob(msg, prompt, quality, aspectRatio)
+	defer finishJob()
 	var lastErr error
 
-	for i, q := range qualities {
-		b.updateMessageMarkdown(processingMsg, fmt.Sprintf("⏳ *生成圖片中...* (嘗試 %d/6，畫質 %s)\n\n🔌 服務：`%s`\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 圖片數量：%d",
-			i+1, q, serviceName, ratioDisplay, qualityDisplay, len(images)))
+	// 取得全域生成名額，避免同時送出太多請求給 Gemini；需要排隊時先回報順位
+	releaseSlot := b.acquireGenerationSlotWithStatus(processingMsg, lang)
+	stopChatAction := b.startChatAction(msg.Chat.ID)
+	startedAt := time.Now()
+
+	for i := 0; i < len(qualities); i++ {
+		q := qualities[i]
+		b.updateMessageMarkdown(processingMsg, tr(lang, "status.attempt",
+			i+1, q, markdownCode(serviceName), ratioDisplay, qualityDisplay, len(images)))
 
-		result, lastErr = gClient.GenerateImageWithContext(ctx, downloadedImages, prompt, q, aspectRatio)
+		results, lastErr = gClient.GenerateImageWithContext(ctx, downloadedImages, prompt, q, aspectRatio, genOpts)
 		if lastErr == nil {
+			// 降畫質的結果不寫入快取，避免之後同畫質的請求拿到較低畫質
+			if q == quality {
+				b.storeCachedResult(cacheKey, results[0])
+			}
 			break
 		}
 
 		log.Printf("Attempt %d failed: %v", i+1, lastErr)
+		if ctx.Err() != nil {
+			// 使用者從 /jobs 取消
+			break
+		}
+		if i == 0 {
+			// 依第一次失敗的錯誤類型決定後續是否降畫質
+			qualities = append(qualities, planRetries(quality, lastErr)...)
+		}
 		time.Sleep(time.Second * 2)
 	}
+	releaseSlot()
+	stopChatAction()
+	if lastErr != nil && ctx.Err() != nil {
+		b.updateMessage(processingMsg, "🛑 已取消這次生成")
+		return
+	}
+	logID := b.recordGeneration(msg.From.ID, msg.Chat.ID, prompt, quality, startedAt, lastErr)
+	b.storeGenerationPayload(logID, generationPayload)
+	b.sendDebugDump(msg.Chat.ID, msg.MessageID, genOpts.Debug)
 
+	if gemini.IsSafetyBlocked(lastErr) {
+		b.updateMessageHTML(processingMsg, safetyBlockedText(lang, lastErr))
+		return
+	}
 	if lastErr != nil {
-		var imageFileIDs []string
-		for _, img := range images {
-			imageFileIDs = append(imageFileIDs, img.FileID)
-		}
 		b.enqueueFailedGeneration(msg, msg.ReplyToMessage.MessageID, failedGenerationPayload{
-			Prompt:       prompt,
-			Quality:      quality,
-			AspectRatio:  aspectRatio,
-			ImageFileIDs: imageFileIDs,
-			Service:      serviceConfig,
+			Prompt:         prompt,
+			Quality:        quality,
+			AspectRatio:    aspectRatio,
+			ImageFileIDs:   imageFileIDs(images),
+			FrameMimeTypes: imageFrameMimeTypes(images),
+			Service:        serviceConfig,
 		}, lastErr)
 
-		b.updateMessageHTML(processingMsg, fmt.Sprintf("❌ <b>處理失敗</b>（已重試 6 次）\n已加入失敗重試佇列，系統每 15 分鐘會隨機挑一筆再試一次。\n\n<blockquote expandable>%s</blockquote>",
-			truncateError(lastErr.Error())))
+		b.updateMessageHTML(processingMsg, withErrorHint(lang, tr(lang, "error.generation",
+			truncateError(lastErr.Error())), lastErr))
 		return
 	}
 
+	removePlaceholder := b.sendPlaceholder(msg.Chat.ID, msg.ReplyToMessage.MessageID, results[0])
+
+	// 需要語音時，從第一張原圖擷取文字並生成語音
+	var voiceAudio []byte
+	if params.WithVoice && len(downloadedImages) > 0 {
+		voiceAudio = b.generateVoiceForImage(ctx, gClient, processingMsg, downloadedImages[0], msg.From.ID)
+	}
+
 	// 刪除處理中訊息
 	b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
 
-	// 發送預覽圖（會被 Telegram 壓縮，方便快速查看）
-	photoMsg := tgbotapi.NewPhoto(msg.Chat.ID, tgbotapi.FileBytes{Name: "preview.png", Bytes: result.ImageData})
-	photoMsg.ReplyToMessageID = msg.ReplyToMessage.MessageID
-	b.api.Send(photoMsg)
-
-	// 發送原檔案（不壓縮，完整畫質）
-	docMsg := tgbotapi.NewDocument(msg.Chat.ID, tgbotapi.FileBytes{Name: fmt.Sprintf("generated_%s.png", quality), Bytes: result.ImageData})
-	docMsg.ReplyToMessageID = msg.ReplyToMessage.MessageID
-	docMsg.Caption = "📎 原畫質檔案"
-	b.api.Send(docMsg)
+	go b.savePromptThumbnail(msg.From.ID, prompt, results[0].ImageData)
+	b.archiveResults(msg.From.ID, prompt, quality, results...)
+	addResultNote(results, b.applyOutputFormat(lang, results, params, msg.From.ID))
+	addResultNote(results, ratioNote)
+	b.sendGeneratedResults(lang, msg.Chat.ID, msg.ReplyToMessage.MessageID, quality, results, voiceAudio, logID)
+	removePlaceholder()
+	if params.Compare {
+		b.sendComparison(msg.Chat.ID, msg.ReplyToMessage.MessageID, downloadedImages[0].Data, results[0].ImageData)
+	}
 }
 
 // handleStickerReplyText 處理用貼圖回覆文字訊息的情況
@@ -1125,24 +1856,13 @@ func (b *Bot) handleStickerReplyText(msg *tgbotapi.Message) {
 
 	// 解析參數（從被回覆的文字中）
 	params := parseTextParams(replyText)
+	lang := b.userLang(msg.From)
 
 	// 檢查參數錯誤
-	if params.RatioError != "" || params.QualityError != "" {
-		errorText := "❌ *參數錯誤*\n\n"
-
-		if params.RatioError != "" {
-			errorText += fmt.Sprintf("無效的比例：`%s`\n", params.RatioError)
-			errorText += "支援的比例：`@1:1` `@2:3` `@3:2` `@3:4` `@4:3` `@4:5` `@5:4` `@9:16` `@16:9` `@21:9`\n\n"
-		}
-
-		if params.QualityError != "" {
-			errorText += fmt.Sprintf("無效的畫質：`%s`\n", params.QualityError)
-			errorText += "支援的畫質：`@1K` `@2K` `@4K`\n\n"
-		}
-
-		errorText += "*正確範例：*\n`翻譯這張漫畫 @16:9 @4K`"
-
-		reply := tgbotapi.NewMessage(msg.Chat.ID, errorText)
+	if params.RatioError != "" || params.QualityError != "" || params.PagesError != "" ||
+		params.VariantsError != "" || params.TemperatureError != "" || params.SeedError != "" ||
+		params.ModelError != "" || params.FormatError != "" || params.JPEGQualityError != "" {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, paramErrorText(lang, params))
 		reply.ParseMode = "Markdown"
 		reply.ReplyToMessageID = msg.MessageID
 		b.api.Send(reply)
@@ -1151,12 +1871,12 @@ func (b *Bot) handleStickerReplyText(msg *tgbotapi.Message) {
 
 	serviceConfig, serviceName, err := b.resolveServiceConfig(msg.From.ID)
 	if err != nil {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n請先用 /service add 新增服務")
+		reply := tgbotapi.NewMessage(msg.Chat.ID, tr(lang, "error.no_service", err.Error()))
 		reply.ReplyToMessageID = msg.MessageID
 		b.api.Send(reply)
 		return
 	}
-	gClient := gemini.NewClientWithService(serviceConfig)
+	gClient := b.newGeminiClient(serviceConfig)
 
 	// 收集貼圖
 	var images []imageData
@@ -1169,30 +1889,49 @@ func (b *Bot) handleStickerReplyText(msg *tgbotapi.Message) {
 		}
 	}
 
+	if errText := compareValidationError(params, len(images)); errText != "" {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, errText)
+		reply.ParseMode = "Markdown"
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
 	// 取得預設設定
 	quality := params.Quality
-	if quality == "" {
-		quality, _ = b.db.GetUserSettings(msg.From.ID)
-		if quality == "" {
-			quality = "2K"
-		}
+	if params.Upscale {
+		// 放大模式固定使用 4K
+		quality = "4K"
+	} else if quality == "" {
+		quality = b.resolveDefaultQuality(msg)
 	}
 
 	aspectRatio := params.AspectRatio
 
 	// 決定使用的 Prompt
 	prompt := params.Prompt
-	if prompt == "" {
-		defaultPrompt, _ := b.db.GetDefaultPrompt(msg.From.ID)
-		if defaultPrompt != nil {
-			prompt = defaultPrompt.Prompt
-		} else {
-			prompt = config.DefaultPrompt
-		}
-	} else {
+	if params.Upscale {
+		prompt = config.UpscalePrompt
+	} else if prompt == "" {
+		// 依序使用：保存的預設 Prompt > 自訂預設文字 > 系統預設
+		prompt = b.resolveMessageDefaultPrompt(msg)
+	}
+
+	if b.rejectBlockedPrompt(msg, prompt, quality) {
+		return
+	}
+	if !params.Upscale && params.Prompt != "" {
+		// 通過內容過濾後才記錄到歷史
 		b.db.AddToHistory(msg.From.ID, prompt)
 	}
 
+	if params.Enhance && !params.Upscale && params.Prompt != "" {
+		prompt = b.enhancePrompt(msg, gClient, lang, prompt)
+		if b.rejectBlockedPrompt(msg, prompt, quality) {
+			return
+		}
+	}
+
 	// 顯示參數資訊
 	ratioDisplay := "Auto"
 	if aspectRatio != "" {
@@ -1200,13 +1939,16 @@ func (b *Bot) handleStickerReplyText(msg *tgbotapi.Message) {
 	}
 
 	qualityDisplay := quality
-	if params.Quality == "" {
-		qualityDisplay = quality + " (預設)"
+	if params.Quality == "" && !params.Upscale {
+		qualityDisplay = quality + tr(lang, "label.default")
 	}
 
 	// 發送處理中訊息（回覆被引用的文字訊息）
-	statusText := fmt.Sprintf("⏳ *處理中...*\n\n🔌 服務：`%s`\n📏 比例：`%s`\n🎨 畫質：`%s`\n🎭 貼圖數量：%d",
-		serviceName, ratioDisplay, qualityDisplay, len(images))
+	statusText := tr(lang, "status.processing_sticker",
+		markdownCode(serviceName), ratioDisplay, qualityDisplay, len(images))
+	if params.Upscale {
+		statusText += tr(lang, "status.upscale")
+	}
 
 	processingMsg, err := b.sendReplyToMessage(msg.ReplyToMessage, statusText)
 	if err != nil {
@@ -1216,276 +1958,197 @@ func (b *Bot) handleStickerReplyText(msg *tgbotapi.Message) {
 	// 下載貼圖
 	var downloadedImages []gemini.DownloadedImage
 	for i, img := range images {
-		b.updateMessageMarkdown(processingMsg, fmt.Sprintf("⏳ *處理中...*\n\n📏 比例：`%s`\n🎨 畫質：`%s`\n🎭 下載貼圖 %d/%d...",
+		b.updateMessageMarkdown(processingMsg, tr(lang, "status.downloading_sticker",
 			ratioDisplay, qualityDisplay, i+1, len(images)))
 
-		fileConfig := tgbotapi.FileConfig{FileID: img.FileID}
-		file, err := b.api.GetFile(fileConfig)
+		downloaded, err := b.downloadCachedImage(img.FileID, img.FrameMimeType)
 		if err != nil {
-			b.updateMessageHTML(processingMsg, fmt.Sprintf("❌ <b>處理失敗</b>\n\n無法取得貼圖 %d\n\n<blockquote expandable>%s</blockquote>",
-				i+1, truncateError(err.Error())))
+			b.updateMessageHTML(processingMsg, withErrorHint(lang,
+				downloadErrorText(lang, err, i+1, "error.get_sticker", "error.download_sticker"), err))
 			return
 		}
-
-		data, mimeType, err := b.downloadFile(file.FilePath)
-		if err != nil {
-			b.updateMessageHTML(processingMsg, fmt.Sprintf("❌ <b>處理失敗</b>\n\n下載貼圖 %d 失敗\n\n<blockquote expandable>%s</blockquote>",
-				i+1, truncateError(err.Error())))
-			return
-		}
-
-		downloadedImages = append(downloadedImages, gemini.DownloadedImage{
-			Data:     data,
-			MimeType: mimeType,
-		})
+		downloadedImages = append(downloadedImages, downloaded)
 	}
 
 	// 比例規則：
 	// 1. 使用者有指定 -> 使用指定值
-	// 2. 有圖片但未指定 -> 使用最接近圖片比例的支援比例
-	// 3. 沒圖片且未指定 -> 預設 1:1
-	aspectRatio = resolveAspectRatio(params.AspectRatio, downloadedImages)
-	ratioDisplay = ratioDisplayText(params.AspectRatio, aspectRatio, len(downloadedImages))
-
-	b.updateMessageMarkdown(processingMsg, fmt.Sprintf("⏳ *生成圖片中...*\n\n🔌 服務：`%s`\n📏 比例：`%s`\n🎨 畫質：`%s`\n🎭 貼圖數量：%d",
-		serviceName, ratioDisplay, qualityDisplay, len(images)))
+	// 2. 有圖片但未指定 -> 使用最接近圖片比例的支援比例（差距過大時交給模型）
+	// 3. 沒圖片且未指定 -> 使用者預設比例，未設定時 1:1
+	aspectRatio = resolveAspectRatio(params.AspectRatio, b.userDefaultRatio(msg.From.ID), downloadedImages, b.ratioTolerance())
+	detectedRatio := detectRawRatio(downloadedImages)
+	ratioDisplay = ratioDisplayText(lang, params.AspectRatio, aspectRatio, detectedRatio, len(downloadedImages))
+	ratioNote := ratioNoteText(lang, params.AspectRatio, aspectRatio, detectedRatio)
+
+	b.updateMessageMarkdown(processingMsg, tr(lang, "status.generating_sticker",
+		markdownCode(serviceName), ratioDisplay, qualityDisplay, len(images)))
+
+	// 記下這次請求，供 /redo 與結果下方的畫質按鈕重新生成
+	generationPayload := failedGenerationPayload{
+		Prompt:         prompt,
+		Quality:        quality,
+		AspectRatio:    aspectRatio,
+		ImageFileIDs:   imageFileIDs(images),
+		FrameMimeTypes: imageFrameMimeTypes(images),
+	}
+	b.rememberLastGeneration(msg.From.ID, generationPayload)
 
 	// 重試邏輯
-	var result *gemini.ImageResult
-	qualities := buildRetryQualities(quality)
+	var results []*gemini.ImageResult
+	qualities := []string{quality}
+	genOpts := b.generationOptions(params, msg.From.ID)
+
+	// 相同圖片、Prompt 與參數近期生成過時直接回傳快取結果，不再呼叫 API
+	cacheKey := ""
+	if b.resultCacheable(params, genOpts) {
+		cacheKey = resultCacheKey(gClient.WrapPrompt(prompt), gClient.SystemInstruction(), quality, aspectRatio, gemini.ResolveImageModel(genOpts.Model, serviceConfig.Model), downloadedImages)
+		if cached := b.cachedResult(cacheKey); cached != nil {
+			b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
+			addResultNote([]*gemini.ImageResult{cached}, b.applyOutputFormat(lang, []*gemini.ImageResult{cached}, params, msg.From.ID))
+			addResultNote([]*gemini.ImageResult{cached}, ratioNote)
+			b.sendCachedResult(msg, msg.ReplyToMessage.MessageID, prompt, quality, generationPayload, cached)
+			return
+		}
+	}
 
-	ctx := context.Background()
+	ctx, finishJob := b.startJob(msg, prompt, quality, aspectRatio)
+	defer finishJob()
 	var lastErr error
 
-	for i, q := range qualities {
-		b.updateMessageMarkdown(processingMsg, fmt.Sprintf("⏳ *生成圖片中...* (嘗試 %d/6，畫質 %s)\n\n🔌 服務：`%s`\n📏 比例：`%s`\n🎨 畫質：`%s`\n🎭 貼圖數量：%d",
-			i+1, q, serviceName, ratioDisplay, qualityDisplay, len(images)))
+	// 取得全域生成名額，避免同時送出太多請求給 Gemini；需要排隊時先回報順位
+	releaseSlot := b.acquireGenerationSlotWithStatus(processingMsg, lang)
+	stopChatAction := b.startChatAction(msg.Chat.ID)
+	startedAt := time.Now()
+
+	for i := 0; i < len(qualities); i++ {
+		q := qualities[i]
+		b.updateMessageMarkdown(processingMsg, tr(lang, "status.attempt_sticker",
+			i+1, q, markdownCode(serviceName), ratioDisplay, qualityDisplay, len(images)))
 
-		result, lastErr = gClient.GenerateImageWithContext(ctx, downloadedImages, prompt, q, aspectRatio)
+		results, lastErr = gClient.GenerateImageWithContext(ctx, downloadedImages, prompt, q, aspectRatio, genOpts)
 		if lastErr == nil {
+			// 降畫質的結果不寫入快取，避免之後同畫質的請求拿到較低畫質
+			if q == quality {
+				b.storeCachedResult(cacheKey, results[0])
+			}
 			break
 		}
 
 		log.Printf("Attempt %d failed: %v", i+1, lastErr)
+		if ctx.Err() != nil {
+			// 使用者從 /jobs 取消
+			break
+		}
+		if i == 0 {
+			// 依第一次失敗的錯誤類型決定後續是否降畫質
+			qualities = append(qualities, planRetries(quality, lastErr)...)
+		}
 		time.Sleep(time.Second * 2)
 	}
+	releaseSlot()
+	stopChatAction()
+	if lastErr != nil && ctx.Err() != nil {
+		b.updateMessage(processingMsg, "🛑 已取消這次生成")
+		return
+	}
+	logID := b.recordGeneration(msg.From.ID, msg.Chat.ID, prompt, quality, startedAt, lastErr)
+	b.storeGenerationPayload(logID, generationPayload)
+	b.sendDebugDump(msg.Chat.ID, msg.MessageID, genOpts.Debug)
 
+	if gemini.IsSafetyBlocked(lastErr) {
+		b.updateMessageHTML(processingMsg, safetyBlockedText(lang, lastErr))
+		return
+	}
 	if lastErr != nil {
-		var imageFileIDs []string
-		for _, img := range images {
-			imageFileIDs = append(imageFileIDs, img.FileID)
-		}
 		b.enqueueFailedGeneration(msg, msg.ReplyToMessage.MessageID, failedGenerationPayload{
-			Prompt:       prompt,
-			Quality:      quality,
-			AspectRatio:  aspectRatio,
-			ImageFileIDs: imageFileIDs,
-			Service:      serviceConfig,
+			Prompt:         prompt,
+			Quality:        quality,
+			AspectRatio:    aspectRatio,
+			ImageFileIDs:   imageFileIDs(images),
+			FrameMimeTypes: imageFrameMimeTypes(images),
+			Service:        serviceConfig,
 		}, lastErr)
 
-		b.updateMessageHTML(processingMsg, fmt.Sprintf("❌ <b>處理失敗</b>（已重試 6 次）\n已加入失敗重試佇列，系統每 15 分鐘會隨機挑一筆再試一次。\n\n<blockquote expandable>%s</blockquote>",
-			truncateError(lastErr.Error())))
+		b.updateMessageHTML(processingMsg, withErrorHint(lang, tr(lang, "error.generation",
+			truncateError(lastErr.Error())), lastErr))
 		return
 	}
 
-	// 刪除處理中訊息
-	b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
-
-	// 發送預覽圖（會被 Telegram 壓縮，方便快速查看）
-	photoMsg := tgbotapi.NewPhoto(msg.Chat.ID, tgbotapi.FileBytes{Name: "preview.png", Bytes: result.ImageData})
-	photoMsg.ReplyToMessageID = msg.ReplyToMessage.MessageID
-	b.api.Send(photoMsg)
-
-	// 發送原檔案（不壓縮，完整畫質）
-	docMsg := tgbotapi.NewDocument(msg.Chat.ID, tgbotapi.FileBytes{Name: fmt.Sprintf("generated_%s.png", quality), Bytes: result.ImageData})
-	docMsg.ReplyToMessageID = msg.ReplyToMessage.MessageID
-	docMsg.Caption = "📎 原畫質檔案"
-	b.api.Send(docMsg)
-}
-
-type imageData struct {
-	FileID string
-}
-
-func (b *Bot) handlePhoto(msg *tgbotapi.Message) {
-	// 解析參數
-	caption := msg.Caption
-	quality := ""
-	withVoice := false
-	customPrompt := ""
-
-	// 檢查參數
-	if strings.Contains(caption, "/s ") {
-		// 解析畫質設定
-		parts := strings.Split(caption, "/s ")
-		if len(parts) > 1 {
-			qParts := strings.Fields(parts[1])
-			if len(qParts) > 0 {
-				q := strings.ToUpper(qParts[0])
-				if q == "1K" || q == "2K" || q == "4K" {
-					quality = q
-				}
-			}
-		}
-		caption = strings.Split(caption, "/s")[0]
-	}
-
-	if strings.Contains(caption, "/v") {
-		withVoice = true
-		caption = strings.ReplaceAll(caption, "/v", "")
-	}
-
-	caption = strings.TrimSpace(caption)
-	if caption != "" && !strings.HasPrefix(caption, "/") {
-		customPrompt = caption
-	}
+	removePlaceholder := b.sendPlaceholder(msg.Chat.ID, msg.ReplyToMessage.MessageID, results[0])
 
-	// 取得預設設定
-	if quality == "" {
-		quality, _ = b.db.GetUserSettings(msg.From.ID)
-		if quality == "" {
-			quality = "2K"
-		}
+	// 需要語音時，從第一張原圖擷取文字並生成語音
+	var voiceAudio []byte
+	if params.WithVoice && len(downloadedImages) > 0 {
+		voiceAudio = b.generateVoiceForImage(ctx, gClient, processingMsg, downloadedImages[0], msg.From.ID)
 	}
 
-	// 決定使用的 Prompt
-	prompt := config.DefaultPrompt
-	if customPrompt != "" {
-		prompt = customPrompt
-		// 記錄到歷史
-		b.db.AddToHistory(msg.From.ID, prompt)
-	} else {
-		// 檢查是否有使用者設定的預設
-		defaultPrompt, _ := b.db.GetDefaultPrompt(msg.From.ID)
-		if defaultPrompt != nil {
-			prompt = defaultPrompt.Prompt
-		}
-	}
-
-	serviceConfig, serviceName, err := b.resolveServiceConfig(msg.From.ID)
-	if err != nil {
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n請先用 /service add 新增服務")
-		reply.ReplyToMessageID = msg.MessageID
-		b.api.Send(reply)
-		return
-	}
-	gClient := gemini.NewClientWithService(serviceConfig)
-
-	// 發送處理中訊息
-	processingMsg, _ := b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "⏳ 處理中..."))
-
-	// 下載圖片
-	photo := msg.Photo[len(msg.Photo)-1] // 取最大的圖片
-	fileConfig := tgbotapi.FileConfig{FileID: photo.FileID}
-	file, err := b.api.GetFile(fileConfig)
-	if err != nil {
-		b.updateMessage(processingMsg, "❌ 無法取得圖片")
-		return
-	}
+	// 刪除處理中訊息
+	b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
 
-	imageData, mimeType, err := b.downloadFile(file.FilePath)
-	if err != nil {
-		b.updateMessage(processingMsg, "❌ 下載圖片失敗")
-		return
+	go b.savePromptThumbnail(msg.From.ID, prompt, results[0].ImageData)
+	b.archiveResults(msg.From.ID, prompt, quality, results...)
+	addResultNote(results, b.applyOutputFormat(lang, results, params, msg.From.ID))
+	addResultNote(results, ratioNote)
+	b.sendGeneratedResults(lang, msg.Chat.ID, msg.ReplyToMessage.MessageID, quality, results, voiceAudio, logID)
+	removePlaceholder()
+	if params.Compare {
+		b.sendComparison(msg.Chat.ID, msg.ReplyToMessage.MessageID, downloadedImages[0].Data, results[0].ImageData)
 	}
+}
 
-	// 取得圖片資訊並計算比例
-	imageInfo, err := gemini.GetImageInfo(imageData)
-	if err != nil {
-		log.Printf("無法解析圖片資訊: %v", err)
-		imageInfo = &gemini.ImageInfo{AspectRatio: defaultAspectRatio}
-	}
-	if imageInfo.AspectRatio == "" {
-		imageInfo.AspectRatio = defaultAspectRatio
+// sendGeneratedResult 發送預覽圖與原畫質檔案；有語音時在圖片之後另外發送音訊
+// （Telegram 不接受圖片與音訊混在同一個 Media Group）
+func (b *Bot) sendGeneratedResult(lang string, chatID int64, replyToMessageID int, quality string, result *gemini.ImageResult, voiceAudio []byte, logID int64) {
+	// 發送預覽圖（會被 Telegram 壓縮，方便快速查看）
+	photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: "preview" + result.FileExt(), Bytes: result.ImageData})
+	photoMsg.Caption = resultCaption(lang, result)
+	photoMsg.ReplyToMessageID = replyToMessageID
+	if sent, err := b.api.Send(photoMsg); err == nil {
+		b.trackResultMessage(sent, logID, false)
 	}
 
-	// 顯示圖片資訊
-	ratioInfo := imageInfo.AspectRatio
-	b.updateMessage(processingMsg, fmt.Sprintf("⏳ 處理中...\n🔌 服務: %s\n📐 圖片: %dx%d\n📏 比例: %s", serviceName, imageInfo.Width, imageInfo.Height, ratioInfo))
-
-	// 重試邏輯：固定同畫質重試 6 次
-	var result *gemini.ImageResult
-	qualities := buildRetryQualities(quality)
-
-	ctx := context.Background()
-	var lastErr error
-
-	for i, q := range qualities {
-		b.updateMessage(processingMsg, fmt.Sprintf("⏳ 處理中... (嘗試 %d/6，畫質 %s)\n🔌 服務: %s\n📐 圖片: %dx%d\n📏 比例: %s", i+1, q, serviceName, imageInfo.Width, imageInfo.Height, ratioInfo))
-
-		result, lastErr = gClient.GenerateImage(ctx, imageData, mimeType, prompt, q, imageInfo.AspectRatio)
-		if lastErr == nil {
-			break
-		}
-
-		log.Printf("Attempt %d failed: %v", i+1, lastErr)
-		time.Sleep(time.Second * 2)
+	// 發送原檔案（不壓縮，完整畫質）
+	docMsg := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: fmt.Sprintf("generated_%s%s", quality, result.FileExt()), Bytes: result.ImageData})
+	docMsg.ReplyToMessageID = replyToMessageID
+	docMsg.Caption = "📎 原畫質檔案"
+	if logID > 0 {
+		docMsg.ReplyMarkup = b.resultKeyboard(logID, 0)
 	}
-
-	if lastErr != nil {
-		b.enqueueFailedGeneration(msg, msg.MessageID, failedGenerationPayload{
-			Prompt:      prompt,
-			Quality:     quality,
-			AspectRatio: imageInfo.AspectRatio,
-			ImageFileIDs: []string{
-				photo.FileID,
-			},
-			Service: serviceConfig,
-		}, lastErr)
-
-		b.updateMessage(processingMsg, fmt.Sprintf("❌ 處理失敗（已重試 6 次）\n已加入失敗重試佇列，系統每 15 分鐘會隨機挑一筆再試一次。\n錯誤：%s", lastErr.Error()))
-		return
+	if sent, err := b.api.Send(docMsg); err == nil {
+		b.saveResultFileID(logID, sent)
+		b.trackResultMessage(sent, logID, true)
 	}
 
-	// 如果需要語音
-	var extractedText string
-	var ttsResult *gemini.TTSResult
-
-	if withVoice {
-		b.updateMessage(processingMsg, "⏳ 擷取文字中...")
-		extractedText, _ = gClient.ExtractText(ctx, imageData, mimeType, config.ExtractTextPrompt)
-
-		if extractedText != "" {
-			b.updateMessage(processingMsg, "⏳ 生成語音中...")
-			ttsResult, _ = gClient.GenerateTTS(ctx, extractedText, config.TTSVoiceName)
+	if len(voiceAudio) > 0 {
+		audioMsg := tgbotapi.NewAudio(chatID, tgbotapi.FileBytes{Name: "voice.wav", Bytes: voiceAudio})
+		audioMsg.ReplyToMessageID = replyToMessageID
+		if _, err := b.api.Send(audioMsg); err != nil {
+			log.Printf("發送語音失敗: %v", err)
 		}
 	}
+}
 
-	// 刪除處理中訊息
-	b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
-
-	// 發送結果
-	if withVoice && ttsResult != nil {
-		// 使用 Media Group 同時發送圖片和音訊
-		mediaGroup := tgbotapi.NewMediaGroup(msg.Chat.ID, []interface{}{
-			tgbotapi.NewInputMediaPhoto(tgbotapi.FileBytes{Name: "translated.png", Bytes: result.ImageData}),
-			tgbotapi.NewInputMediaAudio(tgbotapi.FileBytes{Name: "voice.wav", Bytes: ttsResult.AudioData}),
-		})
-		mediaGroup.ReplyToMessageID = msg.MessageID
-		b.api.SendMediaGroup(mediaGroup)
-	} else {
-		// 只發送圖片
-		photoMsg := tgbotapi.NewPhoto(msg.Chat.ID, tgbotapi.FileBytes{Name: "translated.png", Bytes: result.ImageData})
-		photoMsg.ReplyToMessageID = msg.MessageID
-		b.api.Send(photoMsg)
-	}
+type imageData struct {
+	FileID        string
+	FrameMimeType string // 非空時為動畫或影片，下載後需擷取第一格畫面
 }
 
-func (b *Bot) downloadFile(filePath string) ([]byte, string, error) {
-	url := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", b.config.BotToken, filePath)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, "", err
+// downloadFile 下載 Telegram 檔案，超過 MaxImageBytes 時直接拒絕，不會整個讀進記憶體；
+// 暫時性錯誤由 downloadFileCtx 重試與續傳
+func (b *Bot) downloadFile(file tgbotapi.File) ([]byte, string, error) {
+	limit := int64(b.config.MaxImageBytes)
+	if file.FileSize > 0 && int64(file.FileSize) > limit {
+		return nil, "", &fileTooLargeError{Size: int64(file.FileSize), Limit: limit}
 	}
-	defer resp.Body.Close()
 
-	data, err := io.ReadAll(resp.Body)
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+	data, err := b.downloadFileCtx(ctx, file.FilePath)
 	if err != nil {
 		return nil, "", err
 	}
 
 	mimeType := "image/jpeg"
-	if strings.HasSuffix(filePath, ".png") {
+	if strings.HasSuffix(file.FilePath, ".png") {
 		mimeType = "image/png"
 	}
 
@@ -1493,20 +2156,15 @@ func (b *Bot) downloadFile(filePath string) ([]byte, string, error) {
 }
 
 func (b *Bot) updateMessage(msg tgbotapi.Message, text string) {
-	edit := tgbotapi.NewEditMessageText(msg.Chat.ID, msg.MessageID, text)
-	b.api.Send(edit)
+	b.editMessage(msg, text, "")
 }
 
 func (b *Bot) updateMessageMarkdown(msg tgbotapi.Message, text string) {
-	edit := tgbotapi.NewEditMessageText(msg.Chat.ID, msg.MessageID, text)
-	edit.ParseMode = "Markdown"
-	b.api.Send(edit)
+	b.editMessage(msg, text, "Markdown")
 }
 
 func (b *Bot) updateMessageHTML(msg tgbotapi.Message, text string) {
-	edit := tgbotapi.NewEditMessageText(msg.Chat.ID, msg.MessageID, text)
-	edit.ParseMode = "HTML"
-	b.api.Send(edit)
+	b.editMessage(msg, text, "HTML")
 }
 
 func (b *Bot) sendReplyMessage(msg *tgbotapi.Message, text string) (tgbotapi.Message, error) {
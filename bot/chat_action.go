@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatActionInterval Telegram 的聊天動作約 5 秒後消失，需在那之前重送
+const chatActionInterval = 4 * time.Second
+
+// startChatAction 生成期間持續顯示「正在傳送圖片…」，回傳的 stop 可重複呼叫
+func (b *Bot) startChatAction(chatID int64) (stop func()) {
+	done := make(chan struct{})
+	go runChatAction(done, chatActionInterval, func() {
+		if b.api == nil {
+			return
+		}
+		if _, err := b.api.Request(tgbotapi.NewChatAction(chatID, tgbotapi.ChatUploadPhoto)); err != nil {
+			log.Printf("發送聊天動作失敗 (chat=%d): %v", chatID, err)
+		}
+	})
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// runChatAction 立即送出一次動作，之後每隔 interval 重送，直到 done 被關閉
+func runChatAction(done <-chan struct{}, interval time.Duration, send func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		send()
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package bot
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunChatAction_RepeatsUntilStopped(t *testing.T) {
+	var sent int32
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		runChatAction(done, 10*time.Millisecond, func() { atomic.AddInt32(&sent, 1) })
+		close(exited)
+	}()
+
+	time.Sleep(35 * time.Millisecond)
+	close(done)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("expected runChatAction to exit after done is closed")
+	}
+
+	count := atomic.LoadInt32(&sent)
+	if count < 2 {
+		t.Fatalf("expected the action to be resent periodically, got %d sends", count)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if after := atomic.LoadInt32(&sent); after != count {
+		t.Fatalf("expected no sends after stop, got %d more", after-count)
+	}
+}
+
+func TestStartChatAction_StopIsIdempotent(t *testing.T) {
+	b := &Bot{}
+	stop := b.startChatAction(1)
+	stop()
+	stop()
+}
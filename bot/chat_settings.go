@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"tg-bawer/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatSettingsFor 群組啟用共用設定時回傳設定，私聊或未啟用時回傳 nil
+func (b *Bot) chatSettingsFor(chat *tgbotapi.Chat) *database.ChatSettings {
+	if chat == nil || chat.IsPrivate() {
+		return nil
+	}
+	settings, err := b.db.GetChatSettings(chat.ID)
+	if err != nil {
+		log.Printf("Failed to load chat settings: %v", err)
+		return nil
+	}
+	if !settings.Enabled {
+		return nil
+	}
+	return settings
+}
+
+// resolveDefaultQuality 未指定畫質時決定預設：主題設定 > 群組共用設定 > 使用者設定 > 2K
+func (b *Bot) resolveDefaultQuality(msg *tgbotapi.Message) string {
+	if topic := b.topicSettingsFor(msg); topic != nil && topic.DefaultQuality != "" {
+		return topic.DefaultQuality
+	}
+	if settings := b.chatSettingsFor(msg.Chat); settings != nil && settings.DefaultQuality != "" {
+		return settings.DefaultQuality
+	}
+	quality, _ := b.db.GetUserSettings(msg.From.ID)
+	if quality == "" {
+		quality = "2K"
+	}
+	return quality
+}
+
+// resolveMessageDefaultPrompt 依序使用主題設定、群組共用設定的 Prompt，都沒有時回到個人預設
+func (b *Bot) resolveMessageDefaultPrompt(msg *tgbotapi.Message) string {
+	if _, prompt := b.topicDefaultPrompt(b.topicSettingsFor(msg)); strings.TrimSpace(prompt) != "" {
+		return prompt
+	}
+	if settings := b.chatSettingsFor(msg.Chat); settings != nil && strings.TrimSpace(settings.DefaultPrompt) != "" {
+		return settings.DefaultPrompt
+	}
+	return b.resolveDefaultPrompt(msg.From.ID)
+}
+
+// isChatAdmin 檢查使用者是否為群組管理員
+func (b *Bot) isChatAdmin(chatID, userID int64) bool {
+	member, err := b.api.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID},
+	})
+	if err != nil {
+		log.Printf("Failed to get chat member: %v", err)
+		return false
+	}
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+// cmdChatSettings 群組共用設定，只有群組管理員可以修改
+// /chatsettings prompt <內容> 設定群組預設 Prompt，不帶內容則清除
+func (b *Bot) cmdChatSettings(msg *tgbotapi.Message) {
+	if msg.Chat.IsPrivate() {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 此指令只能在群組中使用\n私聊請用 /settings"))
+		return
+	}
+
+	settings, err := b.db.GetChatSettings(msg.Chat.ID)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 取得失敗："+err.Error()))
+		return
+	}
+
+	args := strings.TrimSpace(msg.CommandArguments())
+	if args != "" {
+		if !b.isChatAdmin(msg.Chat.ID, msg.From.ID) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 只有群組管理員可以修改群組設定"))
+			return
+		}
+
+		fields := strings.SplitN(args, " ", 2)
+		if fields[0] != "prompt" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/chatsettings prompt <內容>"))
+			return
+		}
+		settings.DefaultPrompt = ""
+		if len(fields) == 2 {
+			settings.DefaultPrompt = strings.TrimSpace(fields[1])
+		}
+		if err := b.db.SetChatSettings(settings); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 設定失敗："+err.Error()))
+			return
+		}
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, chatSettingsText(settings))
+	reply.ParseMode = "Markdown"
+	reply.ReplyMarkup = chatSettingsKeyboard(settings)
+	b.api.Send(reply)
+}
+
+// callbackChatSettings 處理 chatset:on / chatset:off / chatset:q:<畫質>
+func (b *Bot) callbackChatSettings(callback *tgbotapi.CallbackQuery, value string) {
+	chatID := callback.Message.Chat.ID
+	if !b.isChatAdmin(chatID, callback.From.ID) {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "只有群組管理員可以修改"))
+		return
+	}
+
+	settings, err := b.db.GetChatSettings(chatID)
+	if err != nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "設定失敗"))
+		return
+	}
+
+	switch {
+	case value == "on":
+		settings.Enabled = true
+	case value == "off":
+		settings.Enabled = false
+	case strings.HasPrefix(value, "q:"):
+		quality, ok := supportedQualities[strings.TrimPrefix(value, "q:")]
+		if !ok {
+			b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
+			return
+		}
+		settings.DefaultQuality = quality
+	default:
+		b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+
+	if err := b.db.SetChatSettings(settings); err != nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "設定失敗"))
+		return
+	}
+	b.api.Request(tgbotapi.NewCallback(callback.ID, "✅ 已更新群組設定"))
+
+	edit := tgbotapi.NewEditMessageText(chatID, callback.Message.MessageID, chatSettingsText(settings))
+	edit.ParseMode = "Markdown"
+	keyboard := chatSettingsKeyboard(settings)
+	edit.ReplyMarkup = &keyboard
+	b.api.Send(edit)
+}
+
+func chatSettingsText(settings *database.ChatSettings) string {
+	status := "❌ 未啟用（成員各自使用個人設定）"
+	if settings.Enabled {
+		status = "✅ 已啟用（全群組共用）"
+	}
+	quality := settings.DefaultQuality
+	if quality == "" {
+		quality = "未設定（使用個人設定）"
+	}
+	prompt := "未設定（使用個人預設）"
+	if strings.TrimSpace(settings.DefaultPrompt) != "" {
+		prompt = markdownCode(settings.DefaultPrompt)
+	}
+
+	return fmt.Sprintf("👥 *群組設定*\n\n狀態：%s\n預設畫質：%s\n預設 Prompt：%s\n\n用 `/chatsettings prompt <內容>` 設定群組預設 Prompt",
+		status, quality, prompt)
+}
+
+func chatSettingsKeyboard(settings *database.ChatSettings) tgbotapi.InlineKeyboardMarkup {
+	toggle := tgbotapi.NewInlineKeyboardButtonData("✅ 啟用共用設定", "chatset:on")
+	if settings.Enabled {
+		toggle = tgbotapi.NewInlineKeyboardButtonData("❌ 停用共用設定", "chatset:off")
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(toggle),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(qualityButton("1K", settings.DefaultQuality), "chatset:q:1K"),
+			tgbotapi.NewInlineKeyboardButtonData(qualityButton("2K", settings.DefaultQuality), "chatset:q:2K"),
+			tgbotapi.NewInlineKeyboardButtonData(qualityButton("4K", settings.DefaultQuality), "chatset:q:4K"),
+		),
+	)
+}
@@ -0,0 +1,211 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bawer/database"
+	"tg-bawer/gemini"
+)
+
+// serviceOutcome /compare 中單一服務的生成結果
+type serviceOutcome struct {
+	Label   string
+	Result  *gemini.ImageResult
+	Latency time.Duration
+	Err     error
+}
+
+// cmdCompareServices /compare <服務ID1> <服務ID2> [prompt]：以同一 Prompt（與附上或回覆的圖片）同時用兩個服務生成，方便評估代理
+func (b *Bot) cmdCompareServices(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) < 2 {
+		b.sendReplyMessage(msg, "❌ 格式：`/compare <服務ID1> <服務ID2> [prompt]`\n可附上或回覆一張圖片")
+		return
+	}
+
+	var labels []string
+	var services []gemini.ServiceConfig
+	for _, arg := range args[:2] {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			b.sendReplyMessage(msg, "❌ 服務 ID 必須是數字")
+			return
+		}
+		service, err := b.findUserService(msg.From.ID, id)
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 讀取服務列表失敗："+err.Error()))
+			return
+		}
+		if service == nil {
+			b.sendReplyMessage(msg, fmt.Sprintf("❌ 找不到服務 #%d，請先用 /service list 查詢", id))
+			return
+		}
+		labels = append(labels, fmt.Sprintf("%s (#%d)", service.Name, service.ID))
+		services = append(services, serviceConfigFromUserService(service))
+	}
+
+	params := parseTextParams(strings.Join(args[2:], " "))
+	if params.RatioError != "" || params.QualityError != "" || params.PagesError != "" ||
+		params.VariantsError != "" || params.TemperatureError != "" || params.SeedError != "" ||
+		params.ModelError != "" || params.FormatError != "" || params.JPEGQualityError != "" {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, paramErrorText(b.userLang(msg.From), params))
+		reply.ParseMode = "Markdown"
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
+	fileID := findImageFileID(msg)
+	if fileID == "" {
+		fileID = findImageFileID(msg.ReplyToMessage)
+	}
+
+	prompt := params.Prompt
+	if prompt == "" {
+		if fileID == "" {
+			b.sendReplyMessage(msg, "❌ 請提供 Prompt，或附上／回覆一張圖片")
+			return
+		}
+		prompt = b.resolveMessageDefaultPrompt(msg)
+	}
+	quality := params.Quality
+	if quality == "" {
+		quality = b.resolveDefaultQuality(msg)
+	}
+	if b.rejectBlockedPrompt(msg, prompt, quality) {
+		return
+	}
+
+	processingMsg, err := b.sendReplyMessage(msg, "⏳ *同時以兩個服務生成中...*")
+	if err != nil {
+		return
+	}
+
+	var images []gemini.DownloadedImage
+	if fileID != "" {
+		images, err = b.downloadImagesByFileIDs([]string{fileID}, nil)
+		if err != nil {
+			b.updateMessageHTML(processingMsg, withErrorHint(defaultLang, fmt.Sprintf("❌ <b>處理失敗</b>\n\n下載圖片失敗\n\n<blockquote expandable>%s</blockquote>",
+				html.EscapeString(truncateError(err.Error()))), err))
+			return
+		}
+	}
+	aspectRatio := resolveAspectRatio(params.AspectRatio, b.userDefaultRatio(msg.From.ID), images, b.ratioTolerance())
+	opts := gemini.GenerationOptions{Temperature: params.Temperature, Seed: params.Seed, Model: params.Model}
+
+	ctx, finishJob := b.startJob(msg, prompt, quality, aspectRatio)
+	defer finishJob()
+
+	outcomes := make([]serviceOutcome, len(services))
+	var wg sync.WaitGroup
+	for i := range services {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outcomes[i] = b.generateForComparison(ctx, msg, services[i], labels[i], images, prompt, quality, aspectRatio, opts)
+		}(i)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		b.updateMessage(processingMsg, "🛑 已取消這次生成")
+		return
+	}
+	b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
+
+	var media []interface{}
+	for i, outcome := range outcomes {
+		if outcome.Err != nil {
+			continue
+		}
+		photo := tgbotapi.NewInputMediaPhoto(tgbotapi.FileBytes{Name: fmt.Sprintf("service_%d%s", i+1, outcome.Result.FileExt()), Bytes: outcome.Result.ImageData})
+		photo.Caption = fmt.Sprintf("%s · %.1fs", outcome.Label, outcome.Latency.Seconds())
+		media = append(media, photo)
+	}
+	switch {
+	case len(media) > 1:
+		group := tgbotapi.NewMediaGroup(msg.Chat.ID, media)
+		group.ReplyToMessageID = msg.MessageID
+		if _, err := b.api.SendMediaGroup(group); err != nil {
+			log.Printf("發送服務比較 Media Group 失敗: %v", err)
+		}
+	case len(media) == 1:
+		// Media Group 至少要兩項，只有一個服務成功時改發單張
+		only := media[0].(tgbotapi.InputMediaPhoto)
+		photo := tgbotapi.NewPhoto(msg.Chat.ID, only.Media)
+		photo.Caption = only.Caption
+		photo.ReplyToMessageID = msg.MessageID
+		b.api.Send(photo)
+	}
+
+	summary := tgbotapi.NewMessage(msg.Chat.ID, formatServiceComparison(outcomes))
+	summary.ParseMode = "HTML"
+	summary.ReplyToMessageID = msg.MessageID
+	b.api.Send(summary)
+}
+
+// generateForComparison 以單一服務生成一次（不降畫質重試），各自取得全域名額並計時
+func (b *Bot) generateForComparison(ctx context.Context, msg *tgbotapi.Message, service gemini.ServiceConfig, label string, images []gemini.DownloadedImage, prompt, quality, aspectRatio string, opts gemini.GenerationOptions) serviceOutcome {
+	releaseSlot := b.acquireGenerationSlot()
+	defer releaseSlot()
+
+	client := b.newGeminiClient(service)
+	startedAt := time.Now()
+	var results []*gemini.ImageResult
+	var err error
+	if len(images) > 0 {
+		results, err = client.GenerateImageWithContext(ctx, images, prompt, quality, aspectRatio, opts)
+	} else {
+		results, err = client.GenerateImageFromText(ctx, prompt, quality, aspectRatio, opts)
+	}
+	outcome := serviceOutcome{Label: label, Latency: time.Since(startedAt), Err: err}
+	if ctx.Err() == nil {
+		b.recordGeneration(msg.From.ID, msg.Chat.ID, prompt, quality, startedAt, err)
+	}
+	if err == nil {
+		outcome.Result = results[0]
+	}
+	return outcome
+}
+
+// formatServiceComparison 列出每個服務的耗時與錯誤，一個失敗不影響另一個的呈現
+func formatServiceComparison(outcomes []serviceOutcome) string {
+	lines := []string{"⚖️ <b>服務比較</b>", ""}
+	for _, outcome := range outcomes {
+		label := html.EscapeString(outcome.Label)
+		if outcome.Err != nil {
+			line := fmt.Sprintf("❌ %s · %.1fs\n<blockquote expandable>%s</blockquote>",
+				label, outcome.Latency.Seconds(), html.EscapeString(truncateError(outcome.Err.Error())))
+			if hint := friendlyError(outcome.Err); hint != "" {
+				line += "💡 " + hint
+			}
+			lines = append(lines, line)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("✅ %s · %.1fs", label, outcome.Latency.Seconds()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// findUserService 依 ID 取得使用者自己的服務，找不到時回傳 nil
+func (b *Bot) findUserService(userID, serviceID int64) (*database.UserService, error) {
+	services, err := b.db.GetUserServices(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range services {
+		if services[i].ID == serviceID {
+			return &services[i], nil
+		}
+	}
+	return nil, nil
+}
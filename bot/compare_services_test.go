@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tg-bawer/config"
+	"tg-bawer/database"
+	"tg-bawer/gemini"
+)
+
+func TestFormatServiceComparison(t *testing.T) {
+	text := formatServiceComparison([]serviceOutcome{
+		{Label: "main (#1)", Result: &gemini.ImageResult{}, Latency: 12300 * time.Millisecond},
+		{Label: "proxy <b> (#2)", Latency: 2 * time.Second, Err: errors.New("API error: 503 https://proxy.example.com/v1?key=secret")},
+	})
+	if !strings.Contains(text, "✅ main (#1) · 12.3s") {
+		t.Fatalf("expected success line with latency:\n%s", text)
+	}
+	if !strings.Contains(text, "❌ proxy &lt;b&gt; (#2) · 2.0s") {
+		t.Fatalf("expected escaped failure line:\n%s", text)
+	}
+	if !strings.Contains(text, "503") || strings.Contains(text, "secret") {
+		t.Fatalf("expected redacted error detail:\n%s", text)
+	}
+}
+
+func TestFindUserService(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db, config: &config.Config{}}
+
+	id, err := db.AddUserService(1, "custom", "proxy", "k", "https://proxy.example.com", "", "", "m", true)
+	if err != nil {
+		t.Fatalf("AddUserService failed: %v", err)
+	}
+
+	service, err := b.findUserService(1, id)
+	if err != nil || service == nil || service.Name != "proxy" {
+		t.Fatalf("expected to find service, got %+v (%v)", service, err)
+	}
+	if cfg := serviceConfigFromUserService(service); cfg.BaseURL != "https://proxy.example.com" || cfg.Model != "m" {
+		t.Fatalf("unexpected service config %+v", cfg)
+	}
+	if other, err := b.findUserService(2, id); err != nil || other != nil {
+		t.Fatalf("expected other users not to see the service, got %+v (%v)", other, err)
+	}
+}
@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// slotPositionInterval 排隊中多久重新回報一次順位，避免頻繁編輯訊息
+const slotPositionInterval = 5 * time.Second
+
+// slotQueue 先到先得的全域生成名額，名額用完時依序排隊
+type slotQueue struct {
+	mu       sync.Mutex
+	free     int
+	waiters  []chan struct{}
+	interval time.Duration
+}
+
+func newSlotQueue(size int) *slotQueue {
+	if size <= 0 {
+		size = 1
+	}
+	return &slotQueue{free: size, interval: slotPositionInterval}
+}
+
+// acquire 等待並取得名額，回傳的函式用來釋放名額
+// 需要排隊時先以目前順位（1 代表下一個）呼叫 onWait，之後順位變動時再呼叫；onWait 可為 nil
+func (q *slotQueue) acquire(onWait func(position int)) func() {
+	q.mu.Lock()
+	if q.free > 0 && len(q.waiters) == 0 {
+		q.free--
+		q.mu.Unlock()
+		return q.releaser()
+	}
+	ready := make(chan struct{})
+	q.waiters = append(q.waiters, ready)
+	position := len(q.waiters)
+	q.mu.Unlock()
+
+	if onWait != nil {
+		onWait(position)
+	}
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ready:
+			return q.releaser()
+		case <-ticker.C:
+			if current := q.position(ready); current > 0 && current != position {
+				position = current
+				if onWait != nil {
+					onWait(position)
+				}
+			}
+		}
+	}
+}
+
+// position 排隊中的順位，已輪到時回傳 0
+func (q *slotQueue) position(ready chan struct{}) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, waiter := range q.waiters {
+		if waiter == ready {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// releaser 釋放名額：有人排隊時直接交給第一位，否則歸還；重複呼叫只生效一次
+func (q *slotQueue) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if len(q.waiters) > 0 {
+				next := q.waiters[0]
+				q.waiters = q.waiters[1:]
+				close(next)
+				return
+			}
+			q.free++
+		})
+	}
+}
+
+// acquireGenerationSlot 等待並取得一個全域生成名額，回傳的函式用來釋放名額
+// 未設定名額（例如測試中直接建立的 Bot）時不做限制
+func (b *Bot) acquireGenerationSlot() func() {
+	if b.generationSlots == nil {
+		return func() {}
+	}
+	return b.generationSlots.acquire(nil)
+}
+
+// acquireGenerationSlotWithStatus 同 acquireGenerationSlot，需要排隊時把處理中訊息改成目前順位
+// 取得名額後由呼叫端接著更新狀態訊息
+func (b *Bot) acquireGenerationSlotWithStatus(processingMsg tgbotapi.Message, lang string) func() {
+	if b.generationSlots == nil {
+		return func() {}
+	}
+	return b.generationSlots.acquire(func(position int) {
+		b.updateMessageMarkdown(processingMsg, tr(lang, "status.queued", position))
+	})
+}
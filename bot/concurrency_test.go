@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlotQueue_FIFOWithPositions(t *testing.T) {
+	q := newSlotQueue(1)
+	q.interval = time.Millisecond
+	release := q.acquire(nil)
+
+	var mu sync.Mutex
+	positions := map[int][]int{}
+	order := make(chan int, 3)
+	var finished sync.WaitGroup
+	for i := 1; i <= 3; i++ {
+		i := i
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+			done := q.acquire(func(position int) {
+				mu.Lock()
+				positions[i] = append(positions[i], position)
+				mu.Unlock()
+			})
+			order <- i
+			time.Sleep(5 * time.Millisecond)
+			done()
+		}()
+		// 等前一位排進隊伍，確保順序固定
+		deadline := time.Now().Add(time.Second)
+		for queued(q) < i && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	release()
+	release() // 重複釋放不應多給名額
+	for want := 1; want <= 3; want++ {
+		select {
+		case got := <-order:
+			if got != want {
+				t.Fatalf("expected waiter %d to run next, got %d", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("waiter %d never acquired a slot", want)
+		}
+	}
+
+	finished.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if p := positions[3]; len(p) == 0 || p[0] != 3 || p[len(p)-1] != 1 {
+		t.Fatalf("expected waiter 3 to move from position 3 to 1, got %v", p)
+	}
+	if p := positions[1]; len(p) != 1 || p[0] != 1 {
+		t.Fatalf("expected waiter 1 to report position 1 once, got %v", p)
+	}
+
+	// 全部釋放後名額歸還，不需要排隊
+	waited := false
+	q.acquire(func(int) { waited = true })()
+	if waited {
+		t.Fatal("expected a free slot after all waiters finished")
+	}
+}
+
+func queued(q *slotQueue) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiters)
+}
@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"tg-bawer/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// contentFilterRegexPrefix 規則以此開頭時視為正規表示式，否則為不分大小寫的子字串
+const contentFilterRegexPrefix = "re:"
+
+// contentFilterNotice 被擋下時回覆的訊息
+const contentFilterNotice = "🚫 內容不符合使用規範"
+
+// contentFilter 生成前的 Prompt 過濾，沒有規則時不啟用
+type contentFilter struct {
+	substrings []string
+	patterns   []*regexp.Regexp
+}
+
+// newContentFilter 編譯過濾規則，規則為空時回傳 nil
+func newContentFilter(rules []string) (*contentFilter, error) {
+	filter := &contentFilter{}
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if strings.HasPrefix(rule, contentFilterRegexPrefix) {
+			re, err := regexp.Compile(strings.TrimPrefix(rule, contentFilterRegexPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("invalid content filter %q: %w", rule, err)
+			}
+			filter.patterns = append(filter.patterns, re)
+			continue
+		}
+		filter.substrings = append(filter.substrings, strings.ToLower(rule))
+	}
+
+	if len(filter.substrings) == 0 && len(filter.patterns) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// match 回傳第一條符合的規則
+func (f *contentFilter) match(prompt string) (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	lower := strings.ToLower(prompt)
+	for _, sub := range f.substrings {
+		if strings.Contains(lower, sub) {
+			return sub, true
+		}
+	}
+	for _, re := range f.patterns {
+		if re.MatchString(prompt) {
+			return contentFilterRegexPrefix + re.String(), true
+		}
+	}
+	return "", false
+}
+
+// rejectBlockedPrompt Prompt 符合過濾規則時回覆使用者並記錄到 generation_log，回傳 true 代表應停止生成
+func (b *Bot) rejectBlockedPrompt(msg *tgbotapi.Message, prompt, quality string) bool {
+	rule, blocked := b.contentFilter.match(prompt)
+	if !blocked {
+		return false
+	}
+
+	log.Printf("[內容過濾] 擋下使用者 %d 的 Prompt（規則 %s）", msg.From.ID, rule)
+	if _, err := b.db.LogGeneration(&database.GenerationLog{
+		UserID:  msg.From.ID,
+		ChatID:  msg.Chat.ID,
+		Prompt:  prompt,
+		Quality: quality,
+		Status:  database.GenerationStatusBlocked,
+		Error:   "content filter: " + rule,
+	}); err != nil {
+		log.Printf("記錄被擋下的請求失敗: %v", err)
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, contentFilterNotice)
+	reply.ReplyToMessageID = msg.MessageID
+	b.api.Send(reply)
+	return true
+}
@@ -0,0 +1,45 @@
+package bot
+
+import "testing"
+
+func TestContentFilter_Match(t *testing.T) {
+	filter, err := newContentFilter([]string{" Banned ", "", `re:(?i)bad\s*word`})
+	if err != nil {
+		t.Fatalf("newContentFilter failed: %v", err)
+	}
+
+	cases := []struct {
+		prompt string
+		rule   string
+		match  bool
+	}{
+		{"draw something BANNED here", "banned", true},
+		{"a Bad  Word appears", `re:(?i)bad\s*word`, true},
+		{"翻譯這張漫畫", "", false},
+	}
+	for _, tc := range cases {
+		rule, ok := filter.match(tc.prompt)
+		if ok != tc.match || rule != tc.rule {
+			t.Fatalf("match(%q) = %q, %v; want %q, %v", tc.prompt, rule, ok, tc.rule, tc.match)
+		}
+	}
+}
+
+func TestContentFilter_EmptyRulesDisable(t *testing.T) {
+	filter, err := newContentFilter([]string{" ", ""})
+	if err != nil {
+		t.Fatalf("newContentFilter failed: %v", err)
+	}
+	if filter != nil {
+		t.Fatalf("expected nil filter for empty rules")
+	}
+	if _, ok := filter.match("anything"); ok {
+		t.Fatalf("nil filter should never match")
+	}
+}
+
+func TestContentFilter_InvalidRegex(t *testing.T) {
+	if _, err := newContentFilter([]string{"re:("}); err == nil {
+		t.Fatalf("expected error for invalid regex")
+	}
+}
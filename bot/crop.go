@@ -0,0 +1,253 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cropSessionTTL 等待使用者選擇區域的時間
+const cropSessionTTL = 10 * time.Minute
+
+// pendingCrop 使用者送出 @crop 後、選擇區域前暫存的請求
+type pendingCrop struct {
+	Image            gemini.DownloadedImage
+	Prompt           string
+	Quality          string
+	AspectRatio      string
+	Options          gemini.GenerationOptions
+	ReplyToMessageID int
+	CreatedAt        time.Time
+}
+
+// cropSessions 以「使用者:預覽訊息」為 key 暫存待選區域的請求
+type cropSessions struct {
+	sync.Mutex
+	pending map[string]*pendingCrop
+}
+
+func cropSessionKey(userID int64, messageID int) string {
+	return fmt.Sprintf("%d:%d", userID, messageID)
+}
+
+func (c *cropSessions) put(key string, p *pendingCrop) {
+	c.Lock()
+	defer c.Unlock()
+
+	// 順便清掉過期的請求
+	for k, v := range c.pending {
+		if time.Since(v.CreatedAt) > cropSessionTTL {
+			delete(c.pending, k)
+		}
+	}
+	c.pending[key] = p
+}
+
+// take 取出並移除請求，過期或不存在時回傳 nil
+func (c *cropSessions) take(key string) *pendingCrop {
+	c.Lock()
+	defer c.Unlock()
+
+	p, ok := c.pending[key]
+	if !ok {
+		return nil
+	}
+	delete(c.pending, key)
+	if time.Since(p.CreatedAt) > cropSessionTTL {
+		return nil
+	}
+	return p
+}
+
+// cropImage 將圖片切成 3x3，取出第 cell 格（1-9，由左到右、由上到下）
+func cropImage(data []byte, cell int) ([]byte, error) {
+	if cell < 1 || cell > 9 {
+		return nil, fmt.Errorf("invalid crop cell: %d", cell)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	row, col := (cell-1)/3, (cell-1)%3
+	rect := image.Rect(
+		bounds.Min.X+bounds.Dx()*col/3,
+		bounds.Min.Y+bounds.Dy()*row/3,
+		bounds.Min.X+bounds.Dx()*(col+1)/3,
+		bounds.Min.Y+bounds.Dy()*(row+1)/3,
+	)
+
+	var cropped image.Image
+	if sub, ok := src.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		cropped = sub.SubImage(rect)
+	} else {
+		rgba := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, rect.Min, draw.Src)
+		cropped = rgba
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, cropped); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawCropGrid 在圖片上畫出 3x3 格線作為選擇預覽
+func drawCropGrid(data []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), src, bounds.Min, draw.Src)
+
+	width := bounds.Dx() / 200
+	if width < 2 {
+		width = 2
+	}
+	line := image.NewUniform(color.RGBA{R: 255, A: 255})
+	for i := 1; i < 3; i++ {
+		x := bounds.Dx() * i / 3
+		y := bounds.Dy() * i / 3
+		draw.Draw(canvas, image.Rect(x-width/2, 0, x+width/2+1, bounds.Dy()), line, image.Point{}, draw.Src)
+		draw.Draw(canvas, image.Rect(0, y-width/2, bounds.Dx(), y+width/2+1), line, image.Point{}, draw.Src)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func cropKeyboard() tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for row := 0; row < 3; row++ {
+		var buttons []tgbotapi.InlineKeyboardButton
+		for col := 1; col <= 3; col++ {
+			cell := row*3 + col
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(cell), fmt.Sprintf("crop:%d", cell)))
+		}
+		rows = append(rows, buttons)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// startCropSelection 下載圖片並送出格線預覽，等使用者選擇區域
+func (b *Bot) startCropSelection(msg *tgbotapi.Message, fileID, prompt, quality, aspectRatio string, opts gemini.GenerationOptions) {
+	downloaded, err := b.downloadImagesByFileIDs([]string{fileID}, nil)
+	if err != nil {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ 下載圖片失敗："+err.Error())
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
+	preview, err := drawCropGrid(downloaded[0].Data)
+	if err != nil {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ 無法讀取圖片："+err.Error())
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
+	photo := tgbotapi.NewPhoto(msg.Chat.ID, tgbotapi.FileBytes{Name: "crop_grid.png", Bytes: preview})
+	photo.Caption = "✂️ 選擇要處理的區域（1-9，由左到右、由上到下）"
+	photo.ReplyToMessageID = msg.MessageID
+	photo.ReplyMarkup = cropKeyboard()
+	sent, err := b.api.Send(photo)
+	if err != nil {
+		log.Printf("發送裁切預覽失敗: %v", err)
+		return
+	}
+
+	b.crops.put(cropSessionKey(msg.From.ID, sent.MessageID), &pendingCrop{
+		Image:            downloaded[0],
+		Prompt:           prompt,
+		Quality:          quality,
+		AspectRatio:      aspectRatio,
+		Options:          opts,
+		ReplyToMessageID: msg.MessageID,
+		CreatedAt:        time.Now(),
+	})
+}
+
+// callbackCrop 使用者選擇區域後，只對該區域生成
+func (b *Bot) callbackCrop(callback *tgbotapi.CallbackQuery, cellStr string) {
+	cell, _ := strconv.Atoi(cellStr)
+	pending := b.crops.take(cropSessionKey(callback.From.ID, callback.Message.MessageID))
+	if pending == nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "這個裁切請求已過期，請重新傳送 @crop"))
+		return
+	}
+
+	cropped, err := cropImage(pending.Image.Data, cell)
+	if err != nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "裁切失敗"))
+		return
+	}
+	b.api.Request(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("已選擇第 %d 格", cell)))
+	b.api.Request(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID,
+		tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	chatID := callback.Message.Chat.ID
+	serviceConfig, serviceName, err := b.resolveServiceConfig(callback.From.ID)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(chatID, "❌ "+err.Error()+"\n請先用 /service add 新增服務"))
+		return
+	}
+	gClient := b.newGeminiClient(serviceConfig)
+
+	status := tgbotapi.NewMessage(chatID, fmt.Sprintf("⏳ *生成圖片中...*\n\n🔌 服務：%s\n🎨 畫質：`%s`\n✂️ 區域：第 %d 格", markdownCode(serviceName), pending.Quality, cell))
+	status.ParseMode = "Markdown"
+	status.ReplyToMessageID = pending.ReplyToMessageID
+	processingMsg, err := b.api.Send(status)
+	if err != nil {
+		return
+	}
+
+	images := []gemini.DownloadedImage{{Data: cropped, MimeType: "image/png"}}
+	aspectRatio := resolveAspectRatio(pending.AspectRatio, "", images, b.ratioTolerance())
+
+	ctx, finishJob := b.jobs.start(activeJob{
+		UserID:      callback.From.ID,
+		ChatID:      chatID,
+		Prompt:      pending.Prompt,
+		Quality:     pending.Quality,
+		AspectRatio: aspectRatio,
+	})
+	defer finishJob()
+
+	result, logID, lastErr := b.generateWithFallback(ctx, callback.From.ID, chatID, gClient, images, pending.Prompt, pending.Quality, aspectRatio, pending.Options)
+	if lastErr != nil && ctx.Err() != nil {
+		b.updateMessage(processingMsg, "🛑 已取消這次生成")
+		return
+	}
+	if lastErr != nil {
+		b.updateMessageHTML(processingMsg, withErrorHint(defaultLang, fmt.Sprintf("❌ <b>處理失敗</b>\n\n<blockquote expandable>%s</blockquote>",
+			html.EscapeString(truncateError(lastErr.Error()))), lastErr))
+		return
+	}
+
+	b.api.Request(tgbotapi.NewDeleteMessage(chatID, processingMsg.MessageID))
+	b.sendGeneratedResult(b.userLang(callback.From), chatID, pending.ReplyToMessageID, pending.Quality, result, nil, logID)
+}
@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"testing"
+
+	"tg-bawer/config"
+	"tg-bawer/database"
+)
+
+func TestResolveDefaultPrompt_Precedence(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db, config: &config.Config{}}
+
+	if got := b.resolveDefaultPrompt(1); got != config.DefaultPrompt {
+		t.Fatalf("expected config default, got %q", got)
+	}
+
+	if err := db.SetUserDefaultPrompt(1, "自訂預設"); err != nil {
+		t.Fatalf("SetUserDefaultPrompt failed: %v", err)
+	}
+	if got := b.resolveDefaultPrompt(1); got != "自訂預設" {
+		t.Fatalf("expected user default prompt, got %q", got)
+	}
+
+	if err := db.SavePrompt(1, "saved", "保存的預設"); err != nil {
+		t.Fatalf("SavePrompt failed: %v", err)
+	}
+	prompts, _ := db.GetSavedPrompts(1)
+	if err := db.SetDefaultPrompt(1, prompts[0].ID); err != nil {
+		t.Fatalf("SetDefaultPrompt failed: %v", err)
+	}
+	if got := b.resolveDefaultPrompt(1); got != "保存的預設" {
+		t.Fatalf("expected saved default prompt, got %q", got)
+	}
+}
@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ratioAuto 代表清除預設比例，改回自動偵測 / 1:1
+const ratioAuto = "auto"
+
+// ratioOrder /settings 比例區塊上比例的順序
+var ratioOrder = []string{"1:1", "2:3", "3:2", "3:4", "4:3", "4:5", "5:4", "9:16", "16:9", "21:9"}
+
+// userDefaultRatio 使用者以 /setratio 設定的預設比例，未設定或讀取失敗時回傳空字串
+func (b *Bot) userDefaultRatio(userID int64) string {
+	ratio, err := b.db.GetUserDefaultRatio(userID)
+	if err != nil || !supportedRatios[ratio] {
+		return ""
+	}
+	return ratio
+}
+
+// ratioLabel 顯示用的預設比例，未設定時顯示自動
+func ratioLabel(ratio string) string {
+	if ratio == "" {
+		return "自動"
+	}
+	return ratio
+}
+
+// cmdSetRatio /setratio <比例>|reset：設定沒有 @ratio 也沒有圖片時使用的比例
+func (b *Bot) cmdSetRatio(msg *tgbotapi.Message) {
+	arg := strings.TrimSpace(msg.CommandArguments())
+	if arg == "" {
+		b.sendReplyMessage(msg, fmt.Sprintf("📐 目前預設比例：*%s*\n\n用法：`/setratio 16:9`，`/setratio reset` 清除\n支援：%s",
+			ratioLabel(b.userDefaultRatio(msg.From.ID)), strings.Join(ratioOrder, ", ")))
+		return
+	}
+
+	ratio := arg
+	if strings.EqualFold(arg, "reset") || strings.EqualFold(arg, ratioAuto) {
+		ratio = ""
+	} else if !supportedRatios[ratio] {
+		b.sendReplyMessage(msg, fmt.Sprintf("❌ 不支援的比例 `%s`\n\n支援：%s", markdownCode(arg), strings.Join(ratioOrder, ", ")))
+		return
+	}
+
+	if err := b.db.SetUserDefaultRatio(msg.From.ID, ratio); err != nil {
+		b.sendReplyMessage(msg, "❌ 設定失敗")
+		return
+	}
+	b.sendReplyMessage(msg, fmt.Sprintf("✅ 預設比例已設為 *%s*", ratioLabel(ratio)))
+}
+
+// callbackRatio 舊版 /settings 訊息上的比例按鈕，改由 settings 選單的比例區塊處理
+func (b *Bot) callbackRatio(callback *tgbotapi.CallbackQuery, value string) {
+	b.callbackSettings(callback, settingsRatio+":"+value)
+}
+
+// ratioKeyboardRows 比例選項，每列 5 個，最後一列為自動
+func ratioKeyboardRows(current string) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, ratio := range ratioOrder {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(qualityButton(ratio, current), "ratio:"+ratio))
+		if len(row) == 5 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	return append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(qualityButton(ratioLabel(""), ratioLabel(current)), "ratio:"+ratioAuto),
+	))
+}
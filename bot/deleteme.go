@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cmdDeleteMe 刪除使用者所有資料，需先按確認按鈕
+func (b *Bot) cmdDeleteMe(msg *tgbotapi.Message) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑 確認全部刪除", "deleteme:confirm"),
+			tgbotapi.NewInlineKeyboardButtonData("取消", "deleteme:cancel"),
+		),
+	)
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, "⚠️ *確定要刪除你的所有資料嗎？*\n\n"+
+		"將永久刪除：\n• 保存的 Prompt\n• 使用歷史\n• 個人設定\n• 服務設定（含 API Key）\n• 失敗重試佇列中的任務\n\n此操作無法復原。")
+	reply.ParseMode = "Markdown"
+	reply.ReplyMarkup = keyboard
+	b.api.Send(reply)
+}
+
+func (b *Bot) callbackDeleteMe(callback *tgbotapi.CallbackQuery, action string) {
+	switch action {
+	case "confirm":
+		if err := b.db.DeleteAllUserData(callback.From.ID); err != nil {
+			log.Printf("刪除使用者資料失敗 (user=%d): %v", callback.From.ID, err)
+			b.api.Request(tgbotapi.NewCallback(callback.ID, "刪除失敗"))
+			return
+		}
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "已刪除"))
+		b.updateMessage(*callback.Message, "✅ 已刪除你的所有資料：保存的 Prompt、使用歷史、個人設定、服務設定與重試任務")
+	default:
+		b.api.Request(tgbotapi.NewCallback(callback.ID, ""))
+		b.updateMessage(*callback.Message, "已取消，資料未被刪除")
+	}
+}
@@ -0,0 +1,183 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"strconv"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// diffThreshold RGB 三個通道差異總和（0–765）超過此值才視為有變化，避免壓縮雜訊被標出
+	diffThreshold = 48
+	// diffRecentLimit /diff 不帶參數時列出的最近結果數
+	diffRecentLimit = 10
+)
+
+// imageDiff 逐像素比較兩張圖片：相同處以淡化的灰階呈現，差異處以紅色標出，輸出 PNG
+// 尺寸不同時先把 b 縮放成 a 的大小再比較
+func imageDiff(a, b []byte) ([]byte, error) {
+	base, _, err := image.Decode(bytes.NewReader(a))
+	if err != nil {
+		return nil, fmt.Errorf("decode first image: %w", err)
+	}
+	other, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("decode second image: %w", err)
+	}
+
+	bounds := base.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if other.Bounds().Dx() != width || other.Bounds().Dy() != height {
+		other = scaleToSize(other, width, height)
+	}
+	otherMin := other.Bounds().Min
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			ca := color.RGBAModel.Convert(base.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+			cb := color.RGBAModel.Convert(other.At(otherMin.X+x, otherMin.Y+y)).(color.RGBA)
+			if colorDistance(ca, cb) > diffThreshold {
+				// 保留一點原本的明暗，方便看出變化的是什麼
+				dst.SetRGBA(x, y, color.RGBA{R: uint8(153 + int(ca.R)*2/5), G: uint8(int(ca.G) * 2 / 5), B: uint8(int(ca.B) * 2 / 5), A: 255})
+				continue
+			}
+			gray := uint8(160 + int(color.GrayModel.Convert(ca).(color.Gray).Y)*95/255)
+			dst.SetRGBA(x, y, color.RGBA{R: gray, G: gray, B: gray, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// colorDistance RGB 三個通道差異的總和
+func colorDistance(a, b color.RGBA) int {
+	return absInt(int(a.R)-int(b.R)) + absInt(int(a.G)-int(b.G)) + absInt(int(a.B)-int(b.B))
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// saveResultFileID 記錄生成紀錄送出的原畫質檔案，供之後 /diff 比較
+func (b *Bot) saveResultFileID(logID int64, sent tgbotapi.Message) {
+	if logID <= 0 || sent.Document == nil {
+		return
+	}
+	if err := b.db.SetGenerationResultFileID(logID, sent.Document.FileID); err != nil {
+		log.Printf("保存結果 FileID 失敗: %v", err)
+	}
+}
+
+// parseDiffArgs 解析 /diff 的兩個生成紀錄 ID（可帶 # 前綴），必須是兩個不同的正整數
+func parseDiffArgs(args string) (int64, int64, bool) {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	var ids [2]int64
+	for i, field := range fields {
+		id, err := strconv.ParseInt(strings.TrimPrefix(field, "#"), 10, 64)
+		if err != nil || id <= 0 {
+			return 0, 0, false
+		}
+		ids[i] = id
+	}
+	if ids[0] == ids[1] {
+		return 0, 0, false
+	}
+	return ids[0], ids[1], true
+}
+
+// cmdDiff /diff <ID> <ID>：標出自己兩次生成結果的差異；不帶參數時列出最近可比較的結果
+func (b *Bot) cmdDiff(msg *tgbotapi.Message) {
+	args := strings.TrimSpace(msg.CommandArguments())
+	if args == "" {
+		b.listDiffableResults(msg)
+		return
+	}
+
+	first, second, ok := parseDiffArgs(args)
+	if !ok {
+		b.sendReplyMessage(msg, "❌ 格式：/diff <ID> <ID>\n不帶參數可列出最近的生成結果")
+		return
+	}
+
+	fileIDs := make([]string, 0, 2)
+	for _, id := range []int64{first, second} {
+		entry, err := b.db.GetGenerationLog(id)
+		if err != nil || entry == nil || entry.UserID != msg.From.ID || entry.ResultFileID == "" {
+			b.sendReplyMessage(msg, fmt.Sprintf("❌ 找不到你的生成結果 #%d\n用 /diff 查看可比較的結果", id))
+			return
+		}
+		fileIDs = append(fileIDs, entry.ResultFileID)
+	}
+
+	images, err := b.downloadImagesByFileIDs(fileIDs, nil)
+	if err != nil {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, withErrorHint(defaultLang, fmt.Sprintf("❌ <b>下載結果失敗</b>\n\n<blockquote expandable>%s</blockquote>",
+			html.EscapeString(truncateError(err.Error()))), err))
+		reply.ReplyToMessageID = msg.MessageID
+		reply.ParseMode = "HTML"
+		b.api.Send(reply)
+		return
+	}
+
+	data, err := imageDiff(images[0].Data, images[1].Data)
+	if err != nil {
+		log.Printf("產生差異圖失敗: %v", err)
+		b.sendReplyMessage(msg, "❌ 無法比較這兩張圖片")
+		return
+	}
+
+	doc := tgbotapi.NewDocument(msg.Chat.ID, tgbotapi.FileBytes{Name: fmt.Sprintf("diff_%d_%d.png", first, second), Bytes: data})
+	doc.Caption = fmt.Sprintf("🔍 #%d ↔ #%d 的差異\n紅色為有變化的區域，底圖為 #%d", first, second, first)
+	doc.ReplyToMessageID = msg.MessageID
+	b.api.Send(doc)
+}
+
+// listDiffableResults 列出最近有保存原畫質檔案、可用 /diff 比較的生成結果
+func (b *Bot) listDiffableResults(msg *tgbotapi.Message) {
+	logs, err := b.db.GetGenerationLogs(msg.From.ID, diffRecentLimit*3)
+	if err != nil {
+		b.sendReplyMessage(msg, "❌ 讀取生成紀錄失敗")
+		return
+	}
+
+	var lines []string
+	for _, entry := range logs {
+		if entry.ResultFileID == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("#%d · %s · %s", entry.ID, entry.CreatedAt.Local().Format(scheduleTimeDisplay),
+			escapeMarkdown(truncateRunes(entry.Prompt, 40, "…"))))
+		if len(lines) == diffRecentLimit {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		b.sendReplyMessage(msg, "📭 目前沒有可比較的生成結果")
+		return
+	}
+
+	lines = append([]string{"🔍 *最近的生成結果*", ""}, lines...)
+	lines = append(lines, "", "比較：`/diff ID ID`")
+	b.sendReplyMessage(msg, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func solidPNG(t *testing.T, width, height int, fill color.RGBA, marks map[image.Point]color.RGBA) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, fill)
+		}
+	}
+	for p, c := range marks {
+		img.SetRGBA(p.X, p.Y, c)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func isDiffRed(c color.RGBA) bool {
+	return c.R > 150 && c.G < 110 && c.B < 110
+}
+
+func TestImageDiff_HighlightsChangedPixels(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	a := solidPNG(t, 4, 4, white, nil)
+	b := solidPNG(t, 4, 4, white, map[image.Point]color.RGBA{
+		{X: 1, Y: 2}: {A: 255},                         // 黑點：明顯變化
+		{X: 3, Y: 0}: {R: 250, G: 250, B: 250, A: 255}, // 輕微雜訊：不應被標出
+	})
+
+	data, err := imageDiff(a, b)
+	if err != nil {
+		t.Fatalf("imageDiff failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode diff failed: %v", err)
+	}
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 4 {
+		t.Fatalf("unexpected diff size %v", img.Bounds())
+	}
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			if want := x == 1 && y == 2; isDiffRed(c) != want {
+				t.Fatalf("pixel (%d,%d) = %v, highlighted=%v", x, y, c, want)
+			}
+			if !isDiffRed(c) && (c.R != c.G || c.G != c.B) {
+				t.Fatalf("unchanged pixel (%d,%d) should be gray, got %v", x, y, c)
+			}
+		}
+	}
+}
+
+func TestImageDiff_ScalesMismatchedSizes(t *testing.T) {
+	blue := color.RGBA{B: 255, A: 255}
+	a := solidPNG(t, 4, 2, blue, nil)
+	b := solidPNG(t, 8, 8, blue, nil)
+
+	data, err := imageDiff(a, b)
+	if err != nil {
+		t.Fatalf("imageDiff failed: %v", err)
+	}
+	img, _ := png.Decode(bytes.NewReader(data))
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 2 {
+		t.Fatalf("diff should use the first image size, got %v", img.Bounds())
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			if c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA); isDiffRed(c) {
+				t.Fatalf("same content should have no highlights, pixel (%d,%d) = %v", x, y, c)
+			}
+		}
+	}
+
+	if _, err := imageDiff(a, []byte("not an image")); err == nil {
+		t.Fatal("expected decode error")
+	}
+}
+
+func TestParseDiffArgs(t *testing.T) {
+	if first, second, ok := parseDiffArgs("#12 15"); !ok || first != 12 || second != 15 {
+		t.Fatalf("unexpected parse result %d %d %v", first, second, ok)
+	}
+	for _, args := range []string{"12", "12 12", "12 abc", "0 3", "1 2 3"} {
+		if _, _, ok := parseDiffArgs(args); ok {
+			t.Fatalf("expected %q to be rejected", args)
+		}
+	}
+}
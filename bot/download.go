@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// fileTooLargeError 檔案超過 MaxImageBytes
+type fileTooLargeError struct {
+	Size  int64 // 已知大小；串流讀取時為已讀到的位元組數
+	Limit int64
+}
+
+func (e *fileTooLargeError) Error() string {
+	return fmt.Sprintf("檔案過大（%s），上限為 %s", formatBytes(e.Size), formatBytes(e.Limit))
+}
+
+// readLimited 最多讀取 limit 位元組，超過時回傳 fileTooLargeError，避免超大檔案耗盡記憶體
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &fileTooLargeError{Size: int64(len(data)), Limit: limit}
+	}
+	return data, nil
+}
+
+func formatBytes(n int64) string {
+	const mb = 1024 * 1024
+	if n >= mb {
+		return fmt.Sprintf("%.1f MB", float64(n)/mb)
+	}
+	return fmt.Sprintf("%d KB", (n+1023)/1024)
+}
+
+const (
+	// downloadAttempts 下載 Telegram 檔案的最多嘗試次數（含第一次）
+	downloadAttempts = 3
+	// downloadBackoff 第一次重試前的等待時間，之後每次加倍
+	downloadBackoff = 500 * time.Millisecond
+	// downloadTimeout 單一檔案下載（含重試）的總時限
+	downloadTimeout = 2 * time.Minute
+)
+
+// downloadFileCtx 下載 Telegram 檔案內容，暫時性錯誤會重試，
+// 連線中斷時以 Range 從已收到的位置續傳
+func (b *Bot) downloadFileCtx(ctx context.Context, filePath string) ([]byte, error) {
+	url := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", b.config.BotToken, filePath)
+	return fetchResumable(ctx, http.DefaultClient, url, int64(b.config.MaxImageBytes), downloadAttempts, downloadBackoff)
+}
+
+// fetchResumable 下載 url，最多嘗試 attempts 次並在失敗之間指數退避；
+// 已收到的部分會保留，下一次以 Range 要求剩餘內容，伺服器不支援時從頭下載
+func fetchResumable(ctx context.Context, client *http.Client, url string, limit int64, attempts int, backoff time.Duration) ([]byte, error) {
+	var buf bytes.Buffer
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff << (attempt - 1)):
+			}
+		}
+
+		retry, err := fetchOnce(ctx, client, url, limit, &buf)
+		if err == nil {
+			return buf.Bytes(), nil
+		}
+		lastErr = err
+		if !retry || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// fetchOnce 送出一次請求並把內容接到 buf 後面，回傳錯誤是否值得重試
+func fetchOnce(ctx context.Context, client *http.Client, url string, limit int64, buf *bytes.Buffer) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	offset := int64(buf.Len())
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// 伺服器忽略 Range，只能從頭開始
+		buf.Reset()
+		offset = 0
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			buf.Reset()
+			return true, fmt.Errorf("續傳位置不符: %s", resp.Header.Get("Content-Range"))
+		}
+	default:
+		err := fmt.Errorf("下載失敗: HTTP %d", resp.StatusCode)
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+		return retry, err
+	}
+
+	if resp.ContentLength > 0 && offset+resp.ContentLength > limit {
+		return false, &fileTooLargeError{Size: offset + resp.ContentLength, Limit: limit}
+	}
+
+	_, err = io.Copy(buf, io.LimitReader(resp.Body, limit+1-offset))
+	if int64(buf.Len()) > limit {
+		return false, &fileTooLargeError{Size: int64(buf.Len()), Limit: limit}
+	}
+	if err != nil {
+		return true, err
+	}
+	return false, nil
+}
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadLimited(t *testing.T) {
+	data, err := readLimited(bytes.NewReader([]byte("12345")), 5)
+	if err != nil {
+		t.Fatalf("readLimited within limit failed: %v", err)
+	}
+	if string(data) != "12345" {
+		t.Fatalf("unexpected data %q", data)
+	}
+
+	// 來源很大也只會讀到 limit+1 位元組
+	huge := strings.NewReader(strings.Repeat("x", 10*1024*1024))
+	_, err = readLimited(huge, 1024)
+	var tooLarge *fileTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected fileTooLargeError, got %v", err)
+	}
+	if tooLarge.Size != 1025 || tooLarge.Limit != 1024 {
+		t.Fatalf("unexpected error fields %+v", tooLarge)
+	}
+	if remaining := huge.Len(); remaining < 10*1024*1024-64*1024 {
+		t.Fatalf("expected reader to stop early, %d bytes left", remaining)
+	}
+}
+
+func TestFileTooLargeError_Message(t *testing.T) {
+	err := &fileTooLargeError{Size: 25 * 1024 * 1024, Limit: 20 * 1024 * 1024}
+	if got := err.Error(); got != "檔案過大（25.0 MB），上限為 20.0 MB" {
+		t.Fatalf("unexpected message %q", got)
+	}
+}
+
+func TestFetchResumable_ResumesAfterDroppedConnection(t *testing.T) {
+	body := []byte(strings.Repeat("0123456789", 1000))
+	half := len(body) / 2
+
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+
+		if first {
+			// 宣告完整長度但只送一半就斷線
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(body[:half])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+
+		var start int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil {
+			t.Errorf("續傳請求缺少 Range: %q", r.Header.Get("Range"))
+			w.WriteHeader(http.StatusOK)
+			w.Write(body)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(body)-1, len(body)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(body[start:])
+	}))
+	defer server.Close()
+
+	data, err := fetchResumable(context.Background(), server.Client(), server.URL, int64(len(body)), 3, time.Millisecond)
+	if err != nil {
+		t.Fatalf("fetchResumable failed: %v", err)
+	}
+	if !bytes.Equal(data, body) {
+		t.Fatalf("內容不符: got %d bytes, want %d", len(data), len(body))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ranges) != 2 {
+		t.Fatalf("預期 2 次請求，實際 %d 次", len(ranges))
+	}
+	if ranges[0] != "" || ranges[1] != fmt.Sprintf("bytes=%d-", half) {
+		t.Fatalf("unexpected Range headers %q", ranges)
+	}
+}
+
+func TestFetchResumable_NoRetryOnClientError(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	if _, err := fetchResumable(context.Background(), server.Client(), server.URL, 1024, 3, time.Millisecond); err == nil {
+		t.Fatal("expected error for 404")
+	}
+	if calls != 1 {
+		t.Fatalf("404 不應重試，實際請求 %d 次", calls)
+	}
+}
+
+func TestFetchResumable_RespectsContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := fetchResumable(ctx, server.Client(), server.URL, 1024, 10, time.Second)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("逾時後仍繼續重試")
+	}
+}
@@ -0,0 +1,30 @@
+package bot
+
+import (
+	"context"
+	"html"
+	"log"
+
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// enhancePrompt 以文字模型擴寫 Prompt 並回覆使用者擴寫結果
+// 失敗時通知使用者並回傳原始 Prompt
+func (b *Bot) enhancePrompt(msg *tgbotapi.Message, gClient *gemini.Client, lang, prompt string) string {
+	enhanced, err := gClient.EnhancePrompt(context.Background(), prompt)
+	if err != nil {
+		log.Printf("Prompt 優化失敗: %v", err)
+		reply := tgbotapi.NewMessage(msg.Chat.ID, tr(lang, "enhance.failed"))
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return prompt
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, tr(lang, "enhance.done", html.EscapeString(enhanced)))
+	reply.ReplyToMessageID = msg.MessageID
+	reply.ParseMode = "HTML"
+	b.api.Send(reply)
+	return enhanced
+}
@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"tg-bawer/database"
+)
+
+const (
+	// eventQueueSize 待送出的事件上限，滿了就丟棄新事件，避免拖慢生成
+	eventQueueSize = 256
+	// eventMaxAttempts 單一事件最多 POST 的次數
+	eventMaxAttempts = 3
+)
+
+// generationEvent 每次生成結束後送到 EVENT_WEBHOOK_URL 的內容
+type generationEvent struct {
+	UserID       int64     `json:"user_id"`
+	Quality      string    `json:"quality"`
+	Success      bool      `json:"success"`
+	LatencyMs    int64     `json:"latency_ms"`
+	Timestamp    time.Time `json:"timestamp"`
+	PromptLength int       `json:"prompt_length"`
+	Prompt       string    `json:"prompt,omitempty"` // 預設不送出，需開啟 EVENT_WEBHOOK_INCLUDE_PROMPT
+}
+
+// eventDispatcher 以背景 worker 將事件 POST 到 webhook，失敗時重試
+type eventDispatcher struct {
+	url        string
+	client     *http.Client
+	events     chan generationEvent
+	retryDelay time.Duration
+}
+
+// newEventDispatcher 建立並啟動 dispatcher，url 為空時回傳 nil（不送出事件）
+func newEventDispatcher(url string) *eventDispatcher {
+	if url == "" {
+		return nil
+	}
+	d := &eventDispatcher{
+		url:        url,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		events:     make(chan generationEvent, eventQueueSize),
+		retryDelay: 2 * time.Second,
+	}
+	go d.run()
+	return d
+}
+
+// dispatch 不阻塞地排入事件，佇列已滿時丟棄
+func (d *eventDispatcher) dispatch(event generationEvent) {
+	if d == nil {
+		return
+	}
+	select {
+	case d.events <- event:
+	default:
+		log.Printf("[Webhook] 事件佇列已滿，丟棄事件 (user=%d)", event.UserID)
+	}
+}
+
+func (d *eventDispatcher) run() {
+	for event := range d.events {
+		var err error
+		for attempt := 1; attempt <= eventMaxAttempts; attempt++ {
+			if err = d.post(event); err == nil {
+				break
+			}
+			if attempt < eventMaxAttempts {
+				time.Sleep(d.retryDelay * time.Duration(attempt))
+			}
+		}
+		if err != nil {
+			log.Printf("[Webhook] 送出事件失敗 (user=%d): %v", event.UserID, err)
+		}
+	}
+}
+
+func (d *eventDispatcher) post(event generationEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Post(d.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordGeneration 在每次生成結束後呼叫，寫入 generation_log 並送出 webhook 事件，回傳紀錄 ID（寫入失敗時為 0）
+func (b *Bot) recordGeneration(userID, chatID int64, prompt, quality string, startedAt time.Time, genErr error) int64 {
+	latency := time.Since(startedAt).Milliseconds()
+
+	entry := &database.GenerationLog{
+		UserID:    userID,
+		ChatID:    chatID,
+		Prompt:    prompt,
+		Quality:   quality,
+		Status:    database.GenerationStatusSuccess,
+		LatencyMs: latency,
+	}
+	if genErr != nil {
+		entry.Status = database.GenerationStatusFailed
+		entry.Error = genErr.Error()
+	}
+	logID, err := b.db.LogGeneration(entry)
+	if err != nil {
+		log.Printf("記錄生成結果失敗: %v", err)
+		logID = 0
+	}
+
+	event := generationEvent{
+		UserID:       userID,
+		Quality:      quality,
+		Success:      genErr == nil,
+		LatencyMs:    latency,
+		Timestamp:    time.Now().UTC(),
+		PromptLength: utf8.RuneCountInString(prompt),
+	}
+	if b.config.EventWebhookIncludePrompt {
+		event.Prompt = prompt
+	}
+	b.events.dispatch(event)
+	return logID
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tg-bawer/config"
+	"tg-bawer/database"
+)
+
+func TestRecordGeneration_PostsRedactedEvent(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次回 500，確認會重試
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("invalid payload %s: %v", body, err)
+		}
+		received <- payload
+	}))
+	defer server.Close()
+
+	dispatcher := newEventDispatcher(server.URL)
+	dispatcher.retryDelay = time.Millisecond
+	b := &Bot{db: newEventsTestDB(t), config: &config.Config{}, events: dispatcher}
+
+	logID := b.recordGeneration(42, -100, "翻譯這張漫畫", "4K", time.Now().Add(-1500*time.Millisecond), errors.New("boom"))
+	entry, err := b.db.GetGenerationLog(logID)
+	if err != nil || entry == nil {
+		t.Fatalf("expected generation log %d, got %+v (err %v)", logID, entry, err)
+	}
+	if entry.Status != database.GenerationStatusFailed || entry.Error != "boom" || entry.ChatID != -100 {
+		t.Fatalf("unexpected generation log %+v", entry)
+	}
+
+	select {
+	case payload := <-received:
+		if payload["user_id"] != float64(42) || payload["quality"] != "4K" || payload["success"] != false {
+			t.Fatalf("unexpected payload %v", payload)
+		}
+		if payload["prompt_length"] != float64(6) {
+			t.Fatalf("expected rune prompt length 6, got %v", payload["prompt_length"])
+		}
+		if latency, _ := payload["latency_ms"].(float64); latency < 1500 {
+			t.Fatalf("unexpected latency %v", payload["latency_ms"])
+		}
+		if _, ok := payload["timestamp"].(string); !ok {
+			t.Fatalf("expected timestamp, got %v", payload["timestamp"])
+		}
+		if _, ok := payload["prompt"]; ok {
+			t.Fatalf("prompt should be redacted by default: %v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("webhook was not called")
+	}
+}
+
+func TestEventDispatcher_DisabledIsNoop(t *testing.T) {
+	b := &Bot{db: newEventsTestDB(t), config: &config.Config{}, events: newEventDispatcher("")}
+	// 未設定 webhook 時不應 panic 或阻塞，紀錄仍要寫入
+	if logID := b.recordGeneration(1, 1, "p", "2K", time.Now(), nil); logID == 0 {
+		t.Fatalf("expected generation log to be written")
+	}
+}
+
+func newEventsTestDB(t *testing.T) *database.Database {
+	t.Helper()
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
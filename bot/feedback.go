@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bawer/database"
+)
+
+// statsTopPrompts /stats 中列出的評價最佳 Prompt 數量
+const statsTopPrompts = 5
+
+// rateKeyboard 生成結果下方的 👍/👎 按鈕，rating 為目前評分（再按一次同一顆會取消）
+func rateKeyboard(logID int64, rating int) tgbotapi.InlineKeyboardMarkup {
+	up, down := "👍", "👎"
+	switch rating {
+	case 1:
+		up = "✅ " + up
+	case -1:
+		down = "✅ " + down
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(up, fmt.Sprintf("rate:%d:up", logID)),
+			tgbotapi.NewInlineKeyboardButtonData(down, fmt.Sprintf("rate:%d:down", logID)),
+		),
+	)
+}
+
+// parseRateValue 解析 rate callback 的 "<logID>:up|down"
+func parseRateValue(value string) (int64, int, bool) {
+	idStr, dir, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, 0, false
+	}
+	logID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || logID <= 0 {
+		return 0, 0, false
+	}
+	switch dir {
+	case "up":
+		return logID, 1, true
+	case "down":
+		return logID, -1, true
+	}
+	return 0, 0, false
+}
+
+// callbackRate 記錄 👍/👎，只有發起該次生成的使用者可以評分
+func (b *Bot) callbackRate(callback *tgbotapi.CallbackQuery, value string) {
+	logID, rating, ok := parseRateValue(value)
+	if !ok {
+		return
+	}
+
+	entry, err := b.db.GetGenerationLog(logID)
+	if err != nil || entry == nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "❌ 找不到這次生成的紀錄"))
+		return
+	}
+	if entry.UserID != callback.From.ID {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "⛔ 只有發起生成的人可以評分"))
+		return
+	}
+
+	// 再按一次相同評分視為取消
+	if entry.Rating == rating {
+		rating = 0
+	}
+	if err := b.db.RateGeneration(logID, rating); err != nil {
+		log.Printf("記錄評分失敗 (log=%d): %v", logID, err)
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "❌ 評分失敗"))
+		return
+	}
+
+	notice := "已取消評分"
+	if rating != 0 {
+		notice = "感謝回饋！"
+	}
+	b.api.Request(tgbotapi.NewCallback(callback.ID, notice))
+	b.api.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, b.resultKeyboard(logID, rating)))
+}
+
+// cmdStats /stats：顯示自己的生成統計與評分；管理員可用 /stats all 查看全體
+func (b *Bot) cmdStats(msg *tgbotapi.Message) {
+	userID := msg.From.ID
+	title := "📊 <b>我的生成統計</b>"
+	if strings.EqualFold(strings.TrimSpace(msg.CommandArguments()), "all") && b.config.IsAdmin(msg.From.ID) {
+		userID = 0
+		title = "📊 <b>全體生成統計</b>"
+	}
+
+	stats, err := b.db.GetGenerationStats(userID, statsTopPrompts)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 讀取統計失敗："+err.Error()))
+		return
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, formatGenerationStats(title, stats))
+	reply.ParseMode = "HTML"
+	b.api.Send(reply)
+}
+
+// formatGenerationStats 將統計轉成 HTML 訊息
+func formatGenerationStats(title string, stats *database.GenerationStats) string {
+	lines := []string{title, ""}
+	if stats.Total == 0 {
+		return strings.Join(append(lines, "還沒有任何生成紀錄"), "\n")
+	}
+
+	lines = append(lines,
+		fmt.Sprintf("🖼️ 生成次數：%d（成功 %d／失敗 %d／擋下 %d）", stats.Total, stats.Success, stats.Failed, stats.Blocked),
+		fmt.Sprintf("⏱️ 平均耗時：%.1f 秒", float64(stats.AvgLatencyMs)/1000),
+		fmt.Sprintf("💬 評分：👍 %d／👎 %d", stats.Up, stats.Down),
+	)
+
+	if len(stats.ByQuality) > 0 {
+		lines = append(lines, "", "🎨 <b>各畫質</b>")
+		for _, q := range stats.ByQuality {
+			label := q.Key
+			if label == "" {
+				label = "未指定"
+			}
+			lines = append(lines, fmt.Sprintf("• <code>%s</code>：%d 次，👍 %d／👎 %d", html.EscapeString(label), q.Count, q.Up, q.Down))
+		}
+	}
+
+	if len(stats.TopPrompts) > 0 {
+		lines = append(lines, "", "🏆 <b>評價最佳的 Prompt</b>")
+		for i, p := range stats.TopPrompts {
+			lines = append(lines, fmt.Sprintf("%d. %s（👍 %d／👎 %d）", i+1, html.EscapeString(truncateRunes(p.Key, 40, "...")), p.Up, p.Down))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
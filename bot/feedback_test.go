@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"tg-bawer/database"
+)
+
+func TestParseRateValue(t *testing.T) {
+	tests := []struct {
+		value  string
+		id     int64
+		rating int
+		ok     bool
+	}{
+		{"12:up", 12, 1, true},
+		{"7:down", 7, -1, true},
+		{"7:sideways", 0, 0, false},
+		{"abc:up", 0, 0, false},
+		{"0:up", 0, 0, false},
+		{"12", 0, 0, false},
+	}
+	for _, tt := range tests {
+		id, rating, ok := parseRateValue(tt.value)
+		if id != tt.id || rating != tt.rating || ok != tt.ok {
+			t.Errorf("parseRateValue(%q) = %d, %d, %v; want %d, %d, %v", tt.value, id, rating, ok, tt.id, tt.rating, tt.ok)
+		}
+	}
+}
+
+func TestRateKeyboardMarksCurrentRating(t *testing.T) {
+	row := rateKeyboard(5, -1).InlineKeyboard[0]
+	if row[0].Text != "👍" || row[1].Text != "✅ 👎" {
+		t.Fatalf("unexpected buttons %q %q", row[0].Text, row[1].Text)
+	}
+	if *row[0].CallbackData != "rate:5:up" || *row[1].CallbackData != "rate:5:down" {
+		t.Fatalf("unexpected callback data %q %q", *row[0].CallbackData, *row[1].CallbackData)
+	}
+}
+
+func TestFormatGenerationStats(t *testing.T) {
+	text := formatGenerationStats("📊", &database.GenerationStats{
+		Total: 3, Success: 2, Failed: 1, Up: 2, Down: 1, AvgLatencyMs: 2500,
+		ByQuality:  []database.GenerationGroupStats{{Key: "", Count: 1}, {Key: "4K", Count: 2, Up: 2}},
+		TopPrompts: []database.GenerationGroupStats{{Key: "<b>cat</b>", Count: 2, Up: 2}},
+	})
+	for _, want := range []string{"成功 2／失敗 1", "2.5 秒", "👍 2／👎 1", "<code>未指定</code>", "1. &lt;b&gt;cat&lt;/b&gt;"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in stats:\n%s", want, text)
+		}
+	}
+
+	if empty := formatGenerationStats("📊", &database.GenerationStats{}); !strings.Contains(empty, "還沒有任何生成紀錄") {
+		t.Fatalf("unexpected empty stats %q", empty)
+	}
+}
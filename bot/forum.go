@@ -0,0 +1,420 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tg-bawer/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 論壇主題（Bot API 6.3 的 message_thread_id）在 tgbotapi v5.5.1 中沒有對應欄位，
+// 改由包裝 HTTP client 從 getUpdates 與發送 API 的原始回應記下每則訊息所屬的主題，
+// 並在回覆主題中的訊息時補上 message_thread_id，讓狀態與結果留在使用者發訊息的主題
+
+// maxTrackedThreads 最多記住幾則訊息的主題，超過時整批清空
+const maxTrackedThreads = 5000
+
+type threadKey struct {
+	chatID    int64
+	messageID int
+}
+
+// threadIndex 訊息所屬的論壇主題 ID
+type threadIndex struct {
+	mu  sync.RWMutex
+	ids map[threadKey]int
+}
+
+func newThreadIndex() *threadIndex {
+	return &threadIndex{ids: make(map[threadKey]int)}
+}
+
+func (t *threadIndex) record(chatID int64, messageID, threadID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.ids) >= maxTrackedThreads {
+		t.ids = make(map[threadKey]int)
+	}
+	t.ids[threadKey{chatID: chatID, messageID: messageID}] = threadID
+}
+
+// lookup 回傳訊息所屬的主題 ID，不是主題訊息或 t 為 nil 時回傳 0
+func (t *threadIndex) lookup(chatID int64, messageID int) int {
+	if t == nil {
+		return 0
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.ids[threadKey{chatID: chatID, messageID: messageID}]
+}
+
+// forumMessage API 回應的訊息中與主題有關的欄位
+type forumMessage struct {
+	MessageID       int  `json:"message_id"`
+	MessageThreadID int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+	Chat            struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	ReplyToMessage *forumMessage `json:"reply_to_message"`
+}
+
+// recordMessage 記下主題訊息與它回覆的訊息；回覆串（非論壇主題）的 message_thread_id 不處理
+func (t *threadIndex) recordMessage(msg *forumMessage) {
+	if msg == nil || !msg.IsTopicMessage || msg.MessageThreadID == 0 {
+		return
+	}
+	t.record(msg.Chat.ID, msg.MessageID, msg.MessageThreadID)
+	// 結果常以 reply_to_message（例如被回覆的圖片）為回覆目標，它和觸發的訊息在同一個主題
+	if reply := msg.ReplyToMessage; reply != nil && reply.MessageID != 0 {
+		t.record(msg.Chat.ID, reply.MessageID, msg.MessageThreadID)
+	}
+}
+
+// recordUpdates 從 getUpdates 的回應記下主題訊息（一般訊息、它回覆的訊息與按鈕所在的訊息）
+func (t *threadIndex) recordUpdates(body []byte) {
+	var resp struct {
+		Result []struct {
+			Message       *forumMessage `json:"message"`
+			CallbackQuery *struct {
+				Message *forumMessage `json:"message"`
+			} `json:"callback_query"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return
+	}
+	for _, update := range resp.Result {
+		t.recordMessage(update.Message)
+		if update.CallbackQuery != nil {
+			t.recordMessage(update.CallbackQuery.Message)
+		}
+	}
+}
+
+// recordSent 從發送 API 的回應記下 Bot 自己送出的主題訊息（單則或 Media Group）
+func (t *threadIndex) recordSent(body []byte) {
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Result) == 0 {
+		return
+	}
+	var messages []*forumMessage
+	if resp.Result[0] == '[' {
+		json.Unmarshal(resp.Result, &messages)
+	} else {
+		var msg forumMessage
+		if json.Unmarshal(resp.Result, &msg) == nil {
+			messages = append(messages, &msg)
+		}
+	}
+	for _, msg := range messages {
+		t.recordMessage(msg)
+	}
+}
+
+// threadForReply 回覆目標是主題訊息時回傳主題 ID；已指定 message_thread_id 或無法判斷時回傳 0
+func (t *threadIndex) threadForReply(chatID, replyTo, existing string) int {
+	if existing != "" || replyTo == "" {
+		return 0
+	}
+	chat, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return 0
+	}
+	messageID, err := strconv.Atoi(replyTo)
+	if err != nil {
+		return 0
+	}
+	return t.lookup(chat, messageID)
+}
+
+// isSendMethod 會建立新訊息、可以帶 message_thread_id 的 API
+func isSendMethod(method string) bool {
+	return strings.HasPrefix(method, "send") && method != "sendChatAction" || method == "copyMessage"
+}
+
+// forumClient 包裝 tgbotapi 的 HTTP client，記錄主題訊息並替主題中的回覆補上 message_thread_id，
+// 同時把 tgbotapi 不認得的 message_reaction 更新交給 reactions
+type forumClient struct {
+	next      tgbotapi.HTTPClient
+	threads   *threadIndex
+	reactions func(messageReaction)
+}
+
+func newForumClient(threads *threadIndex) *forumClient {
+	return &forumClient{next: &http.Client{}, threads: threads}
+}
+
+func (c *forumClient) Do(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	sending := isSendMethod(method)
+	if sending {
+		if err := c.addThreadID(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.next.Do(req)
+	if err != nil || (!sending && method != "getUpdates") {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if sending {
+		c.threads.recordSent(body)
+	} else {
+		c.threads.recordUpdates(body)
+		if c.reactions != nil {
+			for _, reaction := range parseReactionUpdates(body) {
+				go c.reactions(reaction)
+			}
+		}
+	}
+	return resp, nil
+}
+
+// addThreadID 回覆主題中的訊息時，在表單（urlencoded 或 multipart）補上 message_thread_id
+func (c *forumClient) addThreadID(req *http.Request) error {
+	if req.Body == nil {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err == nil {
+			if threadID := c.threads.threadForReply(values.Get("chat_id"), values.Get("reply_to_message_id"), values.Get("message_thread_id")); threadID != 0 {
+				values.Set("message_thread_id", strconv.Itoa(threadID))
+				body = []byte(values.Encode())
+			}
+		}
+	case "multipart/form-data":
+		if rebuilt, contentType, ok := addMultipartThreadID(body, params["boundary"], c.threads); ok {
+			body = rebuilt
+			req.Header.Set("Content-Type", contentType)
+		}
+	}
+
+	setRequestBody(req, body)
+	return nil
+}
+
+// addMultipartThreadID 解析 multipart 表單，需要時加上 message_thread_id 欄位並重新編碼
+func addMultipartThreadID(body []byte, boundary string, threads *threadIndex) ([]byte, string, bool) {
+	type formPart struct {
+		header textproto.MIMEHeader
+		data   []byte
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	fields := make(map[string]string)
+	var parts []formPart
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", false
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, "", false
+		}
+		if part.FileName() == "" {
+			fields[part.FormName()] = string(data)
+		}
+		parts = append(parts, formPart{header: part.Header, data: data})
+	}
+
+	threadID := threads.threadForReply(fields["chat_id"], fields["reply_to_message_id"], fields["message_thread_id"])
+	if threadID == 0 {
+		return nil, "", false
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, part := range parts {
+		w, err := writer.CreatePart(part.header)
+		if err != nil {
+			return nil, "", false
+		}
+		w.Write(part.data)
+	}
+	if err := writer.WriteField("message_thread_id", strconv.Itoa(threadID)); err != nil {
+		return nil, "", false
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", false
+	}
+	return buf.Bytes(), writer.FormDataContentType(), true
+}
+
+// setRequestBody 替換請求內容並更新長度
+func setRequestBody(req *http.Request, body []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// messageThreadID 訊息所屬的論壇主題 ID，不在主題中時回傳 0
+func (b *Bot) messageThreadID(msg *tgbotapi.Message) int {
+	if msg == nil || msg.Chat == nil {
+		return 0
+	}
+	return b.threads.lookup(msg.Chat.ID, msg.MessageID)
+}
+
+// topicSettingsFor 訊息在論壇主題中且該主題有設定時回傳設定，否則回傳 nil
+func (b *Bot) topicSettingsFor(msg *tgbotapi.Message) *database.TopicSettings {
+	threadID := b.messageThreadID(msg)
+	if threadID == 0 {
+		return nil
+	}
+	settings, err := b.db.GetTopicSettings(msg.Chat.ID, threadID)
+	if err != nil {
+		log.Printf("Failed to load topic settings: %v", err)
+		return nil
+	}
+	if settings.DefaultPromptID == 0 && settings.DefaultQuality == "" {
+		return nil
+	}
+	return settings
+}
+
+// topicDefaultPrompt 主題設定的預設 Prompt 內容，未設定或 Prompt 已刪除時回傳空字串
+func (b *Bot) topicDefaultPrompt(settings *database.TopicSettings) (name, prompt string) {
+	if settings == nil || settings.DefaultPromptID == 0 {
+		return "", ""
+	}
+	saved, err := b.db.GetSavedPromptByID(settings.DefaultPromptID)
+	if err != nil || saved == nil {
+		return "", ""
+	}
+	return saved.Name, saved.Prompt
+}
+
+// cmdTopicSettings 論壇主題的預設 Prompt 與畫質，只有群組管理員可以修改
+// /topicsettings prompt <名稱或 ID>、/topicsettings quality <畫質>、/topicsettings reset
+func (b *Bot) cmdTopicSettings(msg *tgbotapi.Message) {
+	threadID := b.messageThreadID(msg)
+	if threadID == 0 {
+		b.sendReplyMessage(msg, "❌ 此指令只能在論壇群組的主題中使用\n整個群組的設定請用 /chatsettings")
+		return
+	}
+
+	settings, err := b.db.GetTopicSettings(msg.Chat.ID, threadID)
+	if err != nil {
+		b.sendReplyMessage(msg, "❌ 取得失敗")
+		return
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) > 0 {
+		if !b.isChatAdmin(msg.Chat.ID, msg.From.ID) {
+			b.sendReplyMessage(msg, "❌ 只有群組管理員可以修改主題設定")
+			return
+		}
+
+		switch strings.ToLower(args[0]) {
+		case "prompt":
+			settings.DefaultPromptID = 0
+			if len(args) > 1 {
+				prompt := b.findOwnPrompt(msg.From.ID, strings.Join(args[1:], " "))
+				if prompt == nil {
+					b.sendReplyMessage(msg, "❌ 找不到這個 Prompt，請用你在 /list 中保存的名稱或 ID")
+					return
+				}
+				settings.DefaultPromptID = prompt.ID
+			}
+		case "quality":
+			settings.DefaultQuality = ""
+			if len(args) > 1 {
+				quality, ok := supportedQualities[args[1]]
+				if !ok {
+					b.sendReplyMessage(msg, "❌ 畫質只支援 1K、2K、4K")
+					return
+				}
+				settings.DefaultQuality = quality
+			}
+		case "reset":
+			settings.DefaultPromptID = 0
+			settings.DefaultQuality = ""
+		default:
+			b.sendReplyMessage(msg, "用法：\n`/topicsettings prompt 名稱` 設定此主題的預設 Prompt（不帶名稱則清除）\n`/topicsettings quality 4K` 設定此主題的預設畫質\n`/topicsettings reset` 清除此主題的設定")
+			return
+		}
+
+		if err := b.db.SetTopicSettings(settings); err != nil {
+			b.sendReplyMessage(msg, "❌ 設定失敗")
+			return
+		}
+	}
+
+	b.sendReplyMessage(msg, b.topicSettingsText(settings))
+}
+
+// findOwnPrompt 依名稱或 ID 找使用者自己保存的 Prompt
+func (b *Bot) findOwnPrompt(userID int64, nameOrID string) *database.SavedPrompt {
+	if id, err := strconv.ParseInt(nameOrID, 10, 64); err == nil {
+		if prompt, _ := b.db.GetSavedPromptByID(id); prompt != nil && prompt.UserID == userID {
+			return prompt
+		}
+	}
+	prompts, err := b.db.GetSavedPrompts(userID)
+	if err != nil {
+		return nil
+	}
+	for i := range prompts {
+		if prompts[i].Name == nameOrID {
+			return &prompts[i]
+		}
+	}
+	return nil
+}
+
+func (b *Bot) topicSettingsText(settings *database.TopicSettings) string {
+	prompt := "未設定（使用群組或個人預設）"
+	if name, _ := b.topicDefaultPrompt(settings); name != "" {
+		prompt = markdownCode(name)
+	} else if settings.DefaultPromptID != 0 {
+		prompt = "（Prompt 已被刪除，使用群組或個人預設）"
+	}
+	quality := settings.DefaultQuality
+	if quality == "" {
+		quality = "未設定（使用群組或個人設定）"
+	}
+	return fmt.Sprintf("🧵 *此主題的設定*\n\n📝 預設 Prompt：%s\n🎨 預設畫質：%s\n\n主題設定優先於 /chatsettings 與個人設定", prompt, quality)
+}
@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"tg-bawer/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const forumUpdates = `{"ok":true,"result":[
+	{"update_id":1,"message":{"message_id":10,"message_thread_id":7,"is_topic_message":true,"chat":{"id":-100,"type":"supergroup"},"text":"hi"}},
+	{"update_id":2,"message":{"message_id":11,"message_thread_id":3,"chat":{"id":-100,"type":"supergroup"},"text":"reply thread, not a topic"}},
+	{"update_id":3,"callback_query":{"id":"q","data":"rate:1:up","message":{"message_id":12,"message_thread_id":9,"is_topic_message":true,"chat":{"id":-100,"type":"supergroup"}}}},
+	{"update_id":4,"message":{"message_id":14,"message_thread_id":7,"is_topic_message":true,"chat":{"id":-100,"type":"supergroup"},"text":".翻譯","reply_to_message":{"message_id":13,"chat":{"id":-100,"type":"supergroup"},"photo":[]}}}
+]}`
+
+// stubHTTPClient 固定回傳同一個回應內容
+type stubHTTPClient struct{ body string }
+
+func (s stubHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(s.body))}, nil
+}
+
+func TestForumClient_RecordsTopicMessagesFromGetUpdates(t *testing.T) {
+	threads := newThreadIndex()
+	client := &forumClient{next: stubHTTPClient{body: forumUpdates}, threads: threads}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.telegram.org/botTOKEN/getUpdates", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != forumUpdates {
+		t.Fatal("response body should be passed through unchanged")
+	}
+
+	if got := threads.lookup(-100, 10); got != 7 {
+		t.Fatalf("expected topic 7, got %d", got)
+	}
+	if got := threads.lookup(-100, 11); got != 0 {
+		t.Fatalf("non-topic thread should be ignored, got %d", got)
+	}
+	if got := threads.lookup(-100, 12); got != 9 {
+		t.Fatalf("expected callback message topic 9, got %d", got)
+	}
+	// 回覆的圖片在啟動後沒出現過，也要能從觸發訊息得知它所在的主題
+	if got := threads.lookup(-100, 13); got != 7 {
+		t.Fatalf("expected replied-to message topic 7, got %d", got)
+	}
+
+	// 其他 API 的回應不解析
+	req, _ = http.NewRequest(http.MethodPost, "https://api.telegram.org/botTOKEN/getChatMember", nil)
+	other := newThreadIndex()
+	(&forumClient{next: stubHTTPClient{body: forumUpdates}, threads: other}).Do(req)
+	if other.lookup(-100, 10) != 0 {
+		t.Fatal("only getUpdates and send responses should be recorded")
+	}
+}
+
+// captureHTTPClient 記下送出的請求內容並回傳固定回應
+type captureHTTPClient struct {
+	body        string
+	sent        []byte
+	contentType string
+}
+
+func (c *captureHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.sent, _ = io.ReadAll(req.Body)
+	c.contentType = req.Header.Get("Content-Type")
+	if int64(len(c.sent)) != req.ContentLength {
+		return nil, fmt.Errorf("content length %d does not match body %d", req.ContentLength, len(c.sent))
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(c.body))}, nil
+}
+
+func TestForumClient_AddsThreadIDToFormReplies(t *testing.T) {
+	threads := newThreadIndex()
+	threads.record(-100, 10, 7)
+	capture := &captureHTTPClient{body: `{"ok":true,"result":{"message_id":20,"message_thread_id":7,"is_topic_message":true,"chat":{"id":-100}}}`}
+	client := &forumClient{next: capture, threads: threads}
+
+	send := func(form url.Values) url.Values {
+		req, _ := http.NewRequest(http.MethodPost, "https://api.telegram.org/botTOKEN/sendMessage", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if _, err := client.Do(req); err != nil {
+			t.Fatalf("Do failed: %v", err)
+		}
+		sent, _ := url.ParseQuery(string(capture.sent))
+		return sent
+	}
+
+	sent := send(url.Values{"chat_id": {"-100"}, "reply_to_message_id": {"10"}, "text": {"處理中"}})
+	if sent.Get("message_thread_id") != "7" || sent.Get("text") != "處理中" {
+		t.Fatalf("expected thread 7 to be added, got %v", sent)
+	}
+	// Bot 自己送出的訊息也記下主題，之後回覆它（例如 Media Group 的說明）同樣留在主題
+	if got := threads.lookup(-100, 20); got != 7 {
+		t.Fatalf("expected sent message in topic 7, got %d", got)
+	}
+
+	if sent := send(url.Values{"chat_id": {"-100"}, "reply_to_message_id": {"11"}}); sent.Has("message_thread_id") {
+		t.Fatal("replies outside a topic should not get a thread ID")
+	}
+	if sent := send(url.Values{"chat_id": {"-100"}, "reply_to_message_id": {"10"}, "message_thread_id": {"3"}}); sent.Get("message_thread_id") != "3" {
+		t.Fatal("an explicit thread ID should be kept")
+	}
+}
+
+func TestForumClient_AddsThreadIDToMultipartReplies(t *testing.T) {
+	threads := newThreadIndex()
+	threads.record(-100, 10, 7)
+	capture := &captureHTTPClient{body: `{"ok":true,"result":[{"message_id":21,"message_thread_id":7,"is_topic_message":true,"chat":{"id":-100}},{"message_id":22,"message_thread_id":7,"is_topic_message":true,"chat":{"id":-100}}]}`}
+	client := &forumClient{next: capture, threads: threads}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("chat_id", "-100")
+	writer.WriteField("reply_to_message_id", "10")
+	file, _ := writer.CreateFormFile("photo", "result.png")
+	file.Write([]byte("\x89PNG binary"))
+	writer.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.telegram.org/botTOKEN/sendMediaGroup", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+
+	_, params, err := mime.ParseMediaType(capture.contentType)
+	if err != nil {
+		t.Fatalf("invalid content type %q: %v", capture.contentType, err)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(capture.sent), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("ReadForm failed: %v", err)
+	}
+	if got := form.Value["message_thread_id"]; len(got) != 1 || got[0] != "7" {
+		t.Fatalf("expected thread 7, got %v", got)
+	}
+	if len(form.File["photo"]) != 1 {
+		t.Fatal("file part should be kept")
+	}
+	photo, _ := form.File["photo"][0].Open()
+	data, _ := io.ReadAll(photo)
+	if string(data) != "\x89PNG binary" {
+		t.Fatalf("file content changed: %q", data)
+	}
+
+	if threads.lookup(-100, 21) != 7 || threads.lookup(-100, 22) != 7 {
+		t.Fatal("media group messages should be recorded")
+	}
+}
+
+func TestIsSendMethod(t *testing.T) {
+	for method, want := range map[string]bool{
+		"sendMessage":     true,
+		"sendDocument":    true,
+		"sendMediaGroup":  true,
+		"copyMessage":     true,
+		"sendChatAction":  false,
+		"editMessageText": false,
+		"getUpdates":      false,
+	} {
+		if got := isSendMethod(method); got != want {
+			t.Errorf("isSendMethod(%q) = %v, want %v", method, got, want)
+		}
+	}
+}
+
+func TestResolveDefaults_TopicTakesPrecedence(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db, threads: newThreadIndex()}
+
+	db.SetUserSettings(1, "1K")
+	db.SetChatSettings(&database.ChatSettings{ChatID: -100, Enabled: true, DefaultQuality: "2K", DefaultPrompt: "群組 Prompt"})
+	db.SavePrompt(1, "上色", "colorize")
+	prompts, _ := db.GetSavedPrompts(1)
+	db.SetTopicSettings(&database.TopicSettings{ChatID: -100, ThreadID: 7, DefaultPromptID: prompts[0].ID, DefaultQuality: "4K"})
+
+	chat := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	inTopic := &tgbotapi.Message{MessageID: 10, Chat: chat, From: &tgbotapi.User{ID: 1}}
+	general := &tgbotapi.Message{MessageID: 11, Chat: chat, From: &tgbotapi.User{ID: 1}}
+	b.threads.record(-100, 10, 7)
+
+	if q := b.resolveDefaultQuality(inTopic); q != "4K" {
+		t.Fatalf("expected topic quality, got %s", q)
+	}
+	if p := b.resolveMessageDefaultPrompt(inTopic); p != "colorize" {
+		t.Fatalf("expected topic prompt, got %q", p)
+	}
+	if q := b.resolveDefaultQuality(general); q != "2K" {
+		t.Fatalf("expected chat quality outside the topic, got %s", q)
+	}
+	if p := b.resolveMessageDefaultPrompt(general); p != "群組 Prompt" {
+		t.Fatalf("expected chat prompt outside the topic, got %q", p)
+	}
+
+	// 主題的 Prompt 被刪除後回到群組設定
+	db.DeletePrompt(1, prompts[0].ID)
+	if p := b.resolveMessageDefaultPrompt(inTopic); p != "群組 Prompt" {
+		t.Fatalf("expected fallback to chat prompt, got %q", p)
+	}
+}
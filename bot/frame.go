@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/gif"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// frameExtractTimeout 擷取單一畫面的逾時
+const frameExtractTimeout = 30 * time.Second
+
+// videoFrameSource 回覆的訊息是動畫或圓形影片時，回傳要擷取畫面的檔案
+func videoFrameSource(msg *tgbotapi.Message) (imageData, bool) {
+	switch {
+	case msg.Animation != nil:
+		mimeType := msg.Animation.MimeType
+		if mimeType == "" {
+			mimeType = "video/mp4"
+		}
+		return imageData{FileID: msg.Animation.FileID, FrameMimeType: mimeType}, true
+	case msg.VideoNote != nil:
+		return imageData{FileID: msg.VideoNote.FileID, FrameMimeType: "video/mp4"}, true
+	}
+	return imageData{}, false
+}
+
+// extractFirstFrame 取出動畫或影片的第一格畫面並轉成 PNG：
+// GIF 直接以 Go 解碼，影片則呼叫 ffmpeg（路徑為空或 - 時不支援）
+func extractFirstFrame(ctx context.Context, ffmpeg string, data []byte, mimeType string) ([]byte, error) {
+	if mimeType == "image/gif" {
+		img, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decode gif: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	if !strings.HasPrefix(mimeType, "video/") {
+		return nil, fmt.Errorf("unsupported media type: %s", mimeType)
+	}
+	if ffmpeg == "" || ffmpeg == "-" {
+		return nil, fmt.Errorf("ffmpeg is not configured")
+	}
+
+	dir, err := os.MkdirTemp("", "tg-bawer-frame-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input")
+	output := filepath.Join(dir, "frame.png")
+	if err := os.WriteFile(input, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-loglevel", "error", "-i", input, "-frames:v", "1", output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("extract frame: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.ReadFile(output)
+}
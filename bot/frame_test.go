@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestExtractFirstFrame_GIF(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	first := image.NewPaletted(image.Rect(0, 0, 4, 2), palette)
+	second := image.NewPaletted(image.Rect(0, 0, 4, 2), palette)
+	for i := range second.Pix {
+		second.Pix[i] = 1
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{first, second}, Delay: []int{10, 10}}); err != nil {
+		t.Fatalf("encode gif: %v", err)
+	}
+
+	frame, err := extractFirstFrame(context.Background(), "-", buf.Bytes(), "image/gif")
+	if err != nil {
+		t.Fatalf("extractFirstFrame failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatalf("expected PNG output: %v", err)
+	}
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 2 {
+		t.Fatalf("unexpected frame size %v", img.Bounds())
+	}
+	if r, g, b, _ := img.At(0, 0).RGBA(); r != 0 || g != 0 || b != 0 {
+		t.Fatalf("expected the first (black) frame")
+	}
+}
+
+func TestExtractFirstFrame_Unsupported(t *testing.T) {
+	if _, err := extractFirstFrame(context.Background(), "ffmpeg", []byte("x"), "application/zip"); err == nil {
+		t.Fatal("expected error for non-video input")
+	}
+	if _, err := extractFirstFrame(context.Background(), "-", []byte("x"), "video/mp4"); err == nil {
+		t.Fatal("expected error when ffmpeg is disabled")
+	}
+	if _, err := extractFirstFrame(context.Background(), "-", []byte("not a gif"), "image/gif"); err == nil {
+		t.Fatal("expected error for invalid gif")
+	}
+}
+
+func TestVideoFrameSource(t *testing.T) {
+	if _, ok := videoFrameSource(&tgbotapi.Message{}); ok {
+		t.Fatal("expected plain message to have no frame source")
+	}
+	source, ok := videoFrameSource(&tgbotapi.Message{Animation: &tgbotapi.Animation{FileID: "anim", MimeType: "image/gif"}})
+	if !ok || source.FileID != "anim" || source.FrameMimeType != "image/gif" {
+		t.Fatalf("unexpected animation source %+v", source)
+	}
+	source, ok = videoFrameSource(&tgbotapi.Message{VideoNote: &tgbotapi.VideoNote{FileID: "note"}})
+	if !ok || source.FileID != "note" || source.FrameMimeType != "video/mp4" {
+		t.Fatalf("unexpected video note source %+v", source)
+	}
+}
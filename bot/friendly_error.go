@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"errors"
+
+	"tg-bawer/gemini"
+)
+
+// friendlyError 依錯誤類型給使用者可以採取的下一步，無法分類時回傳空字串
+func friendlyError(err error) string {
+	return errorHint(defaultLang, err)
+}
+
+// errorHint 依使用者語言回傳 friendlyError 的提示
+func errorHint(lang string, err error) string {
+	var tooLarge *fileTooLargeError
+	switch {
+	case err == nil:
+		return ""
+	case gemini.IsSafetyBlocked(err):
+		return tr(lang, "hint.safety_blocked")
+	case gemini.IsRateLimited(err):
+		return tr(lang, "hint.rate_limited")
+	case gemini.IsInvalidImage(err):
+		return tr(lang, "hint.invalid_image")
+	case errors.As(err, &tooLarge):
+		return tr(lang, "hint.file_too_large")
+	case gemini.IsAuthError(err):
+		return tr(lang, "hint.auth")
+	case gemini.IsResourceError(err):
+		return tr(lang, "hint.resource")
+	}
+	return ""
+}
+
+// withErrorHint 在失敗訊息後附上 errorHint 的提示，沒有提示時原樣回傳
+func withErrorHint(lang, text string, err error) string {
+	if hint := errorHint(lang, err); hint != "" {
+		return text + "\n\n💡 " + hint
+	}
+	return text
+}
@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"tg-bawer/gemini"
+)
+
+func TestFriendlyError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"rate limited", &gemini.APIError{StatusCode: http.StatusTooManyRequests, Body: "quota"}, "配額用盡，請稍後或切換服務 (/service use)"},
+		{"safety", &gemini.SafetyBlockError{Reason: "IMAGE_SAFETY"}, "調整提示詞內容"},
+		{"invalid image", &gemini.APIError{StatusCode: http.StatusBadRequest, Body: "Unable to process input image."}, "請改用 JPEG/PNG"},
+		{"wrapped", fmt.Errorf("attempt 6: %w", &gemini.APIError{StatusCode: http.StatusTooManyRequests}), "配額用盡"},
+		{"too large", &fileTooLargeError{Size: 30 << 20, Limit: 20 << 20}, "壓縮"},
+		{"auth", &gemini.APIError{StatusCode: http.StatusUnauthorized, Body: "API key not valid"}, "API Key"},
+		{"timeout", context.DeadlineExceeded, "較低畫質"},
+		{"unknown", errors.New("boom"), ""},
+		{"nil", nil, ""},
+	}
+	for _, c := range cases {
+		got := friendlyError(c.err)
+		if c.want == "" && got != "" || !strings.Contains(got, c.want) {
+			t.Errorf("%s: friendlyError() = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWithErrorHint(t *testing.T) {
+	if got := withErrorHint(langEn, "❌ failed", &gemini.APIError{StatusCode: http.StatusTooManyRequests}); !strings.HasSuffix(got, "\n\n💡 "+tr(langEn, "hint.rate_limited")) {
+		t.Fatalf("expected English hint appended, got %q", got)
+	}
+	if got := withErrorHint(langZhHant, "❌ 失敗", errors.New("boom")); got != "❌ 失敗" {
+		t.Fatalf("unknown errors should not get a hint, got %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"log"
+	"regexp"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bawer/gemini"
+)
+
+// @temp 可接受的範圍（Gemini generationConfig.temperature）
+const (
+	minTemperature = 0.0
+	maxTemperature = 2.0
+)
+
+// modelNamePattern @model= 可接受的模型名稱，例如 gemini-3-pro-image-preview
+var modelNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// generationOptions 將 @variants、@temp、@seed、@model 轉為單次請求的覆寫；
+// @debug 只對管理員生效，其他使用者會被忽略
+func (b *Bot) generationOptions(params *ParsedParams, userID int64) gemini.GenerationOptions {
+	opts := gemini.GenerationOptions{
+		CandidateCount: clampVariants(params.Variants, b.config.MaxVariants),
+		Temperature:    params.Temperature,
+		Seed:           params.Seed,
+		Model:          params.Model,
+	}
+	if params.Debug && b.config.IsAdmin(userID) {
+		opts.Debug = &gemini.DebugDump{}
+	}
+	return opts
+}
+
+// sendDebugDump 將 @debug 收集的請求與回應寫入 log，並以文字檔回覆（金鑰已遮蔽）
+func (b *Bot) sendDebugDump(chatID int64, replyToMessageID int, dump *gemini.DebugDump) {
+	if dump == nil {
+		return
+	}
+	text := dump.String()
+	if text == "" {
+		text = "（沒有送出任何請求）"
+	}
+	log.Printf("[debug] chat=%d\n%s", chatID, text)
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: "debug.txt", Bytes: []byte(text)})
+	doc.Caption = "🐞 請求 / 回應紀錄（金鑰已遮蔽）"
+	doc.ReplyToMessageID = replyToMessageID
+	if _, err := b.api.Send(doc); err != nil {
+		log.Printf("發送 debug 紀錄失敗: %v", err)
+	}
+}
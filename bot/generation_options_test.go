@@ -0,0 +1,25 @@
+package bot
+
+import (
+	"testing"
+
+	"tg-bawer/config"
+)
+
+func TestGenerationOptions_DebugIsAdminOnly(t *testing.T) {
+	b := &Bot{config: &config.Config{AdminIDs: []int64{1}, MaxVariants: 4}}
+	params := parseTextParams("畫一隻貓 @debug @variants=9")
+	if !params.Debug || params.Prompt != "畫一隻貓" {
+		t.Fatalf("unexpected params %+v", params)
+	}
+
+	if opts := b.generationOptions(params, 1); opts.Debug == nil || opts.CandidateCount != 4 {
+		t.Fatalf("expected admin debug dump and capped variants, got %+v", opts)
+	}
+	if opts := b.generationOptions(params, 2); opts.Debug != nil {
+		t.Fatalf("@debug should be ignored for non-admins")
+	}
+	if opts := b.generationOptions(parseTextParams("畫一隻貓"), 1); opts.Debug != nil {
+		t.Fatalf("expected no debug dump without @debug")
+	}
+}
@@ -0,0 +1,395 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 支援的介面語言
+const (
+	langZhHant = "zh-Hant"
+	langEn     = "en"
+)
+
+// defaultLang 找不到對應語言時使用
+const defaultLang = langZhHant
+
+// messageCatalog 各語言的訊息，值為 fmt 格式字串
+var messageCatalog = map[string]map[string]string{
+	langZhHant: {
+		"help": `🍌✏️ *TG-Bawer*
+
+用 AI 畫你想要的圖！
+
+*基本用法：*
+• 直接輸入文字 → AI 根據描述生成圖片
+• 回覆圖片/貼圖並輸入文字 → AI 根據圖片進行編輯
+• 回覆文字並傳圖片/貼圖 → 同上，另一種操作方式
+• 上傳多張圖片後回覆其一 → AI 會抓取所有圖片處理
+
+*群組使用：*
+在群組中，文字訊息需以 ` + "`.`" + ` 開頭才會觸發
+例如：` + "`.幫我畫一隻貓 @16:9`" + `
+
+*參數設定（用 @ 符號，前後需有空格）：*
+• ` + "`@1:1`" + ` ` + "`@16:9`" + ` ` + "`@9:16`" + ` → 設定比例
+• ` + "`@4K`" + ` ` + "`@2K`" + ` ` + "`@1K`" + ` → 設定畫質
+• ` + "`@s`" + ` → 回覆群組圖片時只使用單張，不抓整組
+• ` + "`@voice`" + ` → 另外擷取圖中文字並生成語音
+• ` + "`@upscale`" + ` → 只放大並提升畫質（固定 4K，不翻譯）
+• ` + "`@enhance`" + ` → 先用文字模型把描述擴寫成詳細指令再生成
+• ` + "`@compare`" + ` → 另外發送原圖與結果的左右對照圖
+• ` + "`@crop`" + ` → 先選擇 3x3 中的一格，只處理該區域
+• ` + "`@pages=1-3`" + ` → 群組圖只處理指定頁（也可 ` + "`@pages=1,4,5`" + `）
+• ` + "`@variants=3`" + ` → 一次生成多張候選圖片挑選
+• ` + "`@temp=0.7`" + ` / ` + "`@seed=42`" + ` → 調整創意程度（0–2）／固定種子重現結果
+• ` + "`@model=名稱`" + ` → 這次改用指定的圖片模型
+• ` + "`@format=jpeg`" + ` → 輸出格式（png / jpeg，/setformat 設定預設）
+• ` + "`@jpegq=85`" + ` → 轉成 JPEG 時的品質（1–100，預設 90）
+
+*支援的比例：*
+` + "`@1:1`" + ` ` + "`@2:3`" + ` ` + "`@3:2`" + ` ` + "`@3:4`" + ` ` + "`@4:3`" + ` ` + "`@4:5`" + ` ` + "`@5:4`" + ` ` + "`@9:16`" + ` ` + "`@16:9`" + ` ` + "`@21:9`" + `
+
+💡 不指定比例時：
+• 有圖片時，使用最接近原圖的支援比例
+• 沒有圖片時，預設使用 1:1
+
+*範例：*
+` + "`畫一隻可愛的貓咪 @16:9 @4K`" + `
+
+*指令：*
+/save <名稱> <prompt> - 保存 Prompt
+/list [sort=name|recent] - 列出已保存的 Prompt
+/list preview - 查看各 Prompt 最近一次結果的縮圖
+/duplicate <名稱> <新名稱> - 複製已保存的 Prompt
+/library - 瀏覽公開 Prompt 庫
+/random [@參數] - 隨機使用一個保存的 Prompt（可回覆圖片）
+/history - 查看使用歷史
+/setdefault - 設定預設 Prompt
+/setprompt <內容> - 設定自訂預設 Prompt 文字
+/chatsettings - 群組共用設定（限管理員修改）
+/topicsettings - 論壇主題的預設 Prompt 與畫質（限管理員修改）
+/whoami - 查看目前生效的設定
+/lasterror - 查看最近一次失敗的完整錯誤
+/schedule <時間> <prompt> - 排程稍後生成（list / cancel）
+/redo <畫質> - 以其他畫質重新生成最近一次的請求
+/models - 列出目前服務可用的模型
+/compare ID1 ID2 [prompt] - 用兩個服務同時生成並比較
+/diff [ID ID] - 標出兩次生成結果的差異（不帶參數列出最近結果）
+/jobs - 查看進行中的生成並個別取消
+/stats - 查看生成統計與 👍/👎 評分
+/deleteme - 刪除你的所有資料
+/settings - 設定選單：畫質、比例、預設 Prompt、模型、語音、語言
+/setratio <比例> - 設定沒有圖片時的預設比例
+/setformat <格式> [品質] - 設定輸出格式（png / jpeg）與 JPEG 品質
+/delete - 刪除已保存的 Prompt
+/service - 服務管理（standard/custom/vertex）
+/ocr [@tiles=N] - 回覆圖片，只擷取文字不生成圖片（長圖可切段）
+/tts [語音] <文字> - 文字轉語音（也可回覆文字訊息）
+/translate [@lang=語言] <文字> - 只翻譯文字（也可回覆文字訊息）
+/voice - 選擇 TTS 語音
+/lang - 切換介面語言
+/help - 顯示幫助`,
+
+		"param.title":              "❌ *參數錯誤*\n\n",
+		"param.ratio":              "無效的比例：`%s`\n",
+		"param.ratio_supported":    "支援的比例：`@1:1` `@2:3` `@3:2` `@3:4` `@4:3` `@4:5` `@5:4` `@9:16` `@16:9` `@21:9`\n\n",
+		"param.quality":            "無效的畫質：`%s`\n",
+		"param.quality_supported":  "支援的畫質：`@1K` `@2K` `@4K`\n\n",
+		"param.pages":              "無效的頁數：`@%s`\n",
+		"param.pages_format":       "格式：`@pages=1-3` 或 `@pages=1,4,5`\n\n",
+		"param.variants":           "無效的候選數：`@%s`\n",
+		"param.variants_format":    "格式：`@variants=3`（至少 1）\n\n",
+		"param.temperature":        "無效的溫度：`@%s`\n",
+		"param.temperature_format": "格式：`@temp=0.7`（0 到 2 之間的數字，越高越有創意）\n\n",
+		"param.seed":               "無效的種子：`@%s`\n",
+		"param.seed_format":        "格式：`@seed=42`（整數，相同種子可重現結果，視模型支援）\n\n",
+		"param.model":              "無效的模型名稱：`@%s`\n",
+		"param.model_format":       "格式：`@model=gemini-3-pro-image-preview`（英數字、`.`、`-`、`_`）\n\n",
+		"param.format":             "不支援的輸出格式：`@%s`\n",
+		"param.format_supported":   "支援：`@format=png`、`@format=jpeg`\n\n",
+		"param.jpegq":              "無效的 JPEG 品質：`@%s`\n",
+		"param.jpegq_range":        "範圍：`@jpegq=1` – `@jpegq=100`\n\n",
+		"format.jpeg_note":         "🗜 JPEG 品質 %d",
+		"param.example":            "*正確範例：*\n`翻譯這張漫畫 @16:9 @4K`",
+
+		"label.default":          " (預設)",
+		"label.auto_detected":    " (自動偵測)",
+		"label.user_default":     " (個人預設)",
+		"label.detected_applied": " (偵測 %s，套用 %s)",
+		"label.detected_auto":    " (偵測 %s，交給模型決定)",
+		"ratio.note_applied":     "📐 偵測比例 %s，已套用最接近的 %s",
+		"ratio.note_auto":        "📐 偵測比例 %s，與支援比例差距過大，未指定比例",
+
+		"status.processing":          "⏳ *處理中...*\n\n🔌 服務：%s\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 圖片數量：%d",
+		"status.processing_sticker":  "⏳ *處理中...*\n\n🔌 服務：%s\n📏 比例：`%s`\n🎨 畫質：`%s`\n🎭 貼圖數量：%d",
+		"status.upscale":             "\n🔍 模式：放大",
+		"status.downloading":         "⏳ *處理中...*\n\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 下載圖片 %d/%d...",
+		"status.downloading_sticker": "⏳ *處理中...*\n\n📏 比例：`%s`\n🎨 畫質：`%s`\n🎭 下載貼圖 %d/%d...",
+		"status.generating":          "⏳ *生成圖片中...*\n\n🔌 服務：%s\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 圖片數量：%d",
+		"status.generating_sticker":  "⏳ *生成圖片中...*\n\n🔌 服務：%s\n📏 比例：`%s`\n🎨 畫質：`%s`\n🎭 貼圖數量：%d",
+		"status.queued":              "⏳ *排隊中...*\n\n目前生成的人比較多，你排在第 %d 位，輪到時會自動開始",
+		"status.user_queue_full":     "⏳ 佇列已滿，請等目前的請求完成後再試",
+		"status.user_queue_expired":  "⌛ 排隊等待過久，已略過此請求，請重新發送",
+		"status.attempt":             "⏳ *生成圖片中...* (嘗試 %d/6，畫質 %s)\n\n🔌 服務：%s\n📏 比例：`%s`\n🎨 畫質：`%s`\n📸 圖片數量：%d",
+		"status.attempt_sticker":     "⏳ *生成圖片中...* (嘗試 %d/6，畫質 %s)\n\n🔌 服務：%s\n📏 比例：`%s`\n🎨 畫質：`%s`\n🎭 貼圖數量：%d",
+
+		"error.get_image":        "❌ <b>處理失敗</b>\n\n無法取得圖片 %d\n\n<blockquote expandable>%s</blockquote>",
+		"error.download_image":   "❌ <b>處理失敗</b>\n\n下載圖片 %d 失敗\n\n<blockquote expandable>%s</blockquote>",
+		"error.extract_frame":    "❌ <b>處理失敗</b>\n\n無法從動畫或影片擷取畫面，目前只支援圖片、GIF 或靜態畫面\n\n<blockquote expandable>%s</blockquote>",
+		"error.get_sticker":      "❌ <b>處理失敗</b>\n\n無法取得貼圖 %d\n\n<blockquote expandable>%s</blockquote>",
+		"error.download_sticker": "❌ <b>處理失敗</b>\n\n下載貼圖 %d 失敗\n\n<blockquote expandable>%s</blockquote>",
+		"error.generation":       "❌ <b>處理失敗</b>（已自動重試）\n已加入失敗重試佇列，系統會定時自動再試。\n\n<blockquote expandable>%s</blockquote>",
+		"error.no_service":       "❌ %s\n請先用 /service add 新增服務",
+		"error.safety_blocked":   "🛡️ <b>內容被 Gemini 安全政策擋下</b>\n請調整 Prompt 或圖片後再試（不會加入重試佇列）。\n\n<blockquote expandable>%s</blockquote>",
+
+		"hint.rate_limited":   "配額用盡，請稍後或切換服務 (/service use)",
+		"hint.safety_blocked": "調整提示詞內容",
+		"hint.invalid_image":  "請改用 JPEG/PNG",
+		"hint.file_too_large": "請壓縮圖片或改傳較小的檔案",
+		"hint.auth":           "服務的 API Key 無效或沒有權限，請用 /service 檢查設定",
+		"hint.resource":       "服務暫時忙碌，可稍後再試或改用較低畫質（例如 @1K）",
+
+		"enhance.done":   "✨ <b>已優化 Prompt</b>\n\n<blockquote expandable>%s</blockquote>",
+		"enhance.failed": "⚠️ Prompt 優化失敗，改用原始 Prompt 生成",
+
+		"result.model_fallback": "🔁 主要模型無法使用，改由 %s 生成",
+
+		"lang.title":   "🌐 *選擇介面語言*\n\n目前語言：*%s*",
+		"lang.auto":    "跟隨 Telegram",
+		"lang.set":     "✅ 介面語言已設為 %s",
+		"lang.unknown": "未知的語言",
+		"lang.failed":  "設定失敗",
+	},
+	langEn: {
+		"help": `🍌✏️ *TG-Bawer*
+
+Draw what you want with AI!
+
+*Basics:*
+• Send text → AI generates an image from the description
+• Reply to an image/sticker with text → AI edits the image
+• Reply to text with an image/sticker → same as above
+• Upload several images and reply to one → AI processes all of them
+
+*In groups:*
+Text messages must start with ` + "`.`" + ` to trigger the bot
+e.g. ` + "`.draw a cat @16:9`" + `
+
+*Parameters (use @, separated by spaces):*
+• ` + "`@1:1`" + ` ` + "`@16:9`" + ` ` + "`@9:16`" + ` → aspect ratio
+• ` + "`@4K`" + ` ` + "`@2K`" + ` ` + "`@1K`" + ` → quality
+• ` + "`@s`" + ` → when replying to an album, use only that image
+• ` + "`@voice`" + ` → also extract the text and read it aloud
+• ` + "`@upscale`" + ` → only upscale and sharpen (always 4K, no translation)
+• ` + "`@enhance`" + ` → expand the prompt into a detailed instruction before generating
+• ` + "`@compare`" + ` → also send a side-by-side before/after image
+• ` + "`@crop`" + ` → pick one cell of a 3x3 grid and process only that region
+• ` + "`@pages=1-3`" + ` → only process the given album pages (or ` + "`@pages=1,4,5`" + `)
+• ` + "`@variants=3`" + ` → generate several candidates to choose from
+• ` + "`@temp=0.7`" + ` / ` + "`@seed=42`" + ` → adjust creativity (0–2) / fix the seed to reproduce results
+• ` + "`@model=name`" + ` → use a different image model for this request
+• ` + "`@format=jpeg`" + ` → output format (png / jpeg, default via /setformat)
+• ` + "`@jpegq=85`" + ` → JPEG quality when converting (1–100, default 90)
+
+*Supported ratios:*
+` + "`@1:1`" + ` ` + "`@2:3`" + ` ` + "`@3:2`" + ` ` + "`@3:4`" + ` ` + "`@4:3`" + ` ` + "`@4:5`" + ` ` + "`@5:4`" + ` ` + "`@9:16`" + ` ` + "`@16:9`" + ` ` + "`@21:9`" + `
+
+💡 Without a ratio:
+• With images, the closest supported ratio is used
+• Without images, 1:1 is used
+
+*Example:*
+` + "`draw a cute cat @16:9 @4K`" + `
+
+*Commands:*
+/save <name> <prompt> - save a prompt
+/list [sort=name|recent] - list saved prompts
+/list preview - show the latest result thumbnail of each prompt
+/duplicate <name> <newname> - copy a saved prompt
+/library - browse the public prompt library
+/random [@params] - run a random saved prompt (reply to an image to edit it)
+/history - show prompt history
+/setdefault - choose the default prompt
+/setprompt <text> - set a custom default prompt
+/chatsettings - group-wide settings (admins only)
+/topicsettings - per-topic prompt and quality in forum groups (admins only)
+/whoami - show the effective settings
+/lasterror - show the full error of the last failure
+/schedule <when> <prompt> - generate later (list / cancel)
+/redo <quality> - re-run the last generation at another quality
+/models - list models available on the current service
+/compare ID1 ID2 [prompt] - generate with two services side by side
+/diff [ID ID] - highlight what changed between two results (no args lists recent ones)
+/jobs - list your running generations and cancel them individually
+/stats - show generation stats and 👍/👎 ratings
+/deleteme - delete all of your data
+/settings - settings menu: quality, ratio, default prompt, model, voice, language
+/setratio <ratio> - set the default ratio when there is no image
+/setformat <format> [quality] - set the output format (png / jpeg) and JPEG quality
+/delete - delete a saved prompt
+/service - manage services (standard/custom/vertex)
+/ocr [@tiles=N] - reply to an image to only extract its text (split long pages)
+/tts [voice] <text> - text to speech (or reply to a text message)
+/translate [@lang=language] <text> - translate text only (or reply to a text message)
+/voice - choose the TTS voice
+/lang - change the interface language
+/help - show this help`,
+
+		"param.title":              "❌ *Invalid parameters*\n\n",
+		"param.ratio":              "Invalid ratio: `%s`\n",
+		"param.ratio_supported":    "Supported ratios: `@1:1` `@2:3` `@3:2` `@3:4` `@4:3` `@4:5` `@5:4` `@9:16` `@16:9` `@21:9`\n\n",
+		"param.quality":            "Invalid quality: `%s`\n",
+		"param.quality_supported":  "Supported qualities: `@1K` `@2K` `@4K`\n\n",
+		"param.pages":              "Invalid pages: `@%s`\n",
+		"param.pages_format":       "Format: `@pages=1-3` or `@pages=1,4,5`\n\n",
+		"param.variants":           "Invalid variants: `@%s`\n",
+		"param.variants_format":    "Format: `@variants=3` (at least 1)\n\n",
+		"param.temperature":        "Invalid temperature: `@%s`\n",
+		"param.temperature_format": "Format: `@temp=0.7` (a number from 0 to 2; higher is more creative)\n\n",
+		"param.seed":               "Invalid seed: `@%s`\n",
+		"param.seed_format":        "Format: `@seed=42` (an integer; the same seed reproduces results if the model supports it)\n\n",
+		"param.model":              "Invalid model name: `@%s`\n",
+		"param.model_format":       "Format: `@model=gemini-3-pro-image-preview` (letters, digits, `.`, `-`, `_`)\n\n",
+		"param.format":             "Unsupported output format: `@%s`\n",
+		"param.format_supported":   "Supported: `@format=png`, `@format=jpeg`\n\n",
+		"param.jpegq":              "Invalid JPEG quality: `@%s`\n",
+		"param.jpegq_range":        "Range: `@jpegq=1` – `@jpegq=100`\n\n",
+		"format.jpeg_note":         "🗜 JPEG quality %d",
+		"param.example":            "*Example:*\n`translate this manga @16:9 @4K`",
+
+		"label.default":          " (default)",
+		"label.auto_detected":    " (auto)",
+		"label.user_default":     " (your default)",
+		"label.detected_applied": " (detected %s, using %s)",
+		"label.detected_auto":    " (detected %s, left to the model)",
+		"ratio.note_applied":     "📐 Detected ratio %s, using the closest supported %s",
+		"ratio.note_auto":        "📐 Detected ratio %s is far from every supported ratio, so none was set",
+
+		"status.processing":          "⏳ *Processing...*\n\n🔌 Service: %s\n📏 Ratio: `%s`\n🎨 Quality: `%s`\n📸 Images: %d",
+		"status.processing_sticker":  "⏳ *Processing...*\n\n🔌 Service: %s\n📏 Ratio: `%s`\n🎨 Quality: `%s`\n🎭 Stickers: %d",
+		"status.upscale":             "\n🔍 Mode: upscale",
+		"status.downloading":         "⏳ *Processing...*\n\n📏 Ratio: `%s`\n🎨 Quality: `%s`\n📸 Downloading image %d/%d...",
+		"status.downloading_sticker": "⏳ *Processing...*\n\n📏 Ratio: `%s`\n🎨 Quality: `%s`\n🎭 Downloading sticker %d/%d...",
+		"status.generating":          "⏳ *Generating...*\n\n🔌 Service: %s\n📏 Ratio: `%s`\n🎨 Quality: `%s`\n📸 Images: %d",
+		"status.generating_sticker":  "⏳ *Generating...*\n\n🔌 Service: %s\n📏 Ratio: `%s`\n🎨 Quality: `%s`\n🎭 Stickers: %d",
+		"status.queued":              "⏳ *Queued...*\n\nThe bot is busy; you are number %d in line and will start automatically",
+		"status.user_queue_full":     "⏳ Your queue is full, please wait for the current requests to finish",
+		"status.user_queue_expired":  "⌛ This request waited too long in the queue and was skipped, please send it again",
+		"status.attempt":             "⏳ *Generating...* (attempt %d/6, quality %s)\n\n🔌 Service: %s\n📏 Ratio: `%s`\n🎨 Quality: `%s`\n📸 Images: %d",
+		"status.attempt_sticker":     "⏳ *Generating...* (attempt %d/6, quality %s)\n\n🔌 Service: %s\n📏 Ratio: `%s`\n🎨 Quality: `%s`\n🎭 Stickers: %d",
+
+		"error.get_image":        "❌ <b>Failed</b>\n\nCould not get image %d\n\n<blockquote expandable>%s</blockquote>",
+		"error.download_image":   "❌ <b>Failed</b>\n\nDownloading image %d failed\n\n<blockquote expandable>%s</blockquote>",
+		"error.extract_frame":    "❌ <b>Failed</b>\n\nCould not extract a frame from the animation or video; only images, GIFs and stills are supported\n\n<blockquote expandable>%s</blockquote>",
+		"error.get_sticker":      "❌ <b>Failed</b>\n\nCould not get sticker %d\n\n<blockquote expandable>%s</blockquote>",
+		"error.download_sticker": "❌ <b>Failed</b>\n\nDownloading sticker %d failed\n\n<blockquote expandable>%s</blockquote>",
+		"error.generation":       "❌ <b>Failed</b> (retried automatically)\nAdded to the retry queue; the bot will try again automatically.\n\n<blockquote expandable>%s</blockquote>",
+		"error.no_service":       "❌ %s\nAdd a service first with /service add",
+		"error.safety_blocked":   "🛡️ <b>Blocked by Gemini's safety policy</b>\nAdjust the prompt or image and try again (not added to the retry queue).\n\n<blockquote expandable>%s</blockquote>",
+
+		"hint.rate_limited":   "Quota exhausted; try again later or switch service (/service use)",
+		"hint.safety_blocked": "Adjust the prompt content",
+		"hint.invalid_image":  "Please use a JPEG/PNG image",
+		"hint.file_too_large": "Compress the image or send a smaller file",
+		"hint.auth":           "The service API key is invalid or lacks permission; check it with /service",
+		"hint.resource":       "The service is busy; try again later or use a lower quality (e.g. @1K)",
+
+		"enhance.done":   "✨ <b>Enhanced prompt</b>\n\n<blockquote expandable>%s</blockquote>",
+		"enhance.failed": "⚠️ Prompt enhancement failed; generating with the original prompt",
+
+		"result.model_fallback": "🔁 The primary model is unavailable; generated with %s",
+
+		"lang.title":   "🌐 *Interface language*\n\nCurrent: *%s*",
+		"lang.auto":    "Follow Telegram",
+		"lang.set":     "✅ Language set to %s",
+		"lang.unknown": "Unknown language",
+		"lang.failed":  "Failed to save",
+	},
+}
+
+// normalizeLang 將 Telegram 的 language_code（如 en-US、zh-hans）對應到支援的語言
+func normalizeLang(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "en" || strings.HasPrefix(code, "en-") {
+		return langEn
+	}
+	return defaultLang
+}
+
+// tr 依語言取出訊息並套用參數，缺少翻譯時退回預設語言
+func tr(langCode, key string, args ...interface{}) string {
+	text, ok := messageCatalog[normalizeLang(langCode)][key]
+	if !ok {
+		if text, ok = messageCatalog[defaultLang][key]; !ok {
+			log.Printf("缺少翻譯: %s", key)
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// userLang 取得使用者的介面語言：優先使用 user_settings 的設定，否則依 Telegram 的 language_code
+func (b *Bot) userLang(user *tgbotapi.User) string {
+	if user == nil {
+		return defaultLang
+	}
+	if lang, err := b.db.GetUserLanguage(user.ID); err == nil && lang != "" {
+		return lang
+	}
+	return user.LanguageCode
+}
+
+// paramErrorText 組出參數錯誤的說明
+func paramErrorText(lang string, params *ParsedParams) string {
+	text := tr(lang, "param.title")
+	if params.RatioError != "" {
+		text += tr(lang, "param.ratio", params.RatioError)
+		text += tr(lang, "param.ratio_supported")
+	}
+	if params.QualityError != "" {
+		text += tr(lang, "param.quality", params.QualityError)
+		text += tr(lang, "param.quality_supported")
+	}
+	if params.PagesError != "" {
+		text += tr(lang, "param.pages", params.PagesError)
+		text += tr(lang, "param.pages_format")
+	}
+	if params.VariantsError != "" {
+		text += tr(lang, "param.variants", params.VariantsError)
+		text += tr(lang, "param.variants_format")
+	}
+	if params.TemperatureError != "" {
+		text += tr(lang, "param.temperature", params.TemperatureError)
+		text += tr(lang, "param.temperature_format")
+	}
+	if params.SeedError != "" {
+		text += tr(lang, "param.seed", params.SeedError)
+		text += tr(lang, "param.seed_format")
+	}
+	if params.ModelError != "" {
+		text += tr(lang, "param.model", params.ModelError)
+		text += tr(lang, "param.model_format")
+	}
+	if params.FormatError != "" {
+		text += tr(lang, "param.format", params.FormatError)
+		text += tr(lang, "param.format_supported")
+	}
+	if params.JPEGQualityError != "" {
+		text += tr(lang, "param.jpegq", params.JPEGQualityError)
+		text += tr(lang, "param.jpegq_range")
+	}
+	return text + tr(lang, "param.example")
+}
+
+// safetyBlockedText Gemini 安全政策擋下時給使用者的說明
+func safetyBlockedText(lang string, err error) string {
+	return tr(lang, "error.safety_blocked", html.EscapeString(truncateError(err.Error())))
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"tg-bawer/config"
+	"tg-bawer/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestTr_SelectsLanguageAndFallsBack(t *testing.T) {
+	if got := tr("en-US", "param.quality", "5K"); got != "Invalid quality: `5K`\n" {
+		t.Fatalf("unexpected english text %q", got)
+	}
+	if got := tr("zh-hant", "param.quality", "5K"); got != "無效的畫質：`5K`\n" {
+		t.Fatalf("unexpected chinese text %q", got)
+	}
+	// 不支援的語言退回中文
+	if got := tr("ja", "param.quality", "5K"); got != "無效的畫質：`5K`\n" {
+		t.Fatalf("expected chinese fallback, got %q", got)
+	}
+	if got := tr("en", "missing.key"); got != "missing.key" {
+		t.Fatalf("expected key for missing translation, got %q", got)
+	}
+}
+
+func TestMessageCatalog_LanguagesHaveSameKeys(t *testing.T) {
+	for key := range messageCatalog[defaultLang] {
+		for lang, messages := range messageCatalog {
+			if _, ok := messages[key]; !ok {
+				t.Fatalf("language %s is missing key %s", lang, key)
+			}
+		}
+	}
+	for lang, messages := range messageCatalog {
+		if len(messages) != len(messageCatalog[defaultLang]) {
+			t.Fatalf("language %s has %d keys, want %d", lang, len(messages), len(messageCatalog[defaultLang]))
+		}
+	}
+}
+
+func TestUserLang_PrefersStoredOverride(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db, config: &config.Config{}}
+
+	user := &tgbotapi.User{ID: 1, LanguageCode: "en"}
+	if got := b.userLang(user); got != "en" {
+		t.Fatalf("expected telegram language, got %q", got)
+	}
+
+	if err := db.SetUserLanguage(1, langZhHant); err != nil {
+		t.Fatalf("SetUserLanguage failed: %v", err)
+	}
+	if got := b.userLang(user); got != langZhHant {
+		t.Fatalf("expected stored override, got %q", got)
+	}
+}
+
+func TestParamErrorText_Localized(t *testing.T) {
+	params := parseTextParams("draw @5K @pages=x")
+	text := paramErrorText("en", params)
+	for _, want := range []string{"Invalid parameters", "Invalid quality: `5K`", "Invalid pages: `@pages=x`"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in %q", want, text)
+		}
+	}
+	if strings.Contains(text, "Invalid ratio") {
+		t.Fatalf("unexpected ratio error in %q", text)
+	}
+}
+
+func TestLanguageLabelAndKeyboard(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db, config: &config.Config{}}
+	user := &tgbotapi.User{ID: 1, LanguageCode: "en-GB"}
+
+	if got := b.languageLabel(user); got != "Follow Telegram（English）" {
+		t.Fatalf("unexpected auto label %q", got)
+	}
+	keyboard := langKeyboard("en", "")
+	if got := keyboard.InlineKeyboard[1][0].Text; got != "● Follow Telegram" {
+		t.Fatalf("expected auto option selected, got %q", got)
+	}
+
+	if err := db.SetUserLanguage(1, langZhHant); err != nil {
+		t.Fatalf("SetUserLanguage failed: %v", err)
+	}
+	if got := b.languageLabel(user); got != "繁體中文" {
+		t.Fatalf("unexpected stored label %q", got)
+	}
+	keyboard = langKeyboard(langZhHant, langZhHant)
+	if got := keyboard.InlineKeyboard[0][0].Text; got != "● 繁體中文" {
+		t.Fatalf("expected zh-Hant selected, got %q", got)
+	}
+	if got := keyboard.InlineKeyboard[1][0].Text; got != "○ 跟隨 Telegram" {
+		t.Fatalf("expected auto option unselected, got %q", got)
+	}
+}
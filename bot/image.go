@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// composeSideBySide 將兩張圖片縮放到相同高度後左右並排，輸出 PNG
+func composeSideBySide(a, b []byte) ([]byte, error) {
+	left, _, err := image.Decode(bytes.NewReader(a))
+	if err != nil {
+		return nil, fmt.Errorf("decode left image: %w", err)
+	}
+	right, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("decode right image: %w", err)
+	}
+
+	// 以較高的圖為準，避免把生成結果縮小
+	height := left.Bounds().Dy()
+	if h := right.Bounds().Dy(); h > height {
+		height = h
+	}
+	left = scaleToHeight(left, height)
+	right = scaleToHeight(right, height)
+
+	leftWidth := left.Bounds().Dx()
+	canvas := image.NewRGBA(image.Rect(0, 0, leftWidth+right.Bounds().Dx(), height))
+	draw.Draw(canvas, image.Rect(0, 0, leftWidth, height), left, left.Bounds().Min, draw.Src)
+	draw.Draw(canvas, image.Rect(leftWidth, 0, canvas.Bounds().Dx(), height), right, right.Bounds().Min, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleToHeight 以最近鄰取樣等比例縮放到指定高度
+func scaleToHeight(src image.Image, height int) image.Image {
+	bounds := src.Bounds()
+	if bounds.Dy() == height || bounds.Dy() == 0 {
+		return src
+	}
+
+	width := bounds.Dx() * height / bounds.Dy()
+	if width < 1 {
+		width = 1
+	}
+	return scaleToSize(src, width, height)
+}
+
+// scaleToSize 以最近鄰取樣縮放到指定寬高（不保持比例）
+func scaleToSize(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/width
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+	return dst
+}
+
+// compareValidationError @compare 只支援單張原圖，不符合時回傳錯誤訊息
+func compareValidationError(params *ParsedParams, imageCount int) string {
+	if !params.Compare || imageCount == 1 {
+		return ""
+	}
+	return fmt.Sprintf("❌ `@compare` 只支援一張原圖（目前 %d 張）", imageCount)
+}
+
+// sendComparison 發送原圖與結果的左右對照圖（以檔案發送保留畫質）
+func (b *Bot) sendComparison(chatID int64, replyToMessageID int, source, result []byte) {
+	combined, err := composeSideBySide(source, result)
+	if err != nil {
+		log.Printf("合成對照圖失敗: %v", err)
+		reply := tgbotapi.NewMessage(chatID, "⚠️ 無法產生對照圖："+err.Error())
+		reply.ReplyToMessageID = replyToMessageID
+		b.api.Send(reply)
+		return
+	}
+
+	docMsg := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: "compare.png", Bytes: combined})
+	docMsg.ReplyToMessageID = replyToMessageID
+	docMsg.Caption = "🔍 原圖 / 結果對照"
+	b.api.Send(docMsg)
+}
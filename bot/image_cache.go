@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// imageCache 以 FileID 快取最近下載的圖片（LRU），重新生成或換畫質時不必重新下載；
+// 同時限制張數與總位元組數，超過任一上限時淘汰最久未使用的圖片
+type imageCache struct {
+	sync.Mutex
+	capacity int
+	maxBytes int        // <= 0 代表不限制總大小
+	size     int        // 目前快取的總位元組數
+	order    *list.List // 最前面為最近使用
+	entries  map[string]*list.Element
+}
+
+type imageCacheEntry struct {
+	fileID string
+	image  gemini.DownloadedImage
+}
+
+// newImageCache 建立最多 capacity 張、總計 maxBytes 位元組的快取，capacity <= 0 時回傳 nil（不快取）
+func newImageCache(capacity, maxBytes int) *imageCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &imageCache{
+		capacity: capacity,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *imageCache) get(fileID string) (gemini.DownloadedImage, bool) {
+	if c == nil {
+		return gemini.DownloadedImage{}, false
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.entries[fileID]
+	if !ok {
+		return gemini.DownloadedImage{}, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*imageCacheEntry).image, true
+}
+
+func (c *imageCache) add(fileID string, img gemini.DownloadedImage) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.entries[fileID]; ok {
+		c.removeElement(elem)
+	}
+	// 單張就超過總上限時不快取，避免把其他圖片全部擠掉
+	if c.maxBytes > 0 && len(img.Data) > c.maxBytes {
+		return
+	}
+
+	c.entries[fileID] = c.order.PushFront(&imageCacheEntry{fileID: fileID, image: img})
+	c.size += len(img.Data)
+	for c.order.Len() > c.capacity || (c.maxBytes > 0 && c.size > c.maxBytes) {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *imageCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*imageCacheEntry)
+	c.order.Remove(elem)
+	delete(c.entries, entry.fileID)
+	c.size -= len(entry.image.Data)
+}
+
+// 下載失敗的階段
+const (
+	downloadStageGet      = "get"
+	downloadStageDownload = "download"
+	downloadStageFrame    = "frame"
+)
+
+// imageDownloadError 記錄下載失敗的階段，讓呼叫端顯示對應的錯誤訊息
+type imageDownloadError struct {
+	stage string
+	err   error
+}
+
+func (e *imageDownloadError) Error() string { return e.err.Error() }
+func (e *imageDownloadError) Unwrap() error { return e.err }
+
+// downloadCachedImage 先查快取，未命中才從 Telegram 下載並放入快取；
+// frameMimeType 非空時只取第一格畫面，快取的也是擷取後的 PNG
+func (b *Bot) downloadCachedImage(fileID, frameMimeType string) (gemini.DownloadedImage, error) {
+	if cached, ok := b.imageCache.get(fileID); ok {
+		return cached, nil
+	}
+
+	file, err := b.api.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return gemini.DownloadedImage{}, &imageDownloadError{stage: downloadStageGet, err: err}
+	}
+
+	data, mimeType, err := b.downloadFile(file)
+	if err != nil {
+		return gemini.DownloadedImage{}, &imageDownloadError{stage: downloadStageDownload, err: err}
+	}
+
+	if frameMimeType != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), frameExtractTimeout)
+		data, err = extractFirstFrame(ctx, b.config.FfmpegPath, data, frameMimeType)
+		cancel()
+		if err != nil {
+			return gemini.DownloadedImage{}, &imageDownloadError{stage: downloadStageFrame, err: err}
+		}
+		mimeType = "image/png"
+	}
+
+	downloaded := gemini.DownloadedImage{Data: data, MimeType: mimeType}
+	b.imageCache.add(fileID, downloaded)
+	return downloaded, nil
+}
+
+// downloadErrorText 依失敗階段選擇錯誤訊息；getKey、downloadKey 的參數為第幾張與錯誤內容
+func downloadErrorText(lang string, err error, index int, getKey, downloadKey string) string {
+	var dlErr *imageDownloadError
+	if errors.As(err, &dlErr) {
+		switch dlErr.stage {
+		case downloadStageFrame:
+			return tr(lang, "error.extract_frame", truncateError(err.Error()))
+		case downloadStageGet:
+			return tr(lang, getKey, index, truncateError(err.Error()))
+		}
+	}
+	return tr(lang, downloadKey, index, truncateError(err.Error()))
+}
+
+// dedupeImages 依 FileID 去除重複的圖片，保留第一次出現的順序
+func dedupeImages(images []imageData) []imageData {
+	seen := make(map[string]bool, len(images))
+	unique := images[:0:0]
+	for _, img := range images {
+		if seen[img.FileID] {
+			continue
+		}
+		seen[img.FileID] = true
+		unique = append(unique, img)
+	}
+	return unique
+}
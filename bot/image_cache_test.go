@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"tg-bawer/gemini"
+)
+
+func TestImageCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newImageCache(2, 0)
+	cache.add("a", gemini.DownloadedImage{Data: []byte("a")})
+	cache.add("b", gemini.DownloadedImage{Data: []byte("b")})
+
+	// 讀取 a 讓它變成最近使用，接著加入 c 應淘汰 b
+	if _, ok := cache.get("a"); !ok {
+		t.Fatalf("expected a to be cached")
+	}
+	cache.add("c", gemini.DownloadedImage{Data: []byte("c")})
+
+	if _, ok := cache.get("b"); ok {
+		t.Fatalf("expected b to be evicted")
+	}
+	for _, id := range []string{"a", "c"} {
+		img, ok := cache.get(id)
+		if !ok || string(img.Data) != id {
+			t.Fatalf("expected %s to be cached, got %q %v", id, img.Data, ok)
+		}
+	}
+}
+
+func TestImageCache_DisabledIsNoop(t *testing.T) {
+	cache := newImageCache(0, 0)
+	cache.add("a", gemini.DownloadedImage{Data: []byte("a")})
+	if _, ok := cache.get("a"); ok {
+		t.Fatalf("expected disabled cache to miss")
+	}
+}
+
+func TestImageCache_EvictsByTotalBytes(t *testing.T) {
+	cache := newImageCache(10, 10)
+	cache.add("a", gemini.DownloadedImage{Data: make([]byte, 4)})
+	cache.add("b", gemini.DownloadedImage{Data: make([]byte, 4)})
+	cache.get("a")
+
+	// 加入 c 後總共 12 位元組，應淘汰最久未使用的 b
+	cache.add("c", gemini.DownloadedImage{Data: make([]byte, 4)})
+	if _, ok := cache.get("b"); ok {
+		t.Fatalf("expected b to be evicted by the byte budget")
+	}
+	if _, ok := cache.get("a"); !ok {
+		t.Fatalf("expected a to stay cached")
+	}
+	if cache.size != 8 {
+		t.Fatalf("expected 8 cached bytes, got %d", cache.size)
+	}
+
+	// 覆寫同一張時要重新計算大小
+	cache.add("a", gemini.DownloadedImage{Data: make([]byte, 6)})
+	if cache.size != 10 || cache.order.Len() != 2 {
+		t.Fatalf("expected 2 entries / 10 bytes after overwrite, got %d / %d", cache.order.Len(), cache.size)
+	}
+
+	// 單張超過上限時不快取，也不影響既有項目
+	cache.add("huge", gemini.DownloadedImage{Data: make([]byte, 11)})
+	if _, ok := cache.get("huge"); ok {
+		t.Fatalf("expected oversized image to be skipped")
+	}
+	if cache.order.Len() != 2 {
+		t.Fatalf("expected existing entries to survive, got %d", cache.order.Len())
+	}
+}
+
+func TestImageCache_ConcurrentAccess(t *testing.T) {
+	cache := newImageCache(4, 64)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := fmt.Sprintf("%d-%d", i, j%6)
+				cache.add(id, gemini.DownloadedImage{Data: make([]byte, 8)})
+				cache.get(id)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if cache.order.Len() > 4 || cache.size > 64 || cache.size != cache.order.Len()*8 {
+		t.Fatalf("cache bookkeeping out of sync: %d entries, %d bytes", cache.order.Len(), cache.size)
+	}
+}
+
+func TestDedupeImages(t *testing.T) {
+	got := dedupeImages([]imageData{{FileID: "x"}, {FileID: "y"}, {FileID: "x"}, {FileID: "z"}, {FileID: "y"}})
+	if len(got) != 3 || got[0].FileID != "x" || got[1].FileID != "y" || got[2].FileID != "z" {
+		t.Fatalf("unexpected dedupe result %+v", got)
+	}
+}
+
+func TestDownloadCachedImage_HitSkipsTelegram(t *testing.T) {
+	// api 為 nil：命中快取時不應呼叫 Telegram
+	b := &Bot{imageCache: newImageCache(2, 0)}
+	b.imageCache.add("a", gemini.DownloadedImage{Data: []byte("a"), MimeType: "image/png"})
+
+	img, err := b.downloadCachedImage("a", "")
+	if err != nil || string(img.Data) != "a" || img.MimeType != "image/png" {
+		t.Fatalf("expected cached image, got %q %q %v", img.Data, img.MimeType, err)
+	}
+}
+
+func TestDownloadErrorText_ByStage(t *testing.T) {
+	cause := fmt.Errorf("boom")
+	tests := []struct {
+		stage string
+		want  string
+	}{
+		{downloadStageGet, tr(langZhHant, "error.get_image", 2, "boom")},
+		{downloadStageDownload, tr(langZhHant, "error.download_image", 2, "boom")},
+		{downloadStageFrame, tr(langZhHant, "error.extract_frame", "boom")},
+	}
+	for _, tt := range tests {
+		err := &imageDownloadError{stage: tt.stage, err: cause}
+		if got := downloadErrorText(langZhHant, err, 2, "error.get_image", "error.download_image"); got != tt.want {
+			t.Errorf("stage %s: got %q, want %q", tt.stage, got, tt.want)
+		}
+	}
+}
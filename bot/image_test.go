@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodeTestPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("encode png failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestComposeSideBySide_ScalesToEqualHeight(t *testing.T) {
+	combined, err := composeSideBySide(encodeTestPNG(t, 100, 50), encodeTestPNG(t, 200, 200))
+	if err != nil {
+		t.Fatalf("composeSideBySide failed: %v", err)
+	}
+
+	cfg, err := png.DecodeConfig(bytes.NewReader(combined))
+	if err != nil {
+		t.Fatalf("decode combined failed: %v", err)
+	}
+	// 左圖 100x50 放大到高度 200 後寬 400，加上右圖寬 200
+	if cfg.Width != 600 || cfg.Height != 200 {
+		t.Fatalf("unexpected combined size %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestCompareValidationError(t *testing.T) {
+	params := parseTextParams("翻譯 @compare")
+	if !params.Compare {
+		t.Fatalf("expected Compare=true")
+	}
+	if compareValidationError(params, 1) != "" {
+		t.Fatalf("expected single image to be valid")
+	}
+	if compareValidationError(params, 2) == "" {
+		t.Fatalf("expected error for multiple images")
+	}
+	if compareValidationError(parseTextParams("翻譯"), 3) != "" {
+		t.Fatalf("expected no error without @compare")
+	}
+}
+
+func TestCropImage_SelectsGridCell(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 300, 90))
+	// 第 6 格（中間列最右邊）塗成白色
+	for y := 30; y < 60; y++ {
+		for x := 200; x < 300; x++ {
+			src.Set(x, y, color.White)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("encode png failed: %v", err)
+	}
+
+	cropped, err := cropImage(buf.Bytes(), 6)
+	if err != nil {
+		t.Fatalf("cropImage failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(cropped))
+	if err != nil {
+		t.Fatalf("decode cropped failed: %v", err)
+	}
+	if img.Bounds().Dx() != 100 || img.Bounds().Dy() != 30 {
+		t.Fatalf("unexpected cropped size %v", img.Bounds())
+	}
+	if r, _, _, _ := img.At(img.Bounds().Min.X, img.Bounds().Min.Y).RGBA(); r == 0 {
+		t.Fatalf("expected cropped region to be the white cell")
+	}
+
+	if _, err := cropImage(buf.Bytes(), 10); err == nil {
+		t.Fatalf("expected error for invalid cell")
+	}
+}
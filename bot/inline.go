@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bawer/database"
+)
+
+const (
+	// inlinePageSize 每次回覆的結果數，Telegram 上限為 50
+	inlinePageSize = 20
+	// inlineCacheSeconds 結果只快取給同一位使用者，保存新 Prompt 後很快就能搜到
+	inlineCacheSeconds = 10
+	// inlineMessageLimit Telegram 訊息文字上限
+	inlineMessageLimit = 4096
+)
+
+// handleInlineQuery 處理 @bot 關鍵字：搜尋使用者保存的 Prompt，選擇後直接以 Prompt 內容發送
+func (b *Bot) handleInlineQuery(query *tgbotapi.InlineQuery) {
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       []interface{}{},
+		CacheTime:     inlineCacheSeconds,
+		IsPersonal:    true,
+	}
+
+	if query.From == nil || !b.isAllowed(query.From.ID, nil) || (b.inMaintenance() && !b.config.IsAdmin(query.From.ID)) {
+		b.answerInlineQuery(answer)
+		return
+	}
+
+	offset, _ := strconv.Atoi(query.Offset)
+	if offset < 0 {
+		offset = 0
+	}
+	// 多取一筆判斷是否還有下一頁
+	prompts, err := b.db.SearchSavedPrompts(query.From.ID, strings.TrimSpace(query.Query), inlinePageSize+1, offset)
+	if err != nil {
+		log.Printf("搜尋 inline Prompt 失敗: %v", err)
+		b.answerInlineQuery(answer)
+		return
+	}
+
+	if len(prompts) > inlinePageSize {
+		prompts = prompts[:inlinePageSize]
+		answer.NextOffset = strconv.Itoa(offset + inlinePageSize)
+	}
+	answer.Results = inlinePromptResults(prompts)
+	if len(prompts) == 0 && offset == 0 {
+		answer.SwitchPMText = "📝 沒有符合的 Prompt，前往 Bot 保存"
+		answer.SwitchPMParameter = "inline"
+	}
+	b.answerInlineQuery(answer)
+}
+
+func (b *Bot) answerInlineQuery(answer tgbotapi.InlineConfig) {
+	if _, err := b.api.Request(answer); err != nil {
+		log.Printf("回覆 inline query 失敗: %v", err)
+	}
+}
+
+// inlinePromptResults 將保存的 Prompt 轉為文章結果，發送的訊息內容就是 Prompt 本身
+func inlinePromptResults(prompts []database.SavedPrompt) []interface{} {
+	results := make([]interface{}, 0, len(prompts))
+	for _, p := range prompts {
+		title := p.Name
+		if p.IsDefault {
+			title = "⭐ " + title
+		}
+		article := tgbotapi.NewInlineQueryResultArticle(
+			strconv.FormatInt(p.ID, 10),
+			title,
+			truncateRunes(p.Prompt, inlineMessageLimit-3, "..."),
+		)
+		article.Description = truncateRunes(p.Prompt, 100, "...")
+		results = append(results, article)
+	}
+	return results
+}
@@ -0,0 +1,35 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bawer/database"
+)
+
+func TestInlinePromptResults(t *testing.T) {
+	long := strings.Repeat("長", inlineMessageLimit+10)
+	results := inlinePromptResults([]database.SavedPrompt{
+		{ID: 7, Name: "漫畫", Prompt: "翻譯漫畫", IsDefault: true},
+		{ID: 8, Name: "long", Prompt: long},
+	})
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	first := results[0].(tgbotapi.InlineQueryResultArticle)
+	if first.ID != "7" || first.Title != "⭐ 漫畫" || first.Description != "翻譯漫畫" {
+		t.Fatalf("unexpected article %+v", first)
+	}
+	if content := first.InputMessageContent.(tgbotapi.InputTextMessageContent); content.Text != "翻譯漫畫" {
+		t.Fatalf("unexpected message text %q", content.Text)
+	}
+
+	second := results[1].(tgbotapi.InlineQueryResultArticle)
+	text := second.InputMessageContent.(tgbotapi.InputTextMessageContent).Text
+	if n := len([]rune(text)); n != inlineMessageLimit {
+		t.Fatalf("expected message text truncated to %d runes, got %d", inlineMessageLimit, n)
+	}
+}
@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// activeJob 一個進行中的生成請求
+type activeJob struct {
+	ID          int64
+	UserID      int64
+	ChatID      int64
+	Prompt      string
+	Quality     string
+	AspectRatio string
+	StartedAt   time.Time
+	cancel      context.CancelFunc
+}
+
+// jobRegistry 記錄進行中的生成，供 /jobs 顯示與個別取消
+type jobRegistry struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[int64]*activeJob
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: make(map[int64]*activeJob)}
+}
+
+// start 登記一個生成工作，回傳可被取消的 context 與完成時呼叫的函式
+func (r *jobRegistry) start(job activeJob) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mu.Lock()
+	r.nextID++
+	job.ID = r.nextID
+	job.StartedAt = time.Now()
+	job.cancel = cancel
+	r.jobs[job.ID] = &job
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.jobs, job.ID)
+		r.mu.Unlock()
+		cancel()
+	}
+}
+
+// list 依開始順序列出使用者進行中的工作
+func (r *jobRegistry) list(userID int64) []activeJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var jobs []activeJob
+	for _, job := range r.jobs {
+		if job.UserID == userID {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// cancel 取消使用者自己的工作，工作不存在或不屬於該使用者時回傳 false
+func (r *jobRegistry) cancel(userID, jobID int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[jobID]
+	if !ok || job.UserID != userID {
+		return false
+	}
+	job.cancel()
+	delete(r.jobs, jobID)
+	return true
+}
+
+// startJob 登記一次生成並回傳其 context，使用者可從 /jobs 取消
+func (b *Bot) startJob(msg *tgbotapi.Message, prompt, quality, aspectRatio string) (context.Context, func()) {
+	return b.jobs.start(activeJob{
+		UserID:      msg.From.ID,
+		ChatID:      msg.Chat.ID,
+		Prompt:      prompt,
+		Quality:     quality,
+		AspectRatio: aspectRatio,
+	})
+}
+
+// formatJobs 進行中工作的列表文字與每個工作的取消按鈕
+func formatJobs(jobs []activeJob, now time.Time) (string, *tgbotapi.InlineKeyboardMarkup) {
+	if len(jobs) == 0 {
+		return "📭 目前沒有進行中的生成", nil
+	}
+
+	lines := []string{fmt.Sprintf("⚙️ *進行中的生成*（%d 個）", len(jobs)), ""}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, job := range jobs {
+		ratio := job.AspectRatio
+		if ratio == "" {
+			ratio = "Auto"
+		}
+		lines = append(lines, fmt.Sprintf("#%d · %s · %s · %s\n%s", job.ID, formatQueueAge(now.Sub(job.StartedAt)),
+			job.Quality, ratio, escapeMarkdown(truncateRunes(job.Prompt, 40, "…"))))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🛑 取消 #%d", job.ID), fmt.Sprintf("job:%d", job.ID)),
+		))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return strings.Join(lines, "\n"), &keyboard
+}
+
+// cmdJobs /jobs：列出自己進行中的生成，並可個別取消
+func (b *Bot) cmdJobs(msg *tgbotapi.Message) {
+	text, keyboard := formatJobs(b.jobs.list(msg.From.ID), time.Now())
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ParseMode = "Markdown"
+	reply.ReplyToMessageID = msg.MessageID
+	if keyboard != nil {
+		reply.ReplyMarkup = *keyboard
+	}
+	b.api.Send(reply)
+}
+
+// callbackCancelJob 取消按鈕：取消指定工作並更新列表
+func (b *Bot) callbackCancelJob(callback *tgbotapi.CallbackQuery, value string) {
+	jobID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || !b.jobs.cancel(callback.From.ID, jobID) {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "這個工作已經結束"))
+	} else {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("🛑 已取消 #%d", jobID)))
+	}
+
+	if callback.Message == nil {
+		return
+	}
+	text, keyboard := formatJobs(b.jobs.list(callback.From.ID), time.Now())
+	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
+	edit.ParseMode = "Markdown"
+	edit.ReplyMarkup = keyboard
+	b.api.Send(edit)
+}
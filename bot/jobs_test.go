@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestJobRegistry_StartListCancel(t *testing.T) {
+	r := newJobRegistry()
+	ctx1, done1 := r.start(activeJob{UserID: 1, Prompt: "a", Quality: "2K"})
+	ctx2, done2 := r.start(activeJob{UserID: 1, Prompt: "b", Quality: "4K"})
+	_, done3 := r.start(activeJob{UserID: 2, Prompt: "c"})
+	defer done2()
+	defer done3()
+
+	jobs := r.list(1)
+	if len(jobs) != 2 || jobs[0].Prompt != "a" || jobs[1].Prompt != "b" || jobs[0].ID >= jobs[1].ID {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+
+	// 不能取消別人的工作
+	if r.cancel(2, jobs[0].ID) {
+		t.Fatal("should not cancel another user's job")
+	}
+	if !r.cancel(1, jobs[1].ID) {
+		t.Fatal("expected cancel to succeed")
+	}
+	if ctx2.Err() == nil {
+		t.Fatal("cancelled job context should be done")
+	}
+	if ctx1.Err() != nil {
+		t.Fatal("other jobs should keep running")
+	}
+	if r.cancel(1, jobs[1].ID) {
+		t.Fatal("cancelling twice should report the job as finished")
+	}
+
+	done1()
+	if ctx1.Err() == nil {
+		t.Fatal("finished job context should be released")
+	}
+	if jobs := r.list(1); len(jobs) != 0 {
+		t.Fatalf("expected no jobs left, got %+v", jobs)
+	}
+	if jobs := r.list(2); len(jobs) != 1 {
+		t.Fatalf("expected user 2 job to remain, got %+v", jobs)
+	}
+}
+
+func TestFormatJobs(t *testing.T) {
+	if text, keyboard := formatJobs(nil, time.Now()); keyboard != nil || !strings.Contains(text, "沒有") {
+		t.Fatalf("unexpected empty output %q", text)
+	}
+
+	now := time.Now()
+	jobs := []activeJob{
+		{ID: 3, Prompt: "翻譯這張", Quality: "2K", StartedAt: now.Add(-75 * time.Second)},
+		{ID: 5, Prompt: "a_b", Quality: "4K", AspectRatio: "16:9", StartedAt: now.Add(-5 * time.Second)},
+	}
+	text, keyboard := formatJobs(jobs, now)
+	for _, want := range []string{"（2 個）", "#3 · 1m15s · 2K · Auto", "#5 · 5s · 4K · 16:9", `a\_b`} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in %q", want, text)
+		}
+	}
+	if keyboard == nil || len(keyboard.InlineKeyboard) != 2 || *keyboard.InlineKeyboard[1][0].CallbackData != "job:5" {
+		t.Fatalf("unexpected keyboard %+v", keyboard)
+	}
+}
+
+func TestJobs_CancelWhileQueuedGenerationRuns(t *testing.T) {
+	b := &Bot{jobs: newJobRegistry()}
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	queues := newUserQueues(1, func(msg *tgbotapi.Message) {
+		ctx, finishJob := b.startJob(msg, msg.Text, "2K", "")
+		defer finishJob()
+		close(started)
+		<-ctx.Done()
+		close(finished)
+	}, nil)
+
+	chat := &tgbotapi.Chat{ID: 10, Type: "private"}
+	user := &tgbotapi.User{ID: 1}
+	generation := &tgbotapi.Message{MessageID: 1, Chat: chat, From: user, Text: "一隻貓"}
+	if !needsUserQueue(generation) || !queues.enqueue(user.ID, generation) {
+		t.Fatal("generation should be queued")
+	}
+	<-started
+
+	// /jobs 不進入佇列，生成進行中也能立即列出並取消
+	jobsCommand := &tgbotapi.Message{MessageID: 2, Chat: chat, From: user, Text: "/jobs",
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Length: 5}}}
+	if needsUserQueue(jobsCommand) {
+		t.Fatal("/jobs should bypass the user queue")
+	}
+	jobs := b.jobs.list(user.ID)
+	if len(jobs) != 1 {
+		t.Fatalf("expected the running job to be listed, got %+v", jobs)
+	}
+	if !b.jobs.cancel(user.ID, jobs[0].ID) {
+		t.Fatal("expected the running job to be cancelled")
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancelled generation did not stop")
+	}
+}
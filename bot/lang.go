@@ -0,0 +1,83 @@
+package bot
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// langAuto /lang 中代表「跟隨 Telegram 設定」的選項
+const langAuto = "auto"
+
+// supportedLanguages /lang 鍵盤上的語言順序
+var supportedLanguages = []string{langZhHant, langEn}
+
+// languageNames 各語言的顯示名稱（以該語言本身書寫）
+var languageNames = map[string]string{
+	langZhHant: "繁體中文",
+	langEn:     "English",
+}
+
+// languageLabel 顯示使用者目前的語言設定，未設定時標示為跟隨 Telegram
+func (b *Bot) languageLabel(user *tgbotapi.User) string {
+	lang := b.userLang(user)
+	stored, _ := b.db.GetUserLanguage(user.ID)
+	if stored == "" {
+		return tr(lang, "lang.auto") + "（" + languageNames[normalizeLang(lang)] + "）"
+	}
+	return languageNames[normalizeLang(stored)]
+}
+
+// cmdLang /lang：選擇介面語言
+func (b *Bot) cmdLang(msg *tgbotapi.Message) {
+	lang := b.userLang(msg.From)
+	stored, _ := b.db.GetUserLanguage(msg.From.ID)
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, tr(lang, "lang.title", b.languageLabel(msg.From)))
+	reply.ParseMode = "Markdown"
+	reply.ReplyMarkup = langKeyboard(lang, stored)
+	b.api.Send(reply)
+}
+
+func (b *Bot) callbackLang(callback *tgbotapi.CallbackQuery, code string) {
+	stored := code
+	if code == langAuto {
+		stored = ""
+	} else if _, ok := languageNames[code]; !ok {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, tr(b.userLang(callback.From), "lang.unknown")))
+		return
+	}
+
+	if err := b.db.SetUserLanguage(callback.From.ID, stored); err != nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, tr(b.userLang(callback.From), "lang.failed")))
+		return
+	}
+
+	lang := b.userLang(callback.From)
+	label := b.languageLabel(callback.From)
+	b.api.Request(tgbotapi.NewCallback(callback.ID, tr(lang, "lang.set", label)))
+
+	keyboard := langKeyboard(lang, stored)
+	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, tr(lang, "lang.title", label))
+	edit.ParseMode = "Markdown"
+	edit.ReplyMarkup = &keyboard
+	b.api.Send(edit)
+}
+
+// langKeyboard 列出支援的語言與「跟隨 Telegram」，stored 為空代表目前跟隨 Telegram
+func langKeyboard(lang, stored string) tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	for _, code := range supportedLanguages {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(qualityButton(languageNames[code], languageNames[stored]), "lang:"+code))
+	}
+
+	autoLabel := tr(lang, "lang.auto")
+	current := ""
+	if stored == "" {
+		current = autoLabel
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(
+		row,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(qualityButton(autoLabel, current), "lang:"+langAuto),
+		),
+	)
+}
@@ -0,0 +1,29 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cmdLastError /lasterror：顯示最近一次失敗的完整錯誤（金鑰已遮蔽），方便排查代理或 Vertex 問題
+func (b *Bot) cmdLastError(msg *tgbotapi.Message) {
+	raw, err := b.db.GetLastError(msg.From.ID)
+	if err != nil {
+		b.sendReplyMessage(msg, "❌ 讀取錯誤紀錄失敗")
+		return
+	}
+	if raw == "" {
+		b.sendReplyMessage(msg, "✅ 目前沒有失敗紀錄")
+		return
+	}
+
+	// 過長時分段發送
+	b.sendLongMessage(msg.Chat.ID, msg.MessageID, formatLastError(raw), "HTML")
+}
+
+// formatLastError 將錯誤遮蔽金鑰後包成 HTML 訊息
+func formatLastError(raw string) string {
+	return fmt.Sprintf("🧾 <b>最近一次失敗的完整錯誤</b>\n\n<pre>%s</pre>", html.EscapeString(redactSecrets(raw)))
+}
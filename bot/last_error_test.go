@@ -0,0 +1,17 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatLastError_RedactsAndEscapes(t *testing.T) {
+	raw := `{"error":{"code":400,"message":"bad <request>"}} url=https://proxy/v1?key=AIzaSyA-1234567890abcdefghijklmnopqrstuv`
+	text := formatLastError(raw)
+	if strings.Contains(text, "AIzaSy") {
+		t.Fatalf("key was not redacted: %s", text)
+	}
+	if !strings.Contains(text, "&lt;request&gt;") || !strings.Contains(text, `&#34;code&#34;:400`) {
+		t.Fatalf("expected escaped raw JSON, got %s", text)
+	}
+}
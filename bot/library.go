@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"tg-bawer/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cmdLibrary 列出公開 Prompt 庫，點擊即可複製到自己的 Prompt
+func (b *Bot) cmdLibrary(msg *tgbotapi.Message) {
+	prompts, err := b.db.GetPublicPrompts()
+	if err != nil {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ 取得失敗："+err.Error())
+		b.api.Send(reply)
+		return
+	}
+
+	if len(prompts) == 0 {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "📚 Prompt 庫目前是空的")
+		b.api.Send(reply)
+		return
+	}
+
+	var lines []string
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, p := range prompts {
+		lines = append(lines, "• "+markdownBold(p.Name)+"："+escapeMarkdown(p.Description))
+		btn := tgbotapi.NewInlineKeyboardButtonData("➕ "+p.Name, fmt.Sprintf("fork:%d", p.ID))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, "📚 *Prompt 庫*\n\n"+strings.Join(lines, "\n")+"\n\n點擊即可加入你的 Prompt：")
+	reply.ParseMode = "Markdown"
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.api.Send(reply)
+}
+
+func (b *Bot) callbackFork(callback *tgbotapi.CallbackQuery, idStr string) {
+	var id int64
+	fmt.Sscanf(idStr, "%d", &id)
+
+	p, err := b.db.ForkPublicPrompt(callback.From.ID, id)
+	switch {
+	case errors.Is(err, database.ErrPromptNameTaken):
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "你已經有同名的 Prompt"))
+	case errors.Is(err, sql.ErrNoRows):
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "找不到這個 Prompt"))
+	case err != nil:
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "加入失敗"))
+	default:
+		b.api.Request(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("已加入「%s」，可用 /list 查看", p.Name)))
+	}
+}
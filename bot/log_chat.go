@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// logChatQueueSize 待轉存的結果上限，滿了就丟棄新結果，避免拖慢回覆
+	logChatQueueSize = 64
+	// logChatInterval 兩次轉存之間的間隔，Telegram 對同一群組約每分鐘 20 則
+	logChatInterval = 3 * time.Second
+	// logChatCaptionLimit 檔案說明的字數上限
+	logChatCaptionLimit = 1024
+)
+
+// archivedResult 要轉存到 LOG_CHAT_ID 的一張生成結果
+type archivedResult struct {
+	UserID   int64
+	Prompt   string
+	Quality  string
+	FileName string
+	Data     []byte
+}
+
+// resultArchiver 以背景 worker 依序把生成結果轉存到紀錄頻道
+type resultArchiver struct {
+	send     func(archivedResult) error
+	results  chan archivedResult
+	interval time.Duration
+}
+
+// newResultArchiver 建立並啟動 archiver，chatID 為 0 時回傳 nil（不轉存）
+func newResultArchiver(api *tgbotapi.BotAPI, chatID int64) *resultArchiver {
+	if chatID == 0 {
+		return nil
+	}
+	a := &resultArchiver{
+		send: func(result archivedResult) error {
+			doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: result.FileName, Bytes: result.Data})
+			doc.Caption = archiveCaption(result)
+			_, err := api.Send(doc)
+			return err
+		},
+		results:  make(chan archivedResult, logChatQueueSize),
+		interval: logChatInterval,
+	}
+	go a.run()
+	return a
+}
+
+// archive 不阻塞地排入結果，佇列已滿時丟棄
+func (a *resultArchiver) archive(result archivedResult) {
+	if a == nil {
+		return
+	}
+	select {
+	case a.results <- result:
+	default:
+		log.Printf("[LogChat] 轉存佇列已滿，丟棄結果 (user=%d)", result.UserID)
+	}
+}
+
+func (a *resultArchiver) run() {
+	for result := range a.results {
+		if err := a.send(result); err != nil {
+			log.Printf("[LogChat] 轉存結果失敗 (user=%d): %v", result.UserID, redactSecrets(err.Error()))
+		}
+		time.Sleep(a.interval)
+	}
+}
+
+// archiveCaption 紀錄頻道中的檔案說明：使用者 ID、畫質與 Prompt（遮蔽其中的 API Key）
+func archiveCaption(result archivedResult) string {
+	quality := result.Quality
+	if quality == "" {
+		quality = "未指定"
+	}
+	header := fmt.Sprintf("👤 使用者 ID：%d\n🎨 畫質：%s\n📝 Prompt：", result.UserID, quality)
+	prompt := redactSecrets(result.Prompt)
+	limit := logChatCaptionLimit - len([]rune(header)) - len("...")
+	return header + truncateRunes(prompt, limit, "...")
+}
+
+// archiveResults 生成成功後把結果轉存到 LOG_CHAT_ID，未設定時不做任何事
+func (b *Bot) archiveResults(userID int64, prompt, quality string, results ...*gemini.ImageResult) {
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		b.archiver.archive(archivedResult{
+			UserID:   userID,
+			Prompt:   prompt,
+			Quality:  quality,
+			FileName: fmt.Sprintf("result_%d_%d%s", userID, i+1, result.FileExt()),
+			Data:     result.ImageData,
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"log"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// messageLength Telegram 以 UTF-16 code unit 計算訊息長度
+func messageLength(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// sendLongMessage 發送可能超過 Telegram 長度上限的訊息，過長時依段落/行切成多則依序發送；
+// 每段都回覆 replyToMessageID，在論壇主題中才會留在原本的主題
+func (b *Bot) sendLongMessage(chatID int64, replyToMessageID int, text, parseMode string) {
+	for i, chunk := range splitLongMessage(text, parseMode, inlineMessageLimit) {
+		reply := tgbotapi.NewMessage(chatID, chunk)
+		reply.ParseMode = parseMode
+		reply.ReplyToMessageID = replyToMessageID
+		if _, err := b.api.Send(reply); err != nil {
+			log.Printf("發送長訊息第 %d 段失敗: %v", i+1, err)
+			return
+		}
+	}
+}
+
+// codeFence 程式碼區塊的開頭與結尾標記；切割時若在區塊內，要在這段補上結尾、下一段補上開頭
+type codeFence struct {
+	open, close string
+}
+
+// fenceFor 依 parseMode 回傳要追蹤的程式碼區塊標記
+func fenceFor(parseMode string) *codeFence {
+	switch parseMode {
+	case "HTML":
+		return &codeFence{open: "<pre>", close: "</pre>"}
+	case "Markdown", "MarkdownV2":
+		return &codeFence{open: "```", close: "```"}
+	}
+	return nil
+}
+
+// insideFence 處理完這一行後是否仍在程式碼區塊內
+func (f *codeFence) insideFence(inside bool, line string) bool {
+	if f == nil {
+		return false
+	}
+	if f.open == f.close {
+		return inside != (strings.Count(line, f.open)%2 == 1)
+	}
+	lastOpen, lastClose := strings.LastIndex(line, f.open), strings.LastIndex(line, f.close)
+	if lastOpen < 0 && lastClose < 0 {
+		return inside
+	}
+	return lastOpen > lastClose
+}
+
+// splitLongMessage 依行切成每段不超過 limit 的訊息；在程式碼區塊中間切開時補上結尾與開頭，
+// 讓每一段都能單獨解析。單行超過上限時才在行內硬切
+func splitLongMessage(text, parseMode string, limit int) []string {
+	if messageLength(text) <= limit {
+		return []string{text}
+	}
+
+	fence := fenceFor(parseMode)
+	reserve := 0
+	if fence != nil {
+		reserve = messageLength(fence.open) + messageLength(fence.close) + 2
+	}
+
+	var chunks []string
+	var current strings.Builder
+	inside := false
+	flush := func() {
+		chunk := strings.TrimRight(current.String(), "\n")
+		if inside {
+			chunk += "\n" + fence.close
+		}
+		if strings.TrimSpace(chunk) != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+		if inside {
+			current.WriteString(fence.open + "\n")
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		// 保留重新開啟與結尾標記的空間，硬切後的單行一定放得進新的一段
+		for _, piece := range hardSplit(line, limit-2*reserve) {
+			if current.Len() > 0 && messageLength(current.String())+messageLength(piece)+reserve > limit {
+				flush()
+			}
+			current.WriteString(piece)
+			current.WriteString("\n")
+		}
+		inside = fence.insideFence(inside, line)
+	}
+	inside = false
+	flush()
+	return chunks
+}
+
+// hardSplit 將超過 limit 的單行切開，避免切在 HTML 實體（&amp;）中間
+func hardSplit(line string, limit int) []string {
+	if messageLength(line) <= limit {
+		return []string{line}
+	}
+	var pieces []string
+	runes := []rune(line)
+	for len(runes) > 0 {
+		end, size := 0, 0
+		for end < len(runes) && size+utf16Units(runes[end]) <= limit {
+			size += utf16Units(runes[end])
+			end++
+		}
+		if end < len(runes) {
+			// 往回退到 & 之前，讓實體留在下一段（實體最長約 10 個字元）
+			for i := end - 1; i > 0 && i >= end-10 && runes[i] != ';'; i-- {
+				if runes[i] == '&' {
+					end = i
+					break
+				}
+			}
+		}
+		pieces = append(pieces, string(runes[:end]))
+		runes = runes[end:]
+	}
+	return pieces
+}
+
+// utf16Units 單一字元佔用的 UTF-16 code unit 數
+func utf16Units(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSplitLongMessage_ShortTextUnchanged(t *testing.T) {
+	if chunks := splitLongMessage("hello\nworld", "HTML", inlineMessageLimit); len(chunks) != 1 || chunks[0] != "hello\nworld" {
+		t.Fatalf("unexpected chunks %q", chunks)
+	}
+}
+
+func TestSplitLongMessage_KeepsPreBlocksBalanced(t *testing.T) {
+	var lines []string
+	for i := 0; i < 400; i++ {
+		lines = append(lines, fmt.Sprintf("第 %03d 行 &amp; 一些文字", i))
+	}
+	text := "📝 <b>擷取結果</b>\n\n<pre>" + strings.Join(lines, "\n") + "</pre>"
+	if messageLength(text) <= inlineMessageLimit {
+		t.Fatalf("test input should exceed the limit, got %d", messageLength(text))
+	}
+
+	chunks := splitLongMessage(text, "HTML", inlineMessageLimit)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	var joined []string
+	for i, chunk := range chunks {
+		if messageLength(chunk) > inlineMessageLimit {
+			t.Fatalf("chunk %d is %d long", i, messageLength(chunk))
+		}
+		if strings.Count(chunk, "<pre>") != strings.Count(chunk, "</pre>") {
+			t.Fatalf("chunk %d has unbalanced <pre>: %q", i, chunk)
+		}
+		joined = append(joined, strings.TrimSuffix(strings.TrimPrefix(chunk, "<pre>\n"), "\n</pre>"))
+	}
+	// 每一行都要完整出現且順序不變
+	all := strings.Join(joined, "\n")
+	last := -1
+	for _, line := range lines {
+		idx := strings.Index(all, line)
+		if idx <= last {
+			t.Fatalf("line %q missing or out of order", line)
+		}
+		last = idx
+	}
+}
+
+func TestSplitLongMessage_MarkdownFence(t *testing.T) {
+	text := "```\n" + strings.Repeat("x\n", 3000) + "```"
+	for i, chunk := range splitLongMessage(text, "Markdown", inlineMessageLimit) {
+		if strings.Count(chunk, "```")%2 != 0 {
+			t.Fatalf("chunk %d has an unclosed fence", i)
+		}
+	}
+}
+
+func TestHardSplit_DoesNotBreakEntities(t *testing.T) {
+	line := strings.Repeat("a", 8) + "&amp;" + strings.Repeat("b", 8)
+	pieces := hardSplit(line, 10)
+	if strings.Join(pieces, "") != line {
+		t.Fatalf("pieces lost content: %q", pieces)
+	}
+	for _, piece := range pieces {
+		if strings.Contains(piece, "&") && !strings.Contains(piece, "&amp;") {
+			t.Fatalf("entity was split: %q", pieces)
+		}
+		if messageLength(piece) > 10 {
+			t.Fatalf("piece too long: %q", piece)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maintenanceKey    = "maintenance"
+	maintenanceNotice = "🛠 維護中，稍後再試"
+)
+
+// inMaintenance 檢查是否處於維護模式
+func (b *Bot) inMaintenance() bool {
+	value, _, err := b.db.GetKV(maintenanceKey)
+	if err != nil {
+		log.Printf("Failed to read maintenance flag: %v", err)
+		return false
+	}
+	return value == "on"
+}
+
+// cmdMaintenance /maintenance on|off，只有管理員可以切換
+func (b *Bot) cmdMaintenance(msg *tgbotapi.Message) {
+	if !b.config.IsAdmin(msg.From.ID) {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 只有管理員可以使用此指令"))
+		return
+	}
+
+	switch strings.ToLower(strings.TrimSpace(msg.CommandArguments())) {
+	case "on":
+		if err := b.db.SetKV(maintenanceKey, "on"); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 設定失敗："+err.Error()))
+			return
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "🛠 已開啟維護模式，非管理員的訊息與重試佇列將暫停處理"))
+	case "off":
+		if err := b.db.SetKV(maintenanceKey, "off"); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 設定失敗："+err.Error()))
+			return
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "✅ 已關閉維護模式"))
+	default:
+		status := "關閉"
+		if b.inMaintenance() {
+			status = "開啟"
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "維護模式目前為"+status+"\n用法：/maintenance on|off"))
+	}
+}
@@ -0,0 +1,33 @@
+package bot
+
+import "strings"
+
+// markdownEscaper 跳脫 Telegram Markdown（舊版）在實體外會被解析的字元
+var markdownEscaper = strings.NewReplacer(
+	"_", "\\_",
+	"*", "\\*",
+	"`", "\\`",
+	"[", "\\[",
+)
+
+// escapeMarkdown 讓使用者輸入的文字在 Markdown 訊息中原樣顯示
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// markdownCode 將文字包成 code span（方便點擊複製）；
+// 舊版 Markdown 的實體內部無法跳脫，內容含結束字元時改用跳脫後的一般文字，確保內容不會遺失
+func markdownCode(s string) string {
+	if strings.Contains(s, "`") {
+		return escapeMarkdown(s)
+	}
+	return "`" + s + "`"
+}
+
+// markdownBold 將文字包成粗體，內容含 * 時同 markdownCode 改用跳脫後的一般文字
+func markdownBold(s string) string {
+	if strings.Contains(s, "*") {
+		return escapeMarkdown(s)
+	}
+	return "*" + s + "*"
+}
@@ -0,0 +1,37 @@
+package bot
+
+import "testing"
+
+func TestEscapeMarkdown(t *testing.T) {
+	cases := map[string]string{
+		"my_prompt":     `my\_prompt`,
+		"*bold* [link]": `\*bold\* \[link]`,
+		"```code```":    "\\`\\`\\`code\\`\\`\\`",
+		"一般文字":          "一般文字",
+	}
+	for in, want := range cases {
+		if got := escapeMarkdown(in); got != want {
+			t.Fatalf("escapeMarkdown(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMarkdownCode(t *testing.T) {
+	// code span 內底線與星號不會被解析，不需跳脫
+	if got := markdownCode("snake_case *x*"); got != "`snake_case *x*`" {
+		t.Fatalf("unexpected code span %q", got)
+	}
+	// 含反引號（例如 code fence）時改用跳脫後的一般文字
+	if got := markdownCode("```go\nfmt_x```"); got != "\\`\\`\\`go\nfmt\\_x\\`\\`\\`" {
+		t.Fatalf("unexpected escaped text %q", got)
+	}
+}
+
+func TestMarkdownBold(t *testing.T) {
+	if got := markdownBold("my_prompt"); got != "*my_prompt*" {
+		t.Fatalf("unexpected bold %q", got)
+	}
+	if got := markdownBold("a*b_c"); got != `a\*b\_c` {
+		t.Fatalf("unexpected escaped bold %q", got)
+	}
+}
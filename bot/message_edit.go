@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxTrackedEdits 最多記住幾則訊息的最後內容，超過時整批清空（處理中訊息大多很快就被刪除）
+const maxTrackedEdits = 1000
+
+// editKey 以聊天與訊息 ID 識別一則訊息
+type editKey struct {
+	chatID    int64
+	messageID int
+}
+
+// editTracker 記錄每則訊息最後一次編輯的內容，內容相同時跳過編輯
+type editTracker struct {
+	mu   sync.Mutex
+	last map[editKey]string
+}
+
+func newEditTracker() *editTracker {
+	return &editTracker{last: make(map[editKey]string)}
+}
+
+// changed 內容與上次不同時記下並回傳 true；nil 時一律視為不同
+func (t *editTracker) changed(key editKey, content string) bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if previous, ok := t.last[key]; ok && previous == content {
+		return false
+	}
+	if len(t.last) >= maxTrackedEdits {
+		t.last = make(map[editKey]string)
+	}
+	t.last[key] = content
+	return true
+}
+
+// forget 編輯失敗時移除紀錄，讓下次相同內容仍會重送
+func (t *editTracker) forget(key editKey) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	delete(t.last, key)
+	t.mu.Unlock()
+}
+
+// isNotModifiedError Telegram 對內容沒有變化的編輯回傳 400 "message is not modified"
+func isNotModifiedError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "message is not modified")
+}
+
+// editMessage 編輯訊息文字；內容與上次相同時不呼叫 API，並忽略 "message is not modified"
+func (b *Bot) editMessage(msg tgbotapi.Message, text, parseMode string) {
+	key := editKey{chatID: msg.Chat.ID, messageID: msg.MessageID}
+	if !b.edits.changed(key, parseMode+"\x00"+text) {
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(msg.Chat.ID, msg.MessageID, text)
+	edit.ParseMode = parseMode
+	if _, err := b.api.Send(edit); err != nil && !isNotModifiedError(err) {
+		b.edits.forget(key)
+		log.Printf("編輯訊息失敗 (chat=%d, message=%d): %v", msg.Chat.ID, msg.MessageID, err)
+	}
+}
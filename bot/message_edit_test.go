@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEditTracker_SkipsIdenticalContent(t *testing.T) {
+	tracker := newEditTracker()
+	key := editKey{chatID: 1, messageID: 10}
+
+	if !tracker.changed(key, "⏳ 嘗試 1/6") {
+		t.Fatal("first edit should be sent")
+	}
+	if tracker.changed(key, "⏳ 嘗試 1/6") {
+		t.Fatal("identical edit should be skipped")
+	}
+	if !tracker.changed(key, "⏳ 嘗試 2/6") {
+		t.Fatal("changed text should be sent")
+	}
+	if !tracker.changed(editKey{chatID: 1, messageID: 11}, "⏳ 嘗試 2/6") {
+		t.Fatal("other messages are tracked separately")
+	}
+
+	tracker.forget(key)
+	if !tracker.changed(key, "⏳ 嘗試 2/6") {
+		t.Fatal("forgotten edit should be sent again")
+	}
+
+	var nilTracker *editTracker
+	if !nilTracker.changed(key, "x") || !nilTracker.changed(key, "x") {
+		t.Fatal("nil tracker should never skip")
+	}
+}
+
+func TestEditTracker_Bounded(t *testing.T) {
+	tracker := newEditTracker()
+	for i := 0; i <= maxTrackedEdits; i++ {
+		tracker.changed(editKey{chatID: 1, messageID: i}, "x")
+	}
+	if len(tracker.last) > maxTrackedEdits {
+		t.Fatalf("tracker grew to %d entries", len(tracker.last))
+	}
+}
+
+func TestIsNotModifiedError(t *testing.T) {
+	if !isNotModifiedError(errors.New("Bad Request: message is not modified: specified new message content and reply markup are exactly the same")) {
+		t.Fatal("expected not-modified error to be detected")
+	}
+	if isNotModifiedError(errors.New("Bad Request: message to edit not found")) || isNotModifiedError(nil) {
+		t.Fatal("unexpected match")
+	}
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bawer/gemini"
+)
+
+const (
+	// modelListTTL 模型列表快取時間，避免每次 /models 都打 API
+	modelListTTL = 10 * time.Minute
+	// modelListTimeout 查詢模型列表的逾時
+	modelListTimeout = 20 * time.Second
+)
+
+// modelListCache 依服務快取 models.list 結果
+type modelListCache struct {
+	sync.Mutex
+	entries map[string]modelListEntry
+}
+
+type modelListEntry struct {
+	models    []string
+	fallback  bool // 服務不支援列表，使用 gemini.KnownImageModels
+	expiresAt time.Time
+}
+
+func newModelListCache() *modelListCache {
+	return &modelListCache{entries: make(map[string]modelListEntry)}
+}
+
+func (c *modelListCache) get(key string, now time.Time) (modelListEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expiresAt) {
+		return modelListEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *modelListCache) put(key string, entry modelListEntry) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[key] = entry
+}
+
+// modelListKey 同一組服務端點與金鑰共用快取
+func modelListKey(service gemini.ServiceConfig) string {
+	return strings.Join([]string{service.Type, service.BaseURL, service.APIKey}, "|")
+}
+
+// listModels 查詢服務支援的模型；服務不支援 models.list 時改回傳已知的圖片模型
+func (b *Bot) listModels(service gemini.ServiceConfig) modelListEntry {
+	key := modelListKey(service)
+	if entry, ok := b.modelLists.get(key, time.Now()); ok {
+		return entry
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), modelListTimeout)
+	defer cancel()
+
+	entry := modelListEntry{expiresAt: time.Now().Add(modelListTTL)}
+	models, err := b.newGeminiClient(service).ListModels(ctx)
+	if err != nil {
+		log.Printf("查詢模型列表失敗，改用內建清單: %v", redactSecrets(err.Error()))
+		entry.models = gemini.KnownImageModels
+		entry.fallback = true
+	} else {
+		entry.models = models
+	}
+	b.modelLists.put(key, entry)
+	return entry
+}
+
+// cmdModels /models：列出目前服務可用的模型，供 @model= 使用
+func (b *Bot) cmdModels(msg *tgbotapi.Message) {
+	service, name, err := b.resolveServiceConfig(msg.From.ID)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n請先用 /service add 新增服務"))
+		return
+	}
+
+	entry := b.listModels(service)
+	reply := tgbotapi.NewMessage(msg.Chat.ID, formatModelList(name, service.Model, entry))
+	reply.ParseMode = "HTML"
+	reply.ReplyToMessageID = msg.MessageID
+	b.api.Send(reply)
+}
+
+// formatModelList 組出模型列表訊息，標示目前使用的模型，過長時省略尾端
+func formatModelList(serviceName, serviceModel string, entry modelListEntry) string {
+	current := strings.TrimSpace(serviceModel)
+	if current == "" {
+		current = gemini.DefaultImageModel
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🧠 <b>可用模型</b>（%s）\n", html.EscapeString(serviceName))
+	if entry.fallback {
+		b.WriteString("⚠️ 此服務不支援查詢模型列表，以下為內建的圖片模型\n")
+	}
+	b.WriteString("\n")
+
+	const limit = 3500
+	for i, model := range entry.models {
+		line := "• <code>" + html.EscapeString(model) + "</code>"
+		if model == current {
+			line += "（目前）"
+		}
+		if b.Len()+len(line) > limit {
+			fmt.Fprintf(&b, "…還有 %d 個\n", len(entry.models)-i)
+			break
+		}
+		b.WriteString(line + "\n")
+	}
+
+	b.WriteString("\n用 <code>@model=名稱</code> 指定單次生成的模型")
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"tg-bawer/gemini"
+)
+
+func TestModelListCache_Expires(t *testing.T) {
+	cache := newModelListCache()
+	now := time.Now()
+	cache.put("svc", modelListEntry{models: []string{"a"}, expiresAt: now.Add(time.Minute)})
+
+	if entry, ok := cache.get("svc", now); !ok || entry.models[0] != "a" {
+		t.Fatalf("expected cached entry, got %+v %v", entry, ok)
+	}
+	if _, ok := cache.get("svc", now.Add(2*time.Minute)); ok {
+		t.Fatal("expected entry to expire")
+	}
+	if _, ok := cache.get("other", now); ok {
+		t.Fatal("expected miss for unknown key")
+	}
+}
+
+func TestFormatModelList(t *testing.T) {
+	text := formatModelList("proxy (#1)", "", modelListEntry{models: []string{"gemini-2.5-flash", gemini.DefaultImageModel}})
+	if !strings.Contains(text, "<code>"+gemini.DefaultImageModel+"</code>（目前）") {
+		t.Fatalf("expected default model to be marked current:\n%s", text)
+	}
+	if strings.Contains(text, "不支援") {
+		t.Fatalf("unexpected fallback notice:\n%s", text)
+	}
+
+	fallback := formatModelList("env-default", "custom-model", modelListEntry{models: gemini.KnownImageModels, fallback: true})
+	if !strings.Contains(fallback, "不支援") || strings.Contains(fallback, "（目前）") {
+		t.Fatalf("unexpected fallback text:\n%s", fallback)
+	}
+
+	many := make([]string, 500)
+	for i := range many {
+		many[i] = "gemini-model-with-a-fairly-long-name"
+	}
+	if long := formatModelList("svc", "", modelListEntry{models: many}); len(long) > 4096 || !strings.Contains(long, "還有") {
+		t.Fatalf("expected long list to be truncated, got %d bytes", len(long))
+	}
+}
@@ -0,0 +1,248 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"image"
+	"image/png"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-bawer/config"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cmdOCR 只擷取圖片中的文字，不生成圖片
+func (b *Bot) cmdOCR(msg *tgbotapi.Message) {
+	fileID := findImageFileID(msg)
+	if fileID == "" && msg.ReplyToMessage != nil {
+		fileID = findImageFileID(msg.ReplyToMessage)
+	}
+	if fileID == "" {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ 請回覆一張圖片（或貼圖/圖片檔案）再使用 /ocr")
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
+	serviceConfig, _, err := b.resolveServiceConfig(msg.From.ID)
+	if err != nil {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n請先用 /service add 新增服務")
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+	gClient := b.newGeminiClient(serviceConfig)
+
+	tiles, err := parseOCRTiles(msg.CommandArguments())
+	if err != nil {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error())
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
+	processingMsg, err := b.sendReplyMessage(msg, "⏳ *擷取文字中...*")
+	if err != nil {
+		return
+	}
+
+	downloadedImages, err := b.downloadImagesByFileIDs([]string{fileID}, nil)
+	if err != nil {
+		b.updateMessageHTML(processingMsg, withErrorHint(defaultLang, fmt.Sprintf("❌ <b>處理失敗</b>\n\n下載圖片失敗\n\n<blockquote expandable>%s</blockquote>",
+			html.EscapeString(truncateError(err.Error()))), err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	image := downloadedImages[0]
+	var text string
+	if tiles > 1 {
+		text, err = extractTextTiled(ctx, gClient, image.Data, image.MimeType, tiles)
+	} else {
+		text, err = gClient.ExtractText(ctx, image.Data, image.MimeType, config.ExtractTextPrompt)
+	}
+	if err != nil {
+		b.updateMessageHTML(processingMsg, withErrorHint(defaultLang, fmt.Sprintf("❌ <b>擷取失敗</b>\n\n<blockquote expandable>%s</blockquote>",
+			html.EscapeString(truncateError(err.Error()))), err))
+		return
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		b.updateMessage(processingMsg, "📝 圖片中沒有找到文字")
+		return
+	}
+
+	result := fmt.Sprintf("📝 <b>擷取結果</b>\n\n<pre>%s</pre>", html.EscapeString(text))
+	if messageLength(result) <= inlineMessageLimit {
+		b.updateMessageHTML(processingMsg, result)
+		return
+	}
+	// 超過單則訊息上限時改為分段發送
+	b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
+	b.sendLongMessage(msg.Chat.ID, msg.MessageID, result, "HTML")
+}
+
+// findImageFileID 取得訊息中的圖片 FileID（照片、貼圖或圖片檔案）
+func findImageFileID(msg *tgbotapi.Message) string {
+	if msg == nil {
+		return ""
+	}
+	if len(msg.Photo) > 0 {
+		return msg.Photo[len(msg.Photo)-1].FileID
+	}
+	if msg.Sticker != nil {
+		// 優先使用 PNG 縮圖，如果沒有則使用原始貼圖
+		if msg.Sticker.Thumbnail != nil {
+			return msg.Sticker.Thumbnail.FileID
+		}
+		return msg.Sticker.FileID
+	}
+	if msg.Document != nil && strings.HasPrefix(msg.Document.MimeType, "image/") {
+		return msg.Document.FileID
+	}
+	return ""
+}
+
+// @tiles= 可接受的範圍，1 代表不切割
+const (
+	minOCRTiles = 1
+	maxOCRTiles = 8
+)
+
+// ocrSeamOverlap 相鄰直條重疊的比例，避免剛好被切到的文字兩邊都辨識不完整
+const ocrSeamOverlap = 0.1
+
+// ocrMaxSeamLines 接縫處最多比對的重複行數
+const ocrMaxSeamLines = 5
+
+// textExtractor 擷取圖片文字的介面（*gemini.Client）
+type textExtractor interface {
+	ExtractText(ctx context.Context, imageData []byte, mimeType, prompt string) (string, error)
+}
+
+// parseOCRTiles 解析 /ocr 的 @tiles=N，未指定時回傳 1
+func parseOCRTiles(args string) (int, error) {
+	tiles := minOCRTiles
+	for _, field := range strings.Fields(args) {
+		lower := strings.ToLower(field)
+		if !strings.HasPrefix(lower, "@tiles=") {
+			continue
+		}
+		n, err := strconv.Atoi(lower[len("@tiles="):])
+		if err != nil || n < minOCRTiles || n > maxOCRTiles {
+			return 0, fmt.Errorf("無效的 %s，範圍 @tiles=%d – @tiles=%d", field, minOCRTiles, maxOCRTiles)
+		}
+		tiles = n
+	}
+	return tiles, nil
+}
+
+// extractTextTiled 將長圖切成上下重疊的直條逐段擷取文字，依序合併並去除接縫處重複的行
+func extractTextTiled(ctx context.Context, extractor textExtractor, data []byte, mimeType string, strips int) (string, error) {
+	if strips <= 1 {
+		return extractor.ExtractText(ctx, data, mimeType, config.ExtractTextPrompt)
+	}
+
+	parts, err := splitIntoStrips(data, strips)
+	if err != nil {
+		return "", err
+	}
+
+	var merged []string
+	for i, part := range parts {
+		text, err := extractor.ExtractText(ctx, part, "image/png", config.ExtractTextPrompt)
+		if err != nil {
+			return "", fmt.Errorf("第 %d/%d 段擷取失敗: %w", i+1, len(parts), err)
+		}
+		merged = mergeSeamLines(merged, nonEmptyLines(text))
+	}
+	return strings.Join(merged, "\n"), nil
+}
+
+// splitIntoStrips 將圖片切成 strips 條等高直條（PNG），相鄰直條重疊 ocrSeamOverlap
+func splitIntoStrips(data []byte, strips int) ([][]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := src.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("不支援切割的圖片格式")
+	}
+
+	bounds := src.Bounds()
+	if strips > bounds.Dy() {
+		strips = bounds.Dy()
+	}
+	stripHeight := bounds.Dy() / strips
+	overlap := int(float64(stripHeight) * ocrSeamOverlap)
+
+	parts := make([][]byte, 0, strips)
+	for i := 0; i < strips; i++ {
+		top := bounds.Min.Y + i*stripHeight - overlap
+		bottom := bounds.Min.Y + (i+1)*stripHeight + overlap
+		if i == 0 {
+			top = bounds.Min.Y
+		}
+		if i == strips-1 || bottom > bounds.Max.Y {
+			bottom = bounds.Max.Y
+		}
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, sub.SubImage(image.Rect(bounds.Min.X, top, bounds.Max.X, bottom))); err != nil {
+			return nil, err
+		}
+		parts = append(parts, buf.Bytes())
+	}
+	return parts, nil
+}
+
+// mergeSeamLines 接上下一段的文字；前一段結尾與下一段開頭重複的行（重疊區域）只保留一次
+func mergeSeamLines(prev, next []string) []string {
+	maxOverlap := ocrMaxSeamLines
+	if len(prev) < maxOverlap {
+		maxOverlap = len(prev)
+	}
+	if len(next) < maxOverlap {
+		maxOverlap = len(next)
+	}
+
+	skip := 0
+	for n := maxOverlap; n > 0; n-- {
+		if sameLines(prev[len(prev)-n:], next[:n]) {
+			skip = n
+			break
+		}
+	}
+	return append(prev, next[skip:]...)
+}
+
+func sameLines(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// nonEmptyLines 切成去除前後空白的非空行
+func nonEmptyLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
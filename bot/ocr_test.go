@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// fakeExtractor 依呼叫順序回傳預設的文字，並記錄每段的高度
+type fakeExtractor struct {
+	responses []string
+	heights   []int
+	err       error
+}
+
+func (f *fakeExtractor) ExtractText(ctx context.Context, data []byte, mimeType, prompt string) (string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	f.heights = append(f.heights, cfg.Height)
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.responses[len(f.heights)-1], nil
+}
+
+func tallPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractTextTiled_MergesSeams(t *testing.T) {
+	extractor := &fakeExtractor{responses: []string{
+		"第一格\n第二格",
+		"第二格\n第三格\n\n第四格",
+		"第三格\n第四格\n第五格",
+	}}
+	text, err := extractTextTiled(context.Background(), extractor, tallPNG(t, 100, 3000), "image/png", 3)
+	if err != nil {
+		t.Fatalf("extractTextTiled failed: %v", err)
+	}
+	if want := "第一格\n第二格\n第三格\n第四格\n第五格"; text != want {
+		t.Fatalf("got %q, want %q", text, want)
+	}
+
+	// 每段 1000px，中間段上下各多 100px 重疊
+	if len(extractor.heights) != 3 || extractor.heights[0] != 1100 || extractor.heights[1] != 1200 || extractor.heights[2] != 1100 {
+		t.Fatalf("unexpected strip heights %v", extractor.heights)
+	}
+}
+
+func TestExtractTextTiled_ReportsFailingStrip(t *testing.T) {
+	extractor := &fakeExtractor{err: errors.New("quota")}
+	_, err := extractTextTiled(context.Background(), extractor, tallPNG(t, 10, 100), "image/png", 2)
+	if err == nil || !strings.Contains(err.Error(), "1/2") {
+		t.Fatalf("expected strip error, got %v", err)
+	}
+}
+
+func TestMergeSeamLines_KeepsRepeatedTextOutsideSeam(t *testing.T) {
+	got := mergeSeamLines([]string{"啊", "好"}, []string{"啊", "走吧"})
+	if strings.Join(got, "|") != "啊|好|啊|走吧" {
+		t.Fatalf("unexpected merge %v", got)
+	}
+}
+
+func TestParseOCRTiles(t *testing.T) {
+	if n, err := parseOCRTiles(""); err != nil || n != 1 {
+		t.Fatalf("expected default 1, got %d (%v)", n, err)
+	}
+	if n, err := parseOCRTiles("@tiles=4"); err != nil || n != 4 {
+		t.Fatalf("expected 4, got %d (%v)", n, err)
+	}
+	for _, bad := range []string{"@tiles=0", "@tiles=9", "@tiles=x"} {
+		if _, err := parseOCRTiles(bad); err == nil {
+			t.Fatalf("%s: expected error", bad)
+		}
+	}
+}
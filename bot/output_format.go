@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bawer/gemini"
+)
+
+// outputJPEGQuality 轉成 JPEG 時的預設品質
+const outputJPEGQuality = 90
+
+// JPEG 品質（@jpegq=、/setformat jpeg <品質>）可接受的範圍
+const (
+	minJPEGQuality = 1
+	maxJPEGQuality = 100
+)
+
+// outputFormats @format= 與 /setformat 可用的輸出格式與對應的 MIME
+var outputFormats = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+}
+
+// normalizeOutputFormat 統一格式名稱（jpg → jpeg），不支援時回傳 false
+func normalizeOutputFormat(format string) (string, bool) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	_, ok := outputFormats[format]
+	return format, ok
+}
+
+// encodeAs 將圖片轉為指定格式；jpeg 使用 quality（1–100）
+func encodeAs(data []byte, format string, quality int) ([]byte, error) {
+	format, ok := normalizeOutputFormat(format)
+	if !ok {
+		return nil, fmt.Errorf("不支援的輸出格式: %s", format)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// outputFormatFor 這次要輸出的格式：@format > /setformat > 空字串（維持模型原本的格式）
+func (b *Bot) outputFormatFor(params *ParsedParams, userID int64) string {
+	if params.Format != "" {
+		return params.Format
+	}
+	stored, err := b.db.GetUserOutputFormat(userID)
+	if err != nil {
+		return ""
+	}
+	format, _ := normalizeOutputFormat(stored)
+	if _, ok := outputFormats[format]; !ok {
+		return ""
+	}
+	return format
+}
+
+// jpegQualityFor 這次轉 JPEG 的品質：@jpegq > /setformat 設定 > 預設 90
+func (b *Bot) jpegQualityFor(params *ParsedParams, userID int64) int {
+	if params.JPEGQuality > 0 {
+		return params.JPEGQuality
+	}
+	if stored, err := b.db.GetUserJPEGQuality(userID); err == nil && stored >= minJPEGQuality && stored <= maxJPEGQuality {
+		return stored
+	}
+	return outputJPEGQuality
+}
+
+// applyOutputFormat 依 @format / @jpegq 與使用者設定轉換結果，轉成 JPEG 時回傳要顯示在說明中的品質提示
+func (b *Bot) applyOutputFormat(lang string, results []*gemini.ImageResult, params *ParsedParams, userID int64) string {
+	format := b.outputFormatFor(params, userID)
+	if format == "" {
+		return ""
+	}
+	quality := b.jpegQualityFor(params, userID)
+	if !convertResults(results, format, quality) || format != "jpeg" {
+		return ""
+	}
+	return tr(lang, "format.jpeg_note", quality)
+}
+
+// convertResults 將結果轉為指定格式；已是該格式或轉換失敗時保留原圖，有任何一張轉換成功時回傳 true
+func convertResults(results []*gemini.ImageResult, format string, quality int) bool {
+	mimeType, ok := outputFormats[format]
+	if !ok {
+		return false
+	}
+	converted := false
+	for _, result := range results {
+		if result.MimeType == mimeType {
+			continue
+		}
+		data, err := encodeAs(result.ImageData, format, quality)
+		if err != nil {
+			log.Printf("轉換輸出格式 %s 失敗: %v", format, err)
+			continue
+		}
+		result.ImageData = data
+		result.MimeType = mimeType
+		converted = true
+	}
+	return converted
+}
+
+// cmdSetFormat /setformat png|jpeg [品質]|reset：設定預設輸出格式與 JPEG 品質
+func (b *Bot) cmdSetFormat(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		current, _ := b.db.GetUserOutputFormat(msg.From.ID)
+		if current == "" {
+			current = "原始格式"
+		}
+		quality, _ := b.db.GetUserJPEGQuality(msg.From.ID)
+		if quality <= 0 {
+			quality = outputJPEGQuality
+		}
+		b.sendReplyMessage(msg, fmt.Sprintf("🖼 目前輸出格式：*%s*（JPEG 品質 %d）\n\n用法：`/setformat jpeg 85`，`/setformat reset` 改回模型原始格式\n支援：png, jpeg", current, quality))
+		return
+	}
+
+	format := ""
+	if !strings.EqualFold(args[0], "reset") {
+		var ok bool
+		if format, ok = normalizeOutputFormat(args[0]); !ok {
+			b.sendReplyMessage(msg, fmt.Sprintf("❌ 不支援的格式 `%s`\n\n支援：png, jpeg", markdownCode(args[0])))
+			return
+		}
+	}
+
+	quality := 0
+	if len(args) > 1 {
+		q, err := strconv.Atoi(args[1])
+		if format != "jpeg" || err != nil || q < minJPEGQuality || q > maxJPEGQuality {
+			b.sendReplyMessage(msg, "❌ 品質只適用於 jpeg，範圍 1–100，例如 `/setformat jpeg 85`")
+			return
+		}
+		quality = q
+	}
+
+	if err := b.db.SetUserOutputFormat(msg.From.ID, format); err != nil {
+		b.sendReplyMessage(msg, "❌ 設定失敗")
+		return
+	}
+	// reset 時一併清除品質
+	if quality > 0 || format == "" {
+		if err := b.db.SetUserJPEGQuality(msg.From.ID, quality); err != nil {
+			b.sendReplyMessage(msg, "❌ 設定失敗")
+			return
+		}
+	}
+
+	switch {
+	case format == "":
+		b.sendReplyMessage(msg, "✅ 已改回模型原始格式")
+	case quality > 0:
+		b.sendReplyMessage(msg, fmt.Sprintf("✅ 輸出格式已設為 *%s*（品質 %d）", format, quality))
+	default:
+		b.sendReplyMessage(msg, fmt.Sprintf("✅ 輸出格式已設為 *%s*", format))
+	}
+}
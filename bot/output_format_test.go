@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"tg-bawer/gemini"
+)
+
+func gradientPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 5), G: uint8(y * 7), B: uint8(x ^ y), A: uint8(200 + (x+y)%56)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeAs_PNGToJPEG(t *testing.T) {
+	out, err := encodeAs(gradientPNG(t, 40, 30), "jpg", 80)
+	if err != nil {
+		t.Fatalf("encodeAs jpeg failed: %v", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+	if err != nil || format != "jpeg" {
+		t.Fatalf("expected jpeg output, got %q (%v)", format, err)
+	}
+	if cfg.Width != 40 || cfg.Height != 30 {
+		t.Fatalf("unexpected size %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestEncodeAs_RejectsUnknownFormat(t *testing.T) {
+	for _, format := range []string{"bmp", "webp"} {
+		if _, err := encodeAs(gradientPNG(t, 2, 2), format, 0); err == nil {
+			t.Fatalf("expected error for %s", format)
+		}
+	}
+	if _, ok := normalizeOutputFormat("JPG"); !ok {
+		t.Fatal("JPG should be accepted as jpeg")
+	}
+}
+
+func TestConvertResults_UpdatesMimeType(t *testing.T) {
+	results := []*gemini.ImageResult{{ImageData: gradientPNG(t, 8, 8), MimeType: "image/png"}}
+	if !convertResults(results, "jpeg", outputJPEGQuality) {
+		t.Fatal("expected conversion")
+	}
+	if results[0].MimeType != "image/jpeg" || results[0].FileExt() != ".jpg" {
+		t.Fatalf("unexpected result %q / %q", results[0].MimeType, results[0].FileExt())
+	}
+
+	// 未指定格式時不動
+	before := results[0].ImageData
+	if convertResults(results, "", outputJPEGQuality) {
+		t.Fatal("empty format should not convert")
+	}
+	if !bytes.Equal(before, results[0].ImageData) {
+		t.Fatal("empty format should keep the image")
+	}
+}
+
+func TestEncodeAs_LowerJPEGQualityIsSmaller(t *testing.T) {
+	source := gradientPNG(t, 120, 90)
+	high, err := encodeAs(source, "jpeg", 95)
+	if err != nil {
+		t.Fatalf("encodeAs q95 failed: %v", err)
+	}
+	low, err := encodeAs(source, "jpeg", 20)
+	if err != nil {
+		t.Fatalf("encodeAs q20 failed: %v", err)
+	}
+	if len(low) >= len(high) {
+		t.Fatalf("expected quality 20 (%d bytes) to be smaller than 95 (%d bytes)", len(low), len(high))
+	}
+}
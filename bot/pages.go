@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxPageNumber 頁碼上限，避免 @pages=1-99999 這類輸入展開過大
+const maxPageNumber = 100
+
+// parsePageSelection 解析 @pages= 的值，支援 1-3 與 1,4,5 以及混用（1-3,5）
+// 回傳依出現順序去重後的 1-based 頁碼
+func parsePageSelection(spec string) ([]int, error) {
+	if spec == "" {
+		return nil, fmt.Errorf("empty page selection")
+	}
+
+	var pages []int
+	seen := make(map[int]bool)
+	add := func(page int) {
+		if !seen[page] {
+			seen[page] = true
+			pages = append(pages, page)
+		}
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		start, end, isRange := strings.Cut(part, "-")
+		from, err := parsePageNumber(start)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if isRange {
+			if to, err = parsePageNumber(end); err != nil {
+				return nil, err
+			}
+			if to < from {
+				return nil, fmt.Errorf("invalid page range: %s", part)
+			}
+		}
+		for page := from; page <= to; page++ {
+			add(page)
+		}
+	}
+	return pages, nil
+}
+
+func parsePageNumber(value string) (int, error) {
+	page, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || page < 1 || page > maxPageNumber {
+		return 0, fmt.Errorf("invalid page number: %q", value)
+	}
+	return page, nil
+}
+
+// selectPages 依頁碼從列表中挑出項目，任一頁碼超出實際數量時回傳錯誤
+func selectPages[T any](items []T, pages []int) ([]T, error) {
+	if len(pages) == 0 {
+		return items, nil
+	}
+
+	selected := make([]T, 0, len(pages))
+	for _, page := range pages {
+		if page > len(items) {
+			return nil, fmt.Errorf("第 %d 頁超出範圍（共 %d 頁）", page, len(items))
+		}
+		selected = append(selected, items[page-1])
+	}
+	return selected, nil
+}
+
+// pagesErrorText 頁碼超出範圍時的提示，格式與其他參數錯誤一致
+func pagesErrorText(spec string, err error) string {
+	return fmt.Sprintf("❌ *參數錯誤*\n\n無效的頁數：`@pages=%s`\n%s", spec, err.Error())
+}
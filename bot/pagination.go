@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 列表每頁顯示的項目數
+const itemsPerPage = 8
+
+func pageCount(total, perPage int) int {
+	if total <= 0 || perPage <= 0 {
+		return 1
+	}
+	return (total + perPage - 1) / perPage
+}
+
+// clampPage 將頁碼（從 1 開始）限制在有效範圍內
+func clampPage(page, totalPages int) int {
+	if page < 1 {
+		return 1
+	}
+	if page > totalPages {
+		return totalPages
+	}
+	return page
+}
+
+// pageIndicator 只有多頁時才顯示「（第 2/5 頁）」
+func pageIndicator(page, totalPages int) string {
+	if totalPages <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("（第 %d/%d 頁）", page, totalPages)
+}
+
+// pageNavRow 產生 ◀️/▶️ 換頁按鈕，callback 格式為 "<prefix>:<頁碼>"；只有一頁時回傳 nil
+func pageNavRow(prefix string, page, totalPages int) []tgbotapi.InlineKeyboardButton {
+	if totalPages <= 1 {
+		return nil
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 1 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("%s:%d", prefix, page-1)))
+	}
+	row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d/%d", page, totalPages), fmt.Sprintf("%s:%d", prefix, page)))
+	if page < totalPages {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("%s:%d", prefix, page+1)))
+	}
+	return row
+}
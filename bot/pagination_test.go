@@ -0,0 +1,38 @@
+package bot
+
+import "testing"
+
+func TestPageCountAndClamp(t *testing.T) {
+	if got := pageCount(40, 8); got != 5 {
+		t.Fatalf("expected 5 pages, got %d", got)
+	}
+	if got := pageCount(41, 8); got != 6 {
+		t.Fatalf("expected 6 pages, got %d", got)
+	}
+	if got := pageCount(0, 8); got != 1 {
+		t.Fatalf("expected 1 page for empty list, got %d", got)
+	}
+	if got := clampPage(9, 5); got != 5 {
+		t.Fatalf("expected clamp to last page, got %d", got)
+	}
+	if got := clampPage(0, 5); got != 1 {
+		t.Fatalf("expected clamp to first page, got %d", got)
+	}
+}
+
+func TestPageNavRow(t *testing.T) {
+	if row := pageNavRow("listpage", 1, 1); row != nil {
+		t.Fatalf("expected no nav for single page, got %+v", row)
+	}
+
+	row := pageNavRow("listpage", 2, 5)
+	if len(row) != 3 {
+		t.Fatalf("expected prev/indicator/next, got %d buttons", len(row))
+	}
+	if *row[0].CallbackData != "listpage:1" || *row[2].CallbackData != "listpage:3" {
+		t.Fatalf("unexpected callbacks: %s %s", *row[0].CallbackData, *row[2].CallbackData)
+	}
+	if got := pageIndicator(2, 5); got != "（第 2/5 頁）" {
+		t.Fatalf("unexpected indicator: %q", got)
+	}
+}
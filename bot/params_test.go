@@ -1,6 +1,15 @@
 package bot
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"tg-bawer/gemini"
+)
 
 func TestParseTextParams_WithSingleImageFlag(t *testing.T) {
 	params := parseTextParams("翻譯這張圖 @16:9 @4K @s")
@@ -19,15 +28,268 @@ func TestParseTextParams_WithSingleImageFlag(t *testing.T) {
 	}
 }
 
-func TestBuildRetryQualities_NoDowngrade(t *testing.T) {
-	qualities := buildRetryQualities("4K")
-	if len(qualities) != 6 {
-		t.Fatalf("expected 6 retry qualities, got %d", len(qualities))
+func TestPlanRetries_NoBotRetriesForRateLimit(t *testing.T) {
+	// 429 已由 gemini.Client 重試，bot 不再疊加同畫質的重試
+	if qualities := planRetries("4K", &gemini.APIError{StatusCode: http.StatusTooManyRequests}); len(qualities) != 0 {
+		t.Fatalf("expected no retries for rate limits, got %v", qualities)
+	}
+}
+
+func TestPlanRetries_SkipsSafetyBlocks(t *testing.T) {
+	if qualities := planRetries("2K", &gemini.SafetyBlockError{Reason: "SAFETY"}); len(qualities) != 0 {
+		t.Fatalf("expected no retries for safety blocks, got %v", qualities)
+	}
+}
+
+func TestPlanRetries_DowngradesOnResourceErrors(t *testing.T) {
+	cases := []error{
+		&gemini.APIError{StatusCode: http.StatusServiceUnavailable},
+		context.DeadlineExceeded,
+	}
+	for _, err := range cases {
+		got := strings.Join(planRetries("4K", err), ",")
+		if got != "2K,1K" {
+			t.Fatalf("error %v: unexpected plan %s", err, got)
+		}
+	}
+
+	if got := planRetries("1K", context.DeadlineExceeded); len(got) != 0 {
+		t.Fatalf("expected no lower quality than 1K, got %v", got)
+	}
+}
+
+func TestParseTextParams_WithVoiceFlag(t *testing.T) {
+	params := parseTextParams("翻譯這張圖 @voice @2K")
+
+	if params.Prompt != "翻譯這張圖" {
+		t.Fatalf("unexpected prompt: %q", params.Prompt)
+	}
+	if !params.WithVoice {
+		t.Fatalf("expected WithVoice=true")
+	}
+	if params.Quality != "2K" {
+		t.Fatalf("unexpected quality: %q", params.Quality)
+	}
+
+	if parseTextParams("翻譯這張圖").WithVoice {
+		t.Fatalf("expected WithVoice=false without flag")
+	}
+}
+
+func TestParseTextParams_UpscaleFlag(t *testing.T) {
+	params := parseTextParams("@upscale")
+
+	if !params.Upscale {
+		t.Fatalf("expected Upscale=true")
+	}
+	if params.Prompt != "" {
+		t.Fatalf("expected empty prompt, got %q", params.Prompt)
+	}
+	if parseTextParams("放大這張圖").Upscale {
+		t.Fatalf("expected Upscale=false without flag")
+	}
+}
+
+func TestParseTextParams_EnhanceFlag(t *testing.T) {
+	params := parseTextParams("窗邊的貓 @enhance")
+
+	if !params.Enhance {
+		t.Fatalf("expected Enhance=true")
+	}
+	if params.Prompt != "窗邊的貓" {
+		t.Fatalf("expected prompt without flag, got %q", params.Prompt)
+	}
+	if parseTextParams("窗邊的貓").Enhance {
+		t.Fatalf("expected Enhance=false without flag")
+	}
+}
+
+func TestParseTextParams_PageSelection(t *testing.T) {
+	params := parseTextParams("翻譯 @pages=1-3 @4K")
+	if params.PagesError != "" {
+		t.Fatalf("unexpected pages error %q", params.PagesError)
+	}
+	if got := fmt.Sprint(params.PageSelection); got != "[1 2 3]" {
+		t.Fatalf("unexpected selection %s", got)
+	}
+	if params.Prompt != "翻譯" || params.Quality != "4K" {
+		t.Fatalf("unexpected prompt/quality %q %q", params.Prompt, params.Quality)
+	}
+
+	params = parseTextParams("@pages=1,4,5,4")
+	if got := fmt.Sprint(params.PageSelection); got != "[1 4 5]" {
+		t.Fatalf("unexpected selection %s", got)
 	}
 
-	for i, quality := range qualities {
-		if quality != "4K" {
-			t.Fatalf("retry #%d unexpected quality: %s", i, quality)
+	for _, bad := range []string{"@pages=", "@pages=3-1", "@pages=0", "@pages=a,b", "@pages=1-"} {
+		params = parseTextParams(bad)
+		if params.PagesError == "" || params.PageSelection != nil {
+			t.Fatalf("expected pages error for %q", bad)
+		}
+	}
+}
+
+func TestParseTextParams_Variants(t *testing.T) {
+	params := parseTextParams("畫一隻貓 @variants=3 @2K")
+	if params.VariantsError != "" || params.Variants != 3 {
+		t.Fatalf("unexpected variants %d (error %q)", params.Variants, params.VariantsError)
+	}
+	if params.Prompt != "畫一隻貓" || params.Quality != "2K" {
+		t.Fatalf("unexpected prompt/quality %q %q", params.Prompt, params.Quality)
+	}
+
+	if parseTextParams("畫一隻貓").Variants != 0 {
+		t.Fatalf("expected no variants without flag")
+	}
+
+	for _, bad := range []string{"@variants=", "@variants=0", "@variants=-2", "@variants=abc"} {
+		params = parseTextParams(bad)
+		if params.VariantsError == "" || params.Variants != 0 {
+			t.Fatalf("expected variants error for %q", bad)
+		}
+	}
+}
+
+func TestParseTextParams_TemperatureAndSeed(t *testing.T) {
+	params := parseTextParams("畫一隻貓 @temp=0.7 @seed=42")
+	if params.TemperatureError != "" || params.SeedError != "" {
+		t.Fatalf("unexpected errors %q %q", params.TemperatureError, params.SeedError)
+	}
+	if params.Temperature == nil || *params.Temperature != 0.7 || params.Seed == nil || *params.Seed != 42 {
+		t.Fatalf("unexpected temperature/seed %v %v", params.Temperature, params.Seed)
+	}
+	if params.Prompt != "畫一隻貓" {
+		t.Fatalf("unexpected prompt %q", params.Prompt)
+	}
+
+	if p := parseTextParams("@temp=0 @temp=2"); p.TemperatureError != "" || *p.Temperature != 2 {
+		t.Fatalf("expected boundary temperatures to be accepted, got %+v", p)
+	}
+	if p := parseTextParams("畫一隻貓"); p.Temperature != nil || p.Seed != nil {
+		t.Fatalf("expected no overrides without flags")
+	}
+
+	for _, bad := range []string{"@temp=", "@temp=-0.1", "@temp=2.5", "@temp=hot", "@temp=NaN", "@temp=nan", "@temp=Inf"} {
+		if p := parseTextParams(bad); p.TemperatureError == "" || p.Temperature != nil {
+			t.Fatalf("expected temperature error for %q", bad)
+		}
+	}
+	for _, bad := range []string{"@seed=", "@seed=1.5", "@seed=abc", "@seed=99999999999"} {
+		if p := parseTextParams(bad); p.SeedError == "" || p.Seed != nil {
+			t.Fatalf("expected seed error for %q", bad)
+		}
+	}
+}
+
+func TestClampVariants(t *testing.T) {
+	tests := []struct{ requested, max, want int }{
+		{0, 4, 1},
+		{3, 4, 3},
+		{8, 4, 4},
+		{20, 50, maxMediaGroupSize},
+		{3, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := clampVariants(tt.requested, tt.max); got != tt.want {
+			t.Errorf("clampVariants(%d, %d) = %d, want %d", tt.requested, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestSelectPages_ValidatesAgainstCount(t *testing.T) {
+	items := []string{"a", "b", "c"}
+
+	got, err := selectPages(items, []int{3, 1})
+	if err != nil {
+		t.Fatalf("selectPages failed: %v", err)
+	}
+	if fmt.Sprint(got) != "[c a]" {
+		t.Fatalf("unexpected selection %v", got)
+	}
+
+	if got, _ := selectPages(items, nil); len(got) != 3 {
+		t.Fatalf("expected all items without selection, got %v", got)
+	}
+
+	if _, err := selectPages(items, []int{1, 4}); err == nil {
+		t.Fatalf("expected out-of-range error")
+	}
+}
+
+func TestTruncateRunes_KeepsUTF8Valid(t *testing.T) {
+	text := strings.Repeat("漫畫翻譯", 10)
+
+	got := truncateRunes(text, 30, "...")
+	if !utf8.ValidString(got) {
+		t.Fatalf("truncated text is not valid UTF-8: %q", got)
+	}
+	if want := string([]rune(text)[:30]) + "..."; got != want {
+		t.Fatalf("unexpected truncation %q", got)
+	}
+	if got := truncateRunes("短", 30, "..."); got != "短" {
+		t.Fatalf("short text should be unchanged, got %q", got)
+	}
+
+	errText := truncateError(strings.Repeat("錯", 250))
+	if !utf8.ValidString(errText) || !strings.HasPrefix(errText, strings.Repeat("錯", 200)+"...") {
+		t.Fatalf("unexpected truncated error %q", errText)
+	}
+}
+
+func TestResultCaption_ShowsFallbackModel(t *testing.T) {
+	result := &gemini.ImageResult{Text: "已翻譯", Model: "gemini-2.5-flash-image", Fallback: true}
+	if got := resultCaption(langZhHant, result); got != "🔁 主要模型無法使用，改由 gemini-2.5-flash-image 生成\n已翻譯" {
+		t.Fatalf("unexpected caption %q", got)
+	}
+	if got := resultCaption(langEn, result); !strings.HasPrefix(got, "🔁 The primary model is unavailable; generated with gemini-2.5-flash-image\n") {
+		t.Fatalf("unexpected English caption %q", got)
+	}
+	result = &gemini.ImageResult{Model: "gemini-3-pro-image-preview"}
+	if got := resultCaption(langZhHant, result); got != "" {
+		t.Fatalf("primary model should not be shown, got %q", got)
+	}
+}
+
+func TestParseTextParams_Model(t *testing.T) {
+	params := parseTextParams("畫一隻貓 @model=gemini-2.5-flash-image")
+	if params.ModelError != "" || params.Model != "gemini-2.5-flash-image" {
+		t.Fatalf("unexpected model %q (error %q)", params.Model, params.ModelError)
+	}
+	if params.Prompt != "畫一隻貓" {
+		t.Fatalf("unexpected prompt %q", params.Prompt)
+	}
+	if p := parseTextParams("@model=models/gemini-3-pro-image-preview"); p.Model != "gemini-3-pro-image-preview" {
+		t.Fatalf("expected models/ prefix to be stripped, got %q", p.Model)
+	}
+	if p := parseTextParams("畫一隻貓"); p.Model != "" {
+		t.Fatalf("expected no model without flag, got %q", p.Model)
+	}
+	for _, bad := range []string{"@model=", "@model=../x", "@model=a/b", "@model=-x"} {
+		if p := parseTextParams(bad); p.ModelError == "" || p.Model != "" {
+			t.Fatalf("expected model error for %q", bad)
+		}
+	}
+}
+
+func TestParseTextParams_Format(t *testing.T) {
+	params := parseTextParams("翻譯 @format=JPG")
+	if params.Format != "jpeg" || params.FormatError != "" {
+		t.Fatalf("unexpected format %q / error %q", params.Format, params.FormatError)
+	}
+	params = parseTextParams("翻譯 @format=bmp")
+	if params.FormatError != "format=bmp" {
+		t.Fatalf("expected format error, got %q", params.FormatError)
+	}
+}
+
+func TestParseTextParams_JPEGQuality(t *testing.T) {
+	params := parseTextParams("翻譯 @format=jpeg @jpegq=85")
+	if params.JPEGQuality != 85 || params.JPEGQualityError != "" {
+		t.Fatalf("unexpected quality %d / error %q", params.JPEGQuality, params.JPEGQualityError)
+	}
+	for _, bad := range []string{"@jpegq=0", "@jpegq=101", "@jpegq=high"} {
+		if p := parseTextParams("翻譯 " + bad); p.JPEGQualityError == "" || p.JPEGQuality != 0 {
+			t.Fatalf("%s: expected error, got quality %d", bad, p.JPEGQuality)
 		}
 	}
 }
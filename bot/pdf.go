@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// pdfRenderTimeout 轉換整份 PDF 的逾時
+const pdfRenderTimeout = 2 * time.Minute
+
+// isPDFDocument 判斷文件是否為 PDF
+func isPDFDocument(doc *tgbotapi.Document) bool {
+	if doc == nil {
+		return false
+	}
+	return doc.MimeType == "application/pdf" || strings.HasSuffix(strings.ToLower(doc.FileName), ".pdf")
+}
+
+// renderPDFPages 呼叫外部程式（pdftoppm 參數格式）將 PDF 前 maxPages 頁轉成 PNG
+func renderPDFPages(ctx context.Context, renderer string, data []byte, maxPages int) ([][]byte, error) {
+	dir, err := os.MkdirTemp("", "tg-bawer-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.pdf")
+	if err := os.WriteFile(input, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, renderer, "-png", "-r", "150", "-f", "1", "-l", strconv.Itoa(maxPages), input, filepath.Join(dir, "page"))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("render pdf: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// pdftoppm 輸出 page-1.png 或 page-01.png 等補零檔名，補零後字典序即頁序
+	files, err := filepath.Glob(filepath.Join(dir, "page*.png"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	if len(files) > maxPages {
+		files = files[:maxPages]
+	}
+
+	pages := make([][]byte, 0, len(files))
+	for _, file := range files {
+		page, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("render pdf: no pages rendered")
+	}
+	return pages, nil
+}
+
+// handlePDFDocument 將 PDF 每頁轉成圖片後逐頁生成，每頁回覆一份結果
+func (b *Bot) handlePDFDocument(msg *tgbotapi.Message) {
+	if !b.config.EnablePdf {
+		if msg.Chat.IsPrivate() {
+			b.sendReplyMessage(msg, "❌ 此 Bot 未啟用 PDF 處理")
+		}
+		return
+	}
+
+	params := parseTextParams(strings.TrimSpace(strings.TrimPrefix(msg.Caption, ".")))
+	lang := b.userLang(msg.From)
+	if params.RatioError != "" || params.QualityError != "" || params.PagesError != "" ||
+		params.VariantsError != "" || params.TemperatureError != "" || params.SeedError != "" ||
+		params.ModelError != "" || params.FormatError != "" || params.JPEGQualityError != "" {
+		b.sendReplyMessage(msg, paramErrorText(lang, params))
+		return
+	}
+
+	serviceConfig, serviceName, err := b.resolveServiceConfig(msg.From.ID)
+	if err != nil {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, tr(lang, "error.no_service", err.Error()))
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+	gClient := b.newGeminiClient(serviceConfig)
+
+	quality := params.Quality
+	if quality == "" {
+		quality = b.resolveDefaultQuality(msg)
+	}
+	prompt := params.Prompt
+	if prompt == "" {
+		prompt = b.resolveMessageDefaultPrompt(msg)
+	}
+	if b.rejectBlockedPrompt(msg, prompt, quality) {
+		return
+	}
+	if params.Prompt != "" {
+		b.db.AddToHistory(msg.From.ID, prompt)
+	}
+
+	processingMsg, err := b.sendReplyMessage(msg, fmt.Sprintf("⏳ *轉換 PDF 中...*\n\n🔌 服務：%s\n🎨 畫質：`%s`\n📄 最多 %d 頁",
+		markdownCode(serviceName), quality, b.config.MaxPdfPages))
+	if err != nil {
+		return
+	}
+
+	downloaded, err := b.downloadImagesByFileIDs([]string{msg.Document.FileID}, nil)
+	if err != nil {
+		b.updateMessageHTML(processingMsg, withErrorHint(lang, fmt.Sprintf("❌ <b>處理失敗</b>\n\n下載 PDF 失敗\n\n<blockquote expandable>%s</blockquote>",
+			html.EscapeString(truncateError(err.Error()))), err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdfRenderTimeout)
+	pages, err := renderPDFPages(ctx, b.config.PdfRenderer, downloaded[0].Data, b.config.MaxPdfPages)
+	cancel()
+	if err != nil {
+		b.updateMessageHTML(processingMsg, fmt.Sprintf("❌ <b>處理失敗</b>\n\nPDF 轉換失敗\n\n<blockquote expandable>%s</blockquote>",
+			html.EscapeString(truncateError(err.Error()))))
+		return
+	}
+
+	pages, err = selectPages(pages, params.PageSelection)
+	if err != nil {
+		b.updateMessageMarkdown(processingMsg, pagesErrorText(params.PageSpec, err))
+		return
+	}
+
+	// 逐頁處理，每頁都要取得全域生成名額；整份 PDF 為一個工作，從 /jobs 取消後不再處理後續頁面
+	ctx, finishJob := b.startJob(msg, prompt, quality, params.AspectRatio)
+	defer finishJob()
+	failed := 0
+	genOpts := b.generationOptions(params, msg.From.ID)
+	for i, page := range pages {
+		b.updateMessageMarkdown(processingMsg, fmt.Sprintf("⏳ *生成圖片中...*\n\n🔌 服務：%s\n🎨 畫質：`%s`\n📄 第 %d/%d 頁",
+			markdownCode(serviceName), quality, i+1, len(pages)))
+
+		images := []gemini.DownloadedImage{{Data: page, MimeType: "image/png"}}
+		aspectRatio := resolveAspectRatio(params.AspectRatio, "", images, b.ratioTolerance())
+		result, logID, err := b.generateWithFallback(ctx, msg.From.ID, msg.Chat.ID, gClient, images, prompt, quality, aspectRatio, genOpts)
+		if err != nil && ctx.Err() != nil {
+			b.updateMessageMarkdown(processingMsg, fmt.Sprintf("🛑 *已取消 PDF 處理*\n\n📄 已完成 %d/%d 頁", i-failed, len(pages)))
+			return
+		}
+		if err != nil {
+			failed++
+			notice := tgbotapi.NewMessage(msg.Chat.ID, withErrorHint(lang, fmt.Sprintf("❌ 第 %d 頁處理失敗\n\n<blockquote expandable>%s</blockquote>",
+				i+1, html.EscapeString(truncateError(err.Error()))), err))
+			notice.ParseMode = "HTML"
+			notice.ReplyToMessageID = msg.MessageID
+			b.api.Send(notice)
+			continue
+		}
+		b.sendGeneratedResult(lang, msg.Chat.ID, msg.MessageID, quality, result, nil, logID)
+	}
+
+	b.updateMessageMarkdown(processingMsg, fmt.Sprintf("✅ *PDF 處理完成*\n\n📄 共 %d 頁，成功 %d 頁", len(pages), len(pages)-failed))
+}
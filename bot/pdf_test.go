@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestIsPDFDocument(t *testing.T) {
+	cases := []struct {
+		doc  *tgbotapi.Document
+		want bool
+	}{
+		{nil, false},
+		{&tgbotapi.Document{MimeType: "application/pdf"}, true},
+		{&tgbotapi.Document{FileName: "Chapter01.PDF"}, true},
+		{&tgbotapi.Document{MimeType: "image/png", FileName: "page.png"}, false},
+	}
+	for _, tc := range cases {
+		if got := isPDFDocument(tc.doc); got != tc.want {
+			t.Fatalf("isPDFDocument(%+v) = %v, want %v", tc.doc, got, tc.want)
+		}
+	}
+}
+
+func TestRenderPDFPages_UsesRendererOutputInOrder(t *testing.T) {
+	// 假的 renderer：依 pdftoppm 參數格式在輸出前綴後寫出三頁（最後一個參數為前綴）
+	script := filepath.Join(t.TempDir(), "fake-pdftoppm")
+	content := `#!/bin/sh
+for last; do :; done
+printf 'p2' > "$last-02.png"
+printf 'p1' > "$last-01.png"
+printf 'p3' > "$last-03.png"
+`
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatalf("write script failed: %v", err)
+	}
+
+	pages, err := renderPDFPages(context.Background(), script, []byte("%PDF-1.4"), 2)
+	if err != nil {
+		t.Fatalf("renderPDFPages failed: %v", err)
+	}
+	if len(pages) != 2 || string(pages[0]) != "p1" || string(pages[1]) != "p2" {
+		t.Fatalf("unexpected pages: %q", pages)
+	}
+}
+
+func TestRenderPDFPages_ReportsRendererFailure(t *testing.T) {
+	if _, err := renderPDFPages(context.Background(), "/nonexistent/pdftoppm", []byte("%PDF-1.4"), 1); err == nil {
+		t.Fatalf("expected error for missing renderer")
+	}
+}
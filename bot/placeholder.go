@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"log"
+
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// placeholderSize 預覽圖最長邊（像素），只求讓使用者先看到大概的樣子
+const placeholderSize = 32
+
+// makePlaceholder 將結果縮成極小的 JPEG 預覽
+func makePlaceholder(data []byte) ([]byte, error) {
+	return makeThumbnail(data, placeholderSize)
+}
+
+// sendPlaceholder 生成完成後先送出極小的預覽圖，完整圖片送出後呼叫回傳的函式刪除它
+// 未啟用 SEND_PLACEHOLDER 或送出失敗時回傳空函式
+func (b *Bot) sendPlaceholder(chatID int64, replyToMessageID int, result *gemini.ImageResult) func() {
+	if !b.config.SendPlaceholder || result == nil {
+		return func() {}
+	}
+	data, err := makePlaceholder(result.ImageData)
+	if err != nil {
+		log.Printf("產生預覽圖失敗: %v", err)
+		return func() {}
+	}
+
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: "placeholder.jpg", Bytes: data})
+	photo.Caption = "⏳ 預覽，完整圖片上傳中..."
+	photo.ReplyToMessageID = replyToMessageID
+	sent, err := b.api.Send(photo)
+	if err != nil {
+		log.Printf("發送預覽圖失敗: %v", err)
+		return func() {}
+	}
+	return func() {
+		b.api.Request(tgbotapi.NewDeleteMessage(chatID, sent.MessageID))
+	}
+}
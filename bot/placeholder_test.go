@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"tg-bawer/config"
+	"tg-bawer/gemini"
+)
+
+func TestMakePlaceholder(t *testing.T) {
+	source := encodeTestPNG(t, 900, 1600)
+	placeholder, err := makePlaceholder(source)
+	if err != nil {
+		t.Fatalf("makePlaceholder failed: %v", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(placeholder))
+	if err != nil {
+		t.Fatalf("decode placeholder failed: %v", err)
+	}
+	if format != "jpeg" || cfg.Height != placeholderSize || cfg.Width != 18 {
+		t.Fatalf("expected 18x32 jpeg, got %dx%d %s", cfg.Width, cfg.Height, format)
+	}
+	if len(placeholder) >= len(source) {
+		t.Fatalf("placeholder (%d bytes) should be smaller than the source (%d bytes)", len(placeholder), len(source))
+	}
+
+	if _, err := makePlaceholder([]byte("not an image")); err == nil {
+		t.Fatal("expected error for invalid image data")
+	}
+}
+
+func TestSendPlaceholder_DisabledIsNoop(t *testing.T) {
+	// 未啟用時不應呼叫 API（b.api 為 nil）
+	b := &Bot{config: &config.Config{}}
+	remove := b.sendPlaceholder(1, 2, &gemini.ImageResult{ImageData: encodeTestPNG(t, 10, 10)})
+	remove()
+}
@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bawer/database"
+)
+
+const (
+	// promptThumbnailSize 縮圖最長邊（像素），控制資料庫大小
+	promptThumbnailSize = 256
+	// maxPromptThumbnails /list preview 一次最多發送的縮圖數（Telegram Media Group 上限）
+	maxPromptThumbnails = 10
+)
+
+// makeThumbnail 將圖片等比例縮到最長邊不超過 maxDim，輸出 JPEG
+func makeThumbnail(data []byte, maxDim int) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	height := bounds.Dy()
+	if longest := max(bounds.Dx(), bounds.Dy()); longest > maxDim {
+		height = bounds.Dy() * maxDim / longest
+		if height < 1 {
+			height = 1
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleToHeight(src, height), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// matchSavedPrompt 找出內容與 prompt 相同的保存 Prompt，有多個時優先取預設
+func matchSavedPrompt(prompts []database.SavedPrompt, prompt string) *database.SavedPrompt {
+	prompt = strings.TrimSpace(prompt)
+	var matched *database.SavedPrompt
+	for i := range prompts {
+		if strings.TrimSpace(prompts[i].Prompt) != prompt {
+			continue
+		}
+		if matched == nil || prompts[i].IsDefault {
+			matched = &prompts[i]
+		}
+	}
+	return matched
+}
+
+// savePromptThumbnail 生成成功後，若使用的是保存的 Prompt，記下結果縮圖供 /list preview 顯示
+func (b *Bot) savePromptThumbnail(userID int64, prompt string, result []byte) {
+	prompts, err := b.db.GetSavedPrompts(userID)
+	if err != nil {
+		return
+	}
+	saved := matchSavedPrompt(prompts, prompt)
+	if saved == nil {
+		return
+	}
+
+	thumbnail, err := makeThumbnail(result, promptThumbnailSize)
+	if err != nil {
+		log.Printf("產生 Prompt 縮圖失敗: %v", err)
+		return
+	}
+	if err := b.db.SetPromptThumbnail(userID, saved.ID, thumbnail); err != nil {
+		log.Printf("保存 Prompt 縮圖失敗: %v", err)
+	}
+}
+
+// sendPromptThumbnails /list preview：依目前排序發送各 Prompt 最近一次結果的縮圖
+func (b *Bot) sendPromptThumbnails(msg *tgbotapi.Message) {
+	total, err := b.db.CountSavedPrompts(msg.From.ID)
+	if err != nil || total == 0 {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "📝 尚未保存任何 Prompt\n使用 /save <名稱> <prompt> 來保存"))
+		return
+	}
+
+	order, _ := b.db.GetUserListSort(msg.From.ID)
+	prompts, err := b.db.GetSavedPromptsPage(msg.From.ID, order, total, 0)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 取得失敗："+err.Error()))
+		return
+	}
+
+	var media []interface{}
+	for _, p := range prompts {
+		thumbnail, err := b.db.GetPromptThumbnail(msg.From.ID, p.ID)
+		if err != nil || thumbnail == nil {
+			continue
+		}
+		photo := tgbotapi.NewInputMediaPhoto(tgbotapi.FileBytes{Name: fmt.Sprintf("prompt_%d.jpg", p.ID), Bytes: thumbnail})
+		photo.Caption = p.Name
+		media = append(media, photo)
+		if len(media) == maxPromptThumbnails {
+			break
+		}
+	}
+
+	switch len(media) {
+	case 0:
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "🖼 還沒有任何縮圖\n使用保存的 Prompt 生成成功後會自動記錄"))
+	case 1:
+		only := media[0].(tgbotapi.InputMediaPhoto)
+		photo := tgbotapi.NewPhoto(msg.Chat.ID, only.Media)
+		photo.Caption = only.Caption
+		b.api.Send(photo)
+	default:
+		if _, err := b.api.SendMediaGroup(tgbotapi.NewMediaGroup(msg.Chat.ID, media)); err != nil {
+			log.Printf("發送 Prompt 縮圖失敗: %v", err)
+		}
+	}
+}
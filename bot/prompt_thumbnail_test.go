@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"tg-bawer/database"
+)
+
+func TestMakeThumbnail_BoundsLongestSide(t *testing.T) {
+	thumbnail, err := makeThumbnail(encodeTestPNG(t, 1200, 600), promptThumbnailSize)
+	if err != nil {
+		t.Fatalf("makeThumbnail failed: %v", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatalf("decode thumbnail failed: %v", err)
+	}
+	if format != "jpeg" {
+		t.Fatalf("expected jpeg thumbnail, got %s", format)
+	}
+	if cfg.Width != 256 || cfg.Height != 128 {
+		t.Fatalf("expected 256x128, got %dx%d", cfg.Width, cfg.Height)
+	}
+
+	// 小圖不放大
+	small, err := makeThumbnail(encodeTestPNG(t, 100, 50), promptThumbnailSize)
+	if err != nil {
+		t.Fatalf("makeThumbnail small failed: %v", err)
+	}
+	if cfg, _, _ := image.DecodeConfig(bytes.NewReader(small)); cfg.Width != 100 || cfg.Height != 50 {
+		t.Fatalf("expected small image to keep size, got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestMatchSavedPrompt_PrefersDefault(t *testing.T) {
+	prompts := []database.SavedPrompt{
+		{ID: 1, Name: "a", Prompt: "翻譯成中文"},
+		{ID: 2, Name: "b", Prompt: "翻譯成中文", IsDefault: true},
+		{ID: 3, Name: "c", Prompt: "其他"},
+	}
+	if got := matchSavedPrompt(prompts, " 翻譯成中文 "); got == nil || got.ID != 2 {
+		t.Fatalf("expected default prompt 2, got %+v", got)
+	}
+	if got := matchSavedPrompt(prompts, "沒有保存"); got != nil {
+		t.Fatalf("expected no match, got %+v", got)
+	}
+}
@@ -0,0 +1,40 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// parsePurgeDays 解析 /purgehistory 的天數，必須是正整數
+func parsePurgeDays(arg string) (int, bool) {
+	days, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil || days <= 0 {
+		return 0, false
+	}
+	return days, true
+}
+
+// cmdPurgeHistory /purgehistory <天數>：刪除所有使用者超過 N 天的使用歷史與生成紀錄並壓縮資料庫，限管理員
+func (b *Bot) cmdPurgeHistory(msg *tgbotapi.Message) {
+	if !b.config.IsAdmin(msg.From.ID) {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 只有管理員可以使用此指令"))
+		return
+	}
+
+	days, ok := parsePurgeDays(msg.CommandArguments())
+	if !ok {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/purgehistory <天數>\n刪除所有使用者超過指定天數的使用歷史與生成紀錄"))
+		return
+	}
+
+	removed, err := b.db.PurgeOldHistory(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("❌ 清除失敗（已刪除 %d 筆）：%s", removed, err.Error())))
+		return
+	}
+	b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🧹 已刪除 %d 天前的使用歷史與生成紀錄，共 %d 筆", days, removed)))
+}
@@ -0,0 +1,34 @@
+package bot
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cmdRandom /random [@參數]：隨機挑一個保存的 Prompt，對訊息中或回覆的圖片生成
+func (b *Bot) cmdRandom(msg *tgbotapi.Message) {
+	chosen, err := b.db.GetRandomPrompt(msg.From.ID)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 讀取 Prompt 失敗："+err.Error()))
+		return
+	}
+	if chosen == nil {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "📝 尚未保存任何 Prompt\n使用 /save <名稱> <prompt> 保存後再試")
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
+	b.sendReplyMessage(msg, "🎲 隨機選到："+markdownBold(chosen.Name))
+	b.handleTextMessage(randomPromptMessage(msg, chosen.Prompt))
+}
+
+// randomPromptMessage 把指令訊息改寫成以選中 Prompt 為內容的一般訊息，
+// 指令後的 @參數 會接在 Prompt 後面，圖片與回覆對象維持不變
+func randomPromptMessage(msg *tgbotapi.Message, prompt string) *tgbotapi.Message {
+	rewritten := *msg
+	rewritten.Text = strings.TrimSpace(prompt + " " + msg.CommandArguments())
+	rewritten.Entities = nil
+	return &rewritten
+}
@@ -0,0 +1,33 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRandomPromptMessage_AppendsCommandParams(t *testing.T) {
+	reply := &tgbotapi.Message{MessageID: 5}
+	msg := &tgbotapi.Message{
+		MessageID:      9,
+		Text:           "/random @16:9 @4K",
+		Entities:       []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 7}},
+		ReplyToMessage: reply,
+	}
+
+	rewritten := randomPromptMessage(msg, "翻譯這張漫畫")
+	if rewritten.Text != "翻譯這張漫畫 @16:9 @4K" {
+		t.Fatalf("unexpected text %q", rewritten.Text)
+	}
+	if rewritten.IsCommand() || rewritten.ReplyToMessage != reply || rewritten.MessageID != 9 {
+		t.Fatalf("unexpected rewritten message %+v", rewritten)
+	}
+	if msg.Text != "/random @16:9 @4K" || !msg.IsCommand() {
+		t.Fatalf("original message should not be modified")
+	}
+
+	params := parseTextParams(rewritten.Text)
+	if params.Prompt != "翻譯這張漫畫" || params.AspectRatio != "16:9" || params.Quality != "4K" {
+		t.Fatalf("unexpected params %+v", params)
+	}
+}
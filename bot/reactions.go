@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 訊息反應（Bot API 7.0 的 message_reaction）在 tgbotapi v5.5.1 中沒有對應欄位，
+// 由 forumClient 從 getUpdates 的原始回應取出後交給 handleReaction：
+// 對生成結果按 👍/👎 等同評分按鈕，按 🔁（或 ⚡，Telegram 預設反應沒有 🔁）以相同參數重新生成
+
+// allowedUpdates 訂閱的更新類型；明確列出才會收到 message_reaction
+var allowedUpdates = []string{"message", "callback_query", "inline_query", "message_reaction"}
+
+// maxTrackedResults 最多記住幾則結果訊息，超過時整批清空
+const maxTrackedResults = 5000
+
+type reactionType struct {
+	Type  string `json:"type"`
+	Emoji string `json:"emoji"`
+}
+
+// messageReaction 使用者對訊息的反應變更；匿名管理員（actor_chat）沒有 User
+type messageReaction struct {
+	Chat        tgbotapi.Chat  `json:"chat"`
+	MessageID   int            `json:"message_id"`
+	User        *tgbotapi.User `json:"user"`
+	OldReaction []reactionType `json:"old_reaction"`
+	NewReaction []reactionType `json:"new_reaction"`
+}
+
+// parseReactionUpdates 從 getUpdates 的回應取出 message_reaction 更新
+func parseReactionUpdates(body []byte) []messageReaction {
+	var resp struct {
+		Result []struct {
+			MessageReaction *messageReaction `json:"message_reaction"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil
+	}
+	var reactions []messageReaction
+	for _, update := range resp.Result {
+		if update.MessageReaction != nil {
+			reactions = append(reactions, *update.MessageReaction)
+		}
+	}
+	return reactions
+}
+
+// reactionDiff 這次新增與移除的 emoji 反應（自訂 emoji 不處理）
+func reactionDiff(r messageReaction) (added, removed []string) {
+	emojis := func(types []reactionType) map[string]bool {
+		set := make(map[string]bool)
+		for _, t := range types {
+			if t.Type == "emoji" {
+				set[t.Emoji] = true
+			}
+		}
+		return set
+	}
+	oldSet, newSet := emojis(r.OldReaction), emojis(r.NewReaction)
+	for _, t := range r.NewReaction {
+		if t.Type == "emoji" && !oldSet[t.Emoji] {
+			added = append(added, t.Emoji)
+		}
+	}
+	for _, t := range r.OldReaction {
+		if t.Type == "emoji" && !newSet[t.Emoji] {
+			removed = append(removed, t.Emoji)
+		}
+	}
+	return added, removed
+}
+
+// reactionRating 評分用的反應，其他反應回傳 0
+func reactionRating(emoji string) int {
+	switch emoji {
+	case "👍":
+		return 1
+	case "👎":
+		return -1
+	}
+	return 0
+}
+
+// isRegenerateReaction 是否為重新生成的反應
+func isRegenerateReaction(emoji string) bool {
+	return emoji == "🔁" || emoji == "⚡"
+}
+
+// resultMessage 結果訊息對應的生成紀錄；document 為帶有按鈕的原畫質檔案
+type resultMessage struct {
+	logID    int64
+	document bool
+}
+
+// resultMessageIndex 記錄 Bot 送出的結果訊息，只有這些訊息的反應會被處理
+type resultMessageIndex struct {
+	mu  sync.RWMutex
+	ids map[threadKey]resultMessage
+}
+
+func newResultMessageIndex() *resultMessageIndex {
+	return &resultMessageIndex{ids: make(map[threadKey]resultMessage)}
+}
+
+func (r *resultMessageIndex) record(chatID int64, messageID int, result resultMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.ids) >= maxTrackedResults {
+		r.ids = make(map[threadKey]resultMessage)
+	}
+	r.ids[threadKey{chatID: chatID, messageID: messageID}] = result
+}
+
+func (r *resultMessageIndex) lookup(chatID int64, messageID int) (resultMessage, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result, ok := r.ids[threadKey{chatID: chatID, messageID: messageID}]
+	return result, ok
+}
+
+// trackResultMessage 記下送出的結果訊息，之後對它的反應可以評分或重新生成
+func (b *Bot) trackResultMessage(sent tgbotapi.Message, logID int64, document bool) {
+	if logID <= 0 || sent.Chat == nil {
+		return
+	}
+	b.results.record(sent.Chat.ID, sent.MessageID, resultMessage{logID: logID, document: document})
+}
+
+// handleReaction 處理結果訊息上的反應，只接受發起該次生成的使用者
+func (b *Bot) handleReaction(r messageReaction) {
+	if r.User == nil {
+		return
+	}
+	result, ok := b.results.lookup(r.Chat.ID, r.MessageID)
+	if !ok {
+		return
+	}
+	entry, err := b.db.GetGenerationLog(result.logID)
+	if err != nil || entry == nil || entry.UserID != r.User.ID {
+		return
+	}
+
+	added, removed := reactionDiff(r)
+	rating := entry.Rating
+	for _, emoji := range removed {
+		// 收回評分反應時一併取消評分
+		if reactionRating(emoji) != 0 && reactionRating(emoji) == rating {
+			rating = 0
+		}
+	}
+	regenerate := false
+	for _, emoji := range added {
+		if v := reactionRating(emoji); v != 0 {
+			rating = v
+		}
+		if isRegenerateReaction(emoji) {
+			regenerate = true
+		}
+	}
+
+	if rating != entry.Rating {
+		if err := b.db.RateGeneration(result.logID, rating); err != nil {
+			log.Printf("記錄反應評分失敗 (log=%d): %v", result.logID, err)
+		} else if result.document {
+			b.api.Send(tgbotapi.NewEditMessageReplyMarkup(r.Chat.ID, r.MessageID, b.resultKeyboard(result.logID, rating)))
+		}
+	}
+
+	if regenerate {
+		var payload failedGenerationPayload
+		if entry.Payload == "" || json.Unmarshal([]byte(entry.Payload), &payload) != nil {
+			return
+		}
+		b.redoGeneration(r.Chat.ID, r.MessageID, r.User.ID, b.userLang(r.User), payload)
+	}
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const reactionUpdates = `{"ok":true,"result":[
+	{"update_id":1,"message":{"message_id":10,"chat":{"id":5,"type":"private"},"text":"hi"}},
+	{"update_id":2,"message_reaction":{"chat":{"id":5,"type":"private"},"message_id":20,"user":{"id":5,"first_name":"A","language_code":"en"},"date":1,
+		"old_reaction":[{"type":"emoji","emoji":"👎"}],
+		"new_reaction":[{"type":"emoji","emoji":"👍"},{"type":"custom_emoji","custom_emoji_id":"123"}]}},
+	{"update_id":3,"message_reaction":{"chat":{"id":-100,"type":"supergroup"},"message_id":21,"actor_chat":{"id":-100,"type":"supergroup"},"date":1,
+		"old_reaction":[],"new_reaction":[{"type":"emoji","emoji":"⚡"}]}}
+]}`
+
+func TestParseReactionUpdates(t *testing.T) {
+	reactions := parseReactionUpdates([]byte(reactionUpdates))
+	if len(reactions) != 2 {
+		t.Fatalf("expected 2 reactions, got %+v", reactions)
+	}
+	first := reactions[0]
+	if first.Chat.ID != 5 || first.MessageID != 20 || first.User == nil || first.User.ID != 5 || first.User.LanguageCode != "en" {
+		t.Fatalf("unexpected reaction %+v", first)
+	}
+	if reactions[1].User != nil {
+		t.Fatal("anonymous reactions should have no user")
+	}
+
+	added, removed := reactionDiff(first)
+	if !reflect.DeepEqual(added, []string{"👍"}) || !reflect.DeepEqual(removed, []string{"👎"}) {
+		t.Fatalf("unexpected diff added=%v removed=%v", added, removed)
+	}
+	if parseReactionUpdates([]byte("not json")) != nil {
+		t.Fatal("invalid body should yield no reactions")
+	}
+}
+
+func TestReactionActions(t *testing.T) {
+	if reactionRating("👍") != 1 || reactionRating("👎") != -1 || reactionRating("🔥") != 0 {
+		t.Fatal("unexpected rating mapping")
+	}
+	if !isRegenerateReaction("🔁") || !isRegenerateReaction("⚡") || isRegenerateReaction("👍") {
+		t.Fatal("unexpected regenerate mapping")
+	}
+}
+
+func TestResultMessageIndex(t *testing.T) {
+	index := newResultMessageIndex()
+	index.record(5, 20, resultMessage{logID: 7, document: true})
+	if result, ok := index.lookup(5, 20); !ok || result.logID != 7 || !result.document {
+		t.Fatalf("unexpected lookup %+v %v", result, ok)
+	}
+	if _, ok := index.lookup(5, 21); ok {
+		t.Fatal("untracked message should not be found")
+	}
+}
+
+func TestForumClient_DispatchesReactions(t *testing.T) {
+	got := make(chan messageReaction, 2)
+	client := &forumClient{next: stubHTTPClient{body: reactionUpdates}, threads: newThreadIndex(), reactions: func(r messageReaction) { got <- r }}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.telegram.org/botTOKEN/getUpdates", nil)
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	ids := map[int]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-got:
+			ids[r.MessageID] = true
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for reactions")
+		}
+	}
+	if !ids[20] || !ids[21] {
+		t.Fatalf("unexpected dispatched reactions %v", ids)
+	}
+}
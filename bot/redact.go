@@ -0,0 +1,26 @@
+package bot
+
+import "regexp"
+
+// secretPatterns 錯誤訊息中可能出現的金鑰，依序遮蔽
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// URL 的 key= / api_key= 參數
+	{regexp.MustCompile(`(?i)([?&](?:api_?)?key=)[^&\s"']+`), "${1}***"},
+	// Authorization: Bearer xxx
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/\-]+=*`), "${1}***"},
+	// Google API Key
+	{regexp.MustCompile(`AIza[0-9A-Za-z_\-]{35}`), "***"},
+	// OpenAI 相容代理常見的 sk- 金鑰
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{16,}`), "***"},
+}
+
+// redactSecrets 遮蔽字串中的 API Key，避免錯誤訊息把金鑰回顯給使用者
+func redactSecrets(s string) string {
+	for _, p := range secretPatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
@@ -0,0 +1,198 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// imageFileIDs 取出圖片的 FileID，供序列化請求使用
+func imageFileIDs(images []imageData) []string {
+	var fileIDs []string
+	for _, img := range images {
+		fileIDs = append(fileIDs, img.FileID)
+	}
+	return fileIDs
+}
+
+// imageFrameMimeTypes 取出需要擷取畫面的圖片（動畫、影片）與其格式，沒有時回傳 nil
+func imageFrameMimeTypes(images []imageData) map[string]string {
+	var frames map[string]string
+	for _, img := range images {
+		if img.FrameMimeType == "" {
+			continue
+		}
+		if frames == nil {
+			frames = make(map[string]string)
+		}
+		frames[img.FileID] = img.FrameMimeType
+	}
+	return frames
+}
+
+// rememberLastGeneration 記下使用者最近一次生成請求（不含服務設定，/redo 時使用當下的服務）
+func (b *Bot) rememberLastGeneration(userID int64, payload failedGenerationPayload) {
+	payload.Service = gemini.ServiceConfig{}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("序列化最近生成請求失敗: %v", err)
+		return
+	}
+	if err := b.db.SetLastGeneration(userID, string(raw)); err != nil {
+		log.Printf("記錄最近生成請求失敗: %v", err)
+	}
+}
+
+// lastGeneration 讀取使用者最近一次生成請求，沒有紀錄時回傳 nil
+func (b *Bot) lastGeneration(userID int64) *failedGenerationPayload {
+	raw, err := b.db.GetLastGeneration(userID)
+	if err != nil || raw == "" {
+		return nil
+	}
+	var payload failedGenerationPayload
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		log.Printf("解析最近生成請求失敗: %v", err)
+		return nil
+	}
+	return &payload
+}
+
+// storeGenerationPayload 把請求參數存到生成紀錄，結果下方的畫質按鈕依此重新生成
+func (b *Bot) storeGenerationPayload(logID int64, payload failedGenerationPayload) {
+	if logID <= 0 {
+		return
+	}
+	payload.Service = gemini.ServiceConfig{}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("序列化生成請求失敗: %v", err)
+		return
+	}
+	if err := b.db.SetGenerationPayload(logID, string(raw)); err != nil {
+		log.Printf("保存生成請求失敗 (log=%d): %v", logID, err)
+	}
+}
+
+// requalityOrder 畫質按鈕的順序
+var requalityOrder = []string{"1K", "2K", "4K"}
+
+// requalityRow 切換畫質的按鈕（不含目前的畫質）
+func requalityRow(logID int64, current string) []tgbotapi.InlineKeyboardButton {
+	var row []tgbotapi.InlineKeyboardButton
+	for _, quality := range requalityOrder {
+		if quality == current {
+			continue
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("🔁 "+quality, fmt.Sprintf("requality:%d:%s", logID, quality)))
+	}
+	return row
+}
+
+// resultKeyboard 結果下方的按鈕：評分，以及有保存請求參數時的切換畫質
+func (b *Bot) resultKeyboard(logID int64, rating int) tgbotapi.InlineKeyboardMarkup {
+	keyboard := rateKeyboard(logID, rating)
+	if entry, err := b.db.GetGenerationLog(logID); err == nil && entry != nil && entry.Payload != "" {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, requalityRow(logID, entry.Quality))
+	}
+	return keyboard
+}
+
+// parseRequalityValue 解析 requality callback 的 "<logID>:<畫質>"
+func parseRequalityValue(value string) (int64, string, bool) {
+	idStr, q, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, "", false
+	}
+	logID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || logID <= 0 {
+		return 0, "", false
+	}
+	quality, ok := supportedQualities[q]
+	return logID, quality, ok
+}
+
+// callbackRequality 結果下方的畫質按鈕：以相同參數用新畫質重新生成，只有發起者可以使用
+func (b *Bot) callbackRequality(callback *tgbotapi.CallbackQuery, value string) {
+	logID, quality, ok := parseRequalityValue(value)
+	if !ok {
+		return
+	}
+
+	entry, err := b.db.GetGenerationLog(logID)
+	if err != nil || entry == nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "❌ 找不到這次生成的紀錄"))
+		return
+	}
+	if entry.UserID != callback.From.ID {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "⛔ 只有發起生成的人可以切換畫質"))
+		return
+	}
+	var payload failedGenerationPayload
+	if entry.Payload == "" || json.Unmarshal([]byte(entry.Payload), &payload) != nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "❌ 這次生成沒有保存參數，無法切換畫質"))
+		return
+	}
+
+	b.api.Request(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("⏳ 以 %s 重新生成", quality)))
+	payload.Quality = quality
+	b.redoGeneration(callback.Message.Chat.ID, callback.Message.MessageID, callback.From.ID, b.userLang(callback.From), payload)
+}
+
+// cmdRedo /redo <畫質>：以相同的圖片與 Prompt，用指定畫質重新生成最近一次的請求
+func (b *Bot) cmdRedo(msg *tgbotapi.Message) {
+	payload := b.lastGeneration(msg.From.ID)
+	if payload == nil {
+		b.sendReplyMessage(msg, "❌ 還沒有可以重新生成的紀錄，請先生成一次")
+		return
+	}
+
+	arg := strings.TrimSpace(msg.CommandArguments())
+	if arg == "" {
+		b.sendReplyMessage(msg, fmt.Sprintf("🔁 最近一次：%s（%s，%d 張圖片）\n\n用法：`/redo 4K` 以其他畫質重新生成（1K / 2K / 4K）",
+			markdownCode(truncateRunes(payload.Prompt, 40, "…")), payload.Quality, len(payload.ImageFileIDs)))
+		return
+	}
+	quality, ok := supportedQualities[strings.TrimPrefix(arg, "@")]
+	if !ok {
+		b.sendReplyMessage(msg, fmt.Sprintf("❌ 不支援的畫質 %s\n\n支援：1K、2K、4K", markdownCode(arg)))
+		return
+	}
+	payload.Quality = quality
+	b.redoGeneration(msg.Chat.ID, msg.MessageID, msg.From.ID, b.userLang(msg.From), *payload)
+}
+
+// redoGeneration 以保存的請求參數重新生成並回覆在 replyToMessageID 下方，成功後記為最近一次生成
+func (b *Bot) redoGeneration(chatID int64, replyToMessageID int, userID int64, lang string, payload failedGenerationPayload) {
+	processing := tgbotapi.NewMessage(chatID, fmt.Sprintf("⏳ *以 %s 重新生成中...*", payload.Quality))
+	processing.ParseMode = "Markdown"
+	processing.ReplyToMessageID = replyToMessageID
+	processingMsg, err := b.api.Send(processing)
+	if err != nil {
+		return
+	}
+
+	result, logID, err := b.runGenerationPayload(userID, chatID, payload)
+	if err != nil {
+		if gemini.IsSafetyBlocked(err) {
+			b.updateMessageHTML(processingMsg, safetyBlockedText(lang, err))
+			return
+		}
+		b.updateMessageHTML(processingMsg, withErrorHint(lang, fmt.Sprintf("❌ <b>重新生成失敗</b>\n\n<blockquote expandable>%s</blockquote>",
+			html.EscapeString(truncateError(err.Error()))), err))
+		return
+	}
+	b.rememberLastGeneration(userID, payload)
+	b.storeGenerationPayload(logID, payload)
+
+	b.api.Request(tgbotapi.NewDeleteMessage(chatID, processingMsg.MessageID))
+	results := []*gemini.ImageResult{result}
+	addResultNote(results, b.applyOutputFormat(lang, results, &ParsedParams{}, userID))
+	b.sendGeneratedResult(lang, chatID, replyToMessageID, payload.Quality, result, nil, logID)
+}
@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+
+	"tg-bawer/database"
+	"tg-bawer/gemini"
+)
+
+func TestRememberLastGeneration_DropsServiceCredentials(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db}
+
+	if b.lastGeneration(1) != nil {
+		t.Fatal("expected no last generation yet")
+	}
+
+	b.rememberLastGeneration(1, failedGenerationPayload{
+		Prompt:       "翻譯",
+		Quality:      "2K",
+		AspectRatio:  "3:4",
+		ImageFileIDs: imageFileIDs([]imageData{{FileID: "a"}, {FileID: "b"}}),
+		Service:      gemini.ServiceConfig{APIKey: "secret"},
+	})
+
+	payload := b.lastGeneration(1)
+	if payload == nil {
+		t.Fatal("expected last generation to be stored")
+	}
+	if payload.Prompt != "翻譯" || payload.Quality != "2K" || payload.AspectRatio != "3:4" || len(payload.ImageFileIDs) != 2 || payload.ImageFileIDs[1] != "b" {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+	if payload.Service.APIKey != "" {
+		t.Fatal("service credentials should not be stored")
+	}
+}
+
+func TestParseRequalityValue(t *testing.T) {
+	logID, quality, ok := parseRequalityValue("42:4K")
+	if !ok || logID != 42 || quality != "4K" {
+		t.Fatalf("unexpected parse %d %q %v", logID, quality, ok)
+	}
+	for _, bad := range []string{"42", "x:4K", "0:2K", "42:8K"} {
+		if _, _, ok := parseRequalityValue(bad); ok {
+			t.Fatalf("%q: expected failure", bad)
+		}
+	}
+}
+
+func TestResultKeyboard_QualityButtonsOnlyWithPayload(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db}
+
+	logID, err := db.LogGeneration(&database.GenerationLog{UserID: 1, ChatID: 10, Prompt: "p", Quality: "2K", Status: database.GenerationStatusSuccess})
+	if err != nil {
+		t.Fatalf("LogGeneration failed: %v", err)
+	}
+	if rows := b.resultKeyboard(logID, 0).InlineKeyboard; len(rows) != 1 {
+		t.Fatalf("expected only rating buttons without payload, got %d rows", len(rows))
+	}
+
+	b.storeGenerationPayload(logID, failedGenerationPayload{Prompt: "p", Quality: "2K"})
+	rows := b.resultKeyboard(logID, 0).InlineKeyboard
+	if len(rows) != 2 || len(rows[1]) != 2 {
+		t.Fatalf("expected a quality row with two buttons, got %+v", rows)
+	}
+	if data := *rows[1][1].CallbackData; data != fmt.Sprintf("requality:%d:4K", logID) {
+		t.Fatalf("unexpected callback data %q", data)
+	}
+}
+
+func TestRememberLastGeneration_KeepsFrameMimeTypes(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db}
+
+	images := []imageData{{FileID: "photo"}, {FileID: "gif", FrameMimeType: "video/mp4"}}
+	if imageFrameMimeTypes([]imageData{{FileID: "photo"}}) != nil {
+		t.Fatal("expected no frame types for plain photos")
+	}
+	b.rememberLastGeneration(1, failedGenerationPayload{
+		Prompt:         "翻譯",
+		Quality:        "2K",
+		ImageFileIDs:   imageFileIDs(images),
+		FrameMimeTypes: imageFrameMimeTypes(images),
+	})
+
+	// 重新下載時仍要知道 gif 需要擷取畫面，否則會把影片當成圖片送出
+	payload := b.lastGeneration(1)
+	if payload == nil || len(payload.FrameMimeTypes) != 1 || payload.FrameMimeTypes["gif"] != "video/mp4" {
+		t.Fatalf("unexpected frame types %+v", payload)
+	}
+}
@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"log"
+	"net/http"
+	"time"
+
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// resultCacheable 只有單張、且結果不受隨機參數或附加輸出影響的請求才使用結果快取
+func (b *Bot) resultCacheable(params *ParsedParams, opts gemini.GenerationOptions) bool {
+	return b.config.ResultCacheTTL > 0 &&
+		opts.CandidateCount <= 1 &&
+		opts.Temperature == nil &&
+		opts.Seed == nil &&
+		opts.Debug == nil &&
+		!params.WithVoice &&
+		!params.Compare
+}
+
+// resultCacheKey 以實際送出的 Prompt（含前後綴）、系統指示、畫質、比例、模型與所有圖片內容計算 SHA-256，
+// 調整 PROMPT_PREFIX/PROMPT_SUFFIX 或服務的系統指示後不會再拿到舊的結果
+func resultCacheKey(prompt, systemInstruction, quality, aspectRatio, model string, images []gemini.DownloadedImage) string {
+	h := sha256.New()
+	for _, field := range []string{prompt, systemInstruction, quality, aspectRatio, model} {
+		writeCacheField(h, []byte(field))
+	}
+	for _, img := range images {
+		writeCacheField(h, img.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeCacheField 先寫入長度，避免不同欄位切分方式得到相同的雜湊
+func writeCacheField(h hash.Hash, data []byte) {
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(data)))
+	h.Write(size[:])
+	h.Write(data)
+}
+
+// cachedResult 查詢結果快取，key 為空或未命中時回傳 nil
+func (b *Bot) cachedResult(key string) *gemini.ImageResult {
+	if key == "" {
+		return nil
+	}
+	cached, err := b.db.GetCachedResult(key, b.config.ResultCacheTTL)
+	if err != nil {
+		log.Printf("讀取結果快取失敗: %v", err)
+		return nil
+	}
+	if cached == nil {
+		return nil
+	}
+	return &gemini.ImageResult{ImageData: cached.Image, MimeType: http.DetectContentType(cached.Image), Text: cached.Text}
+}
+
+// storeCachedResult 保存生成結果，key 為空時不動作
+func (b *Bot) storeCachedResult(key string, result *gemini.ImageResult) {
+	if key == "" || result == nil {
+		return
+	}
+	if err := b.db.PutCachedResult(key, result.ImageData, result.Text); err != nil {
+		log.Printf("寫入結果快取失敗: %v", err)
+	}
+}
+
+// sendCachedResult 送出快取命中的結果；同樣寫入 generation_log，評分、換畫質、/diff 與反應才能對應到這次結果
+func (b *Bot) sendCachedResult(msg *tgbotapi.Message, replyToMessageID int, prompt, quality string, payload failedGenerationPayload, result *gemini.ImageResult) {
+	logID := b.recordGeneration(msg.From.ID, msg.Chat.ID, prompt, quality, time.Now(), nil)
+	b.storeGenerationPayload(logID, payload)
+	b.sendGeneratedResult(b.userLang(msg.From), msg.Chat.ID, replyToMessageID, quality, result, nil, logID)
+}
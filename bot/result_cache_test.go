@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"tg-bawer/config"
+	"tg-bawer/database"
+	"tg-bawer/gemini"
+)
+
+func TestResultCacheKey(t *testing.T) {
+	images := []gemini.DownloadedImage{{Data: []byte("page-1")}}
+	base := resultCacheKey("translate", "", "2K", "3:4", "model", images)
+
+	if again := resultCacheKey("translate", "", "2K", "3:4", "model", []gemini.DownloadedImage{{Data: []byte("page-1")}}); again != base {
+		t.Fatalf("expected identical inputs to share a key")
+	}
+	variants := []string{
+		resultCacheKey("translate!", "", "2K", "3:4", "model", images),
+		resultCacheKey("translate", "", "4K", "3:4", "model", images),
+		resultCacheKey("translate", "", "2K", "1:1", "model", images),
+		resultCacheKey("translate", "", "2K", "3:4", "other-model", images),
+		resultCacheKey("translate", "", "2K", "3:4", "model", []gemini.DownloadedImage{{Data: []byte("page-2")}}),
+		resultCacheKey("translate", "", "2K", "3:4", "model", nil),
+		resultCacheKey("translate", "保留原文", "2K", "3:4", "model", images),
+		// 欄位邊界不同也不可碰撞
+		resultCacheKey("translate2", "", "K", "3:4", "model", images),
+	}
+	for i, key := range variants {
+		if key == base {
+			t.Fatalf("variant %d unexpectedly shares the base key", i)
+		}
+	}
+}
+
+func TestResultCacheable(t *testing.T) {
+	b := &Bot{config: &config.Config{ResultCacheTTL: time.Hour}}
+	if !b.resultCacheable(&ParsedParams{}, gemini.GenerationOptions{CandidateCount: 1}) {
+		t.Fatal("expected plain request to be cacheable")
+	}
+
+	temperature, seed := 0.5, int64(1)
+	uncacheable := []struct {
+		params *ParsedParams
+		opts   gemini.GenerationOptions
+	}{
+		{&ParsedParams{}, gemini.GenerationOptions{CandidateCount: 3}},
+		{&ParsedParams{}, gemini.GenerationOptions{Temperature: &temperature}},
+		{&ParsedParams{}, gemini.GenerationOptions{Seed: &seed}},
+		{&ParsedParams{}, gemini.GenerationOptions{Debug: &gemini.DebugDump{}}},
+		{&ParsedParams{WithVoice: true}, gemini.GenerationOptions{}},
+		{&ParsedParams{Compare: true}, gemini.GenerationOptions{}},
+	}
+	for i, tc := range uncacheable {
+		if b.resultCacheable(tc.params, tc.opts) {
+			t.Fatalf("case %d: expected request to skip the cache", i)
+		}
+	}
+
+	disabled := &Bot{config: &config.Config{}}
+	if disabled.resultCacheable(&ParsedParams{}, gemini.GenerationOptions{}) {
+		t.Fatal("expected cache to be disabled when TTL is 0")
+	}
+}
+
+func TestResultCacheKey_ChangesWithPromptAffixes(t *testing.T) {
+	plain := gemini.NewClientWithService(gemini.ServiceConfig{Type: gemini.ServiceTypeStandard, APIKey: "k"})
+	affixed := gemini.NewClientWithService(gemini.ServiceConfig{Type: gemini.ServiceTypeStandard, APIKey: "k"})
+	affixed.SetPromptAffixes("", "不要加浮水印")
+
+	key := func(c *gemini.Client) string {
+		return resultCacheKey(c.WrapPrompt("一隻貓"), c.SystemInstruction(), "2K", "1:1", "model", nil)
+	}
+	if key(plain) == key(affixed) {
+		t.Fatal("changing PROMPT_SUFFIX should change the cache key")
+	}
+}
+
+func TestCachedResult_KeepsText(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db, config: &config.Config{ResultCacheTTL: time.Hour}}
+
+	b.storeCachedResult("k", &gemini.ImageResult{ImageData: []byte("png"), Text: "模型說明"})
+	cached := b.cachedResult("k")
+	if cached == nil || string(cached.ImageData) != "png" || cached.Text != "模型說明" {
+		t.Fatalf("expected cached image with text, got %+v", cached)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"tg-bawer/database"
@@ -14,18 +18,76 @@ import (
 )
 
 type failedGenerationPayload struct {
-	Prompt       string               `json:"prompt"`
-	Quality      string               `json:"quality"`
-	AspectRatio  string               `json:"aspect_ratio,omitempty"`
-	ImageFileIDs []string             `json:"image_file_ids,omitempty"`
-	Service      gemini.ServiceConfig `json:"service"`
+	Prompt       string   `json:"prompt"`
+	Quality      string   `json:"quality"`
+	AspectRatio  string   `json:"aspect_ratio,omitempty"`
+	ImageFileIDs []string `json:"image_file_ids,omitempty"`
+	// FrameMimeTypes 動畫或影片的 FileID 對應的原始格式，重新下載時同樣只取第一格畫面
+	FrameMimeTypes map[string]string    `json:"frame_mime_types,omitempty"`
+	Service        gemini.ServiceConfig `json:"service"`
 }
 
-func buildRetryQualities(quality string) []string {
+// qualityFallback 畫質降一級的對照
+var qualityFallback = map[string]string{"4K": "2K", "2K": "1K"}
+
+// planRetries 依第一次失敗的錯誤決定後續改用的畫質
+// 同畫質的暫時性錯誤已由 gemini.Client 的 RetryPolicy 重試，這裡只在像是資源不足的錯誤（5xx、逾時）時逐級降畫質；
+// 429、安全政策等其他錯誤直接放棄，避免兩層重試疊加
+func planRetries(quality string, err error) []string {
+	if !gemini.IsResourceError(err) {
+		return nil
+	}
 	if quality == "" {
 		quality = "2K"
 	}
-	return []string{quality, quality, quality, quality, quality, quality}
+
+	var plan []string
+	for lower, ok := qualityFallback[quality]; ok; lower, ok = qualityFallback[lower] {
+		plan = append(plan, lower)
+	}
+	return plan
+}
+
+// generateWithFallback 取得生成名額後依 planRetries 重試，供不需要逐次更新狀態的流程使用
+// 只回傳一張結果（忽略 opts.CandidateCount）；logID 為 generation_log 紀錄 ID，供評分按鈕使用
+// ctx 被 /jobs 取消時不記錄生成紀錄，直接回傳 ctx.Err()
+func (b *Bot) generateWithFallback(ctx context.Context, userID, chatID int64, client *gemini.Client, images []gemini.DownloadedImage, prompt, quality, aspectRatio string, opts gemini.GenerationOptions) (*gemini.ImageResult, int64, error) {
+	opts.CandidateCount = 0
+	releaseSlot := b.acquireGenerationSlot()
+	defer releaseSlot()
+	stopChatAction := b.startChatAction(chatID)
+	defer stopChatAction()
+	startedAt := time.Now()
+
+	qualities := []string{quality}
+	var results []*gemini.ImageResult
+	var lastErr error
+	for i := 0; i < len(qualities); i++ {
+		if len(images) > 0 {
+			results, lastErr = client.GenerateImageWithContext(ctx, images, prompt, qualities[i], aspectRatio, opts)
+		} else {
+			results, lastErr = client.GenerateImageFromText(ctx, prompt, qualities[i], aspectRatio, opts)
+		}
+		if lastErr == nil {
+			break
+		}
+		log.Printf("Attempt %d failed: %v", i+1, lastErr)
+		if ctx.Err() != nil {
+			// 使用者從 /jobs 取消，不記錄為失敗
+			return nil, 0, ctx.Err()
+		}
+		if i == 0 {
+			qualities = append(qualities, planRetries(quality, lastErr)...)
+		}
+		time.Sleep(time.Second * 2)
+	}
+	logID := b.recordGeneration(userID, chatID, prompt, quality, startedAt, lastErr)
+	b.sendDebugDump(chatID, 0, opts.Debug)
+	if lastErr != nil {
+		return nil, 0, lastErr
+	}
+	b.archiveResults(userID, prompt, quality, results[0])
+	return results[0], logID, nil
 }
 
 func (b *Bot) enqueueFailedGeneration(msg *tgbotapi.Message, replyToMessageID int, payload failedGenerationPayload, lastErr error) {
@@ -50,24 +112,53 @@ func (b *Bot) enqueueFailedGeneration(msg *tgbotapi.Message, replyToMessageID in
 }
 
 func (b *Bot) retryFailedGenerations() {
-	ticker := time.NewTicker(15 * time.Minute)
+	ticker := time.NewTicker(time.Duration(b.config.RetryIntervalSeconds) * time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		b.retryOneFailedGeneration()
+		// 維護中暫停重試
+		if !b.inMaintenance() {
+			b.retryFailedGenerationBatch()
+		}
+
+		// 順便清掉軟刪除超過 24 小時的 Prompt
+		if purged, err := b.db.PurgeDeletedPrompts(24 * time.Hour); err != nil {
+			log.Printf("清除已刪除 Prompt 失敗: %v", err)
+		} else if purged > 0 {
+			log.Printf("已永久刪除 %d 筆過期的 Prompt", purged)
+		}
+
+		// 清除過期的生成結果快取
+		if b.config.ResultCacheTTL > 0 {
+			if purged, err := b.db.PurgeCachedResults(b.config.ResultCacheTTL); err != nil {
+				log.Printf("清除結果快取失敗: %v", err)
+			} else if purged > 0 {
+				log.Printf("已清除 %d 筆過期的結果快取", purged)
+			}
+		}
 	}
 }
 
-func (b *Bot) retryOneFailedGeneration() {
-	task, err := b.db.GetRandomFailedGeneration()
+// retryFailedGenerationBatch 每次最多取 RetryBatchSize 筆任務並行重試，實際生成受全域名額限制
+func (b *Bot) retryFailedGenerationBatch() {
+	tasks, err := b.db.GetFailedGenerations(b.config.RetryBatchSize)
 	if err != nil {
 		log.Printf("讀取失敗任務失敗: %v", err)
 		return
 	}
-	if task == nil {
-		return
+
+	var wg sync.WaitGroup
+	for i := range tasks {
+		wg.Add(1)
+		go func(task *database.FailedGeneration) {
+			defer wg.Done()
+			b.retryFailedGeneration(task)
+		}(&tasks[i])
 	}
+	wg.Wait()
+}
 
+func (b *Bot) retryFailedGeneration(task *database.FailedGeneration) {
 	var payload failedGenerationPayload
 	if err := json.Unmarshal([]byte(task.Payload), &payload); err != nil {
 		log.Printf("解析失敗任務 payload 失敗 (id=%d): %v", task.ID, err)
@@ -75,110 +166,274 @@ func (b *Bot) retryOneFailedGeneration() {
 		return
 	}
 
+	result, logID, err := b.runGenerationPayload(task.UserID, task.ChatID, payload)
+	if err != nil {
+		b.markRetryFailed(task, err.Error())
+		log.Printf("定時重試失敗 (id=%d): %v", task.ID, err)
+		return
+	}
+
+	if err := b.sendRetrySuccessResult(task, payload, result, logID); err != nil {
+		b.markRetryFailed(task, err.Error())
+		log.Printf("定時重試成功但發送失敗 (id=%d): %v", task.ID, err)
+		return
+	}
+
+	if err := b.db.DeleteFailedGeneration(task.ID); err != nil {
+		log.Printf("刪除已成功重試任務失敗 (id=%d): %v", task.ID, err)
+	}
+}
+
+// runGenerationPayload 依序列化的請求生成一張圖（重試佇列與排程共用）；payload 未帶服務時使用使用者目前的服務
+func (b *Bot) runGenerationPayload(userID, chatID int64, payload failedGenerationPayload) (*gemini.ImageResult, int64, error) {
 	service := payload.Service
 	if service.APIKey == "" {
-		resolved, _, resolveErr := b.resolveServiceConfig(task.UserID)
-		if resolveErr != nil {
-			b.db.MarkFailedGenerationRetry(task.ID, resolveErr.Error())
-			return
+		resolved, _, err := b.resolveServiceConfig(userID)
+		if err != nil {
+			return nil, 0, err
 		}
 		service = resolved
 	}
 
-	client := gemini.NewClientWithService(service)
-	downloadedImages, err := b.downloadImagesByFileIDs(payload.ImageFileIDs)
+	client := b.newGeminiClient(service)
+	downloadedImages, err := b.downloadImagesByFileIDs(payload.ImageFileIDs, payload.FrameMimeTypes)
 	if err != nil {
-		b.db.MarkFailedGenerationRetry(task.ID, err.Error())
-		return
+		return nil, 0, fmt.Errorf("原圖已無法下載: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
-	defer cancel()
+	// 先取得名額再開始計時，避免排隊時間算進延遲；逾時交給 client 依畫質與 GEMINI_TIMEOUT_SECONDS 決定
+	releaseSlot := b.acquireGenerationSlot()
+	stopChatAction := b.startChatAction(chatID)
+	startedAt := time.Now()
+	ctx := context.Background()
 
-	aspectRatio := resolveAspectRatio(payload.AspectRatio, downloadedImages)
+	aspectRatio := resolveAspectRatio(payload.AspectRatio, b.userDefaultRatio(userID), downloadedImages, b.ratioTolerance())
 
-	var result *gemini.ImageResult
+	var results []*gemini.ImageResult
 	if len(downloadedImages) > 0 {
-		result, err = client.GenerateImageWithContext(ctx, downloadedImages, payload.Prompt, payload.Quality, aspectRatio)
+		results, err = client.GenerateImageWithContext(ctx, downloadedImages, payload.Prompt, payload.Quality, aspectRatio, gemini.GenerationOptions{})
 	} else {
-		result, err = client.GenerateImageFromText(ctx, payload.Prompt, payload.Quality, aspectRatio)
+		results, err = client.GenerateImageFromText(ctx, payload.Prompt, payload.Quality, aspectRatio, gemini.GenerationOptions{})
 	}
+	releaseSlot()
+	stopChatAction()
+	logID := b.recordGeneration(userID, chatID, payload.Prompt, payload.Quality, startedAt, err)
 	if err != nil {
-		b.db.MarkFailedGenerationRetry(task.ID, err.Error())
-		log.Printf("定時重試失敗 (id=%d): %v", task.ID, err)
-		return
+		return nil, 0, err
 	}
+	b.archiveResults(userID, payload.Prompt, payload.Quality, results[0])
+	return results[0], logID, nil
+}
 
-	if err := b.sendRetrySuccessResult(task, payload, result); err != nil {
-		b.db.MarkFailedGenerationRetry(task.ID, err.Error())
-		log.Printf("定時重試成功但發送失敗 (id=%d): %v", task.ID, err)
+// markRetryFailed 記錄一次重試失敗；達到上限時移出佇列並通知使用者
+func (b *Bot) markRetryFailed(task *database.FailedGeneration, lastError string) {
+	lastError = redactSecrets(lastError)
+	if err := b.db.MarkFailedGenerationRetry(task.ID, lastError); err != nil {
+		log.Printf("更新失敗任務失敗 (id=%d): %v", task.ID, err)
+		return
+	}
+	if task.RetryCount+1 < b.config.RetryMaxAttempts {
 		return
 	}
 
 	if err := b.db.DeleteFailedGeneration(task.ID); err != nil {
-		log.Printf("刪除已成功重試任務失敗 (id=%d): %v", task.ID, err)
+		log.Printf("移除放棄的任務失敗 (id=%d): %v", task.ID, err)
+		return
+	}
+	log.Printf("任務重試 %d 次仍失敗，已放棄 (id=%d): %s", task.RetryCount+1, task.ID, lastError)
+
+	notice := tgbotapi.NewMessage(task.ChatID, fmt.Sprintf("❌ 你的圖片在多次重試後仍失敗，已放棄（任務 #%d）\n\n<blockquote expandable>%s</blockquote>",
+		task.ID, html.EscapeString(truncateError(lastError))))
+	notice.ParseMode = "HTML"
+	if task.ReplyToMessageID > 0 {
+		notice.ReplyToMessageID = int(task.ReplyToMessageID)
+	}
+	if _, err := b.api.Send(notice); err != nil {
+		log.Printf("通知使用者任務放棄失敗 (id=%d): %v", task.ID, err)
 	}
 }
 
-func (b *Bot) downloadImagesByFileIDs(fileIDs []string) ([]gemini.DownloadedImage, error) {
+// downloadImagesByFileIDs 依序下載圖片；frameMimeTypes 中有記錄的 FileID 為動畫或影片，只取第一格畫面
+func (b *Bot) downloadImagesByFileIDs(fileIDs []string, frameMimeTypes map[string]string) ([]gemini.DownloadedImage, error) {
 	if len(fileIDs) == 0 {
 		return nil, nil
 	}
 
 	downloadedImages := make([]gemini.DownloadedImage, 0, len(fileIDs))
 	for _, fileID := range fileIDs {
-		file, err := b.api.GetFile(tgbotapi.FileConfig{FileID: fileID})
-		if err != nil {
-			return nil, err
-		}
-
-		data, mimeType, err := b.downloadFile(file.FilePath)
+		downloaded, err := b.downloadCachedImage(fileID, frameMimeTypes[fileID])
 		if err != nil {
 			return nil, err
 		}
-
-		downloadedImages = append(downloadedImages, gemini.DownloadedImage{
-			Data:     data,
-			MimeType: mimeType,
-		})
+		downloadedImages = append(downloadedImages, downloaded)
 	}
 
 	return downloadedImages, nil
 }
 
-func (b *Bot) sendRetrySuccessResult(task *database.FailedGeneration, payload failedGenerationPayload, result *gemini.ImageResult) error {
+func (b *Bot) sendRetrySuccessResult(task *database.FailedGeneration, payload failedGenerationPayload, result *gemini.ImageResult, logID int64) error {
+	return b.sendQueuedResult(task.ChatID, int(task.ReplyToMessageID), fmt.Sprintf("♻️ 自動重試成功（任務 #%d）", task.ID),
+		"retry", "📎 定時重試輸出（原畫質）", payload.Quality, result, logID)
+}
+
+// sendQueuedResult 發送背景任務（重試、排程）的結果：通知、預覽圖與原檔，namePrefix 為檔名前綴
+func (b *Bot) sendQueuedResult(chatID int64, replyToMessageID int, notice, namePrefix, docCaption, quality string, result *gemini.ImageResult, logID int64) error {
 	if result == nil {
-		return fmt.Errorf("empty retry result")
+		return fmt.Errorf("empty %s result", namePrefix)
 	}
 
-	notice := tgbotapi.NewMessage(task.ChatID, fmt.Sprintf("♻️ 自動重試成功（任務 #%d）", task.ID))
-	if task.ReplyToMessageID > 0 {
-		notice.ReplyToMessageID = int(task.ReplyToMessageID)
+	noticeMsg := tgbotapi.NewMessage(chatID, notice)
+	if replyToMessageID > 0 {
+		noticeMsg.ReplyToMessageID = replyToMessageID
 	}
-	if _, err := b.api.Send(notice); err != nil {
+	if _, err := b.api.Send(noticeMsg); err != nil {
 		return err
 	}
 
-	photoMsg := tgbotapi.NewPhoto(task.ChatID, tgbotapi.FileBytes{Name: "retry_preview.png", Bytes: result.ImageData})
-	if task.ReplyToMessageID > 0 {
-		photoMsg.ReplyToMessageID = int(task.ReplyToMessageID)
+	photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: namePrefix + "_preview" + result.FileExt(), Bytes: result.ImageData})
+	photoMsg.Caption = resultCaption(defaultLang, result)
+	if replyToMessageID > 0 {
+		photoMsg.ReplyToMessageID = replyToMessageID
 	}
-	if _, err := b.api.Send(photoMsg); err != nil {
+	sentPhoto, err := b.api.Send(photoMsg)
+	if err != nil {
 		return err
 	}
+	b.trackResultMessage(sentPhoto, logID, false)
 
-	filename := "retry_generated.png"
-	if payload.Quality != "" {
-		filename = fmt.Sprintf("retry_generated_%s.png", payload.Quality)
+	filename := namePrefix + "_generated" + result.FileExt()
+	if quality != "" {
+		filename = fmt.Sprintf("%s_generated_%s%s", namePrefix, quality, result.FileExt())
 	}
-	docMsg := tgbotapi.NewDocument(task.ChatID, tgbotapi.FileBytes{Name: filename, Bytes: result.ImageData})
-	docMsg.Caption = "📎 定時重試輸出（原畫質）"
-	if task.ReplyToMessageID > 0 {
-		docMsg.ReplyToMessageID = int(task.ReplyToMessageID)
+	docMsg := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: filename, Bytes: result.ImageData})
+	docMsg.Caption = docCaption
+	if replyToMessageID > 0 {
+		docMsg.ReplyToMessageID = replyToMessageID
+	}
+	if logID > 0 {
+		docMsg.ReplyMarkup = rateKeyboard(logID, 0)
 	}
-	if _, err := b.api.Send(docMsg); err != nil {
+	sent, err := b.api.Send(docMsg)
+	if err != nil {
 		return err
 	}
+	b.saveResultFileID(logID, sent)
+	b.trackResultMessage(sent, logID, true)
 
 	return nil
 }
+
+// cmdFlushQueue /flushqueue [userID]：清空重試佇列（或只清指定使用者），限管理員
+func (b *Bot) cmdFlushQueue(msg *tgbotapi.Message) {
+	if !b.config.IsAdmin(msg.From.ID) {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 只有管理員可以使用此指令"))
+		return
+	}
+
+	arg := strings.TrimSpace(msg.CommandArguments())
+	if arg == "" {
+		removed, err := b.db.DeleteAllFailedGenerations()
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 清除失敗："+err.Error()))
+			return
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🧹 已清空重試佇列，共移除 %d 筆任務", removed)))
+		return
+	}
+
+	userID, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "用法：/flushqueue [使用者 ID]"))
+		return
+	}
+	removed, err := b.db.DeleteFailedGenerationsByUser(userID)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 清除失敗："+err.Error()))
+		return
+	}
+	b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🧹 已移除使用者 %d 的 %d 筆重試任務", userID, removed)))
+}
+
+// queueStatsTopUsers /queuestats 列出的使用者數量
+const queueStatsTopUsers = 10
+
+// cmdQueueStats /queuestats：重試佇列的整體狀況，限管理員
+func (b *Bot) cmdQueueStats(msg *tgbotapi.Message) {
+	if !b.config.IsAdmin(msg.From.ID) {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 只有管理員可以使用此指令"))
+		return
+	}
+
+	stats, err := b.db.GetRetryQueueStats(queueStatsTopUsers)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 讀取佇列統計失敗："+err.Error()))
+		return
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, formatRetryQueueStats(stats))
+	reply.ParseMode = "HTML"
+	b.api.Send(reply)
+}
+
+// formatRetryQueueStats 將佇列統計排成等寬的文字表格
+func formatRetryQueueStats(stats *database.RetryQueueStats) string {
+	title := "📋 <b>重試佇列統計</b>"
+	if stats.Total == 0 {
+		return title + "\n\n佇列是空的"
+	}
+
+	row := func(label, value string) string {
+		return padDisplay(label, 12) + " " + value
+	}
+	rows := []string{
+		row("待重試任務", strconv.Itoa(stats.Total)),
+		row("使用者數", strconv.Itoa(stats.Users)),
+		row("最舊等待", formatQueueAge(stats.OldestAge)),
+		"",
+		row("已重試次數", "任務數"),
+	}
+	for _, g := range stats.ByRetries {
+		rows = append(rows, row(g.Label, strconv.Itoa(g.Count)))
+	}
+	rows = append(rows, "", row("使用者 ID", "任務數"))
+	for _, u := range stats.TopUsers {
+		rows = append(rows, row(strconv.FormatInt(u.UserID, 10), strconv.Itoa(u.Count)))
+	}
+	if others := stats.Users - len(stats.TopUsers); others > 0 {
+		rows = append(rows, fmt.Sprintf("…另有 %d 位使用者", others))
+	}
+	return fmt.Sprintf("%s\n\n<pre>%s</pre>", title, html.EscapeString(strings.Join(rows, "\n")))
+}
+
+// padDisplay 以等寬字型的顯示寬度（全形字算 2 格）補空白到 width
+func padDisplay(s string, width int) string {
+	w := 0
+	for _, r := range s {
+		if r >= 0x1100 && (r <= 0x115F || r >= 0x2E80) {
+			w += 2
+		} else {
+			w++
+		}
+	}
+	if w >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-w)
+}
+
+// formatQueueAge 將等待時間縮成最大的兩個單位，例如 2d3h、5h12m、45s
+func formatQueueAge(age time.Duration) string {
+	age = age.Round(time.Second)
+	days := int(age / (24 * time.Hour))
+	hours := int(age % (24 * time.Hour) / time.Hour)
+	minutes := int(age % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm%ds", minutes, int(age%time.Minute/time.Second))
+	}
+	return fmt.Sprintf("%ds", int(age/time.Second))
+}
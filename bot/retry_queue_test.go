@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"tg-bawer/database"
+)
+
+func TestFormatRetryQueueStats(t *testing.T) {
+	if got := formatRetryQueueStats(&database.RetryQueueStats{}); !strings.Contains(got, "佇列是空的") {
+		t.Fatalf("expected empty notice, got %q", got)
+	}
+
+	got := formatRetryQueueStats(&database.RetryQueueStats{
+		Total:     12,
+		Users:     4,
+		OldestAge: 26 * time.Hour,
+		ByRetries: []database.RetryQueueGroup{{Label: "0", Count: 7}, {Label: "5+", Count: 5}},
+		TopUsers:  []database.RetryQueueUser{{UserID: 123456789, Count: 9}, {UserID: 42, Count: 2}},
+	})
+	for _, want := range []string{
+		"待重試任務   12",
+		"最舊等待     1d2h",
+		"5+           5",
+		"123456789    9",
+		"另有 2 位使用者",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestFormatQueueAge(t *testing.T) {
+	cases := map[time.Duration]string{
+		45 * time.Second:               "45s",
+		3*time.Minute + 20*time.Second: "3m20s",
+		5*time.Hour + 12*time.Minute:   "5h12m",
+		50*time.Hour + 30*time.Minute:  "2d2h",
+		0:                              "0s",
+	}
+	for age, want := range cases {
+		if got := formatQueueAge(age); got != want {
+			t.Errorf("formatQueueAge(%v) = %q, want %q", age, got, want)
+		}
+	}
+}
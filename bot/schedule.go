@@ -0,0 +1,256 @@
+package bot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-bawer/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// schedulePollInterval 檢查到期排程任務的間隔
+	schedulePollInterval = 30 * time.Second
+	// scheduleBatchSize 每次最多取出的到期任務數，實際生成仍受全域名額限制
+	scheduleBatchSize = 5
+	// maxScheduleAhead 最多可以排到多久之後
+	maxScheduleAhead = 7 * 24 * time.Hour
+	// maxScheduledPerUser 每位使用者同時可排的任務數
+	maxScheduledPerUser = 10
+)
+
+// scheduleTimeDisplay 顯示排程時間的格式（伺服器時區）
+const scheduleTimeDisplay = "01-02 15:04"
+
+// parseScheduleTime 解析 /schedule 的時間：時長（2h、1h30m）或時刻（23:30，已過則為隔天）
+func parseScheduleTime(spec string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("時間必須在現在之後")
+		}
+		if d > maxScheduleAhead {
+			return time.Time{}, fmt.Errorf("最多只能排到 7 天後")
+		}
+		return now.Add(d), nil
+	}
+
+	clock, err := time.ParseInLocation("15:04", spec, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("無法解析時間 %q（例如 2h、30m 或 23:30）", spec)
+	}
+	runAt := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !runAt.After(now) {
+		runAt = runAt.AddDate(0, 0, 1)
+	}
+	return runAt, nil
+}
+
+// scheduleUnsupportedFlags 排程任務只保存 Prompt、畫質與比例，其他 @ 參數執行時會遺失，回傳這些參數供提示
+func scheduleUnsupportedFlags(params *ParsedParams) []string {
+	var flags []string
+	add := func(set bool, flag string) {
+		if set {
+			flags = append(flags, flag)
+		}
+	}
+	add(params.SingleImageFromGroup, "@s")
+	add(params.WithVoice, "@voice")
+	add(params.Upscale, "@upscale")
+	add(params.Compare, "@compare")
+	add(params.Enhance, "@enhance")
+	add(params.Crop, "@crop")
+	add(len(params.PageSelection) > 0, "@pages")
+	add(params.Variants > 0, "@variants")
+	add(params.Temperature != nil, "@temp")
+	add(params.Seed != nil, "@seed")
+	add(params.Debug, "@debug")
+	add(params.Model != "", "@model")
+	add(params.Format != "", "@format")
+	add(params.JPEGQuality > 0, "@jpegq")
+	return flags
+}
+
+// cmdSchedule /schedule <時間> <prompt>、/schedule list、/schedule cancel <ID>
+func (b *Bot) cmdSchedule(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		b.sendReplyMessage(msg, "用法：\n`/schedule 2h 一隻貓 @4k` → 2 小時後生成\n`/schedule 23:30 prompt` → 指定時刻（已過則為明天）\n回覆圖片使用時會以該圖片生成\n\n`/schedule list` 查看排程，`/schedule cancel ID` 取消")
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "list":
+		b.listScheduledGenerations(msg)
+		return
+	case "cancel":
+		if len(args) < 2 {
+			b.sendReplyMessage(msg, "用法：`/schedule cancel ID`")
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+		if err != nil {
+			b.sendReplyMessage(msg, "❌ 無效的任務 ID")
+			return
+		}
+		if err := b.db.DeleteScheduledGeneration(id, msg.From.ID); err != nil {
+			b.sendReplyMessage(msg, fmt.Sprintf("❌ 找不到排程任務 #%d", id))
+			return
+		}
+		b.sendReplyMessage(msg, fmt.Sprintf("🗑 已取消排程任務 #%d", id))
+		return
+	}
+
+	runAt, err := parseScheduleTime(args[0], time.Now())
+	if err != nil {
+		b.sendReplyMessage(msg, "❌ "+escapeMarkdown(err.Error()))
+		return
+	}
+
+	params := parseTextParams(strings.Join(args[1:], " "))
+	if params.RatioError != "" || params.QualityError != "" || params.PagesError != "" ||
+		params.VariantsError != "" || params.TemperatureError != "" || params.SeedError != "" ||
+		params.ModelError != "" || params.FormatError != "" || params.JPEGQualityError != "" {
+		b.sendReplyMessage(msg, paramErrorText(b.userLang(msg.From), params))
+		return
+	}
+	if flags := scheduleUnsupportedFlags(params); len(flags) > 0 {
+		b.sendReplyMessage(msg, fmt.Sprintf("❌ /schedule 不支援 %s\n\n排程任務只會保存 Prompt、畫質與比例", escapeMarkdown(strings.Join(flags, "、"))))
+		return
+	}
+
+	var imageFileIDs []string
+	if fileID := findImageFileID(msg.ReplyToMessage); fileID != "" {
+		imageFileIDs = append(imageFileIDs, fileID)
+	}
+	prompt := params.Prompt
+	if prompt == "" && len(imageFileIDs) > 0 {
+		prompt = b.resolveMessageDefaultPrompt(msg)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		b.sendReplyMessage(msg, "❌ 請在時間後面加上 Prompt，或回覆一張圖片")
+		return
+	}
+
+	existing, err := b.db.GetScheduledGenerations(msg.From.ID)
+	if err != nil {
+		b.sendReplyMessage(msg, "❌ 讀取排程失敗")
+		return
+	}
+	if len(existing) >= maxScheduledPerUser {
+		b.sendReplyMessage(msg, fmt.Sprintf("❌ 最多只能同時排 %d 個任務，請先用 `/schedule cancel ID` 取消", maxScheduledPerUser))
+		return
+	}
+
+	quality := params.Quality
+	if quality == "" {
+		quality = b.resolveDefaultQuality(msg)
+	}
+	if b.rejectBlockedPrompt(msg, prompt, quality) {
+		return
+	}
+	// 不保存服務設定，執行時才取使用者當下的服務
+	rawPayload, err := json.Marshal(failedGenerationPayload{
+		Prompt:       prompt,
+		Quality:      quality,
+		AspectRatio:  params.AspectRatio,
+		ImageFileIDs: imageFileIDs,
+	})
+	if err != nil {
+		b.sendReplyMessage(msg, "❌ 排程失敗")
+		return
+	}
+
+	id, err := b.db.AddScheduledGeneration(msg.From.ID, msg.Chat.ID, int64(msg.MessageID), string(rawPayload), runAt)
+	if err != nil {
+		b.sendReplyMessage(msg, "❌ 排程失敗")
+		return
+	}
+	b.sendReplyMessage(msg, fmt.Sprintf("⏰ 已排程（任務 #%d），將於 *%s* 生成\n取消：`/schedule cancel %d`", id, runAt.Format(scheduleTimeDisplay), id))
+}
+
+// listScheduledGenerations 列出使用者尚未執行的排程任務
+func (b *Bot) listScheduledGenerations(msg *tgbotapi.Message) {
+	tasks, err := b.db.GetScheduledGenerations(msg.From.ID)
+	if err != nil {
+		b.sendReplyMessage(msg, "❌ 讀取排程失敗")
+		return
+	}
+	if len(tasks) == 0 {
+		b.sendReplyMessage(msg, "📭 目前沒有排程任務")
+		return
+	}
+
+	lines := []string{"⏰ *排程任務*", ""}
+	for _, task := range tasks {
+		var payload failedGenerationPayload
+		json.Unmarshal([]byte(task.Payload), &payload)
+		lines = append(lines, fmt.Sprintf("#%d · %s · %s", task.ID, task.RunAt.Local().Format(scheduleTimeDisplay),
+			escapeMarkdown(truncateRunes(payload.Prompt, 40, "…"))))
+	}
+	lines = append(lines, "", "取消：`/schedule cancel ID`")
+	b.sendReplyMessage(msg, strings.Join(lines, "\n"))
+}
+
+// runScheduledGenerations 定期執行到期的排程任務
+func (b *Bot) runScheduledGenerations() {
+	ticker := time.NewTicker(schedulePollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// 維護中暫停，結束後再補跑
+		if b.inMaintenance() {
+			continue
+		}
+		tasks, err := b.db.GetDueScheduledGenerations(scheduleBatchSize)
+		if err != nil {
+			log.Printf("讀取排程任務失敗: %v", err)
+			continue
+		}
+		for i := range tasks {
+			task := tasks[i]
+			// 先刪除再執行，確保每個任務只跑一次
+			if err := b.db.DeleteScheduledGeneration(task.ID, task.UserID); err != nil {
+				if err != sql.ErrNoRows {
+					log.Printf("取出排程任務失敗 (id=%d): %v", task.ID, err)
+				}
+				continue
+			}
+			go b.runScheduledGeneration(&task)
+		}
+	}
+}
+
+// runScheduledGeneration 執行一個排程任務；失敗時轉入重試佇列
+func (b *Bot) runScheduledGeneration(task *database.ScheduledGeneration) {
+	var payload failedGenerationPayload
+	if err := json.Unmarshal([]byte(task.Payload), &payload); err != nil {
+		log.Printf("解析排程任務 payload 失敗 (id=%d): %v", task.ID, err)
+		return
+	}
+
+	result, logID, err := b.runGenerationPayload(task.UserID, task.ChatID, payload)
+	if err == nil {
+		err = b.sendQueuedResult(task.ChatID, int(task.ReplyToMessageID), fmt.Sprintf("⏰ 排程生成完成（任務 #%d）", task.ID),
+			"scheduled", "📎 排程輸出（原畫質）", payload.Quality, result, logID)
+		if err == nil {
+			return
+		}
+	}
+
+	log.Printf("排程任務失敗，轉入重試佇列 (id=%d): %v", task.ID, err)
+	if addErr := b.db.AddFailedGeneration(task.UserID, task.ChatID, task.ReplyToMessageID, task.Payload, truncateError(err.Error())); addErr != nil {
+		log.Printf("排程任務寫入重試佇列失敗 (id=%d): %v", task.ID, addErr)
+		return
+	}
+	notice := tgbotapi.NewMessage(task.ChatID, withErrorHint(defaultLang, fmt.Sprintf("⚠️ 排程任務 #%d 生成失敗，已加入重試佇列，稍後會自動重試", task.ID), err))
+	if task.ReplyToMessageID > 0 {
+		notice.ReplyToMessageID = int(task.ReplyToMessageID)
+	}
+	b.api.Send(notice)
+}
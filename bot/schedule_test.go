@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScheduleTime(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2024, 5, 1, 22, 0, 0, 0, loc)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"2h", now.Add(2 * time.Hour)},
+		{"1h30m", now.Add(90 * time.Minute)},
+		{"23:30", time.Date(2024, 5, 1, 23, 30, 0, 0, loc)},
+		// 已過的時刻排到隔天
+		{"08:15", time.Date(2024, 5, 2, 8, 15, 0, 0, loc)},
+		{"22:00", time.Date(2024, 5, 2, 22, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		got, err := parseScheduleTime(tt.spec, now)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.spec, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Fatalf("%s: got %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"-1h", "0s", "200h", "tomorrow", "25:00"} {
+		if _, err := parseScheduleTime(bad, now); err == nil {
+			t.Fatalf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestScheduleUnsupportedFlags(t *testing.T) {
+	if flags := scheduleUnsupportedFlags(parseTextParams("一隻貓 @4K @16:9")); len(flags) != 0 {
+		t.Fatalf("quality and ratio should be allowed, got %v", flags)
+	}
+	flags := scheduleUnsupportedFlags(parseTextParams("一隻貓 @variants=2 @seed=1 @model=m @format=jpeg @jpegq=80"))
+	if got := strings.Join(flags, ","); got != "@variants,@seed,@model,@format,@jpegq" {
+		t.Fatalf("unexpected unsupported flags %s", got)
+	}
+}
@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSystemInstructionLength 服務系統指示的字數上限
+const maxSystemInstructionLength = 2000
+
+// vertexLocationPattern Vertex AI 區域，例如 us-central1、asia-east1；global 另外允許
+var vertexLocationPattern = regexp.MustCompile(`^[a-z]+(-[a-z]+)+[0-9]+$`)
+
+// validateVertexService 檢查 full mode 的 PROJECT_ID 與 LOCATION
+func validateVertexService(projectID, location string) error {
+	if strings.TrimSpace(projectID) == "" {
+		return fmt.Errorf("PROJECT_ID 不可為空")
+	}
+	return validateVertexLocation(location)
+}
+
+// validateVertexLocation 檢查 LOCATION 是否像 Vertex AI 區域
+func validateVertexLocation(location string) error {
+	location = strings.TrimSpace(location)
+	if location != "global" && !vertexLocationPattern.MatchString(location) {
+		return fmt.Errorf("LOCATION %q 看起來不是有效的區域（例如 us-central1、asia-east1 或 global）", location)
+	}
+	return nil
+}
+
+// serviceEditValue 檢查 /service edit 的新值並回傳要寫入的內容；選填欄位可用 - 清空
+func serviceEditValue(field, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch field {
+	case "name", "key":
+		if value == "" || value == "-" {
+			return "", fmt.Errorf("%s 不可為空", field)
+		}
+		return value, nil
+	case "base", "project", "location", "model":
+		if value == "-" {
+			return "", nil
+		}
+	case "system":
+		if value == "-" {
+			return "", nil
+		}
+		if n := utf8.RuneCountInString(value); n > maxSystemInstructionLength {
+			return "", fmt.Errorf("系統指示最多 %d 字，目前 %d 字", maxSystemInstructionLength, n)
+		}
+	default:
+		return "", fmt.Errorf("不支援的欄位 %q，可用 key/base/project/location/model/system/name", field)
+	}
+
+	switch field {
+	case "base":
+		return validateBaseURL(value)
+	case "location":
+		if err := validateVertexLocation(value); err != nil {
+			return "", err
+		}
+	}
+	if value == "" {
+		return "", fmt.Errorf("%s 不可為空，要清除請用 -", field)
+	}
+	return value, nil
+}
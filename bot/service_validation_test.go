@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateVertexService(t *testing.T) {
+	valid := []struct{ project, location string }{
+		{"my-project", "us-central1"},
+		{"my-project", "asia-east1"},
+		{"my-project", "europe-west4"},
+		{"my-project", "northamerica-northeast1"},
+		{"my-project", "global"},
+	}
+	for _, tc := range valid {
+		if err := validateVertexService(tc.project, tc.location); err != nil {
+			t.Fatalf("validateVertexService(%q, %q) error = %v", tc.project, tc.location, err)
+		}
+	}
+
+	invalid := []struct{ project, location string }{
+		{"", "us-central1"},
+		{"  ", "us-central1"},
+		{"my-project", ""},
+		{"my-project", "US-CENTRAL1"},
+		{"my-project", "uscentral1"},
+		{"my-project", "us-central"},
+		{"my-project", "gemini-3-pro-image-preview"},
+	}
+	for _, tc := range invalid {
+		if err := validateVertexService(tc.project, tc.location); err == nil {
+			t.Fatalf("validateVertexService(%q, %q) expected error", tc.project, tc.location)
+		}
+	}
+}
+
+func TestServiceEditValue(t *testing.T) {
+	cases := []struct {
+		field, value, want string
+		wantErr            bool
+	}{
+		{"key", "AIza-new", "AIza-new", false},
+		{"key", "-", "", true},
+		{"name", "", "", true},
+		{"base", "https://proxy.example.com/", "https://proxy.example.com", false},
+		{"base", "proxy.example.com", "", true},
+		{"base", "-", "", false},
+		{"location", "asia-east1", "asia-east1", false},
+		{"location", "taipei", "", true},
+		{"model", "-", "", false},
+		{"model", "gemini-3-pro-image-preview", "gemini-3-pro-image-preview", false},
+		{"system", "always preserve text placement", "always preserve text placement", false},
+		{"system", "-", "", false},
+		{"system", strings.Repeat("字", maxSystemInstructionLength+1), "", true},
+		{"is_default", "1", "", true},
+	}
+	for _, tc := range cases {
+		got, err := serviceEditValue(tc.field, tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("serviceEditValue(%q, %q) error = %v, wantErr %v", tc.field, tc.value, err, tc.wantErr)
+		}
+		if got != tc.want {
+			t.Fatalf("serviceEditValue(%q, %q) = %q, want %q", tc.field, tc.value, got, tc.want)
+		}
+	}
+}
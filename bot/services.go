@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"tg-bawer/database"
 	"tg-bawer/gemini"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -28,6 +30,8 @@ func (b *Bot) cmdService(msg *tgbotapi.Message) {
 		b.cmdServiceAdd(msg, args)
 	case "use":
 		b.cmdServiceUse(msg, args)
+	case "edit":
+		b.cmdServiceEdit(msg, args)
 	case "delete", "del", "rm":
 		b.cmdServiceDelete(msg, args)
 	default:
@@ -46,6 +50,8 @@ func (b *Bot) sendServiceHelp(msg *tgbotapi.Message) {
 *指令格式：*
 ` + "`/service list`" + `
 ` + "`/service use <服務ID>`" + `
+` + "`/service edit <服務ID> <欄位> <新值>`" + `  (欄位：key/base/project/location/model/system/name，選填欄位用 - 清空)
+` + "`/service edit <服務ID> system 保持文字位置不變`" + `  (每次生成都帶入的系統指示)
 ` + "`/service delete <服務ID>`" + `
 
 ` + "`/service add standard <名稱> <API_KEY>`" + `
@@ -107,6 +113,10 @@ func (b *Bot) sendServiceList(msg *tgbotapi.Message) {
 			}
 		}
 
+		if service.SystemInstruction != "" {
+			detail += " system=" + truncateRunes(service.SystemInstruction, 30, "...")
+		}
+
 		lines = append(lines, detail)
 	}
 
@@ -162,12 +172,18 @@ func (b *Bot) cmdServiceAdd(msg *tgbotapi.Message, args []string) {
 			return
 		}
 
+		baseURL, err := validateBaseURL(args[3])
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 無效的 BASE_URL："+err.Error()))
+			return
+		}
+
 		id, err := b.db.AddUserService(
 			msg.From.ID,
 			gemini.ServiceTypeCustom,
 			args[2],
 			args[4],
-			args[3],
+			baseURL,
 			"",
 			"",
 			"",
@@ -205,6 +221,21 @@ func (b *Bot) cmdServiceAdd(msg *tgbotapi.Message, args []string) {
 			baseURL = args[7]
 		}
 
+		if projectID != "" || location != "" {
+			if err := validateVertexService(projectID, location); err != nil {
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 無效的 vertex 設定："+err.Error()))
+				return
+			}
+		}
+		if baseURL != "" {
+			validated, err := validateBaseURL(baseURL)
+			if err != nil {
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 無效的 BASE_URL："+err.Error()))
+				return
+			}
+			baseURL = validated
+		}
+
 		id, err := b.db.AddUserService(
 			msg.From.ID,
 			gemini.ServiceTypeVertex,
@@ -252,6 +283,48 @@ func (b *Bot) cmdServiceUse(msg *tgbotapi.Message, args []string) {
 	b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已切換預設服務為 #%d", serviceID)))
 }
 
+func (b *Bot) cmdServiceEdit(msg *tgbotapi.Message, args []string) {
+	if len(args) < 4 {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 格式：/service edit <服務ID> <key|base|project|location|model|system|name> <新值>"))
+		return
+	}
+
+	serviceID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 服務 ID 必須是數字"))
+		return
+	}
+
+	field := strings.ToLower(args[2])
+	raw := args[3]
+	if field == "system" {
+		// 系統指示可以包含空白
+		raw = strings.Join(args[3:], " ")
+	}
+	value, err := serviceEditValue(field, raw)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()))
+		return
+	}
+
+	if err := b.db.UpdateUserService(msg.From.ID, serviceID, field, value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 找不到該服務 ID，請先用 /service list 查詢"))
+			return
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 更新服務失敗："+err.Error()))
+		return
+	}
+
+	shown := value
+	if field == "key" {
+		shown = maskSecret(value)
+	} else if shown == "" {
+		shown = "（已清除）"
+	}
+	b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("✅ 已更新服務 #%d 的 %s：%s", serviceID, field, shown)))
+}
+
 func (b *Bot) cmdServiceDelete(msg *tgbotapi.Message, args []string) {
 	if len(args) < 2 {
 		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "❌ 格式：/service delete <服務ID>"))
@@ -279,15 +352,7 @@ func (b *Bot) resolveServiceConfig(userID int64) (gemini.ServiceConfig, string,
 	}
 
 	if service != nil {
-		return gemini.ServiceConfig{
-			Type:      service.Type,
-			Name:      service.Name,
-			APIKey:    service.APIKey,
-			BaseURL:   service.BaseURL,
-			ProjectID: service.ProjectID,
-			Location:  service.Location,
-			Model:     service.Model,
-		}, fmt.Sprintf("%s (#%d)", service.Name, service.ID), nil
+		return serviceConfigFromUserService(service), fmt.Sprintf("%s (#%d)", service.Name, service.ID), nil
 	}
 
 	if strings.TrimSpace(b.config.GeminiAPIKey) != "" {
@@ -295,13 +360,45 @@ func (b *Bot) resolveServiceConfig(userID int64) (gemini.ServiceConfig, string,
 			Type:    gemini.ServiceTypeStandard,
 			Name:    "env-default",
 			APIKey:  b.config.GeminiAPIKey,
-			BaseURL: b.config.GeminiBaseURL,
+			BaseURL: b.envBaseURL(),
 		}, "env-default", nil
 	}
 
 	return gemini.ServiceConfig{}, "", fmt.Errorf("尚未設定服務，請先使用 /service add")
 }
 
+// serviceConfigFromUserService 將資料庫中的服務轉為 client 使用的設定
+func serviceConfigFromUserService(service *database.UserService) gemini.ServiceConfig {
+	return gemini.ServiceConfig{
+		Type:      service.Type,
+		Name:      service.Name,
+		APIKey:    service.APIKey,
+		BaseURL:   service.BaseURL,
+		ProjectID: service.ProjectID,
+		Location:  service.Location,
+		Model:     service.Model,
+
+		SystemInstruction: service.SystemInstruction,
+	}
+}
+
+// newGeminiClient 依服務設定建立 client，並套用全域的逾時與模型設定
+func (b *Bot) newGeminiClient(service gemini.ServiceConfig) *gemini.Client {
+	if service.ExtractModel == "" {
+		service.ExtractModel = b.config.ExtractModel
+	}
+	if service.TTSModel == "" {
+		service.TTSModel = b.config.TTSModel
+	}
+	client := gemini.NewClientWithService(service)
+	client.SetTimeout(time.Duration(b.config.GeminiTimeoutSeconds) * time.Second)
+	client.SetMaxImageDimension(b.config.MaxImageDimension)
+	client.SetSafetyLevel(b.config.SafetyLevel)
+	client.SetImageModelFallbacks(b.config.ImageModelFallbacks)
+	client.SetPromptAffixes(b.config.PromptPrefix, b.config.PromptSuffix)
+	return client
+}
+
 func maskSecret(secret string) string {
 	trimmed := strings.TrimSpace(secret)
 	if trimmed == "" {
@@ -0,0 +1,373 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"tg-bawer/database"
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// /settings 是單一訊息的選單：callback 資料為 settings:<區塊>[:<選項>]，
+// 區塊就是這則訊息目前的狀態，帶選項時先套用設定再停留在同一區塊，返回鍵回到主選單。
+// 各區塊對應的 /voice、/lang、/setdefault 等指令仍保留作為捷徑。
+const (
+	settingsMain    = "main"
+	settingsQuality = "quality"
+	settingsRatio   = "ratio"
+	settingsPrompt  = "prompt"
+	settingsModel   = "model"
+	settingsVoice   = "voice"
+	settingsLang    = "lang"
+)
+
+const (
+	// settingsModelLimit 模型區塊最多列出的模型數
+	settingsModelLimit = 8
+	// settingsModelReset 模型區塊中代表改回預設模型的選項
+	settingsModelReset = "-"
+	// callbackDataLimit Telegram callback_data 的長度上限（位元組）
+	callbackDataLimit = 64
+	// settingsPromptPage Prompt 區塊的換頁選項，完整資料為 settings:prompt:page:<頁碼>
+	settingsPromptPage = "page"
+)
+
+// settingsSections 主選單上的區塊與按鈕文字，依顯示順序排列
+var settingsSections = []struct {
+	section string
+	label   string
+}{
+	{settingsQuality, "🎨 畫質"},
+	{settingsRatio, "📐 比例"},
+	{settingsPrompt, "⭐ 預設 Prompt"},
+	{settingsModel, "🧠 模型"},
+	{settingsVoice, "🗣 語音"},
+	{settingsLang, "🌐 語言"},
+}
+
+// settingsState 渲染選單所需的使用者設定
+type settingsState struct {
+	Lang        string
+	Quality     string
+	Ratio       string
+	PromptLabel string
+	Prompts     []database.SavedPrompt
+	PromptPage  int // 0 代表顯示預設 Prompt 所在的頁
+	ServiceName string
+	Model       string
+	Models      []string // 可切換的模型；nil 代表目前的服務無法從這裡更改
+	Voice       string
+	LangLabel   string
+	StoredLang  string
+}
+
+// settingsData 組出 settings 選單的 callback 資料
+func settingsData(section string, option ...string) string {
+	return strings.Join(append([]string{"settings", section}, option...), ":")
+}
+
+// cmdSettings /settings：以單一訊息的選單調整所有個人設定
+func (b *Bot) cmdSettings(msg *tgbotapi.Message) {
+	text, keyboard := renderSettings(settingsMain, b.loadSettingsState(msg.From, settingsMain))
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ParseMode = "Markdown"
+	reply.ReplyMarkup = keyboard
+	b.api.Send(reply)
+}
+
+// callbackSettings 切換區塊或套用區塊內的選項，一律編輯原本的訊息
+func (b *Bot) callbackSettings(callback *tgbotapi.CallbackQuery, value string) {
+	section, option, hasOption := strings.Cut(value, ":")
+	if !isSettingsSection(section) {
+		section = settingsMain
+	}
+	page := 0
+	if name, arg, ok := strings.Cut(option, ":"); ok && section == settingsPrompt && name == settingsPromptPage {
+		page, _ = strconv.Atoi(arg)
+		hasOption = false
+	}
+
+	notice := ""
+	if hasOption {
+		var ok bool
+		if notice, ok = b.applySetting(callback.From, section, option); !ok {
+			b.api.Request(tgbotapi.NewCallback(callback.ID, notice))
+			return
+		}
+	}
+	b.api.Request(tgbotapi.NewCallback(callback.ID, notice))
+
+	if callback.Message == nil {
+		return
+	}
+	state := b.loadSettingsState(callback.From, section)
+	state.PromptPage = page
+	text, keyboard := renderSettings(section, state)
+	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
+	edit.ParseMode = "Markdown"
+	edit.ReplyMarkup = &keyboard
+	b.api.Send(edit)
+}
+
+func isSettingsSection(section string) bool {
+	if section == settingsMain {
+		return true
+	}
+	for _, s := range settingsSections {
+		if s.section == section {
+			return true
+		}
+	}
+	return false
+}
+
+// applySetting 套用區塊內選擇的選項，回傳提示文字與是否成功
+func (b *Bot) applySetting(user *tgbotapi.User, section, option string) (string, bool) {
+	switch section {
+	case settingsQuality:
+		quality, ok := supportedQualities[option]
+		if !ok {
+			return "不支援的畫質", false
+		}
+		if err := b.db.SetUserSettings(user.ID, quality); err != nil {
+			return "設定失敗", false
+		}
+		return fmt.Sprintf("✅ 預設畫質已設為 %s", quality), true
+
+	case settingsRatio:
+		ratio := option
+		if option == ratioAuto {
+			ratio = ""
+		} else if !supportedRatios[option] {
+			return "不支援的比例", false
+		}
+		if err := b.db.SetUserDefaultRatio(user.ID, ratio); err != nil {
+			return "設定失敗", false
+		}
+		return fmt.Sprintf("✅ 預設比例已設為 %s", ratioLabel(ratio)), true
+
+	case settingsPrompt:
+		id, err := strconv.ParseInt(option, 10, 64)
+		if err != nil || b.db.SetDefaultPrompt(user.ID, id) != nil {
+			return "設定失敗", false
+		}
+		return "✅ 已設定為預設", true
+
+	case settingsModel:
+		service, err := b.db.GetDefaultUserService(user.ID)
+		if err != nil || service == nil {
+			return "目前使用系統服務，無法更改模型", false
+		}
+		model := option
+		if option == settingsModelReset {
+			model = ""
+		} else if !containsString(settingsModelChoices(b.listModels(serviceConfigFromUserService(service)).models), option) {
+			return "不支援的模型", false
+		}
+		if err := b.db.UpdateUserService(user.ID, service.ID, "model", model); err != nil {
+			return "設定失敗", false
+		}
+		if model == "" {
+			model = gemini.DefaultImageModel
+		}
+		return fmt.Sprintf("✅ 模型已設為 %s", model), true
+
+	case settingsVoice:
+		voice := normalizeVoiceName(option)
+		if voice == "" {
+			return "未知的語音", false
+		}
+		if err := b.db.SetUserVoice(user.ID, voice); err != nil {
+			return "設定失敗", false
+		}
+		return fmt.Sprintf("✅ 語音已設為 %s", voice), true
+
+	case settingsLang:
+		stored := option
+		if option == langAuto {
+			stored = ""
+		} else if _, ok := languageNames[option]; !ok {
+			return tr(b.userLang(user), "lang.unknown"), false
+		}
+		if err := b.db.SetUserLanguage(user.ID, stored); err != nil {
+			return tr(b.userLang(user), "lang.failed"), false
+		}
+		return tr(b.userLang(user), "lang.set", b.languageLabel(user)), true
+	}
+	return "", false
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// settingsModelChoices 從服務的模型列表挑出圖片模型；列表中沒有時改用內建的已知圖片模型
+func settingsModelChoices(models []string) []string {
+	var choices []string
+	for _, model := range models {
+		if !strings.Contains(model, "image") || len(settingsData(settingsModel, model)) > callbackDataLimit {
+			continue
+		}
+		choices = append(choices, model)
+		if len(choices) == settingsModelLimit {
+			break
+		}
+	}
+	if len(choices) == 0 {
+		return gemini.KnownImageModels
+	}
+	return choices
+}
+
+// loadSettingsState 讀取選單需要的設定；模型列表可能需要查詢 API，只在模型區塊讀取
+func (b *Bot) loadSettingsState(user *tgbotapi.User, section string) settingsState {
+	quality, _ := b.db.GetUserSettings(user.ID)
+	stored, _ := b.db.GetUserLanguage(user.ID)
+	prompts, _ := b.db.GetSavedPrompts(user.ID)
+
+	state := settingsState{
+		Lang:        b.userLang(user),
+		Quality:     quality,
+		Ratio:       b.userDefaultRatio(user.ID),
+		PromptLabel: "系統預設",
+		Prompts:     prompts,
+		Model:       gemini.DefaultImageModel,
+		Voice:       b.resolveVoice(user.ID),
+		LangLabel:   b.languageLabel(user),
+		StoredLang:  stored,
+	}
+	if defaultPrompt, _ := b.db.GetDefaultPrompt(user.ID); defaultPrompt != nil {
+		state.PromptLabel = defaultPrompt.Name
+	} else if custom, _ := b.db.GetUserDefaultPrompt(user.ID); strings.TrimSpace(custom) != "" {
+		state.PromptLabel = "自訂文字（/setprompt）"
+	}
+
+	service, name, err := b.resolveServiceConfig(user.ID)
+	if err != nil {
+		state.ServiceName = "未設定"
+		return state
+	}
+	state.ServiceName = name
+	if strings.TrimSpace(service.Model) != "" {
+		state.Model = service.Model
+	}
+	if section == settingsModel {
+		if owned, _ := b.db.GetDefaultUserService(user.ID); owned != nil {
+			state.Models = settingsModelChoices(b.listModels(service).models)
+		}
+	}
+	return state
+}
+
+// renderSettings 組出指定區塊的訊息內容與按鈕，各區塊最後一列為返回主選單
+func renderSettings(section string, s settingsState) (string, tgbotapi.InlineKeyboardMarkup) {
+	back := tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ 返回", settingsData(settingsMain)))
+
+	switch section {
+	case settingsQuality:
+		row := tgbotapi.NewInlineKeyboardRow()
+		for _, q := range []string{"1K", "2K", "4K"} {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(qualityButton(q, s.Quality), settingsData(settingsQuality, q)))
+		}
+		return fmt.Sprintf("🎨 *預設畫質*\n\n目前：*%s*", s.Quality), tgbotapi.NewInlineKeyboardMarkup(row, back)
+
+	case settingsRatio:
+		rows := rebaseCallbacks(ratioKeyboardRows(s.Ratio), "ratio:", settingsData(settingsRatio)+":")
+		return fmt.Sprintf("📐 *預設比例*\n\n目前：*%s*（沒有圖片也沒有 @ratio 時使用）", ratioLabel(s.Ratio)),
+			tgbotapi.NewInlineKeyboardMarkup(append(rows, back)...)
+
+	case settingsPrompt:
+		totalPages := pageCount(len(s.Prompts), itemsPerPage)
+		page := clampPage(s.PromptPage, totalPages)
+		if s.PromptPage <= 0 {
+			page = defaultPromptPage(s.Prompts)
+		}
+		text := fmt.Sprintf("⭐ *預設 Prompt*%s\n\n目前：*%s*", pageIndicator(page, totalPages), escapeMarkdown(s.PromptLabel))
+		if len(s.Prompts) == 0 {
+			text += "\n\n尚未保存任何 Prompt，先使用 /save 保存後再設定預設"
+		}
+		var rows [][]tgbotapi.InlineKeyboardButton
+		start := (page - 1) * itemsPerPage
+		for _, p := range s.Prompts[start:min(start+itemsPerPage, len(s.Prompts))] {
+			mark := "○"
+			if p.IsDefault {
+				mark = "●"
+			}
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("%s %s", mark, p.Name), settingsData(settingsPrompt, strconv.FormatInt(p.ID, 10)))))
+		}
+		if nav := pageNavRow(settingsData(settingsPrompt, settingsPromptPage), page, totalPages); nav != nil {
+			rows = append(rows, nav)
+		}
+		return text, tgbotapi.NewInlineKeyboardMarkup(append(rows, back)...)
+
+	case settingsModel:
+		text := fmt.Sprintf("🧠 *圖片模型*\n\n服務：*%s*\n目前：*%s*", escapeMarkdown(s.ServiceName), escapeMarkdown(s.Model))
+		if s.Models == nil {
+			text += "\n\n目前使用系統服務，用 /service add 新增自己的服務後可在這裡更改；單次生成可用 `@model=名稱`"
+			return text, tgbotapi.NewInlineKeyboardMarkup(back)
+		}
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, model := range s.Models {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(qualityButton(model, s.Model), settingsData(settingsModel, model))))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↩️ 使用預設模型", settingsData(settingsModel, settingsModelReset))))
+		return text + "\n\n完整列表請用 /models", tgbotapi.NewInlineKeyboardMarkup(append(rows, back)...)
+
+	case settingsVoice:
+		rows := rebaseCallbacks(voiceKeyboard(s.Voice).InlineKeyboard, "voice:", settingsData(settingsVoice)+":")
+		return fmt.Sprintf("🗣 *TTS 語音*\n\n目前：*%s*", s.Voice), tgbotapi.NewInlineKeyboardMarkup(append(rows, back)...)
+
+	case settingsLang:
+		rows := rebaseCallbacks(langKeyboard(s.Lang, s.StoredLang).InlineKeyboard, "lang:", settingsData(settingsLang)+":")
+		return tr(s.Lang, "lang.title", s.LangLabel), tgbotapi.NewInlineKeyboardMarkup(append(rows, back)...)
+	}
+
+	text := fmt.Sprintf("⚙️ *設定*\n\n🎨 預設畫質：*%s*\n📐 預設比例：*%s*\n⭐ 預設 Prompt：*%s*\n🧠 圖片模型：*%s*\n🗣 TTS 語音：*%s*\n🌐 介面語言：*%s*\n\n選擇要調整的項目：",
+		s.Quality, ratioLabel(s.Ratio), escapeMarkdown(s.PromptLabel), escapeMarkdown(s.Model), s.Voice, s.LangLabel)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i := 0; i < len(settingsSections); i += 2 {
+		row := tgbotapi.NewInlineKeyboardRow()
+		for _, item := range settingsSections[i:min(i+2, len(settingsSections))] {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(item.label, settingsData(item.section)))
+		}
+		rows = append(rows, row)
+	}
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// defaultPromptPage 預設 Prompt 所在的頁碼，沒有預設時為第 1 頁
+func defaultPromptPage(prompts []database.SavedPrompt) int {
+	for i, p := range prompts {
+		if p.IsDefault {
+			return i/itemsPerPage + 1
+		}
+	}
+	return 1
+}
+
+// rebaseCallbacks 把既有捷徑指令的鍵盤改成 settings 選單的 callback，沿用相同的按鈕與標記
+func rebaseCallbacks(rows [][]tgbotapi.InlineKeyboardButton, from, to string) [][]tgbotapi.InlineKeyboardButton {
+	rebased := make([][]tgbotapi.InlineKeyboardButton, len(rows))
+	for i, row := range rows {
+		rebased[i] = make([]tgbotapi.InlineKeyboardButton, len(row))
+		for j, btn := range row {
+			if btn.CallbackData != nil && strings.HasPrefix(*btn.CallbackData, from) {
+				data := to + strings.TrimPrefix(*btn.CallbackData, from)
+				btn.CallbackData = &data
+			}
+			rebased[i][j] = btn
+		}
+	}
+	return rebased
+}
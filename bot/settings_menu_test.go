@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"tg-bawer/config"
+	"tg-bawer/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRenderSettings_MainListsSections(t *testing.T) {
+	text, keyboard := renderSettings(settingsMain, settingsState{Quality: "4K", Voice: "Kore", PromptLabel: "my_prompt", Model: "m"})
+	if !strings.Contains(text, "*4K*") || !strings.Contains(text, `my\_prompt`) {
+		t.Fatalf("unexpected main text: %s", text)
+	}
+
+	var sections []string
+	for _, row := range keyboard.InlineKeyboard {
+		for _, btn := range row {
+			sections = append(sections, *btn.CallbackData)
+		}
+	}
+	want := []string{"settings:quality", "settings:ratio", "settings:prompt", "settings:model", "settings:voice", "settings:lang"}
+	if strings.Join(sections, ",") != strings.Join(want, ",") {
+		t.Fatalf("sections = %v, want %v", sections, want)
+	}
+}
+
+func TestRenderSettings_SectionsEndWithBack(t *testing.T) {
+	state := settingsState{Lang: langZhHant, Quality: "2K", Voice: "Kore", Model: "m",
+		Prompts: []database.SavedPrompt{{ID: 7, Name: "貓", IsDefault: true}}}
+	for _, section := range []string{settingsQuality, settingsRatio, settingsPrompt, settingsModel, settingsVoice, settingsLang} {
+		_, keyboard := renderSettings(section, state)
+		rows := keyboard.InlineKeyboard
+		last := rows[len(rows)-1]
+		if len(last) != 1 || *last[0].CallbackData != "settings:main" {
+			t.Fatalf("%s: expected back button last, got %+v", section, last)
+		}
+		for _, row := range rows {
+			for _, btn := range row {
+				if !strings.HasPrefix(*btn.CallbackData, "settings:") || len(*btn.CallbackData) > callbackDataLimit {
+					t.Fatalf("%s: unexpected callback data %q", section, *btn.CallbackData)
+				}
+			}
+		}
+	}
+
+	_, keyboard := renderSettings(settingsPrompt, state)
+	if btn := keyboard.InlineKeyboard[0][0]; btn.Text != "● 貓" || *btn.CallbackData != "settings:prompt:7" {
+		t.Fatalf("unexpected prompt button %q %q", btn.Text, *btn.CallbackData)
+	}
+}
+
+func TestRenderSettings_ModelReadOnlyWithoutOwnService(t *testing.T) {
+	text, keyboard := renderSettings(settingsModel, settingsState{ServiceName: "env-default", Model: "m"})
+	if len(keyboard.InlineKeyboard) != 1 || !strings.Contains(text, "/service add") {
+		t.Fatalf("expected read-only model section, got %d rows: %s", len(keyboard.InlineKeyboard), text)
+	}
+
+	_, keyboard = renderSettings(settingsModel, settingsState{Model: "b-image", Models: []string{"a-image", "b-image"}})
+	if got := keyboard.InlineKeyboard[1][0].Text; got != "● b-image" {
+		t.Fatalf("expected current model marked, got %q", got)
+	}
+}
+
+func TestSettingsModelChoices(t *testing.T) {
+	got := settingsModelChoices([]string{"gemini-2.5-pro", "gemini-3-pro-image-preview", "text-embedding", strings.Repeat("x", 60) + "image"})
+	if len(got) != 1 || got[0] != "gemini-3-pro-image-preview" {
+		t.Fatalf("unexpected choices %v", got)
+	}
+	if got := settingsModelChoices([]string{"gemini-2.5-pro"}); len(got) == 0 {
+		t.Fatal("expected known image models as fallback")
+	}
+}
+
+func TestApplySetting(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db, config: &config.Config{}}
+	user := &tgbotapi.User{ID: 1}
+
+	if _, ok := b.applySetting(user, settingsQuality, "4k"); !ok {
+		t.Fatal("expected quality to be applied")
+	}
+	if quality, _ := db.GetUserSettings(1); quality != "4K" {
+		t.Fatalf("quality = %q, want 4K", quality)
+	}
+	if _, ok := b.applySetting(user, settingsQuality, "5K"); ok {
+		t.Fatal("expected invalid quality to be rejected")
+	}
+
+	if _, ok := b.applySetting(user, settingsRatio, "16:9"); !ok || b.userDefaultRatio(1) != "16:9" {
+		t.Fatalf("expected ratio 16:9, got %q", b.userDefaultRatio(1))
+	}
+	if _, ok := b.applySetting(user, settingsVoice, "puck"); !ok || b.resolveVoice(1) != "Puck" {
+		t.Fatalf("expected voice Puck, got %q", b.resolveVoice(1))
+	}
+	if _, ok := b.applySetting(user, settingsLang, langEn); !ok {
+		t.Fatal("expected language to be applied")
+	}
+	if stored, _ := db.GetUserLanguage(1); stored != langEn {
+		t.Fatalf("stored language = %q", stored)
+	}
+	if _, ok := b.applySetting(user, settingsModel, "gemini-2.5-flash-image"); ok {
+		t.Fatal("expected model change to be rejected without own service")
+	}
+	if _, ok := b.applySetting(user, settingsPrompt, "99"); ok {
+		t.Fatal("expected unknown prompt to be rejected")
+	}
+}
+
+func TestRenderSettings_PromptPages(t *testing.T) {
+	var prompts []database.SavedPrompt
+	for i := 1; i <= itemsPerPage+3; i++ {
+		prompts = append(prompts, database.SavedPrompt{ID: int64(i), Name: fmt.Sprintf("p%d", i), IsDefault: i == itemsPerPage+2})
+	}
+	state := settingsState{Prompts: prompts}
+
+	// 未指定頁碼時顯示預設 Prompt 所在的第 2 頁
+	text, keyboard := renderSettings(settingsPrompt, state)
+	rows := keyboard.InlineKeyboard
+	if !strings.Contains(text, "第 2/2 頁") || len(rows) != 3+2 {
+		t.Fatalf("expected page 2 with 3 prompts, nav and back, got %q %d rows", text, len(rows))
+	}
+	if nav := rows[len(rows)-2]; *nav[0].CallbackData != "settings:prompt:page:1" {
+		t.Fatalf("unexpected nav row %q", *nav[0].CallbackData)
+	}
+
+	state.PromptPage = 1
+	_, keyboard = renderSettings(settingsPrompt, state)
+	if rows := keyboard.InlineKeyboard; len(rows) != itemsPerPage+2 || *rows[0][0].CallbackData != "settings:prompt:1" {
+		t.Fatalf("expected first page of prompts, got %d rows", len(rows))
+	}
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// translateTargets 未指定 @lang= 時依介面語言決定的目標語言
+var translateTargets = map[string]string{
+	langZhHant: "繁體中文",
+	langEn:     "English",
+}
+
+// parseTranslateArgs 從 /translate 參數取出 @lang= 目標語言，其餘視為要翻譯的文字
+func parseTranslateArgs(args string) (target, text string) {
+	for _, field := range strings.Fields(args) {
+		if strings.HasPrefix(strings.ToLower(field), "@lang=") {
+			target = strings.TrimSpace(field[len("@lang="):])
+			args = strings.Replace(args, field, "", 1)
+		}
+	}
+	return target, strings.TrimSpace(args)
+}
+
+// cmdTranslate 只翻譯文字，不生成圖片
+func (b *Bot) cmdTranslate(msg *tgbotapi.Message) {
+	target, text := parseTranslateArgs(msg.CommandArguments())
+	if text == "" && msg.ReplyToMessage != nil {
+		text = strings.TrimSpace(msg.ReplyToMessage.Text)
+		if text == "" {
+			text = strings.TrimSpace(msg.ReplyToMessage.Caption)
+		}
+	}
+	if text == "" {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ 格式：/translate [@lang=語言] <文字>\n或回覆一則文字訊息並輸入 /translate")
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+	if target == "" {
+		target = translateTargets[b.userLang(msg.From)]
+	}
+
+	serviceConfig, _, err := b.resolveServiceConfig(msg.From.ID)
+	if err != nil {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n請先用 /service add 新增服務")
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+	gClient := b.newGeminiClient(serviceConfig)
+
+	processingMsg, err := b.sendReplyMessage(msg, "⏳ *翻譯中...*")
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	translated, err := gClient.TranslateText(ctx, text, target)
+	if err != nil {
+		b.updateMessageHTML(processingMsg, withErrorHint(defaultLang, fmt.Sprintf("❌ <b>翻譯失敗</b>\n\n<blockquote expandable>%s</blockquote>",
+			html.EscapeString(truncateError(err.Error()))), err))
+		return
+	}
+
+	result := fmt.Sprintf("🌐 <b>翻譯結果</b>（%s）\n\n%s", html.EscapeString(target), html.EscapeString(translated))
+	if messageLength(result) <= inlineMessageLimit {
+		b.updateMessageHTML(processingMsg, result)
+		return
+	}
+	// 超過單則訊息上限時改為分段發送
+	b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
+	b.sendLongMessage(msg.Chat.ID, msg.MessageID, result, "HTML")
+}
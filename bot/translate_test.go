@@ -0,0 +1,23 @@
+package bot
+
+import "testing"
+
+func TestParseTranslateArgs(t *testing.T) {
+	tests := []struct {
+		args   string
+		target string
+		text   string
+	}{
+		{"早安", "", "早安"},
+		{"@lang=日本語 早安", "日本語", "早安"},
+		{"早安\n晚安 @LANG=en", "en", "早安\n晚安"},
+		{"@lang=en", "en", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		target, text := parseTranslateArgs(tt.args)
+		if target != tt.target || text != tt.text {
+			t.Fatalf("parseTranslateArgs(%q) = (%q, %q), want (%q, %q)", tt.args, target, text, tt.target, tt.text)
+		}
+	}
+}
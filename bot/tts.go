@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"tg-bawer/config"
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Gemini 內建的預設語音
+var ttsVoices = []string{
+	"Kore", "Puck", "Charon", "Zephyr", "Fenrir", "Leda",
+	"Orus", "Aoede", "Callirrhoe", "Autonoe", "Enceladus", "Iapetus",
+	"Umbriel", "Algieba", "Despina", "Erinome", "Algenib", "Rasalgethi",
+	"Laomedeia", "Achernar", "Alnilam", "Schedar", "Gacrux", "Pulcherrima",
+	"Achird", "Zubenelgenubi", "Vindemiatrix", "Sadachbia", "Sadaltager", "Sulafat",
+}
+
+// normalizeVoiceName 將不分大小寫的語音名稱轉成官方寫法，不認得時回傳空字串
+func normalizeVoiceName(name string) string {
+	for _, voice := range ttsVoices {
+		if strings.EqualFold(voice, strings.TrimSpace(name)) {
+			return voice
+		}
+	}
+	return ""
+}
+
+// resolveVoice 取得使用者的 TTS 語音，未設定時使用 config.TTSVoiceName
+func (b *Bot) resolveVoice(userID int64) string {
+	voice, _ := b.db.GetUserVoice(userID)
+	if v := normalizeVoiceName(voice); v != "" {
+		return v
+	}
+	return config.TTSVoiceName
+}
+
+// cmdVoice 顯示語音選單
+func (b *Bot) cmdVoice(msg *tgbotapi.Message) {
+	current := b.resolveVoice(msg.From.ID)
+
+	keyboard := voiceKeyboard(current)
+	reply := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🗣 *選擇 TTS 語音*\n\n目前語音：*%s*", current))
+	reply.ParseMode = "Markdown"
+	reply.ReplyMarkup = keyboard
+	b.api.Send(reply)
+}
+
+func (b *Bot) callbackVoice(callback *tgbotapi.CallbackQuery, name string) {
+	voice := normalizeVoiceName(name)
+	if voice == "" {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "未知的語音"))
+		return
+	}
+
+	if err := b.db.SetUserVoice(callback.From.ID, voice); err != nil {
+		b.api.Request(tgbotapi.NewCallback(callback.ID, "設定失敗"))
+		return
+	}
+
+	b.api.Request(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("✅ 語音已設為 %s", voice)))
+
+	keyboard := voiceKeyboard(voice)
+	edit := tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID,
+		fmt.Sprintf("🗣 *選擇 TTS 語音*\n\n目前語音：*%s*", voice))
+	edit.ParseMode = "Markdown"
+	edit.ReplyMarkup = &keyboard
+	b.api.Send(edit)
+}
+
+func voiceKeyboard(current string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, voice := range ttsVoices {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(qualityButton(voice, current), "voice:"+voice))
+		if len(row) == 3 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// cmdTTS 將任意文字轉成語音：/tts [語音名稱] <文字>，也可回覆一則文字訊息
+func (b *Bot) cmdTTS(msg *tgbotapi.Message) {
+	args := strings.TrimSpace(msg.CommandArguments())
+	voice := b.resolveVoice(msg.From.ID)
+
+	if fields := strings.Fields(args); len(fields) > 0 {
+		if v := normalizeVoiceName(fields[0]); v != "" {
+			voice = v
+			args = strings.TrimSpace(strings.TrimPrefix(args, fields[0]))
+		}
+	}
+
+	text := args
+	if text == "" && msg.ReplyToMessage != nil {
+		text = strings.TrimSpace(msg.ReplyToMessage.Text)
+		if text == "" {
+			text = strings.TrimSpace(msg.ReplyToMessage.Caption)
+		}
+	}
+	if text == "" {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ 格式：/tts [語音名稱] <文字>\n或回覆一則文字訊息並輸入 /tts")
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+
+	serviceConfig, _, err := b.resolveServiceConfig(msg.From.ID)
+	if err != nil {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ "+err.Error()+"\n請先用 /service add 新增服務")
+		reply.ReplyToMessageID = msg.MessageID
+		b.api.Send(reply)
+		return
+	}
+	gClient := b.newGeminiClient(serviceConfig)
+
+	processingMsg, err := b.sendReplyMessage(msg, fmt.Sprintf("⏳ *生成語音中...*\n\n🗣 語音：`%s`", voice))
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	ttsResult, err := gClient.GenerateTTS(ctx, text, voice)
+	if err != nil {
+		b.updateMessageHTML(processingMsg, withErrorHint(defaultLang, fmt.Sprintf("❌ <b>語音生成失敗</b>\n\n<blockquote expandable>%s</blockquote>",
+			html.EscapeString(truncateError(err.Error()))), err))
+		return
+	}
+
+	b.api.Request(tgbotapi.NewDeleteMessage(msg.Chat.ID, processingMsg.MessageID))
+
+	audioMsg := tgbotapi.NewAudio(msg.Chat.ID, tgbotapi.FileBytes{Name: "tts.wav", Bytes: ttsResult.WAV()})
+	audioMsg.ReplyToMessageID = msg.MessageID
+	audioMsg.Title = "TTS (" + voice + ")"
+	b.api.Send(audioMsg)
+}
+
+// generateVoiceForImage 擷取圖片文字並生成語音（WAV），任一步失敗都回傳 nil，不影響圖片結果
+func (b *Bot) generateVoiceForImage(ctx context.Context, gClient *gemini.Client, processingMsg tgbotapi.Message, source gemini.DownloadedImage, userID int64) []byte {
+	b.updateMessageMarkdown(processingMsg, "⏳ *擷取文字中...*")
+	extractedText, err := gClient.ExtractText(ctx, source.Data, source.MimeType, config.ExtractTextPrompt)
+	if err != nil || strings.TrimSpace(extractedText) == "" {
+		log.Printf("語音模式擷取文字失敗: %v", err)
+		return nil
+	}
+
+	b.updateMessageMarkdown(processingMsg, "⏳ *生成語音中...*")
+	ttsResult, err := gClient.GenerateTTS(ctx, extractedText, b.resolveVoice(userID))
+	if err != nil {
+		log.Printf("語音模式生成語音失敗: %v", err)
+		return nil
+	}
+
+	return ttsResult.WAV()
+}
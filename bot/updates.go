@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// updatesMaxFailures getUpdates 連續失敗超過此次數就結束程序，交由 docker 的 restart 重新啟動
+	updatesMaxFailures = 20
+	// updatesBackoff 第一次失敗後的等待時間，之後每次加倍
+	updatesBackoff = 2 * time.Second
+	// updatesMaxBackoff 失敗後等待時間的上限
+	updatesMaxBackoff = time.Minute
+)
+
+// updatesReconnectDelay 連續第 n 次（從 1 開始）失敗後的等待時間
+func updatesReconnectDelay(n int) time.Duration {
+	delay := updatesBackoff
+	for i := 1; i < n && delay < updatesMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, updatesMaxBackoff)
+}
+
+// pollUpdates 以 getUpdates 長輪詢並依序交給 handle；失敗時退避後重試，成功一次即重新計算，
+// 連續失敗超過 updatesMaxFailures 次時回傳最後的錯誤。
+// 不使用 GetUpdatesChan：它遇到錯誤只會每 3 秒無限重試，持續失敗時外部完全無從得知
+func pollUpdates(fetch func(tgbotapi.UpdateConfig) ([]tgbotapi.Update, error), u tgbotapi.UpdateConfig,
+	handle func(tgbotapi.Update), sleep func(time.Duration)) error {
+	failures := 0
+	for {
+		updates, err := fetch(u)
+		if err != nil {
+			failures++
+			if failures > updatesMaxFailures {
+				return err
+			}
+			delay := updatesReconnectDelay(failures)
+			log.Printf("⚠️ 取得更新失敗，%s 後重試（連續第 %d/%d 次）: %v", delay, failures, updatesMaxFailures, redactSecrets(err.Error()))
+			sleep(delay)
+			continue
+		}
+		if failures > 0 {
+			log.Printf("✅ 已恢復接收更新（先前連續失敗 %d 次）", failures)
+			failures = 0
+		}
+
+		for _, update := range updates {
+			// 下一次 getUpdates 以 offset 確認已處理的更新，避免重複收到
+			if update.UpdateID >= u.Offset {
+				u.Offset = update.UpdateID + 1
+			}
+			handle(update)
+		}
+	}
+}
+
+// dispatchUpdate 依更新類型分派
+func (b *Bot) dispatchUpdate(update tgbotapi.Update) {
+	if update.Message != nil {
+		b.dispatchMessage(update.Message)
+	} else if update.CallbackQuery != nil {
+		go b.handleCallback(update.CallbackQuery)
+	} else if update.InlineQuery != nil {
+		go b.handleInlineQuery(update.InlineQuery)
+	}
+}
@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestUpdatesReconnectDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  2 * time.Second,
+		2:  4 * time.Second,
+		5:  32 * time.Second,
+		6:  time.Minute,
+		20: time.Minute,
+	}
+	for n, want := range cases {
+		if got := updatesReconnectDelay(n); got != want {
+			t.Fatalf("updatesReconnectDelay(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestPollUpdates_GivesUpAfterConsecutiveFailures(t *testing.T) {
+	errDown := errors.New("connection refused")
+	calls := 0
+	var sleeps []time.Duration
+	err := pollUpdates(func(tgbotapi.UpdateConfig) ([]tgbotapi.Update, error) {
+		calls++
+		return nil, errDown
+	}, tgbotapi.NewUpdate(0), func(tgbotapi.Update) {
+		t.Fatal("no updates expected")
+	}, func(d time.Duration) { sleeps = append(sleeps, d) })
+
+	if !errors.Is(err, errDown) {
+		t.Fatalf("err = %v, want %v", err, errDown)
+	}
+	if calls != updatesMaxFailures+1 || len(sleeps) != updatesMaxFailures {
+		t.Fatalf("calls = %d, sleeps = %d", calls, len(sleeps))
+	}
+	if sleeps[0] != updatesBackoff || sleeps[len(sleeps)-1] != updatesMaxBackoff {
+		t.Fatalf("unexpected backoff %v", sleeps)
+	}
+}
+
+func TestPollUpdates_AdvancesOffsetAndResetsFailures(t *testing.T) {
+	errDown := errors.New("bad gateway")
+	var offsets []int
+	var handled []int
+	calls := 0
+	fetch := func(u tgbotapi.UpdateConfig) ([]tgbotapi.Update, error) {
+		calls++
+		offsets = append(offsets, u.Offset)
+		switch {
+		case calls <= updatesMaxFailures:
+			// 失敗到剛好不超過上限，接著恢復
+			return nil, errDown
+		case calls == updatesMaxFailures+1:
+			return []tgbotapi.Update{{UpdateID: 41}, {UpdateID: 42}}, nil
+		case calls == updatesMaxFailures+2:
+			return []tgbotapi.Update{{UpdateID: 43}}, nil
+		}
+		return nil, errDown
+	}
+
+	err := pollUpdates(fetch, tgbotapi.NewUpdate(0), func(u tgbotapi.Update) {
+		handled = append(handled, u.UpdateID)
+	}, func(time.Duration) {})
+	if err == nil {
+		t.Fatal("expected error after failures")
+	}
+
+	// 恢復後重新計算：之後還要再連續失敗 updatesMaxFailures+1 次才放棄
+	if want := 2*updatesMaxFailures + 3; calls != want {
+		t.Fatalf("calls = %d, want %d", calls, want)
+	}
+	if len(handled) != 3 || handled[0] != 41 || handled[2] != 43 {
+		t.Fatalf("handled = %v", handled)
+	}
+	if offsets[updatesMaxFailures+1] != 43 || offsets[len(offsets)-1] != 44 {
+		t.Fatalf("offsets not advanced: %v", offsets[updatesMaxFailures:])
+	}
+}
@@ -0,0 +1,163 @@
+package bot
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// userQueueIdleTimeout 佇列閒置多久後結束 worker 並移除
+	userQueueIdleTimeout = 5 * time.Minute
+	// userQueueMaxWait 排隊超過此時間的訊息直接略過，避免處理使用者早已放棄的請求
+	userQueueMaxWait = 10 * time.Minute
+)
+
+// userQueues 每位使用者一條有上限的 FIFO 佇列與一個 worker：
+// 同一使用者的訊息依序處理，也不會因為某人連發而占滿所有資源
+type userQueues struct {
+	mu       sync.Mutex
+	queues   map[int64]chan queuedMessage
+	capacity int
+	idle     time.Duration
+	maxWait  time.Duration
+	handle   func(*tgbotapi.Message)
+	expired  func(*tgbotapi.Message) // 排隊過久被略過時呼叫，可為 nil
+}
+
+type queuedMessage struct {
+	msg        *tgbotapi.Message
+	enqueuedAt time.Time
+}
+
+func newUserQueues(capacity int, handle, expired func(*tgbotapi.Message)) *userQueues {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &userQueues{
+		queues:   make(map[int64]chan queuedMessage),
+		capacity: capacity,
+		idle:     userQueueIdleTimeout,
+		maxWait:  userQueueMaxWait,
+		handle:   handle,
+		expired:  expired,
+	}
+}
+
+// enqueue 放入使用者的佇列，第一次出現時建立 worker；佇列已滿時回傳 false
+func (q *userQueues) enqueue(userID int64, msg *tgbotapi.Message) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ch, ok := q.queues[userID]
+	if !ok {
+		ch = make(chan queuedMessage, q.capacity)
+		q.queues[userID] = ch
+		go q.work(userID, ch)
+	}
+
+	// 持有鎖時送入，worker 移除佇列前也會取得鎖，因此不會送進已結束的佇列
+	select {
+	case ch <- queuedMessage{msg: msg, enqueuedAt: time.Now()}:
+		return true
+	default:
+		return false
+	}
+}
+
+// work 依序處理佇列中的訊息，閒置超過 idle 後移除佇列並結束
+func (q *userQueues) work(userID int64, ch chan queuedMessage) {
+	timer := time.NewTimer(q.idle)
+	defer timer.Stop()
+
+	for {
+		select {
+		case item := <-ch:
+			if time.Since(item.enqueuedAt) > q.maxWait {
+				if q.expired != nil {
+					q.expired(item.msg)
+				}
+			} else {
+				q.handle(item.msg)
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(q.idle)
+		case <-timer.C:
+			q.mu.Lock()
+			if len(ch) > 0 {
+				q.mu.Unlock()
+				timer.Reset(q.idle)
+				continue
+			}
+			delete(q.queues, userID)
+			q.mu.Unlock()
+			return
+		}
+	}
+}
+
+// size 目前存在的佇列數量
+func (q *userQueues) size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queues)
+}
+
+// dispatchMessage 只有會觸發生成的訊息才放入發送者的佇列；
+// 指令、Media Group 圖片快取與群組中的一般聊天直接處理，不占用佇列
+func (b *Bot) dispatchMessage(msg *tgbotapi.Message) {
+	// 在更新迴圈中同步快取，確保觸發生成時同組的圖片都已收到
+	if len(msg.Photo) > 0 && msg.MediaGroupID != "" {
+		photo := msg.Photo[len(msg.Photo)-1]
+		b.cacheMediaGroupImage(msg.MediaGroupID, photo.FileID)
+		log.Printf("[收到圖片] MediaGroupID=%s, MessageID=%d", msg.MediaGroupID, msg.MessageID)
+	}
+
+	if msg.From == nil || !needsUserQueue(msg) {
+		go b.handleMessage(msg)
+		return
+	}
+	if !b.userQueues.enqueue(msg.From.ID, msg) {
+		go b.notifyUserQueue(msg, "status.user_queue_full")
+	}
+}
+
+// needsUserQueue 對應 handleMessage 中會開始生成的分支
+func needsUserQueue(msg *tgbotapi.Message) bool {
+	if msg.IsCommand() {
+		return false
+	}
+	if (len(msg.Photo) > 0 && msg.Caption == "") || msg.Sticker != nil {
+		return msg.ReplyToMessage != nil && msg.ReplyToMessage.Text != ""
+	}
+	if isPDFDocument(msg.Document) || msg.Text != "" || len(msg.Photo) > 0 {
+		return !(msg.Chat.IsGroup() || msg.Chat.IsSuperGroup()) || isGroupTrigger(msg)
+	}
+	return false
+}
+
+// notifyQueueExpired 排隊過久被略過的訊息
+func (b *Bot) notifyQueueExpired(msg *tgbotapi.Message) {
+	b.notifyUserQueue(msg, "status.user_queue_expired")
+}
+
+// notifyUserQueue 回覆佇列相關的提示，進入佇列的訊息都是會觸發生成的請求
+func (b *Bot) notifyUserQueue(msg *tgbotapi.Message, key string) {
+	reply := tgbotapi.NewMessage(msg.Chat.ID, tr(b.userLang(msg.From), key))
+	reply.ReplyToMessageID = msg.MessageID
+	b.api.Send(reply)
+}
+
+// isGroupTrigger 群組中以 . 開頭的文字或說明文字才會觸發生成
+func isGroupTrigger(msg *tgbotapi.Message) bool {
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	return strings.HasPrefix(text, ".")
+}
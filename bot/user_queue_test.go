@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestUserQueues_PreservesOrder(t *testing.T) {
+	var mu sync.Mutex
+	var got []int
+	done := make(chan struct{})
+	q := newUserQueues(10, func(msg *tgbotapi.Message) {
+		mu.Lock()
+		got = append(got, msg.MessageID)
+		n := len(got)
+		mu.Unlock()
+		if n == 5 {
+			close(done)
+		}
+	}, nil)
+
+	for i := 1; i <= 5; i++ {
+		if !q.enqueue(1, &tgbotapi.Message{MessageID: i}) {
+			t.Fatalf("enqueue %d 不應失敗", i)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("等待處理逾時")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, id := range got {
+		if id != i+1 {
+			t.Fatalf("處理順序錯誤: %v", got)
+		}
+	}
+}
+
+func TestUserQueues_RejectsWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{}, 1)
+	q := newUserQueues(1, func(msg *tgbotapi.Message) {
+		started <- struct{}{}
+		<-block
+	}, nil)
+	defer close(block)
+
+	q.enqueue(1, &tgbotapi.Message{MessageID: 1})
+	<-started // worker 正在處理第一則，佇列為空
+
+	if !q.enqueue(1, &tgbotapi.Message{MessageID: 2}) {
+		t.Fatal("佇列尚有空間，不應拒絕")
+	}
+	if q.enqueue(1, &tgbotapi.Message{MessageID: 3}) {
+		t.Fatal("佇列已滿應拒絕")
+	}
+	// 其他使用者不受影響
+	if !q.enqueue(2, &tgbotapi.Message{MessageID: 4}) {
+		t.Fatal("其他使用者的佇列不應受影響")
+	}
+}
+
+func TestUserQueues_SkipsExpired(t *testing.T) {
+	handled := make(chan int, 1)
+	expired := make(chan int, 1)
+	q := newUserQueues(1, func(msg *tgbotapi.Message) {
+		handled <- msg.MessageID
+	}, func(msg *tgbotapi.Message) {
+		expired <- msg.MessageID
+	})
+	q.maxWait = -time.Second // 所有訊息都視為已逾時
+
+	q.enqueue(1, &tgbotapi.Message{MessageID: 7})
+	select {
+	case id := <-expired:
+		if id != 7 {
+			t.Fatalf("逾時訊息 = %d, want 7", id)
+		}
+	case <-handled:
+		t.Fatal("逾時訊息不應被處理")
+	case <-time.After(2 * time.Second):
+		t.Fatal("等待逾時通知逾時")
+	}
+}
+
+func TestUserQueues_RemovesIdleQueues(t *testing.T) {
+	handled := make(chan struct{}, 1)
+	q := newUserQueues(1, func(msg *tgbotapi.Message) {
+		handled <- struct{}{}
+	}, nil)
+	q.idle = 20 * time.Millisecond
+
+	q.enqueue(1, &tgbotapi.Message{MessageID: 1})
+	<-handled
+
+	deadline := time.Now().Add(2 * time.Second)
+	for q.size() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("閒置佇列未被移除")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 移除後再次送入會重新建立 worker
+	q.enqueue(1, &tgbotapi.Message{MessageID: 2})
+	select {
+	case <-handled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("重新建立的佇列未處理訊息")
+	}
+}
+
+func TestNeedsUserQueue(t *testing.T) {
+	private := &tgbotapi.Chat{Type: "private"}
+	group := &tgbotapi.Chat{Type: "supergroup"}
+	textReply := &tgbotapi.Message{Text: "原文"}
+	photo := []tgbotapi.PhotoSize{{FileID: "p"}}
+	command := &tgbotapi.Message{Chat: private, Text: "/jobs", Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Length: 5}}}
+
+	cases := []struct {
+		name string
+		msg  *tgbotapi.Message
+		want bool
+	}{
+		{"command", command, false},
+		{"private text", &tgbotapi.Message{Chat: private, Text: "一隻貓"}, true},
+		{"group chatter", &tgbotapi.Message{Chat: group, Text: "hello"}, false},
+		{"group trigger", &tgbotapi.Message{Chat: group, Text: ".一隻貓"}, true},
+		{"album photo without caption", &tgbotapi.Message{Chat: private, Photo: photo, MediaGroupID: "g"}, false},
+		{"album photo with caption", &tgbotapi.Message{Chat: private, Photo: photo, MediaGroupID: "g", Caption: "換背景"}, true},
+		{"photo replying to text", &tgbotapi.Message{Chat: group, Photo: photo, ReplyToMessage: textReply}, true},
+		{"lone sticker", &tgbotapi.Message{Chat: private, Sticker: &tgbotapi.Sticker{FileID: "s"}}, false},
+	}
+	for _, c := range cases {
+		if got := needsUserQueue(c.msg); got != c.want {
+			t.Fatalf("%s: needsUserQueue = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
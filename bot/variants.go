@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"tg-bawer/gemini"
+)
+
+// maxMediaGroupSize Telegram 單一 Media Group 最多可放的項目數
+const maxMediaGroupSize = 10
+
+// clampVariants 將 @variants=N 限制在 1 到 MAX_VARIANTS（且不超過一個 Media Group）之間
+func clampVariants(requested, max int) int {
+	if max > maxMediaGroupSize {
+		max = maxMediaGroupSize
+	}
+	if requested > max {
+		requested = max
+	}
+	if requested < 1 {
+		return 1
+	}
+	return requested
+}
+
+// sendGeneratedResults 只有一張時沿用 sendGeneratedResult；多張候選時以 Media Group 發送預覽與原檔，方便挑選
+func (b *Bot) sendGeneratedResults(lang string, chatID int64, replyToMessageID int, quality string, results []*gemini.ImageResult, voiceAudio []byte, logID int64) {
+	if len(results) == 1 {
+		b.sendGeneratedResult(lang, chatID, replyToMessageID, quality, results[0], voiceAudio, logID)
+		return
+	}
+
+	var previews, documents []interface{}
+	for i, result := range results {
+		caption := fmt.Sprintf("🎲 候選 %d/%d", i+1, len(results))
+		if text := resultCaption(lang, result); text != "" {
+			caption = truncateRunes(caption+"\n"+text, 1024, "...")
+		}
+		photo := tgbotapi.NewInputMediaPhoto(tgbotapi.FileBytes{Name: fmt.Sprintf("preview_%d%s", i+1, result.FileExt()), Bytes: result.ImageData})
+		photo.Caption = caption
+		previews = append(previews, photo)
+
+		documents = append(documents, tgbotapi.NewInputMediaDocument(tgbotapi.FileBytes{
+			Name:  fmt.Sprintf("generated_%s_%d%s", quality, i+1, result.FileExt()),
+			Bytes: result.ImageData,
+		}))
+	}
+
+	for _, group := range [][]interface{}{previews, documents} {
+		mediaGroup := tgbotapi.NewMediaGroup(chatID, group)
+		mediaGroup.ReplyToMessageID = replyToMessageID
+		if _, err := b.api.SendMediaGroup(mediaGroup); err != nil {
+			log.Printf("發送候選圖片 Media Group 失敗: %v", err)
+		}
+	}
+
+	if len(voiceAudio) > 0 {
+		audioMsg := tgbotapi.NewAudio(chatID, tgbotapi.FileBytes{Name: "voice.wav", Bytes: voiceAudio})
+		audioMsg.ReplyToMessageID = replyToMessageID
+		b.api.Send(audioMsg)
+	}
+
+	// Media Group 無法附加按鈕，另外發送一則訊息供評分
+	if logID > 0 {
+		notice := tgbotapi.NewMessage(chatID, fmt.Sprintf("📎 共 %d 張候選，挑一張最喜歡的吧！", len(results)))
+		notice.ReplyToMessageID = replyToMessageID
+		notice.ReplyMarkup = rateKeyboard(logID, 0)
+		b.api.Send(notice)
+	}
+}
@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"tg-bawer/gemini"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cmdWhoami 顯示目前實際會套用的設定，方便排查結果與預期不同的原因
+func (b *Bot) cmdWhoami(msg *tgbotapi.Message) {
+	var lines []string
+	lines = append(lines, "🪪 <b>目前生效的設定</b>", "")
+	lines = append(lines, fmt.Sprintf("👤 使用者 ID：<code>%d</code>", msg.From.ID))
+
+	serviceLabel := "未設定（請用 /service add）"
+	model := gemini.DefaultImageModel
+	if service, name, err := b.resolveServiceConfig(msg.From.ID); err == nil {
+		serviceLabel = name
+		if m := strings.TrimSpace(service.Model); m != "" {
+			model = m
+		}
+	}
+	lines = append(lines, fmt.Sprintf("🔌 服務：%s", html.EscapeString(serviceLabel)))
+	lines = append(lines, fmt.Sprintf("🧠 模型：<code>%s</code>", html.EscapeString(model)))
+	lines = append(lines, fmt.Sprintf("🎨 預設畫質：%s", b.resolveDefaultQuality(msg)))
+	lines = append(lines, fmt.Sprintf("📝 預設 Prompt：%s", html.EscapeString(b.defaultPromptLabel(msg))))
+	lines = append(lines, fmt.Sprintf("🗣 TTS 語音：%s", html.EscapeString(b.resolveVoice(msg.From.ID))))
+
+	if b.chatSettingsFor(msg.Chat) != nil {
+		lines = append(lines, "", "👥 此群組已啟用共用設定（/chatsettings），畫質與 Prompt 以群組設定為優先")
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, strings.Join(lines, "\n"))
+	reply.ParseMode = "HTML"
+	b.api.Send(reply)
+}
+
+// defaultPromptLabel 說明未指定 Prompt 時會用哪一個，順序與 resolveMessageDefaultPrompt 相同
+func (b *Bot) defaultPromptLabel(msg *tgbotapi.Message) string {
+	if name, prompt := b.topicDefaultPrompt(b.topicSettingsFor(msg)); strings.TrimSpace(prompt) != "" {
+		return "主題預設「" + name + "」"
+	}
+	if settings := b.chatSettingsFor(msg.Chat); settings != nil && strings.TrimSpace(settings.DefaultPrompt) != "" {
+		return "群組預設"
+	}
+	if saved, _ := b.db.GetDefaultPrompt(msg.From.ID); saved != nil {
+		return "「" + saved.Name + "」"
+	}
+	if custom, _ := b.db.GetUserDefaultPrompt(msg.From.ID); strings.TrimSpace(custom) != "" {
+		return "自訂預設文字（/setprompt）"
+	}
+	return "系統預設"
+}
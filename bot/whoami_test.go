@@ -0,0 +1,35 @@
+package bot
+
+import (
+	"testing"
+
+	"tg-bawer/config"
+	"tg-bawer/database"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestDefaultPromptLabel(t *testing.T) {
+	db, err := database.NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	b := &Bot{db: db, config: &config.Config{}}
+
+	msg := &tgbotapi.Message{From: &tgbotapi.User{ID: 1}, Chat: &tgbotapi.Chat{ID: 1, Type: "private"}}
+	if got := b.defaultPromptLabel(msg); got != "系統預設" {
+		t.Fatalf("expected system default label, got %q", got)
+	}
+
+	if err := db.SavePrompt(1, "漫畫", "翻譯"); err != nil {
+		t.Fatalf("SavePrompt failed: %v", err)
+	}
+	prompts, _ := db.GetSavedPrompts(1)
+	if err := db.SetDefaultPrompt(1, prompts[0].ID); err != nil {
+		t.Fatalf("SetDefaultPrompt failed: %v", err)
+	}
+	if got := b.defaultPromptLabel(msg); got != "「漫畫」" {
+		t.Fatalf("expected saved prompt label, got %q", got)
+	}
+}
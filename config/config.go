@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -9,6 +12,77 @@ type Config struct {
 	GeminiBaseURL string
 	BotToken      string
 	DataDir       string
+
+	// 圖片模型不存在（404）時依序改用的備援模型
+	ImageModelFallbacks []string
+
+	// 每次圖片生成都加在 Prompt 前後的文字（例如統一的風格要求），為空時不加
+	PromptPrefix string
+	PromptSuffix string
+
+	// 擷取文字（含翻譯、Prompt 擴寫）與 TTS 使用的模型，為空時使用內建預設
+	ExtractModel string
+	TTSModel     string
+
+	// Gemini 請求基準逾時（秒），實際逾時依畫質縮放
+	GeminiTimeoutSeconds int
+
+	// 管理員 ID，不受存取限制並可使用管理指令
+	AdminIDs []int64
+	// 允許使用的使用者與群組，都為空時不限制
+	AllowedUsers []int64
+	AllowedChats []int64
+
+	// 失敗重試佇列：每次輪詢間隔（秒）與每次最多處理的任務數
+	RetryIntervalSeconds int
+	RetryBatchSize       int
+	// 同一任務最多重試次數，超過後放棄並通知使用者
+	RetryMaxAttempts int
+	// 同時進行的圖片生成數量上限（含重試佇列）
+	MaxConcurrentGenerations int
+	// 每位使用者最多排隊的訊息數，超過時回覆佇列已滿
+	UserQueueSize int
+
+	// 每日備份保留的份數
+	BackupRetention int
+
+	// 單一下載檔案的大小上限（位元組）
+	MaxImageBytes int
+	// 送給 Gemini 前圖片最長邊上限（像素），超過時等比例縮小
+	MaxImageDimension int
+	// 依 FileID 快取最近下載的圖片張數與總位元組上限
+	ImageCacheSize  int
+	ImageCacheBytes int
+	// @variants=N 一次最多要求的候選圖片數
+	MaxVariants int
+	// 相同圖片、Prompt 與參數的生成結果保存多久，0 代表不快取
+	ResultCacheTTL time.Duration
+	// 自動偵測比例時允許與支援比例相差的百分比，超過時不指定比例；0 代表一律套用最接近的比例
+	RatioTolerancePercent int
+
+	// 圖片生成的 safetySettings 等級：OFF（預設）/ LOW / MEDIUM / HIGH
+	SafetyLevel string
+
+	// 生成前擋下的 Prompt 規則（子字串，或以 re: 開頭的正規表示式），為空時不過濾
+	ContentFilter []string
+
+	// 每次生成後 POST 事件的 webhook，為空時不送出；預設不含 Prompt 內容
+	EventWebhookURL           string
+	EventWebhookIncludePrompt bool
+
+	// 生成完成後先送出極小的預覽圖，完整圖片送達後刪除（多一次上傳，預設關閉）
+	SendPlaceholder bool
+
+	// 生成成功後把結果轉存一份到此聊天（例如私人頻道），0 代表不轉存
+	LogChatID int64
+
+	// PDF 輸入：是否啟用、最多處理頁數與轉圖使用的外部程式（需相容 pdftoppm 參數）
+	EnablePdf   bool
+	MaxPdfPages int
+	PdfRenderer string
+
+	// 擷取動畫 / 圓形影片第一格畫面用的 ffmpeg，設為 - 代表停用（只支援 GIF）
+	FfmpegPath string
 }
 
 // 預設的翻譯 Prompt
@@ -17,15 +91,68 @@ const DefaultPrompt = "漫画的文本翻譯为中文放置在旁邊輔助學習
 // 擷取文字的 Prompt
 const ExtractTextPrompt = "请提取这张漫画图片中的所有文字对话内容，按顺序列出，格式为纯文本，不要加任何额外说明。"
 
+// 放大（@upscale）使用的 Prompt
+const UpscalePrompt = "将这张图片放大并提升清晰度，去除噪点、模糊和压缩痕迹，锐化线条与细节，不要翻译或修改任何文字，保持原本的内容、颜色和构图不变，原比例输出"
+
 // TTS 設定
 const TTSVoiceName = "Kore"
 
+// contentFilterSeparator CONTENT_FILTER 的規則分隔符；不用逗號，因為 re: 規則可能含有 {m,n}
+const contentFilterSeparator = ";;"
+
 func LoadConfig() *Config {
 	return &Config{
 		GeminiAPIKey:  getEnv("GEMINI_API_KEY", ""),
 		GeminiBaseURL: getEnv("GEMINI_BASE_URL", ""),
 		BotToken:      getEnv("BOT_TOKEN", ""),
 		DataDir:       getEnv("DATA_DIR", "./data"),
+
+		ImageModelFallbacks: getEnvList("IMAGE_MODEL_FALLBACKS"),
+
+		PromptPrefix: getEnv("PROMPT_PREFIX", ""),
+		PromptSuffix: getEnv("PROMPT_SUFFIX", ""),
+
+		ExtractModel: getEnv("EXTRACT_MODEL", ""),
+		TTSModel:     getEnv("TTS_MODEL", ""),
+
+		GeminiTimeoutSeconds: getEnvInt("GEMINI_TIMEOUT_SECONDS", 120),
+
+		AdminIDs:     getEnvInt64List("ADMIN_IDS"),
+		AllowedUsers: getEnvInt64List("ALLOWED_USERS"),
+		AllowedChats: getEnvInt64List("ALLOWED_CHATS"),
+
+		RetryIntervalSeconds:     getEnvInt("RETRY_INTERVAL_SECONDS", 900),
+		RetryBatchSize:           getEnvInt("RETRY_BATCH_SIZE", 1),
+		RetryMaxAttempts:         getEnvInt("RETRY_MAX_ATTEMPTS", 10),
+		MaxConcurrentGenerations: getEnvInt("MAX_CONCURRENT_GENERATIONS", 3),
+		UserQueueSize:            getEnvInt("USER_QUEUE_SIZE", 5),
+
+		BackupRetention: getEnvInt("BACKUP_RETENTION", 7),
+
+		MaxImageBytes:     getEnvInt("MAX_IMAGE_BYTES", 20*1024*1024),
+		MaxImageDimension: getEnvInt("MAX_IMAGE_DIMENSION", 2048),
+		ImageCacheSize:    getEnvInt("IMAGE_CACHE_SIZE", 16),
+		ImageCacheBytes:   getEnvInt("IMAGE_CACHE_BYTES", 64*1024*1024),
+		MaxVariants:       getEnvInt("MAX_VARIANTS", 4),
+		ResultCacheTTL:    time.Duration(getEnvInt("RESULT_CACHE_TTL_MINUTES", 0)) * time.Minute,
+
+		RatioTolerancePercent: getEnvInt("RATIO_TOLERANCE_PERCENT", 0),
+
+		SafetyLevel:   getEnv("SAFETY_LEVEL", "OFF"),
+		ContentFilter: getEnvListSep("CONTENT_FILTER", contentFilterSeparator),
+
+		EventWebhookURL:           getEnv("EVENT_WEBHOOK_URL", ""),
+		EventWebhookIncludePrompt: getEnvBool("EVENT_WEBHOOK_INCLUDE_PROMPT", false),
+
+		SendPlaceholder: getEnvBool("SEND_PLACEHOLDER", false),
+
+		LogChatID: getEnvInt64("LOG_CHAT_ID", 0),
+
+		EnablePdf:   getEnvBool("ENABLE_PDF", false),
+		MaxPdfPages: getEnvInt("MAX_PDF_PAGES", 10),
+		PdfRenderer: getEnv("PDF_RENDERER", "pdftoppm"),
+
+		FfmpegPath: getEnv("FFMPEG_PATH", "ffmpeg"),
 	}
 }
 
@@ -35,3 +162,73 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvInt64 解析 64 位元整數，允許負數（例如頻道 ID）
+func getEnvInt64(key string, defaultValue int64) int64 {
+	parsed, err := strconv.ParseInt(strings.TrimSpace(os.Getenv(key)), 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	parsed, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvList 解析以逗號分隔的字串列表，略過空白項目
+func getEnvList(key string) []string {
+	return getEnvListSep(key, ",")
+}
+
+// getEnvListSep 以 sep 分隔的列表，去除空白與空項目
+func getEnvListSep(key, sep string) []string {
+	var items []string
+	for _, part := range strings.Split(os.Getenv(key), sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
+// getEnvInt64List 解析以逗號分隔的 ID 列表，無法解析的項目會被略過
+func getEnvInt64List(key string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if id, err := strconv.ParseInt(part, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// IsAdmin 檢查使用者是否在管理員列表中
+func (c *Config) IsAdmin(userID int64) bool {
+	for _, id := range c.AdminIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package config
+
+import "testing"
+
+func TestGetEnvListSep_KeepsRegexCommas(t *testing.T) {
+	t.Setenv("CONTENT_FILTER", ` banned ;;re:(?i)bad\s{0,3}word;; ;;`)
+	got := getEnvListSep("CONTENT_FILTER", contentFilterSeparator)
+	if len(got) != 2 || got[0] != "banned" || got[1] != `re:(?i)bad\s{0,3}word` {
+		t.Fatalf("unexpected rules %q", got)
+	}
+
+	t.Setenv("ADMIN_LIST", "a, b,,c")
+	if got := getEnvList("ADMIN_LIST"); len(got) != 3 || got[1] != "b" {
+		t.Fatalf("unexpected list %q", got)
+	}
+}
@@ -2,6 +2,8 @@ package database
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
@@ -22,6 +24,62 @@ type SavedPrompt struct {
 	CreatedAt time.Time
 }
 
+// PublicPrompt 公開 Prompt 庫中的項目
+type PublicPrompt struct {
+	ID          int64
+	Name        string
+	Description string
+	Prompt      string
+}
+
+// ErrPromptNameTaken 使用者已有同名的 Prompt
+var ErrPromptNameTaken = errors.New("prompt name already exists")
+
+// defaultPublicPrompts 初始化時寫入的公開 Prompt
+var defaultPublicPrompts = []PublicPrompt{
+	{
+		Name:        "漫畫翻譯",
+		Description: "將漫畫文字翻譯為中文並保留原本風格",
+		Prompt:      "漫画的文本翻譯为中文放置在旁邊輔助學習，保持原文的风格颜色等，其余非文字部分比如元素布局保持不变，原比例输出",
+	},
+	{
+		Name:        "替換嵌字",
+		Description: "直接用中文取代原文，適合閱讀",
+		Prompt:      "将漫画中的所有文字替换为中文翻译，字体风格、大小和颜色尽量与原文一致，其余画面内容保持不变，原比例输出",
+	},
+	{
+		Name:        "線稿上色",
+		Description: "為黑白線稿或漫畫上色",
+		Prompt:      "为这张黑白图片上色，颜色自然协调，保持原本的线条和构图不变，原比例输出",
+	},
+	{
+		Name:        "去除文字",
+		Description: "清除圖片中的文字並補回背景",
+		Prompt:      "移除图片中的所有文字和对话框内的文字，并自然地补全被遮挡的背景，其余内容保持不变，原比例输出",
+	},
+	{
+		Name:        "高清修復",
+		Description: "提升畫質、去除雜訊",
+		Prompt:      "提升这张图片的清晰度，去除噪点和压缩痕迹，保持原本的内容、颜色和构图不变，原比例输出",
+	},
+}
+
+// ChatSettings 群組共用的設定，Enabled 為 false 時群組成員使用各自的設定
+type ChatSettings struct {
+	ChatID         int64
+	Enabled        bool
+	DefaultQuality string
+	DefaultPrompt  string
+}
+
+// TopicSettings 論壇群組中單一主題的預設值，優先於群組共用設定
+type TopicSettings struct {
+	ChatID          int64
+	ThreadID        int
+	DefaultPromptID int64 // saved_prompts.id，0 代表未設定
+	DefaultQuality  string
+}
+
 type HistoryPrompt struct {
 	ID     int64
 	UserID int64
@@ -39,8 +97,10 @@ type UserService struct {
 	ProjectID string
 	Location  string
 	Model     string
-	IsDefault bool
-	CreatedAt time.Time
+	// SystemInstruction 每次圖片生成帶入的系統指示
+	SystemInstruction string
+	IsDefault         bool
+	CreatedAt         time.Time
 }
 
 type FailedGeneration struct {
@@ -53,6 +113,84 @@ type FailedGeneration struct {
 	RetryCount       int
 	CreatedAt        time.Time
 	LastRetryAt      *time.Time
+	NextRetryAt      *time.Time
+}
+
+// ScheduledGeneration 排程在指定時間執行的生成請求，payload 與重試佇列相同
+type ScheduledGeneration struct {
+	ID               int64
+	UserID           int64
+	ChatID           int64
+	ReplyToMessageID int64
+	Payload          string
+	RunAt            time.Time
+	CreatedAt        time.Time
+}
+
+// generation_log 的狀態
+const (
+	GenerationStatusSuccess = "success"
+	GenerationStatusFailed  = "failed"
+	GenerationStatusBlocked = "blocked" // 被內容過濾擋下，未呼叫 API
+)
+
+// GenerationLog 一次生成請求的紀錄
+type GenerationLog struct {
+	ID        int64
+	UserID    int64
+	ChatID    int64
+	Prompt    string
+	Quality   string
+	Status    string
+	Error     string
+	LatencyMs int64
+	Rating    int    // 1 = 👍、-1 = 👎、0 = 未評分
+	Payload   string // 重新生成用的請求參數（JSON），沒有保存時為空字串
+	// ResultFileID 送出的原畫質檔案的 Telegram FileID，供 /diff 比較；沒有時為空字串
+	ResultFileID string
+	CreatedAt    time.Time
+}
+
+// GenerationStats generation_log 的彙總
+type GenerationStats struct {
+	Total        int
+	Success      int
+	Failed       int
+	Blocked      int
+	Up           int
+	Down         int
+	AvgLatencyMs int64 // 只計算成功的生成
+	ByQuality    []GenerationGroupStats
+	TopPrompts   []GenerationGroupStats // 依 👍 數排序
+}
+
+// RetryQueueStats 重試佇列（failed_generations）的彙總
+type RetryQueueStats struct {
+	Total     int
+	Users     int
+	OldestAge time.Duration // 最早入列任務至今的時間，佇列為空時為 0
+	ByRetries []RetryQueueGroup
+	TopUsers  []RetryQueueUser // 依任務數由多到少
+}
+
+// RetryQueueGroup 依已重試次數分組的任務數，Label 如 "0"、"2-4"、"5+"
+type RetryQueueGroup struct {
+	Label string
+	Count int
+}
+
+// RetryQueueUser 單一使用者在重試佇列中的任務數
+type RetryQueueUser struct {
+	UserID int64
+	Count  int
+}
+
+// GenerationGroupStats 依畫質或 Prompt 分組的統計
+type GenerationGroupStats struct {
+	Key   string
+	Count int
+	Up    int
+	Down  int
 }
 
 func NewDatabase(dataDir string) (*Database, error) {
@@ -62,7 +200,10 @@ func NewDatabase(dataDir string) (*Database, error) {
 	}
 
 	dbPath := filepath.Join(dataDir, "bot.db")
-	db, err := sql.Open("sqlite", dbPath)
+	// 每條連線都套用：WAL 讓讀寫可同時進行，busy_timeout 讓寫入衝突時等待而不是直接回傳 "database is locked"
+	// 交易一開始就取得寫入鎖（immediate），避免交易中途升級鎖時失敗
+	dsn := dbPath + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -76,83 +217,318 @@ func NewDatabase(dataDir string) (*Database, error) {
 }
 
 func (d *Database) init() error {
-	// 建立保存的 Prompt 表
-	_, err := d.db.Exec(`
-		CREATE TABLE IF NOT EXISTS saved_prompts (
+	if err := d.migrate(); err != nil {
+		return err
+	}
+
+	// 公開 Prompt 每次啟動都補上，之後新增的項目不需要另外寫 migration
+	for _, p := range defaultPublicPrompts {
+		_, err := d.db.Exec(`
+			INSERT OR IGNORE INTO public_prompts (name, description, prompt)
+			VALUES (?, ?, ?)
+		`, p.Name, p.Description, p.Prompt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migration 一個資料庫結構變更步驟；version 必須遞增，發佈後不可再修改內容
+// 每個步驟都要能套用在「表或欄位可能已存在」的舊資料庫上（沒有 schema_migrations 的舊版本）
+type migration struct {
+	version int
+	name    string
+	apply   func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{1, "initial schema", func(tx *sql.Tx) error {
+		return execAll(tx,
+			// 保存的 Prompt
+			`CREATE TABLE IF NOT EXISTS saved_prompts (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				prompt TEXT NOT NULL,
+				is_default BOOLEAN DEFAULT FALSE,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(user_id, name)
+			)`,
+			// 使用歷史
+			`CREATE TABLE IF NOT EXISTS prompt_history (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				prompt TEXT NOT NULL,
+				used_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			// 使用者設定
+			`CREATE TABLE IF NOT EXISTS user_settings (
+				user_id INTEGER PRIMARY KEY,
+				default_quality TEXT DEFAULT '2K',
+				default_prompt_id INTEGER,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			// 使用者服務設定
+			`CREATE TABLE IF NOT EXISTS user_services (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				service_type TEXT NOT NULL,
+				api_key TEXT NOT NULL,
+				base_url TEXT DEFAULT '',
+				project_id TEXT DEFAULT '',
+				location TEXT DEFAULT '',
+				model TEXT DEFAULT '',
+				is_default BOOLEAN DEFAULT FALSE,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(user_id, name)
+			)`,
+			// 生成失敗重試佇列
+			`CREATE TABLE IF NOT EXISTS failed_generations (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				chat_id INTEGER NOT NULL,
+				reply_to_message_id INTEGER DEFAULT 0,
+				payload TEXT NOT NULL,
+				last_error TEXT,
+				retry_count INTEGER DEFAULT 0,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				last_retry_at DATETIME
+			)`,
+		)
+	}},
+	{2, "user_settings.default_voice", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "user_settings", "default_voice", "TEXT DEFAULT ''")
+	}},
+	{3, "user_settings.user_default_prompt", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "user_settings", "user_default_prompt", "TEXT DEFAULT ''")
+	}},
+	{4, "saved_prompts.deleted_at", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "saved_prompts", "deleted_at", "DATETIME")
+	}},
+	{5, "user_settings.list_sort", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "user_settings", "list_sort", "TEXT DEFAULT ''")
+	}},
+	{6, "public_prompts", func(tx *sql.Tx) error {
+		return execAll(tx, `CREATE TABLE IF NOT EXISTS public_prompts (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT DEFAULT '',
+			prompt TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`)
+	}},
+	{7, "chat_settings", func(tx *sql.Tx) error {
+		return execAll(tx, `CREATE TABLE IF NOT EXISTS chat_settings (
+			chat_id INTEGER PRIMARY KEY,
+			enabled BOOLEAN DEFAULT FALSE,
+			default_quality TEXT DEFAULT '',
+			default_prompt TEXT DEFAULT '',
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`)
+	}},
+	{8, "access_control", func(tx *sql.Tx) error {
+		// 正數為使用者 ID，負數為群組 ID
+		return execAll(tx, `CREATE TABLE IF NOT EXISTS access_control (
+			target_id INTEGER PRIMARY KEY,
+			allowed BOOLEAN NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`)
+	}},
+	{9, "kv_store", func(tx *sql.Tx) error {
+		// 給只需要一個值的功能使用（維護模式、功能開關等）
+		return execAll(tx, `CREATE TABLE IF NOT EXISTS kv_store (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`)
+	}},
+	{10, "failed_generations.next_retry_at", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "failed_generations", "next_retry_at", "DATETIME")
+	}},
+	{11, "hot path indexes", func(tx *sql.Tx) error {
+		return execAll(tx,
+			`CREATE INDEX IF NOT EXISTS idx_prompt_history_user_used ON prompt_history(user_id, used_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_saved_prompts_user ON saved_prompts(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_failed_generations_next_retry ON failed_generations(next_retry_at)`,
+		)
+	}},
+	{12, "user_settings.ui_lang", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "user_settings", "ui_lang", "TEXT DEFAULT ''")
+	}},
+	{13, "generation_log", func(tx *sql.Tx) error {
+		return execAll(tx,
+			`CREATE TABLE IF NOT EXISTS generation_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				chat_id INTEGER NOT NULL,
+				prompt TEXT NOT NULL,
+				quality TEXT DEFAULT '',
+				status TEXT NOT NULL,
+				error TEXT DEFAULT '',
+				latency_ms INTEGER DEFAULT 0,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_generation_log_user ON generation_log(user_id, created_at)`,
+		)
+	}},
+	{14, "generation_log.rating", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "generation_log", "rating", "INTEGER DEFAULT 0")
+	}},
+	{15, "result_cache", func(tx *sql.Tx) error {
+		return execAll(tx,
+			`CREATE TABLE IF NOT EXISTS result_cache (
+				cache_key TEXT PRIMARY KEY,
+				image BLOB NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_result_cache_created ON result_cache(created_at)`,
+		)
+	}},
+	{16, "user_settings.default_ratio", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "user_settings", "default_ratio", "TEXT DEFAULT ''")
+	}},
+	{17, "prompt_thumbnails", func(tx *sql.Tx) error {
+		return execAll(tx, `CREATE TABLE IF NOT EXISTS prompt_thumbnails (
 			user_id INTEGER NOT NULL,
+			prompt_id INTEGER NOT NULL,
+			image BLOB NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, prompt_id)
+		)`)
+	}},
+	{18, "user_settings.output_format", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "user_settings", "output_format", "TEXT DEFAULT ''")
+	}},
+	{19, "user_settings.jpeg_quality", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "user_settings", "jpeg_quality", "INTEGER DEFAULT 0")
+	}},
+	{20, "scheduled_generations", func(tx *sql.Tx) error {
+		return execAll(tx,
+			`CREATE TABLE IF NOT EXISTS scheduled_generations (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				chat_id INTEGER NOT NULL,
+				reply_to_message_id INTEGER DEFAULT 0,
+				payload TEXT NOT NULL,
+				run_at DATETIME NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_scheduled_generations_run_at ON scheduled_generations(run_at)`,
+		)
+	}},
+	{21, "user_settings.last_generation", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "user_settings", "last_generation", "TEXT DEFAULT ''")
+	}},
+	{22, "generation_log.payload", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "generation_log", "payload", "TEXT DEFAULT ''")
+	}},
+	{23, "topic_settings", func(tx *sql.Tx) error {
+		return execAll(tx, `CREATE TABLE IF NOT EXISTS topic_settings (
+			chat_id INTEGER NOT NULL,
+			thread_id INTEGER NOT NULL,
+			default_prompt_id INTEGER DEFAULT 0,
+			default_quality TEXT DEFAULT '',
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (chat_id, thread_id)
+		)`)
+	}},
+	{24, "user_services.system_instruction", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "user_services", "system_instruction", "TEXT DEFAULT ''")
+	}},
+	{25, "generation_log.result_file_id", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "generation_log", "result_file_id", "TEXT DEFAULT ''")
+	}},
+	{26, "result_cache.text", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "result_cache", "text", "TEXT DEFAULT ''")
+	}},
+}
+
+// migrate 依序套用尚未執行的 migration，每一步在自己的交易中執行並記錄版本
+func (d *Database) migrate() error {
+	_, err := d.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
 			name TEXT NOT NULL,
-			prompt TEXT NOT NULL,
-			is_default BOOLEAN DEFAULT FALSE,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(user_id, name)
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)
 	`)
 	if err != nil {
 		return err
 	}
 
-	// 建立使用歷史表
-	_, err = d.db.Exec(`
-		CREATE TABLE IF NOT EXISTS prompt_history (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			prompt TEXT NOT NULL,
-			used_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
+	current, err := d.SchemaVersion()
 	if err != nil {
 		return err
 	}
 
-	// 建立使用者設定表
-	_, err = d.db.Exec(`
-		CREATE TABLE IF NOT EXISTS user_settings (
-			user_id INTEGER PRIMARY KEY,
-			default_quality TEXT DEFAULT '2K',
-			default_prompt_id INTEGER,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := d.applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func (d *Database) applyMigration(m migration) error {
+	tx, err := d.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// 建立使用者服務設定表
-	_, err = d.db.Exec(`
-		CREATE TABLE IF NOT EXISTS user_services (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			name TEXT NOT NULL,
-			service_type TEXT NOT NULL,
-			api_key TEXT NOT NULL,
-			base_url TEXT DEFAULT '',
-			project_id TEXT DEFAULT '',
-			location TEXT DEFAULT '',
-			model TEXT DEFAULT '',
-			is_default BOOLEAN DEFAULT FALSE,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(user_id, name)
-		)
-	`)
+	if err := m.apply(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SchemaVersion 取得目前已套用的最新 migration 版本
+func (d *Database) SchemaVersion() (int, error) {
+	var version int
+	err := d.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+func execAll(tx *sql.Tx, statements ...string) error {
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureColumn 欄位不存在時才 ALTER TABLE 新增
+func ensureColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	// 建立生成失敗重試佇列表
-	_, err = d.db.Exec(`
-		CREATE TABLE IF NOT EXISTS failed_generations (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			chat_id INTEGER NOT NULL,
-			reply_to_message_id INTEGER DEFAULT 0,
-			payload TEXT NOT NULL,
-			last_error TEXT,
-			retry_count INTEGER DEFAULT 0,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			last_retry_at DATETIME
-		)
-	`)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
 	return err
 }
 
@@ -170,7 +546,7 @@ func (d *Database) GetSavedPrompts(userID int64) ([]SavedPrompt, error) {
 	rows, err := d.db.Query(`
 		SELECT id, user_id, name, prompt, is_default, created_at
 		FROM saved_prompts
-		WHERE user_id = ?
+		WHERE user_id = ? AND deleted_at IS NULL
 		ORDER BY created_at DESC
 	`, userID)
 	if err != nil {
@@ -189,16 +565,160 @@ func (d *Database) GetSavedPrompts(userID int64) ([]SavedPrompt, error) {
 	return prompts, nil
 }
 
+// GetSavedPromptByID 依 ID 取得未刪除的 Prompt（不限使用者），不存在時回傳 nil
+func (d *Database) GetSavedPromptByID(promptID int64) (*SavedPrompt, error) {
+	var p SavedPrompt
+	err := d.db.QueryRow(`
+		SELECT id, user_id, name, prompt, is_default, created_at
+		FROM saved_prompts
+		WHERE id = ? AND deleted_at IS NULL
+	`, promptID).Scan(&p.ID, &p.UserID, &p.Name, &p.Prompt, &p.IsDefault, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SearchSavedPrompts 依名稱或內容搜尋使用者保存的 Prompt（不分大小寫），query 為空時列出全部
+func (d *Database) SearchSavedPrompts(userID int64, query string, limit, offset int) ([]SavedPrompt, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, name, prompt, is_default, created_at
+		FROM saved_prompts
+		WHERE user_id = ? AND deleted_at IS NULL
+			AND (? = '' OR instr(lower(name), lower(?)) > 0 OR instr(lower(prompt), lower(?)) > 0)
+		ORDER BY is_default DESC, created_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, userID, query, query, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prompts []SavedPrompt
+	for rows.Next() {
+		var p SavedPrompt
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.Prompt, &p.IsDefault, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, rows.Err()
+}
+
+// GetRandomPrompt 隨機取得一個使用者保存的 Prompt，沒有任何 Prompt 時回傳 nil
+func (d *Database) GetRandomPrompt(userID int64) (*SavedPrompt, error) {
+	var p SavedPrompt
+	err := d.db.QueryRow(`
+		SELECT id, user_id, name, prompt, is_default, created_at
+		FROM saved_prompts
+		WHERE user_id = ? AND deleted_at IS NULL
+		ORDER BY RANDOM()
+		LIMIT 1
+	`, userID).Scan(&p.ID, &p.UserID, &p.Name, &p.Prompt, &p.IsDefault, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Prompt 列表排序方式
+const (
+	PromptSortCreated = "created"
+	PromptSortName    = "name"
+	PromptSortRecent  = "recent"
+)
+
+// savedPromptsOrderClause 依排序方式產生 ORDER BY，未知的排序方式使用建立時間
+func savedPromptsOrderClause(order string) string {
+	switch order {
+	case PromptSortName:
+		return "sp.name COLLATE NOCASE ASC, sp.created_at DESC"
+	case PromptSortRecent:
+		return "h.last_used IS NULL, h.last_used DESC, sp.created_at DESC"
+	default:
+		return "sp.created_at DESC"
+	}
+}
+
+// GetSavedPromptsSorted 依指定排序取得使用者保存的所有 Prompt
+func (d *Database) GetSavedPromptsSorted(userID int64, order string) ([]SavedPrompt, error) {
+	return d.GetSavedPromptsPage(userID, order, -1, 0)
+}
+
+// GetSavedPromptsPage 依指定排序分頁取得使用者保存的 Prompt，limit 為負數時不限制筆數
+func (d *Database) GetSavedPromptsPage(userID int64, order string, limit, offset int) ([]SavedPrompt, error) {
+	// recent 以 prompt_history 中相同內容最後一次使用的時間排序
+	rows, err := d.db.Query(`
+		SELECT sp.id, sp.user_id, sp.name, sp.prompt, sp.is_default, sp.created_at
+		FROM saved_prompts sp
+		LEFT JOIN (
+			SELECT prompt, MAX(used_at) AS last_used
+			FROM prompt_history
+			WHERE user_id = ?
+			GROUP BY prompt
+		) h ON h.prompt = sp.prompt
+		WHERE sp.user_id = ? AND sp.deleted_at IS NULL
+		ORDER BY `+savedPromptsOrderClause(order)+`
+		LIMIT ? OFFSET ?
+	`, userID, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prompts []SavedPrompt
+	for rows.Next() {
+		var p SavedPrompt
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.Prompt, &p.IsDefault, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, nil
+}
+
+// CountSavedPrompts 計算使用者保存的 Prompt 數量
+func (d *Database) CountSavedPrompts(userID int64) (int, error) {
+	var total int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM saved_prompts WHERE user_id = ? AND deleted_at IS NULL`, userID).Scan(&total)
+	return total, err
+}
+
 // SetDefaultPrompt 設定預設 Prompt
 func (d *Database) SetDefaultPrompt(userID int64, promptID int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// 先清除其他預設
-	_, err := d.db.Exec(`UPDATE saved_prompts SET is_default = FALSE WHERE user_id = ?`, userID)
+	if _, err := tx.Exec(`UPDATE saved_prompts SET is_default = FALSE WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	// 設定新預設，找不到時整筆回滾，保留原本的預設
+	result, err := tx.Exec(`
+		UPDATE saved_prompts SET is_default = TRUE
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+	`, promptID, userID)
 	if err != nil {
 		return err
 	}
-	// 設定新預設
-	_, err = d.db.Exec(`UPDATE saved_prompts SET is_default = TRUE WHERE id = ? AND user_id = ?`, promptID, userID)
-	return err
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
 }
 
 // GetDefaultPrompt 取得使用者的預設 Prompt
@@ -206,7 +726,7 @@ func (d *Database) GetDefaultPrompt(userID int64) (*SavedPrompt, error) {
 	row := d.db.QueryRow(`
 		SELECT id, user_id, name, prompt, is_default, created_at
 		FROM saved_prompts
-		WHERE user_id = ? AND is_default = TRUE
+		WHERE user_id = ? AND is_default = TRUE AND deleted_at IS NULL
 	`, userID)
 
 	var p SavedPrompt
@@ -253,6 +773,38 @@ func (d *Database) GetHistory(userID int64, limit int) ([]HistoryPrompt, error)
 	return history, nil
 }
 
+// GetHistoryPage 分頁取得使用歷史
+func (d *Database) GetHistoryPage(userID int64, limit, offset int) ([]HistoryPrompt, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, prompt, used_at
+		FROM prompt_history
+		WHERE user_id = ?
+		ORDER BY used_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []HistoryPrompt
+	for rows.Next() {
+		var h HistoryPrompt
+		if err := rows.Scan(&h.ID, &h.UserID, &h.Prompt, &h.UsedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, nil
+}
+
+// CountHistory 計算使用歷史筆數
+func (d *Database) CountHistory(userID int64) (int, error) {
+	var total int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM prompt_history WHERE user_id = ?`, userID).Scan(&total)
+	return total, err
+}
+
 // GetUserSettings 取得使用者設定
 func (d *Database) GetUserSettings(userID int64) (string, error) {
 	row := d.db.QueryRow(`SELECT default_quality FROM user_settings WHERE user_id = ?`, userID)
@@ -269,37 +821,410 @@ func (d *Database) GetUserSettings(userID int64) (string, error) {
 // SetUserSettings 設定使用者預設畫質
 func (d *Database) SetUserSettings(userID int64, quality string) error {
 	_, err := d.db.Exec(`
-		INSERT OR REPLACE INTO user_settings (user_id, default_quality, updated_at)
+		INSERT INTO user_settings (user_id, default_quality, updated_at)
 		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			default_quality = excluded.default_quality,
+			updated_at = CURRENT_TIMESTAMP
 	`, userID, quality)
 	return err
 }
 
-// DeletePrompt 刪除保存的 Prompt
-func (d *Database) DeletePrompt(userID int64, promptID int64) error {
-	_, err := d.db.Exec(`DELETE FROM saved_prompts WHERE id = ? AND user_id = ?`, promptID, userID)
+// GetChatSettings 取得群組共用設定，未設定時回傳 Enabled 為 false 的空設定
+func (d *Database) GetChatSettings(chatID int64) (*ChatSettings, error) {
+	settings := &ChatSettings{ChatID: chatID}
+	row := d.db.QueryRow(`
+		SELECT enabled, COALESCE(default_quality, ''), COALESCE(default_prompt, '')
+		FROM chat_settings WHERE chat_id = ?
+	`, chatID)
+	if err := row.Scan(&settings.Enabled, &settings.DefaultQuality, &settings.DefaultPrompt); err != nil {
+		if err == sql.ErrNoRows {
+			return settings, nil
+		}
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SetChatSettings 設定群組共用設定
+func (d *Database) SetChatSettings(settings *ChatSettings) error {
+	_, err := d.db.Exec(`
+		INSERT INTO chat_settings (chat_id, enabled, default_quality, default_prompt, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(chat_id) DO UPDATE SET
+			enabled = excluded.enabled,
+			default_quality = excluded.default_quality,
+			default_prompt = excluded.default_prompt,
+			updated_at = CURRENT_TIMESTAMP
+	`, settings.ChatID, settings.Enabled, settings.DefaultQuality, settings.DefaultPrompt)
 	return err
 }
 
-func (d *Database) AddUserService(userID int64, serviceType, name, apiKey, baseURL, projectID, location, model string, setAsDefault bool) (int64, error) {
-	tx, err := d.db.Begin()
-	if err != nil {
-		return 0, err
+// GetTopicSettings 取得論壇主題的設定，未設定時回傳空設定
+func (d *Database) GetTopicSettings(chatID int64, threadID int) (*TopicSettings, error) {
+	settings := &TopicSettings{ChatID: chatID, ThreadID: threadID}
+	row := d.db.QueryRow(`
+		SELECT COALESCE(default_prompt_id, 0), COALESCE(default_quality, '')
+		FROM topic_settings WHERE chat_id = ? AND thread_id = ?
+	`, chatID, threadID)
+	if err := row.Scan(&settings.DefaultPromptID, &settings.DefaultQuality); err != nil {
+		if err == sql.ErrNoRows {
+			return settings, nil
+		}
+		return nil, err
 	}
-	defer tx.Rollback()
+	return settings, nil
+}
 
-	if setAsDefault {
-		if _, err := tx.Exec(`UPDATE user_services SET is_default = FALSE WHERE user_id = ?`, userID); err != nil {
-			return 0, err
+// SetTopicSettings 設定論壇主題的預設 Prompt 與畫質
+func (d *Database) SetTopicSettings(settings *TopicSettings) error {
+	_, err := d.db.Exec(`
+		INSERT INTO topic_settings (chat_id, thread_id, default_prompt_id, default_quality, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(chat_id, thread_id) DO UPDATE SET
+			default_prompt_id = excluded.default_prompt_id,
+			default_quality = excluded.default_quality,
+			updated_at = CURRENT_TIMESTAMP
+	`, settings.ChatID, settings.ThreadID, settings.DefaultPromptID, settings.DefaultQuality)
+	return err
+}
+
+// GetUserVoice 取得使用者選擇的 TTS 語音，未設定時回傳空字串
+func (d *Database) GetUserVoice(userID int64) (string, error) {
+	row := d.db.QueryRow(`SELECT COALESCE(default_voice, '') FROM user_settings WHERE user_id = ?`, userID)
+	var voice string
+	if err := row.Scan(&voice); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
 		}
+		return "", err
 	}
+	return voice, nil
+}
 
-	result, err := tx.Exec(`
-		INSERT INTO user_services (
-			user_id, name, service_type, api_key, base_url, project_id, location, model, is_default, created_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
-	`, userID, name, serviceType, apiKey, baseURL, projectID, location, model, setAsDefault)
-	if err != nil {
+// SetUserVoice 設定使用者的 TTS 語音
+func (d *Database) SetUserVoice(userID int64, voice string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_settings (user_id, default_voice, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			default_voice = excluded.default_voice,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, voice)
+	return err
+}
+
+// GetUserListSort 取得使用者 /list 的排序方式，未設定時回傳空字串
+func (d *Database) GetUserListSort(userID int64) (string, error) {
+	row := d.db.QueryRow(`SELECT COALESCE(list_sort, '') FROM user_settings WHERE user_id = ?`, userID)
+	var order string
+	if err := row.Scan(&order); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return order, nil
+}
+
+// SetUserListSort 設定使用者 /list 的排序方式
+func (d *Database) SetUserListSort(userID int64, order string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_settings (user_id, list_sort, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			list_sort = excluded.list_sort,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, order)
+	return err
+}
+
+// GetUserDefaultRatio 取得使用者的預設比例，未設定時回傳空字串
+func (d *Database) GetUserDefaultRatio(userID int64) (string, error) {
+	row := d.db.QueryRow(`SELECT COALESCE(default_ratio, '') FROM user_settings WHERE user_id = ?`, userID)
+	var ratio string
+	if err := row.Scan(&ratio); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return ratio, nil
+}
+
+// SetUserDefaultRatio 設定使用者的預設比例，傳入空字串代表清除
+func (d *Database) SetUserDefaultRatio(userID int64, ratio string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_settings (user_id, default_ratio, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			default_ratio = excluded.default_ratio,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, ratio)
+	return err
+}
+
+// GetUserOutputFormat 取得使用者的預設輸出格式，未設定時回傳空字串（維持模型原始格式）
+func (d *Database) GetUserOutputFormat(userID int64) (string, error) {
+	row := d.db.QueryRow(`SELECT COALESCE(output_format, '') FROM user_settings WHERE user_id = ?`, userID)
+	var format string
+	if err := row.Scan(&format); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return format, nil
+}
+
+// SetUserOutputFormat 設定使用者的預設輸出格式，傳入空字串代表清除
+func (d *Database) SetUserOutputFormat(userID int64, format string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_settings (user_id, output_format, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			output_format = excluded.output_format,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, format)
+	return err
+}
+
+// GetUserJPEGQuality 取得使用者轉 JPEG 的品質，未設定時回傳 0
+func (d *Database) GetUserJPEGQuality(userID int64) (int, error) {
+	row := d.db.QueryRow(`SELECT COALESCE(jpeg_quality, 0) FROM user_settings WHERE user_id = ?`, userID)
+	var quality int
+	if err := row.Scan(&quality); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return quality, nil
+}
+
+// SetUserJPEGQuality 設定使用者轉 JPEG 的品質，0 代表使用預設
+func (d *Database) SetUserJPEGQuality(userID int64, quality int) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_settings (user_id, jpeg_quality, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			jpeg_quality = excluded.jpeg_quality,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, quality)
+	return err
+}
+
+// GetLastGeneration 取得使用者最近一次生成請求的 payload（JSON），未記錄時回傳空字串
+func (d *Database) GetLastGeneration(userID int64) (string, error) {
+	row := d.db.QueryRow(`SELECT COALESCE(last_generation, '') FROM user_settings WHERE user_id = ?`, userID)
+	var payload string
+	if err := row.Scan(&payload); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return payload, nil
+}
+
+// SetLastGeneration 記錄使用者最近一次生成請求的 payload
+func (d *Database) SetLastGeneration(userID int64, payload string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_settings (user_id, last_generation, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			last_generation = excluded.last_generation,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, payload)
+	return err
+}
+
+// GetUserLanguage 取得使用者自訂的介面語言，未設定時回傳空字串（改用 Telegram 的語言設定）
+func (d *Database) GetUserLanguage(userID int64) (string, error) {
+	row := d.db.QueryRow(`SELECT COALESCE(ui_lang, '') FROM user_settings WHERE user_id = ?`, userID)
+	var lang string
+	if err := row.Scan(&lang); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return lang, nil
+}
+
+// SetUserLanguage 設定使用者的介面語言，傳入空字串代表跟隨 Telegram 設定
+func (d *Database) SetUserLanguage(userID int64, lang string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_settings (user_id, ui_lang, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			ui_lang = excluded.ui_lang,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, lang)
+	return err
+}
+
+// GetUserDefaultPrompt 取得使用者自訂的預設 Prompt 文字（不屬於任何保存的 Prompt），未設定時回傳空字串
+func (d *Database) GetUserDefaultPrompt(userID int64) (string, error) {
+	row := d.db.QueryRow(`SELECT COALESCE(user_default_prompt, '') FROM user_settings WHERE user_id = ?`, userID)
+	var prompt string
+	if err := row.Scan(&prompt); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return prompt, nil
+}
+
+// SetUserDefaultPrompt 設定使用者自訂的預設 Prompt 文字，傳入空字串代表清除
+func (d *Database) SetUserDefaultPrompt(userID int64, prompt string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_settings (user_id, user_default_prompt, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET
+			user_default_prompt = excluded.user_default_prompt,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, prompt)
+	return err
+}
+
+// DeletePrompt 刪除保存的 Prompt（軟刪除，可用 UndoDeletePrompt 復原）
+func (d *Database) DeletePrompt(userID int64, promptID int64) error {
+	_, err := d.db.Exec(`
+		UPDATE saved_prompts
+		SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+	`, promptID, userID)
+	return err
+}
+
+// UndoDeletePrompt 復原被軟刪除的 Prompt，找不到時回傳 sql.ErrNoRows
+func (d *Database) UndoDeletePrompt(userID int64, promptID int64) error {
+	result, err := d.db.Exec(`
+		UPDATE saved_prompts
+		SET deleted_at = NULL
+		WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL
+	`, promptID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PurgeDeletedPrompts 永久刪除軟刪除超過 olderThan 的 Prompt
+func (d *Database) PurgeDeletedPrompts(olderThan time.Duration) (int64, error) {
+	result, err := d.db.Exec(`
+		DELETE FROM saved_prompts
+		WHERE deleted_at IS NOT NULL AND deleted_at < datetime('now', ?)
+	`, fmt.Sprintf("%+d seconds", -int64(olderThan.Seconds())))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CachedResult 結果快取中的圖片與模型附帶的文字
+type CachedResult struct {
+	Image []byte
+	Text  string
+}
+
+// GetCachedResult 取得 maxAge 內寫入的生成結果，沒有或已過期時回傳 nil
+func (d *Database) GetCachedResult(key string, maxAge time.Duration) (*CachedResult, error) {
+	var result CachedResult
+	var text sql.NullString
+	err := d.db.QueryRow(`
+		SELECT image, text FROM result_cache
+		WHERE cache_key = ? AND created_at >= datetime('now', ?)
+	`, key, fmt.Sprintf("%+d seconds", -int64(maxAge.Seconds()))).Scan(&result.Image, &text)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Text = text.String
+	return &result, nil
+}
+
+// PutCachedResult 寫入生成結果，同一 key 會覆寫並重新計算保存時間
+func (d *Database) PutCachedResult(key string, image []byte, text string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO result_cache (cache_key, image, text, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(cache_key) DO UPDATE SET
+			image = excluded.image,
+			text = excluded.text,
+			created_at = CURRENT_TIMESTAMP
+	`, key, image, text)
+	return err
+}
+
+// PurgeCachedResults 刪除超過 olderThan 的快取結果，回傳刪除筆數
+func (d *Database) PurgeCachedResults(olderThan time.Duration) (int64, error) {
+	result, err := d.db.Exec(`
+		DELETE FROM result_cache WHERE created_at < datetime('now', ?)
+	`, fmt.Sprintf("%+d seconds", -int64(olderThan.Seconds())))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetPromptThumbnail 取得保存 Prompt 最近一次成功結果的縮圖，沒有時回傳 nil
+func (d *Database) GetPromptThumbnail(userID, promptID int64) ([]byte, error) {
+	var image []byte
+	err := d.db.QueryRow(`
+		SELECT image FROM prompt_thumbnails WHERE user_id = ? AND prompt_id = ?
+	`, userID, promptID).Scan(&image)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// SetPromptThumbnail 保存（或覆寫）保存 Prompt 的縮圖
+func (d *Database) SetPromptThumbnail(userID, promptID int64, image []byte) error {
+	_, err := d.db.Exec(`
+		INSERT INTO prompt_thumbnails (user_id, prompt_id, image, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id, prompt_id) DO UPDATE SET
+			image = excluded.image,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, promptID, image)
+	return err
+}
+
+func (d *Database) AddUserService(userID int64, serviceType, name, apiKey, baseURL, projectID, location, model string, setAsDefault bool) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if setAsDefault {
+		if _, err := tx.Exec(`UPDATE user_services SET is_default = FALSE WHERE user_id = ?`, userID); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO user_services (
+			user_id, name, service_type, api_key, base_url, project_id, location, model, is_default, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, userID, name, serviceType, apiKey, baseURL, projectID, location, model, setAsDefault)
+	if err != nil {
 		return 0, err
 	}
 
@@ -328,7 +1253,7 @@ func (d *Database) AddUserService(userID int64, serviceType, name, apiKey, baseU
 
 func (d *Database) GetUserServices(userID int64) ([]UserService, error) {
 	rows, err := d.db.Query(`
-		SELECT id, user_id, name, service_type, api_key, base_url, project_id, location, model, is_default, created_at
+		SELECT id, user_id, name, service_type, api_key, base_url, project_id, location, model, COALESCE(system_instruction, ''), is_default, created_at
 		FROM user_services
 		WHERE user_id = ?
 		ORDER BY is_default DESC, created_at DESC
@@ -351,6 +1276,7 @@ func (d *Database) GetUserServices(userID int64) ([]UserService, error) {
 			&service.ProjectID,
 			&service.Location,
 			&service.Model,
+			&service.SystemInstruction,
 			&service.IsDefault,
 			&service.CreatedAt,
 		); err != nil {
@@ -364,7 +1290,7 @@ func (d *Database) GetUserServices(userID int64) ([]UserService, error) {
 
 func (d *Database) GetDefaultUserService(userID int64) (*UserService, error) {
 	row := d.db.QueryRow(`
-		SELECT id, user_id, name, service_type, api_key, base_url, project_id, location, model, is_default, created_at
+		SELECT id, user_id, name, service_type, api_key, base_url, project_id, location, model, COALESCE(system_instruction, ''), is_default, created_at
 		FROM user_services
 		WHERE user_id = ? AND is_default = TRUE
 		ORDER BY created_at DESC
@@ -382,6 +1308,7 @@ func (d *Database) GetDefaultUserService(userID int64) (*UserService, error) {
 		&service.ProjectID,
 		&service.Location,
 		&service.Model,
+		&service.SystemInstruction,
 		&service.IsDefault,
 		&service.CreatedAt,
 	); err != nil {
@@ -471,15 +1398,226 @@ func (d *Database) DeleteUserService(userID int64, serviceID int64) error {
 	return tx.Commit()
 }
 
+// userServiceColumns /service edit 可修改的欄位與對應的資料表欄位
+var userServiceColumns = map[string]string{
+	"name":     "name",
+	"key":      "api_key",
+	"base":     "base_url",
+	"project":  "project_id",
+	"location": "location",
+	"model":    "model",
+	"system":   "system_instruction",
+}
+
+// UpdateUserService 只更新服務的單一欄位，保留 id 與 is_default；找不到服務時回傳 sql.ErrNoRows
+func (d *Database) UpdateUserService(userID, serviceID int64, field, value string) error {
+	column, ok := userServiceColumns[field]
+	if !ok {
+		return fmt.Errorf("unknown service field: %s", field)
+	}
+
+	result, err := d.db.Exec(`UPDATE user_services SET `+column+` = ? WHERE user_id = ? AND id = ?`, value, userID, serviceID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (d *Database) AddFailedGeneration(userID, chatID, replyToMessageID int64, payload, lastError string) error {
 	_, err := d.db.Exec(`
 		INSERT INTO failed_generations (
-			user_id, chat_id, reply_to_message_id, payload, last_error, retry_count, created_at
-		) VALUES (?, ?, ?, ?, ?, 0, CURRENT_TIMESTAMP)
+			user_id, chat_id, reply_to_message_id, payload, last_error, retry_count, created_at, next_retry_at
+		) VALUES (?, ?, ?, ?, ?, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	`, userID, chatID, replyToMessageID, payload, lastError)
 	return err
 }
 
+// LogGeneration 寫入一筆生成紀錄，回傳紀錄 ID
+func (d *Database) LogGeneration(entry *GenerationLog) (int64, error) {
+	result, err := d.db.Exec(`
+		INSERT INTO generation_log (user_id, chat_id, prompt, quality, status, error, latency_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, entry.UserID, entry.ChatID, entry.Prompt, entry.Quality, entry.Status, entry.Error, entry.LatencyMs)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetLastError 取得使用者最近一次失敗（重試佇列或生成紀錄）的完整錯誤，沒有時回傳空字串
+// 同一秒內兩邊都有紀錄時（失敗後立即進入重試佇列）優先使用 generation_log，重試佇列只保存截斷後的錯誤
+func (d *Database) GetLastError(userID int64) (string, error) {
+	var lastError string
+	err := d.db.QueryRow(`
+		SELECT error FROM (
+			SELECT last_error AS error, COALESCE(last_retry_at, created_at) AS at, 1 AS priority
+			FROM failed_generations
+			WHERE user_id = ? AND COALESCE(last_error, '') != ''
+			UNION ALL
+			SELECT error, created_at AS at, 0 AS priority
+			FROM generation_log
+			WHERE user_id = ? AND status = ? AND error != ''
+		)
+		ORDER BY at DESC, priority ASC
+		LIMIT 1
+	`, userID, userID, GenerationStatusFailed).Scan(&lastError)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return lastError, err
+}
+
+// GetGenerationLogs 取得使用者最近的生成紀錄（新到舊）
+func (d *Database) GetGenerationLogs(userID int64, limit int) ([]GenerationLog, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, chat_id, prompt, quality, status, error, latency_ms, rating, COALESCE(payload, ''), COALESCE(result_file_id, ''), created_at
+		FROM generation_log
+		WHERE user_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []GenerationLog
+	for rows.Next() {
+		var l GenerationLog
+		if err := rows.Scan(&l.ID, &l.UserID, &l.ChatID, &l.Prompt, &l.Quality, &l.Status, &l.Error, &l.LatencyMs, &l.Rating, &l.Payload, &l.ResultFileID, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
+
+// GetGenerationLog 依 ID 取得單筆生成紀錄，不存在時回傳 nil
+func (d *Database) GetGenerationLog(logID int64) (*GenerationLog, error) {
+	var l GenerationLog
+	err := d.db.QueryRow(`
+		SELECT id, user_id, chat_id, prompt, quality, status, error, latency_ms, rating, COALESCE(payload, ''), COALESCE(result_file_id, ''), created_at
+		FROM generation_log
+		WHERE id = ?
+	`, logID).Scan(&l.ID, &l.UserID, &l.ChatID, &l.Prompt, &l.Quality, &l.Status, &l.Error, &l.LatencyMs, &l.Rating, &l.Payload, &l.ResultFileID, &l.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// SetGenerationResultFileID 保存生成紀錄送出的原畫質檔案 FileID
+func (d *Database) SetGenerationResultFileID(logID int64, fileID string) error {
+	_, err := d.db.Exec(`UPDATE generation_log SET result_file_id = ? WHERE id = ?`, fileID, logID)
+	return err
+}
+
+// SetGenerationPayload 保存生成紀錄的請求參數，供之後以其他畫質重新生成
+func (d *Database) SetGenerationPayload(logID int64, payload string) error {
+	_, err := d.db.Exec(`UPDATE generation_log SET payload = ? WHERE id = ?`, payload, logID)
+	return err
+}
+
+// RateGeneration 記錄使用者對生成結果的評分（1 = 👍、-1 = 👎、0 = 取消）
+func (d *Database) RateGeneration(logID int64, rating int) error {
+	if rating < -1 || rating > 1 {
+		return fmt.Errorf("無效的評分: %d", rating)
+	}
+	result, err := d.db.Exec(`UPDATE generation_log SET rating = ? WHERE id = ?`, rating, logID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("找不到生成紀錄: %d", logID)
+	}
+	return nil
+}
+
+// GetGenerationStats 彙總生成紀錄與評分；userID 為 0 時統計所有使用者
+func (d *Database) GetGenerationStats(userID int64, topPrompts int) (*GenerationStats, error) {
+	where, args := "", []interface{}{}
+	if userID != 0 {
+		where, args = "WHERE user_id = ?", append(args, userID)
+	}
+
+	stats := &GenerationStats{}
+	var avgLatency sql.NullFloat64
+	err := d.db.QueryRow(`
+		SELECT COUNT(*),
+			COALESCE(SUM(status = 'success'), 0),
+			COALESCE(SUM(status = 'failed'), 0),
+			COALESCE(SUM(status = 'blocked'), 0),
+			COALESCE(SUM(rating > 0), 0),
+			COALESCE(SUM(rating < 0), 0),
+			AVG(CASE WHEN status = 'success' THEN latency_ms END)
+		FROM generation_log `+where, args...).Scan(
+		&stats.Total, &stats.Success, &stats.Failed, &stats.Blocked, &stats.Up, &stats.Down, &avgLatency)
+	if err != nil {
+		return nil, err
+	}
+	if avgLatency.Valid {
+		stats.AvgLatencyMs = int64(avgLatency.Float64)
+	}
+
+	stats.ByQuality, err = d.queryGenerationGroups(`
+		SELECT quality, COUNT(*), COALESCE(SUM(rating > 0), 0), COALESCE(SUM(rating < 0), 0)
+		FROM generation_log `+where+`
+		GROUP BY quality
+		ORDER BY quality
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ratedWhere := "WHERE rating != 0"
+	if where != "" {
+		ratedWhere += " AND user_id = ?"
+	}
+	stats.TopPrompts, err = d.queryGenerationGroups(`
+		SELECT prompt, COUNT(*), COALESCE(SUM(rating > 0), 0), COALESCE(SUM(rating < 0), 0)
+		FROM generation_log `+ratedWhere+`
+		GROUP BY prompt
+		ORDER BY SUM(rating > 0) DESC, SUM(rating < 0) ASC, MAX(id) DESC
+		LIMIT ?
+	`, append(args, topPrompts)...)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (d *Database) queryGenerationGroups(query string, args ...interface{}) ([]GenerationGroupStats, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []GenerationGroupStats
+	for rows.Next() {
+		var g GenerationGroupStats
+		if err := rows.Scan(&g.Key, &g.Count, &g.Up, &g.Down); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
 func (d *Database) GetRandomFailedGeneration() (*FailedGeneration, error) {
 	row := d.db.QueryRow(`
 		SELECT id, user_id, chat_id, reply_to_message_id, payload, last_error, retry_count, created_at, last_retry_at
@@ -514,14 +1652,62 @@ func (d *Database) GetRandomFailedGeneration() (*FailedGeneration, error) {
 	return &failed, nil
 }
 
+// GetFailedGenerations 取得已到重試時間的任務，依 next_retry_at 由早到晚排序
+func (d *Database) GetFailedGenerations(limit int) ([]FailedGeneration, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, chat_id, reply_to_message_id, payload, COALESCE(last_error, ''), retry_count, created_at, last_retry_at, next_retry_at
+		FROM failed_generations
+		WHERE COALESCE(next_retry_at, created_at) <= CURRENT_TIMESTAMP
+		ORDER BY COALESCE(next_retry_at, created_at) ASC, id ASC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []FailedGeneration
+	for rows.Next() {
+		var failed FailedGeneration
+		var lastRetry, nextRetry sql.NullTime
+		if err := rows.Scan(
+			&failed.ID,
+			&failed.UserID,
+			&failed.ChatID,
+			&failed.ReplyToMessageID,
+			&failed.Payload,
+			&failed.LastError,
+			&failed.RetryCount,
+			&failed.CreatedAt,
+			&lastRetry,
+			&nextRetry,
+		); err != nil {
+			return nil, err
+		}
+		if lastRetry.Valid {
+			failed.LastRetryAt = &lastRetry.Time
+		}
+		if nextRetry.Valid {
+			failed.NextRetryAt = &nextRetry.Time
+		}
+		tasks = append(tasks, failed)
+	}
+	return tasks, rows.Err()
+}
+
+// failedRetryMaxBackoffMinutes 重試間隔的上限（分鐘）
+const failedRetryMaxBackoffMinutes = 60
+
+// MarkFailedGenerationRetry 記錄一次重試失敗，下次重試時間依已重試次數指數延後：1、2、4… 分鐘，最多 failedRetryMaxBackoffMinutes
 func (d *Database) MarkFailedGenerationRetry(id int64, lastError string) error {
 	_, err := d.db.Exec(`
 		UPDATE failed_generations
 		SET retry_count = retry_count + 1,
 		    last_error = ?,
-		    last_retry_at = CURRENT_TIMESTAMP
+		    last_retry_at = CURRENT_TIMESTAMP,
+		    next_retry_at = datetime('now', '+' || MIN(1 << MIN(retry_count, 16), ?) || ' minutes')
 		WHERE id = ?
-	`, lastError, id)
+	`, lastError, failedRetryMaxBackoffMinutes, id)
 	return err
 }
 
@@ -530,6 +1716,392 @@ func (d *Database) DeleteFailedGeneration(id int64) error {
 	return err
 }
 
+// DeleteAllFailedGenerations 清空重試佇列，回傳刪除的筆數
+func (d *Database) DeleteAllFailedGenerations() (int, error) {
+	result, err := d.db.Exec(`DELETE FROM failed_generations`)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// DeleteFailedGenerationsByUser 清除指定使用者的重試任務，回傳刪除的筆數
+func (d *Database) DeleteFailedGenerationsByUser(userID int64) (int, error) {
+	result, err := d.db.Exec(`DELETE FROM failed_generations WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// GetRetryQueueStats 彙總重試佇列：總數、依重試次數分組、最舊任務的等待時間與任務最多的使用者
+func (d *Database) GetRetryQueueStats(topUsers int) (*RetryQueueStats, error) {
+	stats := &RetryQueueStats{}
+	var oldestSeconds sql.NullInt64
+	err := d.db.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(DISTINCT user_id),
+			CAST(strftime('%s', 'now') - strftime('%s', MIN(created_at)) AS INTEGER)
+		FROM failed_generations
+	`).Scan(&stats.Total, &stats.Users, &oldestSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if oldestSeconds.Valid && oldestSeconds.Int64 > 0 {
+		stats.OldestAge = time.Duration(oldestSeconds.Int64) * time.Second
+	}
+
+	rows, err := d.db.Query(`
+		SELECT CASE
+				WHEN retry_count <= 0 THEN '0'
+				WHEN retry_count = 1 THEN '1'
+				WHEN retry_count <= 4 THEN '2-4'
+				ELSE '5+'
+			END AS bucket,
+			COUNT(*)
+		FROM failed_generations
+		GROUP BY bucket
+		ORDER BY MIN(retry_count)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g RetryQueueGroup
+		if err := rows.Scan(&g.Label, &g.Count); err != nil {
+			return nil, err
+		}
+		stats.ByRetries = append(stats.ByRetries, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	userRows, err := d.db.Query(`
+		SELECT user_id, COUNT(*)
+		FROM failed_generations
+		GROUP BY user_id
+		ORDER BY COUNT(*) DESC, user_id ASC
+		LIMIT ?
+	`, topUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer userRows.Close()
+	for userRows.Next() {
+		var u RetryQueueUser
+		if err := userRows.Scan(&u.UserID, &u.Count); err != nil {
+			return nil, err
+		}
+		stats.TopUsers = append(stats.TopUsers, u)
+	}
+	return stats, userRows.Err()
+}
+
+// sqliteTimeLayout 與 CURRENT_TIMESTAMP 相同的格式（UTC），寫入後可直接和 CURRENT_TIMESTAMP 比較
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// AddScheduledGeneration 新增排程任務，回傳任務 ID
+func (d *Database) AddScheduledGeneration(userID, chatID, replyToMessageID int64, payload string, runAt time.Time) (int64, error) {
+	result, err := d.db.Exec(`
+		INSERT INTO scheduled_generations (user_id, chat_id, reply_to_message_id, payload, run_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, chatID, replyToMessageID, payload, runAt.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetDueScheduledGenerations 取得已到執行時間的排程任務，依 run_at 由早到晚排序
+func (d *Database) GetDueScheduledGenerations(limit int) ([]ScheduledGeneration, error) {
+	return d.queryScheduledGenerations(`
+		SELECT id, user_id, chat_id, reply_to_message_id, payload, run_at, created_at
+		FROM scheduled_generations
+		WHERE run_at <= CURRENT_TIMESTAMP
+		ORDER BY run_at ASC, id ASC
+		LIMIT ?
+	`, limit)
+}
+
+// GetScheduledGenerations 取得使用者尚未執行的排程任務，依 run_at 由早到晚排序
+func (d *Database) GetScheduledGenerations(userID int64) ([]ScheduledGeneration, error) {
+	return d.queryScheduledGenerations(`
+		SELECT id, user_id, chat_id, reply_to_message_id, payload, run_at, created_at
+		FROM scheduled_generations
+		WHERE user_id = ?
+		ORDER BY run_at ASC, id ASC
+	`, userID)
+}
+
+func (d *Database) queryScheduledGenerations(query string, args ...interface{}) ([]ScheduledGeneration, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []ScheduledGeneration
+	for rows.Next() {
+		var task ScheduledGeneration
+		if err := rows.Scan(&task.ID, &task.UserID, &task.ChatID, &task.ReplyToMessageID, &task.Payload, &task.RunAt, &task.CreatedAt); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// DeleteScheduledGeneration 刪除使用者的排程任務；任務不存在（或已被執行）時回傳 sql.ErrNoRows
+func (d *Database) DeleteScheduledGeneration(id, userID int64) error {
+	result, err := d.db.Exec(`DELETE FROM scheduled_generations WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// userDataTables 以 user_id 儲存使用者資料的表，新增這類表時要一併加入
+var userDataTables = []string{
+	"saved_prompts",
+	"prompt_history",
+	"user_settings",
+	"user_services",
+	"failed_generations",
+	"generation_log",
+	"prompt_thumbnails",
+	"scheduled_generations",
+}
+
+// DeleteAllUserData 在同一個交易中刪除使用者的所有資料
+func (d *Database) DeleteAllUserData(userID int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range userDataTables {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return fmt.Errorf("delete from %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// PurgeOldHistory 刪除所有使用者早於 before 的 prompt_history 與 generation_log，回傳刪除的筆數
+// 有刪除資料時接著 VACUUM 釋放檔案空間
+func (d *Database) PurgeOldHistory(before time.Time) (int64, error) {
+	cutoff := before.UTC().Format(sqliteTimeLayout)
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var removed int64
+	for _, stmt := range []string{
+		`DELETE FROM prompt_history WHERE used_at < ?`,
+		`DELETE FROM generation_log WHERE created_at < ?`,
+	} {
+		result, err := tx.Exec(stmt, cutoff)
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		removed += n
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if removed > 0 {
+		if _, err := d.db.Exec(`VACUUM`); err != nil {
+			return removed, fmt.Errorf("vacuum: %w", err)
+		}
+	}
+	return removed, nil
+}
+
+// BackupTo 以 VACUUM INTO 將資料庫完整複製到指定路徑（不影響使用中的資料庫），目標檔案不可已存在
+func (d *Database) BackupTo(path string) error {
+	_, err := d.db.Exec(`VACUUM INTO ?`, path)
+	return err
+}
+
 func (d *Database) Close() error {
 	return d.db.Close()
 }
+
+// GetPublicPrompts 取得公開 Prompt 庫
+func (d *Database) GetPublicPrompts() ([]PublicPrompt, error) {
+	rows, err := d.db.Query(`
+		SELECT id, name, COALESCE(description, ''), prompt
+		FROM public_prompts
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prompts []PublicPrompt
+	for rows.Next() {
+		var p PublicPrompt
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Prompt); err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, nil
+}
+
+// ForkPublicPrompt 將公開 Prompt 複製到使用者保存的 Prompt，回傳複製的項目
+// 找不到公開 Prompt 時回傳 sql.ErrNoRows，已有同名 Prompt 時回傳 ErrPromptNameTaken
+func (d *Database) ForkPublicPrompt(userID, publicID int64) (*PublicPrompt, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	p := &PublicPrompt{ID: publicID}
+	err = tx.QueryRow(`
+		SELECT name, COALESCE(description, ''), prompt FROM public_prompts WHERE id = ?
+	`, publicID).Scan(&p.Name, &p.Description, &p.Prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM saved_prompts WHERE user_id = ? AND name = ? AND deleted_at IS NULL
+	`, userID, p.Name).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrPromptNameTaken
+	}
+
+	// 可能有同名但已軟刪除的舊資料，直接取代
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO saved_prompts (user_id, name, prompt, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`, userID, p.Name, p.Prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, tx.Commit()
+}
+
+// DuplicatePrompt 將使用者保存的 Prompt 複製為新名稱（複本不會是預設）
+// 找不到來源時回傳 sql.ErrNoRows，新名稱已被使用時回傳 ErrPromptNameTaken
+func (d *Database) DuplicatePrompt(userID int64, name, newName string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var prompt string
+	err = tx.QueryRow(`
+		SELECT prompt FROM saved_prompts WHERE user_id = ? AND name = ? AND deleted_at IS NULL
+	`, userID, name).Scan(&prompt)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM saved_prompts WHERE user_id = ? AND name = ? AND deleted_at IS NULL
+	`, userID, newName).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPromptNameTaken
+	}
+
+	// 可能有同名但已軟刪除的舊資料，直接取代
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO saved_prompts (user_id, name, prompt, is_default, created_at)
+		VALUES (?, ?, ?, FALSE, CURRENT_TIMESTAMP)
+	`, userID, newName, prompt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetAccessRule 設定使用者或群組的存取權限
+func (d *Database) SetAccessRule(targetID int64, allowed bool) error {
+	_, err := d.db.Exec(`
+		INSERT INTO access_control (target_id, allowed, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(target_id) DO UPDATE SET
+			allowed = excluded.allowed,
+			updated_at = CURRENT_TIMESTAMP
+	`, targetID, allowed)
+	return err
+}
+
+// GetAccessRule 取得使用者或群組的存取權限，found 為 false 表示沒有設定
+func (d *Database) GetAccessRule(targetID int64) (allowed bool, found bool, err error) {
+	err = d.db.QueryRow(`SELECT allowed FROM access_control WHERE target_id = ?`, targetID).Scan(&allowed)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return allowed, true, nil
+}
+
+// HasAllowRules 是否有任何允許規則（有的話代表啟用白名單）
+func (d *Database) HasAllowRules() (bool, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM access_control WHERE allowed = TRUE`).Scan(&count)
+	return count > 0, err
+}
+
+// GetKV 取得 key-value 設定，found 為 false 表示沒有設定
+func (d *Database) GetKV(key string) (string, bool, error) {
+	var value string
+	err := d.db.QueryRow(`SELECT value FROM kv_store WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// SetKV 設定 key-value，已存在時覆寫
+func (d *Database) SetKV(key, value string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO kv_store (key, value, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET
+			value = excluded.value,
+			updated_at = CURRENT_TIMESTAMP
+	`, key, value)
+	return err
+}
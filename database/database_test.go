@@ -1,6 +1,13 @@
 package database
 
-import "testing"
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestUserServiceCRUD(t *testing.T) {
 	db, err := NewDatabase(t.TempDir())
@@ -94,3 +101,1308 @@ func TestFailedGenerationQueue(t *testing.T) {
 		t.Fatalf("expected empty queue, got %+v", task)
 	}
 }
+
+func TestMarkFailedGenerationRetry_BacksOff(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.AddFailedGeneration(10, 20, 30, `{"prompt":"x"}`, "boom"); err != nil {
+		t.Fatalf("AddFailedGeneration failed: %v", err)
+	}
+	task, _ := db.GetRandomFailedGeneration()
+
+	var delays []int
+	for i := 0; i < 8; i++ {
+		if err := db.MarkFailedGenerationRetry(task.ID, "still boom"); err != nil {
+			t.Fatalf("MarkFailedGenerationRetry failed: %v", err)
+		}
+		var minutes int
+		if err := db.db.QueryRow(`
+			SELECT CAST(ROUND((julianday(next_retry_at) - julianday(last_retry_at)) * 1440) AS INTEGER)
+			FROM failed_generations WHERE id = ?
+		`, task.ID).Scan(&minutes); err != nil {
+			t.Fatalf("read next_retry_at failed: %v", err)
+		}
+		delays = append(delays, minutes)
+	}
+
+	want := []int{1, 2, 4, 8, 16, 32, 60, 60}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Fatalf("retry delays = %v, want %v", delays, want)
+		}
+	}
+	if tasks, _ := db.GetFailedGenerations(10); len(tasks) != 0 {
+		t.Fatalf("task should not be due right after a failed retry, got %+v", tasks)
+	}
+}
+
+func TestUserVoiceSettings(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	voice, err := db.GetUserVoice(1)
+	if err != nil {
+		t.Fatalf("GetUserVoice failed: %v", err)
+	}
+	if voice != "" {
+		t.Fatalf("expected empty voice, got %q", voice)
+	}
+
+	if err := db.SetUserVoice(1, "Puck"); err != nil {
+		t.Fatalf("SetUserVoice failed: %v", err)
+	}
+	if err := db.SetUserSettings(1, "4K"); err != nil {
+		t.Fatalf("SetUserSettings failed: %v", err)
+	}
+
+	voice, err = db.GetUserVoice(1)
+	if err != nil {
+		t.Fatalf("GetUserVoice after set failed: %v", err)
+	}
+	if voice != "Puck" {
+		t.Fatalf("expected voice Puck to survive quality update, got %q", voice)
+	}
+	quality, err := db.GetUserSettings(1)
+	if err != nil {
+		t.Fatalf("GetUserSettings failed: %v", err)
+	}
+	if quality != "4K" {
+		t.Fatalf("expected quality 4K, got %q", quality)
+	}
+}
+
+func TestUserLanguage(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	lang, err := db.GetUserLanguage(1)
+	if err != nil {
+		t.Fatalf("GetUserLanguage failed: %v", err)
+	}
+	if lang != "" {
+		t.Fatalf("expected empty language, got %q", lang)
+	}
+
+	if err := db.SetUserLanguage(1, "en"); err != nil {
+		t.Fatalf("SetUserLanguage failed: %v", err)
+	}
+	if err := db.SetUserSettings(1, "4K"); err != nil {
+		t.Fatalf("SetUserSettings failed: %v", err)
+	}
+
+	lang, err = db.GetUserLanguage(1)
+	if err != nil {
+		t.Fatalf("GetUserLanguage after set failed: %v", err)
+	}
+	if lang != "en" {
+		t.Fatalf("expected language en to survive quality update, got %q", lang)
+	}
+}
+
+func TestUserDefaultRatio(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	ratio, err := db.GetUserDefaultRatio(1)
+	if err != nil {
+		t.Fatalf("GetUserDefaultRatio failed: %v", err)
+	}
+	if ratio != "" {
+		t.Fatalf("expected empty ratio, got %q", ratio)
+	}
+
+	if err := db.SetUserDefaultRatio(1, "16:9"); err != nil {
+		t.Fatalf("SetUserDefaultRatio failed: %v", err)
+	}
+	if err := db.SetUserSettings(1, "4K"); err != nil {
+		t.Fatalf("SetUserSettings failed: %v", err)
+	}
+	if ratio, _ := db.GetUserDefaultRatio(1); ratio != "16:9" {
+		t.Fatalf("expected ratio 16:9 to survive quality update, got %q", ratio)
+	}
+
+	if err := db.SetUserDefaultRatio(1, ""); err != nil {
+		t.Fatalf("clear ratio failed: %v", err)
+	}
+	if ratio, _ := db.GetUserDefaultRatio(1); ratio != "" {
+		t.Fatalf("expected cleared ratio, got %q", ratio)
+	}
+}
+
+func TestUserOutputFormat(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if format, err := db.GetUserOutputFormat(1); err != nil || format != "" {
+		t.Fatalf("expected empty format, got %q (%v)", format, err)
+	}
+	if err := db.SetUserOutputFormat(1, "jpeg"); err != nil {
+		t.Fatalf("SetUserOutputFormat failed: %v", err)
+	}
+	if err := db.SetUserDefaultRatio(1, "4:3"); err != nil {
+		t.Fatalf("SetUserDefaultRatio failed: %v", err)
+	}
+	if format, _ := db.GetUserOutputFormat(1); format != "jpeg" {
+		t.Fatalf("expected jpeg to survive other settings, got %q", format)
+	}
+
+	if quality, err := db.GetUserJPEGQuality(1); err != nil || quality != 0 {
+		t.Fatalf("expected unset quality, got %d (%v)", quality, err)
+	}
+	if err := db.SetUserJPEGQuality(1, 70); err != nil {
+		t.Fatalf("SetUserJPEGQuality failed: %v", err)
+	}
+	if quality, _ := db.GetUserJPEGQuality(1); quality != 70 {
+		t.Fatalf("expected quality 70, got %d", quality)
+	}
+
+	if payload, err := db.GetLastGeneration(1); err != nil || payload != "" {
+		t.Fatalf("expected no last generation, got %q (%v)", payload, err)
+	}
+	if err := db.SetLastGeneration(1, `{"prompt":"cat"}`); err != nil {
+		t.Fatalf("SetLastGeneration failed: %v", err)
+	}
+	if payload, _ := db.GetLastGeneration(1); payload != `{"prompt":"cat"}` {
+		t.Fatalf("unexpected last generation %q", payload)
+	}
+	if format, _ := db.GetUserOutputFormat(1); format != "jpeg" {
+		t.Fatalf("expected last generation to keep other settings, got %q", format)
+	}
+}
+
+func TestUserDefaultPrompt(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	prompt, err := db.GetUserDefaultPrompt(1)
+	if err != nil {
+		t.Fatalf("GetUserDefaultPrompt failed: %v", err)
+	}
+	if prompt != "" {
+		t.Fatalf("expected empty prompt, got %q", prompt)
+	}
+
+	if err := db.SetUserDefaultPrompt(1, "畫成水彩風格"); err != nil {
+		t.Fatalf("SetUserDefaultPrompt failed: %v", err)
+	}
+	prompt, err = db.GetUserDefaultPrompt(1)
+	if err != nil {
+		t.Fatalf("GetUserDefaultPrompt after set failed: %v", err)
+	}
+	if prompt != "畫成水彩風格" {
+		t.Fatalf("unexpected prompt: %q", prompt)
+	}
+
+	if err := db.SetUserDefaultPrompt(1, ""); err != nil {
+		t.Fatalf("SetUserDefaultPrompt clear failed: %v", err)
+	}
+	prompt, _ = db.GetUserDefaultPrompt(1)
+	if prompt != "" {
+		t.Fatalf("expected cleared prompt, got %q", prompt)
+	}
+}
+
+func TestPromptSoftDeleteAndUndo(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.SavePrompt(1, "keep", "a"); err != nil {
+		t.Fatalf("SavePrompt failed: %v", err)
+	}
+	prompts, _ := db.GetSavedPrompts(1)
+	id := prompts[0].ID
+
+	if err := db.DeletePrompt(1, id); err != nil {
+		t.Fatalf("DeletePrompt failed: %v", err)
+	}
+	prompts, _ = db.GetSavedPrompts(1)
+	if len(prompts) != 0 {
+		t.Fatalf("expected soft-deleted prompt to be hidden, got %+v", prompts)
+	}
+
+	if err := db.UndoDeletePrompt(1, id); err != nil {
+		t.Fatalf("UndoDeletePrompt failed: %v", err)
+	}
+	prompts, _ = db.GetSavedPrompts(1)
+	if len(prompts) != 1 {
+		t.Fatalf("expected prompt restored, got %+v", prompts)
+	}
+
+	if err := db.DeletePrompt(1, id); err != nil {
+		t.Fatalf("DeletePrompt again failed: %v", err)
+	}
+	if purged, err := db.PurgeDeletedPrompts(time.Hour); err != nil || purged != 0 {
+		t.Fatalf("expected nothing purged yet, got %d (%v)", purged, err)
+	}
+	if purged, err := db.PurgeDeletedPrompts(-time.Hour); err != nil || purged != 1 {
+		t.Fatalf("expected 1 purged, got %d (%v)", purged, err)
+	}
+	if err := db.UndoDeletePrompt(1, id); err == nil {
+		t.Fatalf("expected undo to fail after purge")
+	}
+}
+
+func TestHistoryPagination(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := db.AddToHistory(1, "prompt"); err != nil {
+			t.Fatalf("AddToHistory failed: %v", err)
+		}
+	}
+
+	total, err := db.CountHistory(1)
+	if err != nil || total != 10 {
+		t.Fatalf("expected 10 history rows, got %d (%v)", total, err)
+	}
+
+	first, err := db.GetHistoryPage(1, 8, 0)
+	if err != nil || len(first) != 8 {
+		t.Fatalf("expected 8 rows on first page, got %d (%v)", len(first), err)
+	}
+	second, err := db.GetHistoryPage(1, 8, 8)
+	if err != nil || len(second) != 2 {
+		t.Fatalf("expected 2 rows on second page, got %d (%v)", len(second), err)
+	}
+	if first[len(first)-1].ID <= second[0].ID {
+		t.Fatalf("expected pages in descending order, got %d then %d", first[len(first)-1].ID, second[0].ID)
+	}
+}
+
+func TestSavedPromptsSorted(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"beta", "Alpha", "gamma"} {
+		if err := db.SavePrompt(1, name, name+" prompt"); err != nil {
+			t.Fatalf("SavePrompt failed: %v", err)
+		}
+	}
+	if err := db.AddToHistory(1, "gamma prompt"); err != nil {
+		t.Fatalf("AddToHistory failed: %v", err)
+	}
+
+	byName, err := db.GetSavedPromptsSorted(1, PromptSortName)
+	if err != nil {
+		t.Fatalf("GetSavedPromptsSorted name failed: %v", err)
+	}
+	if len(byName) != 3 || byName[0].Name != "Alpha" || byName[2].Name != "gamma" {
+		t.Fatalf("unexpected name order: %+v", byName)
+	}
+
+	byRecent, err := db.GetSavedPromptsSorted(1, PromptSortRecent)
+	if err != nil {
+		t.Fatalf("GetSavedPromptsSorted recent failed: %v", err)
+	}
+	if len(byRecent) != 3 || byRecent[0].Name != "gamma" {
+		t.Fatalf("expected recently used prompt first, got %+v", byRecent)
+	}
+
+	if err := db.SetUserListSort(1, PromptSortRecent); err != nil {
+		t.Fatalf("SetUserListSort failed: %v", err)
+	}
+	if order, err := db.GetUserListSort(1); err != nil || order != PromptSortRecent {
+		t.Fatalf("expected stored sort %q, got %q (%v)", PromptSortRecent, order, err)
+	}
+}
+
+func TestForkPublicPrompt(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	library, err := db.GetPublicPrompts()
+	if err != nil {
+		t.Fatalf("GetPublicPrompts failed: %v", err)
+	}
+	if len(library) != len(defaultPublicPrompts) {
+		t.Fatalf("expected %d seeded prompts, got %d", len(defaultPublicPrompts), len(library))
+	}
+
+	forked, err := db.ForkPublicPrompt(1, library[0].ID)
+	if err != nil {
+		t.Fatalf("ForkPublicPrompt failed: %v", err)
+	}
+	saved, err := db.GetSavedPrompts(1)
+	if err != nil || len(saved) != 1 || saved[0].Prompt != forked.Prompt {
+		t.Fatalf("expected forked prompt in saved prompts, got %+v (%v)", saved, err)
+	}
+
+	if _, err := db.ForkPublicPrompt(1, library[0].ID); err != ErrPromptNameTaken {
+		t.Fatalf("expected ErrPromptNameTaken, got %v", err)
+	}
+	if _, err := db.ForkPublicPrompt(1, 9999); err == nil {
+		t.Fatalf("expected error for unknown public prompt")
+	}
+}
+
+func TestChatSettings(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	settings, err := db.GetChatSettings(-100)
+	if err != nil {
+		t.Fatalf("GetChatSettings failed: %v", err)
+	}
+	if settings.Enabled || settings.DefaultQuality != "" {
+		t.Fatalf("expected empty settings, got %+v", settings)
+	}
+
+	settings.Enabled = true
+	settings.DefaultQuality = "4K"
+	settings.DefaultPrompt = "群組預設"
+	if err := db.SetChatSettings(settings); err != nil {
+		t.Fatalf("SetChatSettings failed: %v", err)
+	}
+
+	got, err := db.GetChatSettings(-100)
+	if err != nil {
+		t.Fatalf("GetChatSettings after set failed: %v", err)
+	}
+	if !got.Enabled || got.DefaultQuality != "4K" || got.DefaultPrompt != "群組預設" {
+		t.Fatalf("unexpected chat settings: %+v", got)
+	}
+}
+
+func TestKVStore(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if value, found, err := db.GetKV("missing"); err != nil || found || value != "" {
+		t.Fatalf("expected missing key, got %q found=%v (%v)", value, found, err)
+	}
+
+	if err := db.SetKV("maintenance", "on"); err != nil {
+		t.Fatalf("SetKV failed: %v", err)
+	}
+	if err := db.SetKV("maintenance", "off"); err != nil {
+		t.Fatalf("SetKV overwrite failed: %v", err)
+	}
+	if value, found, err := db.GetKV("maintenance"); err != nil || !found || value != "off" {
+		t.Fatalf("expected overwritten value off, got %q found=%v (%v)", value, found, err)
+	}
+
+	// 空字串也是有效的值
+	if err := db.SetKV("empty", ""); err != nil {
+		t.Fatalf("SetKV empty failed: %v", err)
+	}
+	if value, found, err := db.GetKV("empty"); err != nil || !found || value != "" {
+		t.Fatalf("expected empty value to be found, got %q found=%v (%v)", value, found, err)
+	}
+}
+
+func TestDeleteFailedGenerationsInBulk(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	for _, userID := range []int64{1, 1, 2} {
+		if err := db.AddFailedGeneration(userID, 20, 30, `{"prompt":"x"}`, "boom"); err != nil {
+			t.Fatalf("AddFailedGeneration failed: %v", err)
+		}
+	}
+
+	removed, err := db.DeleteFailedGenerationsByUser(1)
+	if err != nil || removed != 2 {
+		t.Fatalf("expected 2 tasks removed for user 1, got %d (%v)", removed, err)
+	}
+	removed, err = db.DeleteAllFailedGenerations()
+	if err != nil || removed != 1 {
+		t.Fatalf("expected 1 remaining task removed, got %d (%v)", removed, err)
+	}
+}
+
+func TestGetRetryQueueStats(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	empty, err := db.GetRetryQueueStats(5)
+	if err != nil {
+		t.Fatalf("GetRetryQueueStats failed: %v", err)
+	}
+	if empty.Total != 0 || empty.OldestAge != 0 || len(empty.ByRetries) != 0 || len(empty.TopUsers) != 0 {
+		t.Fatalf("expected empty stats, got %+v", empty)
+	}
+
+	for _, userID := range []int64{1, 1, 1, 2, 3} {
+		if err := db.AddFailedGeneration(userID, 20, 30, `{"prompt":"x"}`, "boom"); err != nil {
+			t.Fatalf("AddFailedGeneration failed: %v", err)
+		}
+	}
+	if _, err := db.db.Exec(`UPDATE failed_generations SET retry_count = id - 1, created_at = datetime('now', '-' || id || ' hours')`); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	stats, err := db.GetRetryQueueStats(2)
+	if err != nil {
+		t.Fatalf("GetRetryQueueStats failed: %v", err)
+	}
+	if stats.Total != 5 || stats.Users != 3 {
+		t.Fatalf("unexpected totals: %+v", stats)
+	}
+	if stats.OldestAge < 5*time.Hour-time.Minute || stats.OldestAge > 5*time.Hour+time.Minute {
+		t.Fatalf("expected oldest task about 5h old, got %v", stats.OldestAge)
+	}
+
+	// retry_count 為 0、1、2、3、4
+	want := []RetryQueueGroup{{"0", 1}, {"1", 1}, {"2-4", 3}}
+	if len(stats.ByRetries) != len(want) {
+		t.Fatalf("unexpected buckets: %+v", stats.ByRetries)
+	}
+	for i, g := range want {
+		if stats.ByRetries[i] != g {
+			t.Fatalf("bucket %d: expected %+v, got %+v", i, g, stats.ByRetries[i])
+		}
+	}
+
+	if len(stats.TopUsers) != 2 || stats.TopUsers[0] != (RetryQueueUser{UserID: 1, Count: 3}) || stats.TopUsers[1].Count != 1 {
+		t.Fatalf("unexpected top users: %+v", stats.TopUsers)
+	}
+}
+
+func TestGetFailedGenerations_OrderedByNextRetry(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := db.AddFailedGeneration(1, 20, 30, `{"prompt":"x"}`, "boom"); err != nil {
+			t.Fatalf("AddFailedGeneration failed: %v", err)
+		}
+	}
+
+	tasks, err := db.GetFailedGenerations(2)
+	if err != nil {
+		t.Fatalf("GetFailedGenerations failed: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("expected batch of 2, got %d", len(tasks))
+	}
+	if tasks[0].ID > tasks[1].ID {
+		t.Fatalf("expected oldest task first, got %d then %d", tasks[0].ID, tasks[1].ID)
+	}
+	if tasks[0].NextRetryAt == nil {
+		t.Fatalf("expected next_retry_at to be set on enqueue")
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	const workers, perWorker = 20, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker*2)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if err := db.AddToHistory(userID, "prompt"); err != nil {
+					errs <- err
+				}
+				if err := db.SetUserSettings(userID, "4K"); err != nil {
+					errs <- err
+				}
+			}
+		}(int64(w))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("concurrent write failed: %v", err)
+	}
+
+	total := 0
+	for w := 0; w < workers; w++ {
+		n, err := db.CountHistory(int64(w))
+		if err != nil {
+			t.Fatalf("CountHistory failed: %v", err)
+		}
+		total += n
+	}
+	if total != workers*perWorker {
+		t.Fatalf("expected %d history rows, got %d", workers*perWorker, total)
+	}
+}
+
+// BenchmarkGetHistory 在 10k 筆歷史（分散在多個使用者）中查詢單一使用者的最近記錄
+func BenchmarkGetHistory(b *testing.B) {
+	db, err := NewDatabase(b.TempDir())
+	if err != nil {
+		b.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		b.Fatalf("Begin failed: %v", err)
+	}
+	for i := 0; i < 10000; i++ {
+		if _, err := tx.Exec(`INSERT INTO prompt_history (user_id, prompt) VALUES (?, ?)`, int64(i%100), "prompt"); err != nil {
+			b.Fatalf("insert failed: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatalf("Commit failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.GetHistory(42, 10); err != nil {
+			b.Fatalf("GetHistory failed: %v", err)
+		}
+	}
+}
+
+func TestMigrate_ReopenIsIdempotent(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDatabase(dir)
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	db.Close()
+
+	db, err = NewDatabase(dir)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if want := migrations[len(migrations)-1].version; version != want {
+		t.Fatalf("expected schema version %d, got %d", want, version)
+	}
+}
+
+func TestMigrate_UpgradesLegacyDatabase(t *testing.T) {
+	dir := t.TempDir()
+
+	// 模擬沒有 schema_migrations 的舊版資料庫
+	legacy, err := sql.Open("sqlite", filepath.Join(dir, "bot.db"))
+	if err != nil {
+		t.Fatalf("open legacy db failed: %v", err)
+	}
+	_, err = legacy.Exec(`
+		CREATE TABLE saved_prompts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			prompt TEXT NOT NULL,
+			is_default BOOLEAN DEFAULT FALSE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, name)
+		);
+		INSERT INTO saved_prompts (user_id, name, prompt) VALUES (1, 'old', 'legacy prompt');
+	`)
+	if err != nil {
+		t.Fatalf("create legacy schema failed: %v", err)
+	}
+	legacy.Close()
+
+	db, err := NewDatabase(dir)
+	if err != nil {
+		t.Fatalf("NewDatabase on legacy db failed: %v", err)
+	}
+	defer db.Close()
+
+	// deleted_at 是後來才加的欄位，查詢不應出現 "no such column"
+	prompts, err := db.GetSavedPrompts(1)
+	if err != nil {
+		t.Fatalf("GetSavedPrompts after upgrade failed: %v", err)
+	}
+	if len(prompts) != 1 || prompts[0].Prompt != "legacy prompt" {
+		t.Fatalf("expected legacy data to survive upgrade, got %+v", prompts)
+	}
+}
+
+func TestPurgeOldHistory(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	for _, stmt := range []string{
+		`INSERT INTO prompt_history (user_id, prompt, used_at) VALUES (1, 'old', datetime('now', '-40 days'))`,
+		`INSERT INTO prompt_history (user_id, prompt, used_at) VALUES (2, 'recent', datetime('now', '-5 days'))`,
+		`INSERT INTO generation_log (user_id, chat_id, prompt, status, created_at) VALUES (1, 1, 'old', 'success', datetime('now', '-31 days'))`,
+		`INSERT INTO generation_log (user_id, chat_id, prompt, status, created_at) VALUES (3, 3, 'old', 'failed', datetime('now', '-90 days'))`,
+		`INSERT INTO generation_log (user_id, chat_id, prompt, status) VALUES (2, 2, 'new', 'success')`,
+	} {
+		if _, err := db.db.Exec(stmt); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	removed, err := db.PurgeOldHistory(time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatalf("PurgeOldHistory failed: %v", err)
+	}
+	if removed != 3 {
+		t.Fatalf("expected 3 rows removed, got %d", removed)
+	}
+
+	var history, logs int
+	db.db.QueryRow(`SELECT COUNT(*) FROM prompt_history WHERE prompt = 'recent'`).Scan(&history)
+	db.db.QueryRow(`SELECT COUNT(*) FROM generation_log WHERE prompt = 'new'`).Scan(&logs)
+	if history != 1 || logs != 1 {
+		t.Fatalf("recent rows should be kept, got history=%d logs=%d", history, logs)
+	}
+
+	removed, err = db.PurgeOldHistory(time.Now().AddDate(0, 0, -30))
+	if err != nil || removed != 0 {
+		t.Fatalf("expected nothing left to purge, got %d (%v)", removed, err)
+	}
+}
+
+func TestDeleteAllUserData(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	for _, userID := range []int64{1, 2} {
+		if err := db.SavePrompt(userID, "p", "prompt"); err != nil {
+			t.Fatalf("SavePrompt failed: %v", err)
+		}
+		if err := db.AddToHistory(userID, "prompt"); err != nil {
+			t.Fatalf("AddToHistory failed: %v", err)
+		}
+		if err := db.SetUserSettings(userID, "4K"); err != nil {
+			t.Fatalf("SetUserSettings failed: %v", err)
+		}
+		if _, err := db.AddUserService(userID, "standard", "main", "key", "", "", "", "", true); err != nil {
+			t.Fatalf("AddUserService failed: %v", err)
+		}
+		if err := db.AddFailedGeneration(userID, 20, 30, `{"prompt":"x"}`, "boom"); err != nil {
+			t.Fatalf("AddFailedGeneration failed: %v", err)
+		}
+		if _, err := db.LogGeneration(&GenerationLog{UserID: userID, ChatID: 20, Prompt: "prompt", Status: GenerationStatusSuccess}); err != nil {
+			t.Fatalf("LogGeneration failed: %v", err)
+		}
+		if err := db.SetPromptThumbnail(userID, 1, []byte("jpg")); err != nil {
+			t.Fatalf("SetPromptThumbnail failed: %v", err)
+		}
+		if _, err := db.AddScheduledGeneration(userID, 20, 30, `{"prompt":"x"}`, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("AddScheduledGeneration failed: %v", err)
+		}
+	}
+
+	if err := db.DeleteAllUserData(1); err != nil {
+		t.Fatalf("DeleteAllUserData failed: %v", err)
+	}
+
+	for _, table := range userDataTables {
+		var remaining, others int
+		if err := db.db.QueryRow(`SELECT COUNT(*) FROM ` + table + ` WHERE user_id = 1`).Scan(&remaining); err != nil {
+			t.Fatalf("count %s failed: %v", table, err)
+		}
+		if err := db.db.QueryRow(`SELECT COUNT(*) FROM ` + table + ` WHERE user_id = 2`).Scan(&others); err != nil {
+			t.Fatalf("count %s failed: %v", table, err)
+		}
+		if remaining != 0 {
+			t.Fatalf("expected %s to be clean for user 1, got %d rows", table, remaining)
+		}
+		if others == 0 {
+			t.Fatalf("expected %s rows of user 2 to be kept", table)
+		}
+	}
+}
+
+func TestSetDefaultPrompt_RollsBackOnMissingPrompt(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.SavePrompt(1, "a", "prompt a"); err != nil {
+		t.Fatalf("SavePrompt failed: %v", err)
+	}
+	prompts, _ := db.GetSavedPrompts(1)
+	if err := db.SetDefaultPrompt(1, prompts[0].ID); err != nil {
+		t.Fatalf("SetDefaultPrompt failed: %v", err)
+	}
+
+	// 第二個 UPDATE 找不到目標，第一個 UPDATE 清掉的預設必須被回滾
+	if err := db.SetDefaultPrompt(1, 9999); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+	defaultPrompt, err := db.GetDefaultPrompt(1)
+	if err != nil {
+		t.Fatalf("GetDefaultPrompt failed: %v", err)
+	}
+	if defaultPrompt == nil || defaultPrompt.ID != prompts[0].ID {
+		t.Fatalf("expected previous default to be preserved, got %+v", defaultPrompt)
+	}
+}
+
+func TestSetDefaultUserService_RollsBackOnMissingService(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	id, err := db.AddUserService(1, "standard", "main", "key1", "", "", "", "", true)
+	if err != nil {
+		t.Fatalf("AddUserService failed: %v", err)
+	}
+	if err := db.SetDefaultUserService(1, 9999); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+	defaultService, err := db.GetDefaultUserService(1)
+	if err != nil {
+		t.Fatalf("GetDefaultUserService failed: %v", err)
+	}
+	if defaultService == nil || defaultService.ID != id {
+		t.Fatalf("expected previous default service to be preserved, got %+v", defaultService)
+	}
+}
+
+func TestUpdateUserService(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	id, err := db.AddUserService(1, "custom", "proxy", "old-key", "https://old.example.com", "", "", "", true)
+	if err != nil {
+		t.Fatalf("AddUserService failed: %v", err)
+	}
+
+	if err := db.UpdateUserService(1, id, "key", "new-key"); err != nil {
+		t.Fatalf("UpdateUserService key failed: %v", err)
+	}
+	if err := db.UpdateUserService(1, id, "base", "https://new.example.com"); err != nil {
+		t.Fatalf("UpdateUserService base failed: %v", err)
+	}
+	if err := db.UpdateUserService(1, id, "system", "保持文字位置不變"); err != nil {
+		t.Fatalf("UpdateUserService system failed: %v", err)
+	}
+
+	service, err := db.GetDefaultUserService(1)
+	if err != nil {
+		t.Fatalf("GetDefaultUserService failed: %v", err)
+	}
+	if service == nil || service.ID != id {
+		t.Fatalf("expected service %d to stay default, got %+v", id, service)
+	}
+	if service.APIKey != "new-key" || service.BaseURL != "https://new.example.com" {
+		t.Fatalf("unexpected service after update: %+v", service)
+	}
+	if service.Name != "proxy" {
+		t.Fatalf("expected name to be untouched, got %q", service.Name)
+	}
+	if service.SystemInstruction != "保持文字位置不變" {
+		t.Fatalf("unexpected system instruction %q", service.SystemInstruction)
+	}
+	if services, _ := db.GetUserServices(1); len(services) != 1 || services[0].SystemInstruction != "保持文字位置不變" {
+		t.Fatalf("expected system instruction in service list, got %+v", services)
+	}
+
+	if err := db.UpdateUserService(1, id, "is_default", "0"); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+	if err := db.UpdateUserService(2, id, "key", "stolen"); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for another user, got %v", err)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if cached, err := db.GetCachedResult("missing", time.Hour); err != nil || cached != nil {
+		t.Fatalf("expected miss, got %v (%v)", cached, err)
+	}
+
+	if err := db.PutCachedResult("k", []byte("old"), "old text"); err != nil {
+		t.Fatalf("PutCachedResult failed: %v", err)
+	}
+	if err := db.PutCachedResult("k", []byte("png"), "caption"); err != nil {
+		t.Fatalf("PutCachedResult overwrite failed: %v", err)
+	}
+	cached, err := db.GetCachedResult("k", time.Hour)
+	if err != nil || cached == nil || string(cached.Image) != "png" || cached.Text != "caption" {
+		t.Fatalf("expected cached png with caption, got %+v (%v)", cached, err)
+	}
+	if cached, err := db.GetCachedResult("k", -time.Hour); err != nil || cached != nil {
+		t.Fatalf("expected expired entry to miss, got %+v (%v)", cached, err)
+	}
+
+	if purged, err := db.PurgeCachedResults(time.Hour); err != nil || purged != 0 {
+		t.Fatalf("expected nothing purged yet, got %d (%v)", purged, err)
+	}
+	if purged, err := db.PurgeCachedResults(-time.Hour); err != nil || purged != 1 {
+		t.Fatalf("expected 1 purged, got %d (%v)", purged, err)
+	}
+}
+
+func TestPromptThumbnail(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if image, err := db.GetPromptThumbnail(1, 5); err != nil || image != nil {
+		t.Fatalf("expected no thumbnail, got %v (%v)", image, err)
+	}
+
+	if err := db.SetPromptThumbnail(1, 5, []byte("old")); err != nil {
+		t.Fatalf("SetPromptThumbnail failed: %v", err)
+	}
+	if err := db.SetPromptThumbnail(1, 5, []byte("new")); err != nil {
+		t.Fatalf("SetPromptThumbnail overwrite failed: %v", err)
+	}
+	image, err := db.GetPromptThumbnail(1, 5)
+	if err != nil || string(image) != "new" {
+		t.Fatalf("expected latest thumbnail, got %q (%v)", image, err)
+	}
+	if image, _ := db.GetPromptThumbnail(2, 5); image != nil {
+		t.Fatalf("thumbnail should not leak to other users, got %q", image)
+	}
+}
+
+func TestLogGeneration(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	firstID, err := db.LogGeneration(&GenerationLog{UserID: 1, ChatID: 10, Prompt: "a", Quality: "2K", Status: GenerationStatusSuccess, LatencyMs: 1500})
+	if err != nil {
+		t.Fatalf("LogGeneration failed: %v", err)
+	}
+	secondID, err := db.LogGeneration(&GenerationLog{UserID: 1, ChatID: 10, Prompt: "bad", Status: GenerationStatusBlocked, Error: "matched"})
+	if err != nil {
+		t.Fatalf("LogGeneration failed: %v", err)
+	}
+	if secondID <= firstID {
+		t.Fatalf("expected increasing ids, got %d then %d", firstID, secondID)
+	}
+
+	logs, err := db.GetGenerationLogs(1, 10)
+	if err != nil {
+		t.Fatalf("GetGenerationLogs failed: %v", err)
+	}
+	if len(logs) != 2 || logs[0].Status != GenerationStatusBlocked || logs[1].LatencyMs != 1500 {
+		t.Fatalf("unexpected logs %+v", logs)
+	}
+	if err := db.SetGenerationPayload(firstID, `{"prompt":"a"}`); err != nil {
+		t.Fatalf("SetGenerationPayload failed: %v", err)
+	}
+	entry, err := db.GetGenerationLog(firstID)
+	if err != nil || entry == nil || entry.Payload != `{"prompt":"a"}` {
+		t.Fatalf("unexpected entry %+v (%v)", entry, err)
+	}
+	if entry, _ := db.GetGenerationLog(secondID); entry.Payload != "" || entry.ResultFileID != "" {
+		t.Fatalf("expected empty payload and result file, got %+v", entry)
+	}
+
+	if err := db.SetGenerationResultFileID(firstID, "file-a"); err != nil {
+		t.Fatalf("SetGenerationResultFileID failed: %v", err)
+	}
+	if logs, _ := db.GetGenerationLogs(1, 10); logs[1].ResultFileID != "file-a" {
+		t.Fatalf("expected result file id in logs, got %+v", logs[1])
+	}
+}
+
+func TestGetLastError(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if lastError, err := db.GetLastError(1); err != nil || lastError != "" {
+		t.Fatalf("expected no error yet, got %q (%v)", lastError, err)
+	}
+
+	db.LogGeneration(&GenerationLog{UserID: 1, ChatID: 10, Prompt: "a", Status: GenerationStatusFailed, Error: `{"error":"old"}`})
+	db.LogGeneration(&GenerationLog{UserID: 1, ChatID: 10, Prompt: "b", Status: GenerationStatusBlocked, Error: "matched"})
+	db.LogGeneration(&GenerationLog{UserID: 2, ChatID: 20, Prompt: "c", Status: GenerationStatusFailed, Error: "other user"})
+	if lastError, _ := db.GetLastError(1); lastError != `{"error":"old"}` {
+		t.Fatalf("expected generation_log failure, got %q", lastError)
+	}
+
+	if err := db.AddFailedGeneration(1, 10, 0, "{}", `{"error":"proxy 502"}`); err != nil {
+		t.Fatalf("AddFailedGeneration failed: %v", err)
+	}
+	// CURRENT_TIMESTAMP 只到秒，手動把重試佇列的紀錄調晚
+	if _, err := db.db.Exec(`UPDATE failed_generations SET created_at = datetime('now', '+1 minute')`); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if lastError, _ := db.GetLastError(1); lastError != `{"error":"proxy 502"}` {
+		t.Fatalf("expected newest failed_generation error, got %q", lastError)
+	}
+}
+
+func TestGetLastError_PrefersGenerationLogOnTie(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	full := `{"error":"` + strings.Repeat("x", 300) + `"}`
+	db.LogGeneration(&GenerationLog{UserID: 1, ChatID: 10, Prompt: "a", Status: GenerationStatusFailed, Error: full})
+	if err := db.AddFailedGeneration(1, 10, 0, "{}", "xxx...(錯誤訊息過長已截斷)"); err != nil {
+		t.Fatalf("AddFailedGeneration failed: %v", err)
+	}
+	// 失敗紀錄與重試佇列在同一秒寫入
+	for _, table := range []string{"generation_log", "failed_generations"} {
+		if _, err := db.db.Exec(`UPDATE ` + table + ` SET created_at = '2026-01-01 00:00:00'`); err != nil {
+			t.Fatalf("update %s failed: %v", table, err)
+		}
+	}
+	if lastError, _ := db.GetLastError(1); lastError != full {
+		t.Fatalf("expected untruncated generation_log error, got %q", lastError)
+	}
+}
+
+func TestScheduledGenerations(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	dueID, err := db.AddScheduledGeneration(1, 10, 100, `{"prompt":"due"}`, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("AddScheduledGeneration failed: %v", err)
+	}
+	laterID, err := db.AddScheduledGeneration(1, 10, 101, `{"prompt":"later"}`, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("AddScheduledGeneration failed: %v", err)
+	}
+
+	due, err := db.GetDueScheduledGenerations(10)
+	if err != nil {
+		t.Fatalf("GetDueScheduledGenerations failed: %v", err)
+	}
+	if len(due) != 1 || due[0].ID != dueID || due[0].ReplyToMessageID != 100 || due[0].Payload != `{"prompt":"due"}` {
+		t.Fatalf("unexpected due tasks %+v", due)
+	}
+
+	tasks, err := db.GetScheduledGenerations(1)
+	if err != nil {
+		t.Fatalf("GetScheduledGenerations failed: %v", err)
+	}
+	if len(tasks) != 2 || tasks[1].ID != laterID {
+		t.Fatalf("unexpected tasks %+v", tasks)
+	}
+	if d := time.Until(tasks[1].RunAt); d < time.Hour || d > 3*time.Hour {
+		t.Fatalf("run_at did not round-trip, %v from now", d)
+	}
+
+	if err := db.DeleteScheduledGeneration(laterID, 2); err != sql.ErrNoRows {
+		t.Fatalf("expected other users to be unable to cancel, got %v", err)
+	}
+	if err := db.DeleteScheduledGeneration(laterID, 1); err != nil {
+		t.Fatalf("DeleteScheduledGeneration failed: %v", err)
+	}
+	if err := db.DeleteScheduledGeneration(laterID, 1); err != sql.ErrNoRows {
+		t.Fatalf("expected second delete to report missing task, got %v", err)
+	}
+}
+
+func TestRateGenerationAndStats(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	logs := []GenerationLog{
+		{UserID: 1, ChatID: 10, Prompt: "cat", Quality: "2K", Status: GenerationStatusSuccess, LatencyMs: 1000},
+		{UserID: 1, ChatID: 10, Prompt: "cat", Quality: "4K", Status: GenerationStatusSuccess, LatencyMs: 3000},
+		{UserID: 1, ChatID: 10, Prompt: "dog", Quality: "2K", Status: GenerationStatusFailed, Error: "timeout"},
+		{UserID: 2, ChatID: 20, Prompt: "dog", Quality: "2K", Status: GenerationStatusSuccess, LatencyMs: 2000},
+	}
+	ids := make([]int64, len(logs))
+	for i := range logs {
+		if ids[i], err = db.LogGeneration(&logs[i]); err != nil {
+			t.Fatalf("LogGeneration failed: %v", err)
+		}
+	}
+
+	for _, r := range []struct {
+		id     int64
+		rating int
+	}{{ids[0], 1}, {ids[1], 1}, {ids[2], -1}, {ids[3], -1}} {
+		if err := db.RateGeneration(r.id, r.rating); err != nil {
+			t.Fatalf("RateGeneration failed: %v", err)
+		}
+	}
+	if err := db.RateGeneration(ids[0], 2); err == nil {
+		t.Fatalf("expected error for invalid rating")
+	}
+	if err := db.RateGeneration(9999, 1); err == nil {
+		t.Fatalf("expected error for missing log")
+	}
+
+	entry, err := db.GetGenerationLog(ids[2])
+	if err != nil || entry == nil || entry.UserID != 1 || entry.Rating != -1 {
+		t.Fatalf("unexpected log %+v (err %v)", entry, err)
+	}
+	if missing, err := db.GetGenerationLog(9999); err != nil || missing != nil {
+		t.Fatalf("expected nil for missing log, got %+v (err %v)", missing, err)
+	}
+
+	stats, err := db.GetGenerationStats(1, 5)
+	if err != nil {
+		t.Fatalf("GetGenerationStats failed: %v", err)
+	}
+	if stats.Total != 3 || stats.Success != 2 || stats.Failed != 1 || stats.Up != 2 || stats.Down != 1 || stats.AvgLatencyMs != 2000 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if len(stats.ByQuality) != 2 || stats.ByQuality[0].Key != "2K" || stats.ByQuality[0].Count != 2 || stats.ByQuality[0].Down != 1 {
+		t.Fatalf("unexpected quality breakdown %+v", stats.ByQuality)
+	}
+	if len(stats.TopPrompts) != 2 || stats.TopPrompts[0].Key != "cat" || stats.TopPrompts[0].Up != 2 {
+		t.Fatalf("unexpected top prompts %+v", stats.TopPrompts)
+	}
+
+	all, err := db.GetGenerationStats(0, 5)
+	if err != nil {
+		t.Fatalf("GetGenerationStats failed: %v", err)
+	}
+	if all.Total != 4 || all.Down != 2 || all.TopPrompts[1].Key != "dog" || all.TopPrompts[1].Down != 2 {
+		t.Fatalf("unexpected global stats %+v", all)
+	}
+}
+
+func TestGetRandomPrompt(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	if p, err := db.GetRandomPrompt(1); err != nil || p != nil {
+		t.Fatalf("expected nil without saved prompts, got %+v (err %v)", p, err)
+	}
+
+	db.SavePrompt(1, "a", "prompt a")
+	db.SavePrompt(1, "b", "prompt b")
+	db.SavePrompt(2, "other", "not mine")
+	prompts, _ := db.GetSavedPrompts(1)
+	for _, p := range prompts {
+		if p.Name == "b" {
+			db.DeletePrompt(1, p.ID)
+		}
+	}
+
+	// 只剩 a 可選：不可選到已刪除或他人的 Prompt
+	for i := 0; i < 10; i++ {
+		p, err := db.GetRandomPrompt(1)
+		if err != nil || p == nil || p.Name != "a" {
+			t.Fatalf("unexpected random prompt %+v (err %v)", p, err)
+		}
+	}
+}
+
+func TestSearchSavedPrompts(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	db.SavePrompt(1, "Manga", "translate the manga")
+	db.SavePrompt(1, "cat", "draw a cute CAT")
+	db.SavePrompt(1, "dog", "draw a dog")
+	db.SavePrompt(2, "manga2", "not mine")
+
+	names := func(prompts []SavedPrompt) []string {
+		var out []string
+		for _, p := range prompts {
+			out = append(out, p.Name)
+		}
+		return out
+	}
+
+	got, err := db.SearchSavedPrompts(1, "MANGA", 10, 0)
+	if err != nil || len(got) != 1 || got[0].Name != "Manga" {
+		t.Fatalf("unexpected name search %v (err %v)", names(got), err)
+	}
+	if got, _ = db.SearchSavedPrompts(1, "cat", 10, 0); len(got) != 1 || got[0].Name != "cat" {
+		t.Fatalf("unexpected content search %v", names(got))
+	}
+	if got, _ = db.SearchSavedPrompts(1, "draw", 10, 0); len(got) != 2 {
+		t.Fatalf("expected 2 matches, got %v", names(got))
+	}
+	if got, _ = db.SearchSavedPrompts(1, "%", 10, 0); len(got) != 0 {
+		t.Fatalf("wildcards should be matched literally, got %v", names(got))
+	}
+
+	all, _ := db.SearchSavedPrompts(1, "", 10, 0)
+	if len(all) != 3 {
+		t.Fatalf("expected all prompts for empty query, got %v", names(all))
+	}
+	page, _ := db.SearchSavedPrompts(1, "", 2, 2)
+	if len(page) != 1 || page[0].Name != all[2].Name {
+		t.Fatalf("unexpected second page %v", names(page))
+	}
+}
+
+func TestDuplicatePrompt(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	db.SavePrompt(1, "base", "translate")
+	db.SavePrompt(1, "other", "draw")
+	prompts, _ := db.GetSavedPrompts(1)
+	for _, p := range prompts {
+		if p.Name == "base" {
+			if err := db.SetDefaultPrompt(1, p.ID); err != nil {
+				t.Fatalf("SetDefaultPrompt failed: %v", err)
+			}
+		}
+	}
+
+	if err := db.DuplicatePrompt(1, "base", "copy"); err != nil {
+		t.Fatalf("DuplicatePrompt failed: %v", err)
+	}
+	prompts, _ = db.GetSavedPrompts(1)
+	var clone *SavedPrompt
+	for i := range prompts {
+		if prompts[i].Name == "copy" {
+			clone = &prompts[i]
+		}
+	}
+	if clone == nil || clone.Prompt != "translate" || clone.IsDefault {
+		t.Fatalf("unexpected clone %+v", clone)
+	}
+	if def, _ := db.GetDefaultPrompt(1); def == nil || def.Name != "base" {
+		t.Fatalf("default prompt should stay on the source, got %+v", def)
+	}
+
+	if err := db.DuplicatePrompt(1, "missing", "x"); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for missing source, got %v", err)
+	}
+	if err := db.DuplicatePrompt(1, "base", "other"); err != ErrPromptNameTaken {
+		t.Fatalf("expected ErrPromptNameTaken, got %v", err)
+	}
+	if err := db.DuplicatePrompt(2, "base", "mine"); err != sql.ErrNoRows {
+		t.Fatalf("should not duplicate another user's prompt, got %v", err)
+	}
+
+	// 軟刪除的名稱可以重新使用
+	for _, p := range prompts {
+		if p.Name == "other" {
+			db.DeletePrompt(1, p.ID)
+		}
+	}
+	if err := db.DuplicatePrompt(1, "base", "other"); err != nil {
+		t.Fatalf("expected soft-deleted name to be reusable, got %v", err)
+	}
+}
+
+func TestTopicSettings(t *testing.T) {
+	db, err := NewDatabase(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+
+	settings, err := db.GetTopicSettings(-100, 7)
+	if err != nil {
+		t.Fatalf("GetTopicSettings failed: %v", err)
+	}
+	if settings.DefaultPromptID != 0 || settings.DefaultQuality != "" {
+		t.Fatalf("expected empty settings, got %+v", settings)
+	}
+
+	if err := db.SavePrompt(1, "上色", "colorize"); err != nil {
+		t.Fatalf("SavePrompt failed: %v", err)
+	}
+	prompts, _ := db.GetSavedPrompts(1)
+	settings.DefaultPromptID = prompts[0].ID
+	settings.DefaultQuality = "4K"
+	if err := db.SetTopicSettings(settings); err != nil {
+		t.Fatalf("SetTopicSettings failed: %v", err)
+	}
+
+	got, _ := db.GetTopicSettings(-100, 7)
+	if got.DefaultPromptID != prompts[0].ID || got.DefaultQuality != "4K" {
+		t.Fatalf("unexpected settings %+v", got)
+	}
+	if other, _ := db.GetTopicSettings(-100, 8); other.DefaultQuality != "" {
+		t.Fatalf("topics should be independent, got %+v", other)
+	}
+
+	prompt, err := db.GetSavedPromptByID(got.DefaultPromptID)
+	if err != nil || prompt == nil || prompt.Prompt != "colorize" {
+		t.Fatalf("unexpected prompt %+v (%v)", prompt, err)
+	}
+	if err := db.DeletePrompt(1, prompt.ID); err != nil {
+		t.Fatalf("DeletePrompt failed: %v", err)
+	}
+	if prompt, _ := db.GetSavedPromptByID(got.DefaultPromptID); prompt != nil {
+		t.Fatalf("deleted prompt should not be returned, got %+v", prompt)
+	}
+}
@@ -0,0 +1,126 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Gemini TTS 預設輸出 24kHz、單聲道、16-bit 的 L16 PCM
+const (
+	DefaultTTSSampleRate    = 24000
+	DefaultTTSChannels      = 1
+	DefaultTTSBitsPerSample = 16
+)
+
+// IsWav 判斷資料是否已帶有 RIFF/WAVE 標頭
+func IsWav(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE"
+}
+
+// WrapPCMAsWav 為原始 PCM 加上 44 bytes 的 RIFF/WAVE 標頭；已經是 WAV 時原樣回傳
+func WrapPCMAsWav(pcm []byte, sampleRate, channels, bitsPerSample int) []byte {
+	if IsWav(pcm) {
+		return pcm
+	}
+
+	byteRate := sampleRate * channels * bitsPerSample / 8
+	blockAlign := channels * bitsPerSample / 8
+
+	buffer := bytes.NewBuffer(make([]byte, 0, 44+len(pcm)))
+	buffer.WriteString("RIFF")
+	binary.Write(buffer, binary.LittleEndian, uint32(36+len(pcm)))
+	buffer.WriteString("WAVE")
+	buffer.WriteString("fmt ")
+	binary.Write(buffer, binary.LittleEndian, uint32(16))
+	binary.Write(buffer, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(buffer, binary.LittleEndian, uint16(channels))
+	binary.Write(buffer, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(buffer, binary.LittleEndian, uint32(byteRate))
+	binary.Write(buffer, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(buffer, binary.LittleEndian, uint16(bitsPerSample))
+	buffer.WriteString("data")
+	binary.Write(buffer, binary.LittleEndian, uint32(len(pcm)))
+	buffer.Write(pcm)
+	return buffer.Bytes()
+}
+
+// WAV 回傳可直接播放的 WAV 音訊
+func (r *TTSResult) WAV() []byte {
+	sampleRate := r.SampleRate
+	if sampleRate <= 0 {
+		sampleRate = DefaultTTSSampleRate
+	}
+	return WrapPCMAsWav(r.AudioData, sampleRate, DefaultTTSChannels, DefaultTTSBitsPerSample)
+}
+
+// parseSampleRate 從 "audio/L16;codec=pcm;rate=24000" 這類 mimeType 取出取樣率
+func parseSampleRate(mimeType string) int {
+	for _, param := range strings.Split(mimeType, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || !strings.EqualFold(key, "rate") {
+			continue
+		}
+		if rate, err := strconv.Atoi(value); err == nil && rate > 0 {
+			return rate
+		}
+	}
+	return 0
+}
+
+// 文字的主要書寫系統
+const (
+	ScriptHan      = "han"
+	ScriptJapanese = "japanese"
+	ScriptHangul   = "hangul"
+	ScriptLatin    = "latin"
+)
+
+// TTS 朗讀指示，依偵測到的書寫系統選用；CJK 與無法判斷時使用中文
+var ttsInstructions = map[string]string{
+	ScriptHan:      "请用自然的语气朗读以下漫画对话内容：\n\n%s",
+	ScriptJapanese: "以下の漫画のセリフを自然な口調で読み上げてください：\n\n%s",
+	ScriptHangul:   "다음 만화 대사를 자연스러운 말투로 읽어 주세요:\n\n%s",
+	ScriptLatin:    "Read the following comic dialogue aloud in a natural tone:\n\n%s",
+}
+
+// detectScript 以 Unicode 範圍粗略判斷文字的書寫系統
+// 只要出現假名就視為日文（日文也會夾雜漢字），否則取數量最多的一種
+func detectScript(text string) string {
+	var han, kana, hangul, latin int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	switch {
+	case kana > 0:
+		return ScriptJapanese
+	case hangul > han && hangul > latin:
+		return ScriptHangul
+	case latin > han && latin > hangul:
+		return ScriptLatin
+	default:
+		return ScriptHan
+	}
+}
+
+// ttsInstruction 依文字語言組出 TTS 朗讀指示
+func ttsInstruction(text string) string {
+	template, ok := ttsInstructions[detectScript(text)]
+	if !ok {
+		template = ttsInstructions[ScriptHan]
+	}
+	return fmt.Sprintf(template, text)
+}
@@ -0,0 +1,72 @@
+package gemini
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestWrapPCMAsWav_HeaderSizes(t *testing.T) {
+	pcm := make([]byte, 4800)
+	wav := WrapPCMAsWav(pcm, 24000, 1, 16)
+
+	if len(wav) != 44+len(pcm) {
+		t.Fatalf("expected %d bytes, got %d", 44+len(pcm), len(wav))
+	}
+	if !IsWav(wav) {
+		t.Fatalf("expected RIFF/WAVE header")
+	}
+	if got := binary.LittleEndian.Uint32(wav[4:8]); got != uint32(36+len(pcm)) {
+		t.Fatalf("unexpected RIFF chunk size: %d", got)
+	}
+	if got := binary.LittleEndian.Uint32(wav[24:28]); got != 24000 {
+		t.Fatalf("unexpected sample rate: %d", got)
+	}
+	if got := binary.LittleEndian.Uint32(wav[28:32]); got != 48000 {
+		t.Fatalf("unexpected byte rate: %d", got)
+	}
+	if got := binary.LittleEndian.Uint32(wav[40:44]); got != uint32(len(pcm)) {
+		t.Fatalf("unexpected data chunk size: %d", got)
+	}
+}
+
+func TestWrapPCMAsWav_NoDoubleWrap(t *testing.T) {
+	wav := WrapPCMAsWav(make([]byte, 100), 24000, 1, 16)
+	again := WrapPCMAsWav(wav, 24000, 1, 16)
+	if len(again) != len(wav) {
+		t.Fatalf("expected existing WAV to be returned as-is, got %d bytes", len(again))
+	}
+}
+
+func TestParseSampleRate(t *testing.T) {
+	if got := parseSampleRate("audio/L16;codec=pcm;rate=24000"); got != 24000 {
+		t.Fatalf("expected 24000, got %d", got)
+	}
+	if got := parseSampleRate("audio/wav"); got != 0 {
+		t.Fatalf("expected 0 without rate, got %d", got)
+	}
+}
+
+func TestDetectScript(t *testing.T) {
+	cases := map[string]string{
+		"Hello there, how are you?": ScriptLatin,
+		"ありがとう、また明日ね":               ScriptJapanese,
+		"今天天氣很好，我們去散步吧":             ScriptHan,
+		"안녕하세요":                     ScriptHangul,
+		"":                          ScriptHan,
+	}
+	for text, expected := range cases {
+		if got := detectScript(text); got != expected {
+			t.Fatalf("detectScript(%q): expected %s, got %s", text, expected, got)
+		}
+	}
+}
+
+func TestTTSInstruction_PicksLanguage(t *testing.T) {
+	if got := ttsInstruction("Hello"); !strings.HasPrefix(got, "Read the following") {
+		t.Fatalf("expected English instruction, got %q", got)
+	}
+	if got := ttsInstruction("你好"); !strings.HasPrefix(got, "请用自然的语气") {
+		t.Fatalf("expected Chinese instruction, got %q", got)
+	}
+}
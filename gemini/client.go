@@ -10,9 +10,12 @@ import (
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"log"
 	"math"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -26,7 +29,37 @@ type Client struct {
 	imageModel  string
 	textModel   string
 	ttsModel    string
+	timeout     time.Duration
 	httpClient  *http.Client
+
+	// 送出前圖片最長邊上限，<= 0 代表不縮小
+	maxImageDimension int
+	// 圖片生成的 safetySettings 等級，空字串為 OFF
+	safetyLevel string
+	// 圖片生成時帶入的 systemInstruction，空字串代表不帶
+	systemInstruction string
+	// 圖片模型不存在時依序改用的備援模型
+	imageFallbacks []string
+	// 圖片生成時加在 Prompt 前後的文字，空字串代表不加
+	promptPrefix string
+	promptSuffix string
+
+	// RetryPolicy 控制暫時性網路/HTTP 錯誤的重試，零值代表不重試
+	RetryPolicy RetryPolicy
+}
+
+// RetryPolicy 指數退避 + 抖動的重試設定
+type RetryPolicy struct {
+	MaxAttempts int           // 含第一次的總嘗試次數
+	BaseDelay   time.Duration // 第一次重試前的等待時間
+	MaxDelay    time.Duration // 單次等待上限
+}
+
+// DefaultRetryPolicy 預設重試 3 次（含第一次），1s 起跳、上限 8s
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	MaxDelay:    8 * time.Second,
 }
 
 const (
@@ -40,6 +73,9 @@ const (
 	DefaultImageModel = "gemini-3-pro-image-preview"
 	DefaultTextModel  = "gemini-2.5-flash"
 	DefaultTTSModel   = "gemini-2.5-flash-preview-tts"
+
+	// DefaultTimeout 為 2K 畫質的基準逾時，其他畫質依比例縮放
+	DefaultTimeout = 120 * time.Second
 )
 
 type ServiceConfig struct {
@@ -50,21 +86,46 @@ type ServiceConfig struct {
 	ProjectID string `json:"project_id,omitempty"`
 	Location  string `json:"location,omitempty"`
 	Model     string `json:"model,omitempty"`
+	// SystemInstruction 每次圖片生成都帶入的系統指示，例如「保持文字位置不變」
+	SystemInstruction string `json:"system_instruction,omitempty"`
+	// ExtractModel / TTSModel 擷取文字與語音使用的模型，空字串代表使用 DefaultTextModel / DefaultTTSModel
+	ExtractModel string `json:"extract_model,omitempty"`
+	TTSModel     string `json:"tts_model,omitempty"`
 }
 
 type ImageResult struct {
 	ImageData []byte
+	MimeType  string // 回應 inlineData.mimeType，未提供時為 image/png
 	Text      string
+	Model     string // 實際產生結果的模型
+	Fallback  bool   // 主要模型無法使用，由備援模型產生
+}
+
+// FileExt 依 MimeType 回傳檔案副檔名（含點），未知格式一律視為 PNG
+func (r *ImageResult) FileExt() string {
+	switch strings.ToLower(strings.TrimSpace(strings.SplitN(r.MimeType, ";", 2)[0])) {
+	case "image/jpeg", "image/jpg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	default:
+		return ".png"
+	}
 }
 
 type TTSResult struct {
-	AudioData []byte
+	AudioData  []byte
+	SampleRate int // 從回應的 mimeType 解析，0 代表未知
 }
 
 type ImageInfo struct {
-	Width       int
-	Height      int
-	AspectRatio string // 匹配的比例，如 "16:9"
+	Width        int
+	Height       int
+	AspectRatio  string  // 匹配的比例，如 "16:9"
+	RawRatio     float64 // 實際寬高比（寬 / 高）
+	RawRatioText string  // 實際比例的顯示文字，如 "10:1"、"1:2.18"
 }
 
 // 支援的比例列表
@@ -92,9 +153,11 @@ func NewClient(apiKey string) *Client {
 		imageModel:  DefaultImageModel,
 		textModel:   DefaultTextModel,
 		ttsModel:    DefaultTTSModel,
-		httpClient: &http.Client{
-			Timeout: 120 * time.Second,
-		},
+		timeout:     DefaultTimeout,
+		httpClient:  &http.Client{},
+		RetryPolicy: DefaultRetryPolicy,
+
+		maxImageDimension: DefaultMaxImageDimension,
 	}
 }
 
@@ -113,6 +176,14 @@ func NewClientWithService(service ServiceConfig) *Client {
 	if model == "" {
 		model = DefaultImageModel
 	}
+	textModel := strings.TrimSpace(service.ExtractModel)
+	if textModel == "" {
+		textModel = DefaultTextModel
+	}
+	ttsModel := strings.TrimSpace(service.TTSModel)
+	if ttsModel == "" {
+		ttsModel = DefaultTTSModel
+	}
 
 	return &Client{
 		apiKey:      service.APIKey,
@@ -121,16 +192,85 @@ func NewClientWithService(service ServiceConfig) *Client {
 		projectID:   strings.TrimSpace(service.ProjectID),
 		location:    strings.TrimSpace(service.Location),
 		imageModel:  model,
-		textModel:   DefaultTextModel,
-		ttsModel:    DefaultTTSModel,
-		httpClient: &http.Client{
-			Timeout: 120 * time.Second,
-		},
+		textModel:   textModel,
+		ttsModel:    ttsModel,
+		timeout:     DefaultTimeout,
+		httpClient:  &http.Client{},
+		RetryPolicy: DefaultRetryPolicy,
+
+		maxImageDimension: DefaultMaxImageDimension,
+		systemInstruction: strings.TrimSpace(service.SystemInstruction),
 	}
 }
 
+// SetTimeout 設定基準逾時（對應 2K 畫質），<= 0 時使用預設值
+func (c *Client) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	c.timeout = timeout
+}
+
+// SetMaxImageDimension 設定送出前圖片最長邊上限，<= 0 代表不縮小
+func (c *Client) SetMaxImageDimension(maxDim int) {
+	c.maxImageDimension = maxDim
+}
+
+// SetSafetyLevel 設定圖片生成的安全等級（OFF/LOW/MEDIUM/HIGH），未知等級視為 OFF
+func (c *Client) SetSafetyLevel(level string) {
+	c.safetyLevel = level
+}
+
+// SetImageModelFallbacks 設定圖片模型不存在（404）時依序改用的備援模型
+func (c *Client) SetImageModelFallbacks(models []string) {
+	c.imageFallbacks = models
+}
+
+// SetPromptAffixes 設定圖片生成時加在 Prompt 前後的文字
+func (c *Client) SetPromptAffixes(prefix, suffix string) {
+	c.promptPrefix = prefix
+	c.promptSuffix = suffix
+}
+
+// SetTransport 替換底層 HTTP transport，方便測試時導向 httptest.Server 或注入 mock
+func (c *Client) SetTransport(transport http.RoundTripper) {
+	c.httpClient.Transport = transport
+}
+
+// requestTimeout 依畫質縮放基準逾時：1K 為一半、2K 為基準、4K 為兩倍
+func (c *Client) requestTimeout(quality string) time.Duration {
+	base := c.timeout
+	if base <= 0 {
+		base = DefaultTimeout
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(quality)) {
+	case "1K":
+		return base / 2
+	case "4K":
+		return base * 2
+	default:
+		return base
+	}
+}
+
+// textTimeout 文字擷取、TTS、改寫與翻譯不產生圖片，使用基準逾時的一半
+func (c *Client) textTimeout() time.Duration {
+	base := c.timeout
+	if base <= 0 {
+		base = DefaultTimeout
+	}
+	return base / 2
+}
+
 // GetImageInfo 取得圖片資訊並計算最接近的支援比例
 func GetImageInfo(imageData []byte) (*ImageInfo, error) {
+	return GetImageInfoWithTolerance(imageData, 0)
+}
+
+// GetImageInfoWithTolerance 同 GetImageInfo，但實際比例與最接近的支援比例相差超過 tolerance
+// （相對誤差，0.2 代表 20%）時 AspectRatio 留空，交給模型依輸入圖片決定；tolerance <= 0 時一律使用最接近的比例
+func GetImageInfoWithTolerance(imageData []byte, tolerance float64) (*ImageInfo, error) {
 	reader := bytes.NewReader(imageData)
 	config, _, err := image.DecodeConfig(reader)
 	if err != nil {
@@ -141,30 +281,60 @@ func GetImageInfo(imageData []byte) (*ImageInfo, error) {
 		Width:  config.Width,
 		Height: config.Height,
 	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return info, nil
+	}
 
 	// 計算實際比例
 	actualRatio := float64(config.Width) / float64(config.Height)
+	info.RawRatio = actualRatio
+	info.RawRatioText = FormatRatio(config.Width, config.Height)
 
 	// 找最接近的支援比例
 	minDiff := math.MaxFloat64
 	matchedRatio := ""
+	matchedValue := 0.0
 
 	for _, r := range supportedRatios {
 		diff := math.Abs(actualRatio - r.Ratio)
 		if diff < minDiff {
 			minDiff = diff
 			matchedRatio = r.Name
+			matchedValue = r.Ratio
 		}
 	}
 
-	// 一律使用最接近的支援比例
+	// 差距太大時硬套比例會讓輸出變形，不如不指定
+	if tolerance > 0 && minDiff/matchedValue > tolerance {
+		return info, nil
+	}
+
 	info.AspectRatio = matchedRatio
 
 	return info, nil
 }
 
+// FormatRatio 將寬高化為顯示用比例：能約分成小整數時顯示 "5:3"，否則顯示 "2.18:1" 或 "1:2.18"
+func FormatRatio(width, height int) string {
+	if width <= 0 || height <= 0 {
+		return ""
+	}
+	a, b := width, height
+	for b != 0 {
+		a, b = b, a%b
+	}
+	if w, h := width/a, height/a; w <= 32 && h <= 32 {
+		return fmt.Sprintf("%d:%d", w, h)
+	}
+	if width >= height {
+		return strconv.FormatFloat(float64(width)/float64(height), 'f', 2, 64) + ":1"
+	}
+	return "1:" + strconv.FormatFloat(float64(height)/float64(width), 'f', 2, 64)
+}
+
 // GenerateImage 生成翻譯後的漫畫圖片
 func (c *Client) GenerateImage(ctx context.Context, imageData []byte, mimeType, prompt, quality, aspectRatio string) (*ImageResult, error) {
+	imageData, mimeType = c.prepareImage(imageData, mimeType)
 	imageBase64 := base64.StdEncoding.EncodeToString(imageData)
 
 	// 建立 imageConfig
@@ -182,7 +352,7 @@ func (c *Client) GenerateImage(ctx context.Context, imageData []byte, mimeType,
 			{
 				"role": "user",
 				"parts": []map[string]interface{}{
-					{"text": prompt},
+					{"text": c.WrapPrompt(prompt)},
 					{
 						"inline_data": map[string]string{
 							"mime_type": mimeType,
@@ -192,85 +362,16 @@ func (c *Client) GenerateImage(ctx context.Context, imageData []byte, mimeType,
 				},
 			},
 		},
-		"generationConfig": map[string]interface{}{
-			"responseModalities": []string{"IMAGE"},
-			"imageConfig":        imageConfig,
-		},
-		"safetySettings": []map[string]interface{}{
-			{"category": "HARM_CATEGORY_HATE_SPEECH", "threshold": "OFF"},
-			{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "OFF"},
-			{"category": "HARM_CATEGORY_SEXUALLY_EXPLICIT", "threshold": "OFF"},
-			{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "threshold": "OFF"},
-		},
-	}
-
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, err
-	}
-
-	url, err := c.buildGenerateURL(c.imageModel)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+		"generationConfig": imageGenerationConfig(imageConfig, GenerationOptions{}),
+		"safetySettings":   safetySettings(c.safetyLevel),
 	}
-	defer resp.Body.Close()
+	c.addSystemInstruction(requestBody)
 
-	body, err := io.ReadAll(resp.Body)
+	images, err := c.sendImageRequest(ctx, c.imageModel, true, c.requestTimeout(quality), requestBody)
 	if err != nil {
 		return nil, err
 	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("API error: %s", string(body))
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	// 解析回應取得圖片
-	candidates, ok := result["candidates"].([]interface{})
-	if !ok || len(candidates) == 0 {
-		return nil, fmt.Errorf("no candidates in response")
-	}
-
-	candidate := candidates[0].(map[string]interface{})
-	content, ok := candidate["content"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("no content in candidate")
-	}
-
-	parts, ok := content["parts"].([]interface{})
-	if !ok || len(parts) == 0 {
-		return nil, fmt.Errorf("no parts in content")
-	}
-
-	for _, part := range parts {
-		partMap := part.(map[string]interface{})
-		if inlineData, ok := partMap["inlineData"].(map[string]interface{}); ok {
-			if dataStr, ok := inlineData["data"].(string); ok {
-				imageBytes, err := base64.StdEncoding.DecodeString(dataStr)
-				if err != nil {
-					return nil, err
-				}
-				return &ImageResult{ImageData: imageBytes}, nil
-			}
-		}
-	}
-
-	return nil, fmt.Errorf("no image data in response")
+	return images[0], nil
 }
 
 // DownloadedImage 下載的圖片資料
@@ -279,20 +380,23 @@ type DownloadedImage struct {
 	MimeType string
 }
 
-// GenerateImageWithContext 使用多張圖片作為上下文生成圖片
-func (c *Client) GenerateImageWithContext(ctx context.Context, images []DownloadedImage, prompt, quality, aspectRatio string) (*ImageResult, error) {
+// GenerateImageWithContext 使用多張圖片作為上下文生成圖片，opts.CandidateCount > 1 時回傳多個候選結果
+func (c *Client) GenerateImageWithContext(ctx context.Context, images []DownloadedImage, prompt, quality, aspectRatio string, opts GenerationOptions) ([]*ImageResult, error) {
+	ctx = withDebugDump(ctx, opts.Debug)
+
 	// 建立 parts
 	var parts []map[string]interface{}
 
 	// 先加入文字 prompt
-	parts = append(parts, map[string]interface{}{"text": prompt})
+	parts = append(parts, map[string]interface{}{"text": c.WrapPrompt(prompt)})
 
 	// 加入所有圖片
 	for _, img := range images {
-		imageBase64 := base64.StdEncoding.EncodeToString(img.Data)
+		data, mimeType := c.prepareImage(img.Data, img.MimeType)
+		imageBase64 := base64.StdEncoding.EncodeToString(data)
 		parts = append(parts, map[string]interface{}{
 			"inline_data": map[string]string{
-				"mime_type": img.MimeType,
+				"mime_type": mimeType,
 				"data":      imageBase64,
 			},
 		})
@@ -315,23 +419,18 @@ func (c *Client) GenerateImageWithContext(ctx context.Context, images []Download
 				"parts": parts,
 			},
 		},
-		"generationConfig": map[string]interface{}{
-			"responseModalities": []string{"IMAGE"},
-			"imageConfig":        imageConfig,
-		},
-		"safetySettings": []map[string]interface{}{
-			{"category": "HARM_CATEGORY_HATE_SPEECH", "threshold": "OFF"},
-			{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "OFF"},
-			{"category": "HARM_CATEGORY_SEXUALLY_EXPLICIT", "threshold": "OFF"},
-			{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "threshold": "OFF"},
-		},
+		"generationConfig": imageGenerationConfig(imageConfig, opts),
+		"safetySettings":   safetySettings(c.safetyLevel),
 	}
+	c.addSystemInstruction(requestBody)
 
-	return c.sendImageRequest(ctx, requestBody)
+	return c.sendImageRequest(ctx, ResolveImageModel(opts.Model, c.imageModel), strings.TrimSpace(opts.Model) == "", c.requestTimeout(quality), requestBody)
 }
 
-// GenerateImageFromText 純文字生成圖片
-func (c *Client) GenerateImageFromText(ctx context.Context, prompt, quality, aspectRatio string) (*ImageResult, error) {
+// GenerateImageFromText 純文字生成圖片，opts.CandidateCount > 1 時回傳多個候選結果
+func (c *Client) GenerateImageFromText(ctx context.Context, prompt, quality, aspectRatio string, opts GenerationOptions) ([]*ImageResult, error) {
+	ctx = withDebugDump(ctx, opts.Debug)
+
 	// 建立 imageConfig
 	imageConfig := map[string]interface{}{
 		"imageSize": quality,
@@ -347,56 +446,136 @@ func (c *Client) GenerateImageFromText(ctx context.Context, prompt, quality, asp
 			{
 				"role": "user",
 				"parts": []map[string]interface{}{
-					{"text": prompt},
+					{"text": c.WrapPrompt(prompt)},
 				},
 			},
 		},
-		"generationConfig": map[string]interface{}{
-			"responseModalities": []string{"IMAGE"},
-			"imageConfig":        imageConfig,
-		},
-		"safetySettings": []map[string]interface{}{
-			{"category": "HARM_CATEGORY_HATE_SPEECH", "threshold": "OFF"},
-			{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "OFF"},
-			{"category": "HARM_CATEGORY_SEXUALLY_EXPLICIT", "threshold": "OFF"},
-			{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "threshold": "OFF"},
+		"generationConfig": imageGenerationConfig(imageConfig, opts),
+		"safetySettings":   safetySettings(c.safetyLevel),
+	}
+	c.addSystemInstruction(requestBody)
+
+	return c.sendImageRequest(ctx, ResolveImageModel(opts.Model, c.imageModel), strings.TrimSpace(opts.Model) == "", c.requestTimeout(quality), requestBody)
+}
+
+// SystemInstruction 服務設定的系統指示
+func (c *Client) SystemInstruction() string {
+	return c.systemInstruction
+}
+
+// WrapPrompt 在圖片生成的 Prompt 前後加上全域設定的前綴與後綴，以空行分隔
+func (c *Client) WrapPrompt(prompt string) string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{c.promptPrefix, prompt, c.promptSuffix} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// addSystemInstruction 服務設定了系統指示時加入 systemInstruction 欄位
+func (c *Client) addSystemInstruction(requestBody map[string]interface{}) {
+	if c.systemInstruction == "" {
+		return
+	}
+	requestBody["systemInstruction"] = map[string]interface{}{
+		"parts": []map[string]interface{}{
+			{"text": c.systemInstruction},
 		},
 	}
+}
 
-	return c.sendImageRequest(ctx, requestBody)
+// GenerationOptions 單次圖片生成的 generationConfig 覆寫，零值代表沿用模型預設
+type GenerationOptions struct {
+	CandidateCount int        // > 1 時要求多個候選結果
+	Temperature    *float64   // 0–2，越高越有創意
+	Seed           *int64     // 固定種子以重現結果（模型不一定支援）
+	Debug          *DebugDump // 非 nil 時記錄這次生成的請求與回應（@debug）
+	Model          string     // @model 指定的模型，空字串代表沿用服務設定
 }
 
-// sendImageRequest 發送圖片生成請求的共用函式
-func (c *Client) sendImageRequest(ctx context.Context, requestBody map[string]interface{}) (*ImageResult, error) {
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, err
+// imageGenerationConfig 建立圖片生成的 generationConfig，只帶入有指定的覆寫欄位
+func imageGenerationConfig(imageConfig map[string]interface{}, opts GenerationOptions) map[string]interface{} {
+	config := map[string]interface{}{
+		"responseModalities": []string{"IMAGE"},
+		"imageConfig":        imageConfig,
+	}
+	if opts.CandidateCount > 1 {
+		config["candidateCount"] = opts.CandidateCount
+	}
+	if opts.Temperature != nil {
+		config["temperature"] = *opts.Temperature
+	}
+	if opts.Seed != nil {
+		config["seed"] = *opts.Seed
 	}
+	return config
+}
 
-	url, err := c.buildGenerateURL(c.imageModel)
-	if err != nil {
-		return nil, err
+// ResolveImageModel 決定圖片模型：單次請求的 @model > 服務設定的模型 > DefaultImageModel
+func ResolveImageModel(requestModel, serviceModel string) string {
+	if model := strings.TrimSpace(requestModel); model != "" {
+		return model
 	}
+	if model := strings.TrimSpace(serviceModel); model != "" {
+		return model
+	}
+	return DefaultImageModel
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+// sendImageRequest 發送圖片生成請求的共用函式；模型不存在時依序改用備援模型，
+// allowFallback 為 false（使用者以 @model 指定模型）時直接回傳錯誤；timeout 為每次嘗試的逾時
+func (c *Client) sendImageRequest(ctx context.Context, model string, allowFallback bool, timeout time.Duration, requestBody map[string]interface{}) ([]*ImageResult, error) {
+	tried := map[string]bool{model: true}
+	images, err := c.sendImageRequestWithModel(ctx, model, timeout, requestBody)
+	fallback := false
+	var fallbacks []string
+	if allowFallback {
+		fallbacks = c.imageFallbacks
+	}
+	for _, next := range fallbacks {
+		if err == nil || !IsModelNotFound(err) {
+			break
+		}
+		if tried[next] {
+			continue
+		}
+		tried[next] = true
+		log.Printf("圖片模型 %s 無法使用，改用備援模型 %s", model, next)
+		model = next
+		fallback = true
+		images, err = c.sendImageRequestWithModel(ctx, model, timeout, requestBody)
+	}
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	if fallback {
+		log.Printf("圖片由備援模型 %s 生成", model)
+	}
+	for _, image := range images {
+		image.Model = model
+		image.Fallback = fallback
+	}
+	return images, nil
+}
+
+// sendImageRequestWithModel 以指定模型送出一次圖片生成請求
+func (c *Client) sendImageRequestWithModel(ctx context.Context, model string, timeout time.Duration, requestBody map[string]interface{}) ([]*ImageResult, error) {
+	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	url, err := c.buildGenerateURL(model)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("API error: %s", string(body))
+	body, err := c.doWithRetry(ctx, url, jsonBody, timeout)
+	if err != nil {
+		return nil, err
 	}
 
 	var result map[string]interface{}
@@ -404,13 +583,45 @@ func (c *Client) sendImageRequest(ctx context.Context, requestBody map[string]in
 		return nil, err
 	}
 
-	// 解析回應取得圖片
+	return parseImageCandidates(result)
+}
+
+// parseImageCandidates 取出每個候選結果的圖片；部分候選沒有圖片時略過，全部失敗才回傳第一個錯誤
+func parseImageCandidates(result map[string]interface{}) ([]*ImageResult, error) {
 	candidates, ok := result["candidates"].([]interface{})
 	if !ok || len(candidates) == 0 {
+		if err := promptBlockError(result); err != nil {
+			return nil, err
+		}
 		return nil, fmt.Errorf("no candidates in response")
 	}
 
-	candidate := candidates[0].(map[string]interface{})
+	var images []*ImageResult
+	var firstErr error
+	for _, raw := range candidates {
+		image, err := parseImageCandidate(raw)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		images = append(images, image)
+	}
+	if len(images) == 0 {
+		return nil, firstErr
+	}
+	return images, nil
+}
+
+func parseImageCandidate(raw interface{}) (*ImageResult, error) {
+	candidate, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid candidate in response")
+	}
+	if reason, _ := candidate["finishReason"].(string); safetyFinishReasons[reason] {
+		return nil, &SafetyBlockError{Reason: reason, Categories: blockedCategories(candidate["safetyRatings"])}
+	}
 	content, ok := candidate["content"].(map[string]interface{})
 	if !ok {
 		return nil, fmt.Errorf("no content in candidate")
@@ -421,24 +632,57 @@ func (c *Client) sendImageRequest(ctx context.Context, requestBody map[string]in
 		return nil, fmt.Errorf("no parts in content")
 	}
 
+	return parseImageParts(parts)
+}
+
+// parseImageParts 從 parts 取出圖片，並收集 Gemini 附帶的文字說明
+// 沒有圖片但有文字時（例如拒絕生成），把文字放進錯誤讓使用者看到原因
+func parseImageParts(parts []interface{}) (*ImageResult, error) {
+	var imageBytes []byte
+	var mimeType string
+	var texts []string
+
 	for _, part := range parts {
-		partMap := part.(map[string]interface{})
+		partMap, ok := part.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if text, ok := partMap["text"].(string); ok && strings.TrimSpace(text) != "" {
+			texts = append(texts, strings.TrimSpace(text))
+			continue
+		}
+		if imageBytes != nil {
+			continue
+		}
 		if inlineData, ok := partMap["inlineData"].(map[string]interface{}); ok {
 			if dataStr, ok := inlineData["data"].(string); ok {
-				imageBytes, err := base64.StdEncoding.DecodeString(dataStr)
+				decoded, err := base64.StdEncoding.DecodeString(dataStr)
 				if err != nil {
 					return nil, err
 				}
-				return &ImageResult{ImageData: imageBytes}, nil
+				imageBytes = decoded
+				mimeType, _ = inlineData["mimeType"].(string)
 			}
 		}
 	}
 
-	return nil, fmt.Errorf("no image data in response")
+	text := strings.Join(texts, "\n")
+	if imageBytes == nil {
+		if text != "" {
+			return nil, fmt.Errorf("no image data in response: %s", text)
+		}
+		return nil, fmt.Errorf("no image data in response")
+	}
+
+	if mimeType == "" {
+		mimeType = "image/png"
+	}
+	return &ImageResult{ImageData: imageBytes, MimeType: mimeType, Text: text}, nil
 }
 
 // ExtractText 從圖片擷取文字
 func (c *Client) ExtractText(ctx context.Context, imageData []byte, mimeType, prompt string) (string, error) {
+	imageData, mimeType = c.prepareImage(imageData, mimeType)
 	imageBase64 := base64.StdEncoding.EncodeToString(imageData)
 
 	requestBody := map[string]interface{}{
@@ -458,35 +702,81 @@ func (c *Client) ExtractText(ctx context.Context, imageData []byte, mimeType, pr
 		},
 	}
 
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", err
+	return c.generateText(ctx, requestBody)
+}
+
+// EnhancePrompt 使用文字模型把簡短描述擴寫成詳細的圖片生成指令
+func (c *Client) EnhancePrompt(ctx context.Context, prompt string) (string, error) {
+	requestBody := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{
+				"role": "user",
+				"parts": []map[string]interface{}{
+					{"text": enhanceInstruction + "\n\n" + prompt},
+				},
+			},
+		},
 	}
 
-	url, err := c.buildGenerateURL(c.textModel)
+	text, err := c.generateText(ctx, requestBody)
 	if err != nil {
 		return "", err
 	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("empty enhanced prompt")
+	}
+	return text, nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+// TranslateText 使用文字模型把文字翻譯成指定語言
+func (c *Client) TranslateText(ctx context.Context, text, targetLang string) (string, error) {
+	requestBody := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{
+				"role": "user",
+				"parts": []map[string]interface{}{
+					{"text": fmt.Sprintf(translateInstruction, targetLang) + "\n\n" + text},
+				},
+			},
+		},
+	}
+
+	translated, err := c.generateText(ctx, requestBody)
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	translated = strings.TrimSpace(translated)
+	if translated == "" {
+		return "", fmt.Errorf("empty translation")
+	}
+	return translated, nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// translateInstruction 翻譯時給文字模型的指示，%s 為目標語言
+const translateInstruction = "Translate the following text into %s. " +
+	"Keep the line breaks and formatting, and reply with the translation only, without explanations or quotes."
+
+// enhanceInstruction 擴寫 Prompt 時給文字模型的指示
+const enhanceInstruction = "Rewrite the following image request into a single detailed image-generation instruction. " +
+	"Keep the original intent and any text that must appear in the image, and add concrete details about subject, composition, style, lighting and colors. " +
+	"Reply with the instruction only, in the same language as the request, without explanations or quotes."
+
+// generateText 以文字模型送出請求並回傳第一段文字
+func (c *Client) generateText(ctx context.Context, requestBody map[string]interface{}) (string, error) {
+	jsonBody, err := json.Marshal(requestBody)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	url, err := c.buildGenerateURL(c.textModel)
 	if err != nil {
 		return "", err
 	}
 
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("API error: %s", string(body))
+	body, err := c.doWithRetry(ctx, url, jsonBody, c.textTimeout())
+	if err != nil {
+		return "", err
 	}
 
 	var result map[string]interface{}
@@ -528,7 +818,7 @@ func (c *Client) GenerateTTS(ctx context.Context, text, voiceName string) (*TTSR
 			{
 				"role": "user",
 				"parts": []map[string]interface{}{
-					{"text": fmt.Sprintf("请用自然的语气朗读以下漫画对话内容：\n\n%s", text)},
+					{"text": ttsInstruction(text)},
 				},
 			},
 		},
@@ -554,27 +844,11 @@ func (c *Client) GenerateTTS(ctx context.Context, text, voiceName string) (*TTSR
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.doWithRetry(ctx, url, jsonBody, c.textTimeout())
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("API error: %s", string(body))
-	}
-
 	var result map[string]interface{}
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, err
@@ -605,7 +879,8 @@ func (c *Client) GenerateTTS(ctx context.Context, text, voiceName string) (*TTSR
 				if err != nil {
 					return nil, err
 				}
-				return &TTSResult{AudioData: audioBytes}, nil
+				mimeType, _ := inlineData["mimeType"].(string)
+				return &TTSResult{AudioData: audioBytes, SampleRate: parseSampleRate(mimeType)}, nil
 			}
 		}
 	}
@@ -613,6 +888,108 @@ func (c *Client) GenerateTTS(ctx context.Context, text, voiceName string) (*TTSR
 	return nil, fmt.Errorf("no audio data in response")
 }
 
+// doWithRetry 發送 POST 請求，遇到暫時性錯誤時依 RetryPolicy 退避重試，成功時回傳 body；
+// 每次嘗試各自有 timeout 的時限，第一次卡住逾時後重試仍有完整的時間
+func (c *Client) doWithRetry(ctx context.Context, url string, jsonBody []byte, timeout time.Duration) ([]byte, error) {
+	attempts := c.RetryPolicy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(c.RetryPolicy.backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, lastErr
+			case <-timer.C:
+			}
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		body, retryable, err := c.doOnce(attemptCtx, url, jsonBody)
+		cancel()
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if !retryable || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+
+	return nil, lastErr
+}
+
+// doOnce 發送單次請求，並回報錯誤是否值得重試
+func (c *Client) doOnce(ctx context.Context, url string, jsonBody []byte) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	dump := debugDumpFrom(ctx)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if dump != nil {
+			dump.record(url, jsonBody, nil, nil, err)
+		}
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if dump != nil {
+		dump.record(url, jsonBody, resp, body, err)
+	}
+	if err != nil {
+		return nil, true, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, isRetryableStatus(resp.StatusCode), &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return body, false, nil
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff 回傳第 n 次重試前的等待時間：指數成長並在 [d/2, d] 之間抖動
+func (p RetryPolicy) backoff(n int) time.Duration {
+	delay := p.BaseDelay
+	if delay <= 0 {
+		return 0
+	}
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			delay = p.MaxDelay
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
 func normalizeServiceType(serviceType string) string {
 	normalized := strings.ToLower(strings.TrimSpace(serviceType))
 	switch normalized {
@@ -2,10 +2,17 @@ package gemini
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"image"
 	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestBuildGenerateURL_Standard(t *testing.T) {
@@ -74,6 +81,49 @@ func TestBuildGenerateURL_VertexExpressMode(t *testing.T) {
 	}
 }
 
+func TestExtractTextAndTTS_UseServiceEndpoint(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery)
+		if strings.Contains(r.URL.Path, DefaultTTSModel) {
+			w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"mimeType":"audio/L16;rate=24000","data":"AAAA"}}]}}]}`))
+			return
+		}
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hello"}]}}]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		config ServiceConfig
+		prefix string
+	}{
+		{"standard", ServiceConfig{Type: ServiceTypeStandard, APIKey: "abc123", BaseURL: server.URL}, "/v1beta/models/"},
+		{"custom", ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL}, "/v1beta/models/"},
+		{"vertex express", ServiceConfig{Type: ServiceTypeVertex, APIKey: "abc123", BaseURL: server.URL}, "/v1/publishers/google/models/"},
+		{"vertex", ServiceConfig{Type: ServiceTypeVertex, APIKey: "abc123", BaseURL: server.URL, ProjectID: "proj", Location: "asia-east1"},
+			"/v1/projects/proj/locations/asia-east1/publishers/google/models/"},
+	}
+	for _, tt := range tests {
+		requests = nil
+		client := NewClientWithService(tt.config)
+		if _, err := client.ExtractText(context.Background(), []byte("img"), "image/png", "read"); err != nil {
+			t.Fatalf("%s: ExtractText failed: %v", tt.name, err)
+		}
+		if _, err := client.GenerateTTS(context.Background(), "hello", "Kore"); err != nil {
+			t.Fatalf("%s: GenerateTTS failed: %v", tt.name, err)
+		}
+
+		want := []string{
+			tt.prefix + DefaultTextModel + ":generateContent?key=abc123",
+			tt.prefix + DefaultTTSModel + ":generateContent?key=abc123",
+		}
+		if len(requests) != len(want) || requests[0] != want[0] || requests[1] != want[1] {
+			t.Fatalf("%s: expected requests %v, got %v", tt.name, want, requests)
+		}
+	}
+}
+
 func TestGetImageInfo_AlwaysReturnNearestRatio(t *testing.T) {
 	buffer := &bytes.Buffer{}
 	if err := png.Encode(buffer, image.NewRGBA(image.Rect(0, 0, 1000, 100))); err != nil {
@@ -88,3 +138,704 @@ func TestGetImageInfo_AlwaysReturnNearestRatio(t *testing.T) {
 		t.Fatalf("expected nearest ratio, got empty")
 	}
 }
+
+func TestGetImageInfoWithTolerance_DoesNotSnapOutliers(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, image.NewRGBA(image.Rect(0, 0, 1000, 100))); err != nil {
+		t.Fatalf("encode png failed: %v", err)
+	}
+
+	info, err := GetImageInfoWithTolerance(buffer.Bytes(), 0.2)
+	if err != nil {
+		t.Fatalf("GetImageInfoWithTolerance failed: %v", err)
+	}
+	if info.AspectRatio != "" {
+		t.Fatalf("expected 10:1 strip to be left unsnapped, got %s", info.AspectRatio)
+	}
+	if info.Width != 1000 || info.Height != 100 {
+		t.Fatalf("unexpected size %dx%d", info.Width, info.Height)
+	}
+	if info.RawRatio != 10 || info.RawRatioText != "10:1" {
+		t.Fatalf("unexpected raw ratio %v / %q", info.RawRatio, info.RawRatioText)
+	}
+}
+
+func TestFormatRatio(t *testing.T) {
+	cases := []struct {
+		w, h int
+		want string
+	}{
+		{1920, 1080, "16:9"},
+		{1000, 600, "5:3"},
+		{1000, 100, "10:1"},
+		{1234, 567, "2.18:1"},
+		{567, 1234, "1:2.18"},
+		{0, 10, ""},
+	}
+	for _, c := range cases {
+		if got := FormatRatio(c.w, c.h); got != c.want {
+			t.Fatalf("FormatRatio(%d, %d) = %q, want %q", c.w, c.h, got, c.want)
+		}
+	}
+}
+
+func TestGetImageInfoWithTolerance_SnapsWithinTolerance(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, image.NewRGBA(image.Rect(0, 0, 1000, 600))); err != nil {
+		t.Fatalf("encode png failed: %v", err)
+	}
+
+	// 1.667 與 16:9（1.778）相差約 6%
+	info, err := GetImageInfoWithTolerance(buffer.Bytes(), 0.1)
+	if err != nil {
+		t.Fatalf("GetImageInfoWithTolerance failed: %v", err)
+	}
+	if info.AspectRatio != "16:9" {
+		t.Fatalf("expected 16:9, got %q", info.AspectRatio)
+	}
+}
+
+func TestRequestTimeout_ScalesByQuality(t *testing.T) {
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeStandard, APIKey: "abc123"})
+	client.SetTimeout(120 * time.Second)
+
+	cases := map[string]time.Duration{
+		"1K": 60 * time.Second,
+		"2K": 120 * time.Second,
+		"4K": 240 * time.Second,
+		"":   120 * time.Second,
+	}
+	for quality, expected := range cases {
+		if got := client.requestTimeout(quality); got != expected {
+			t.Fatalf("quality %q: expected %s, got %s", quality, expected, got)
+		}
+	}
+
+	if got := client.textTimeout(); got != 60*time.Second {
+		t.Fatalf("text timeout: expected 60s, got %s", got)
+	}
+}
+
+func TestRequestTimeout_RespectsParentDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.GenerateImageFromText(ctx, "cat", "4K", "1:1", GenerationOptions{}); err == nil {
+		t.Fatalf("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("parent deadline not respected, took %s", elapsed)
+	}
+}
+
+func TestDoWithRetry_EachAttemptHasItsOwnTimeout(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// 第一次卡住直到用戶端逾時
+			<-release
+			return
+		}
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"mimeType":"image/png","data":"aGVsbG8="}}]}}]}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	client.SetTimeout(200 * time.Millisecond)
+	client.RetryPolicy = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+
+	if _, err := client.GenerateImageFromText(context.Background(), "cat", "1K", "1:1", GenerationOptions{}); err != nil {
+		t.Fatalf("expected retry after a hung attempt to succeed, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected 2 attempts, got %d", got)
+	}
+}
+
+func TestDoWithRetry_RecoversFromTransientFailures(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"overloaded"}`))
+			return
+		}
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"mimeType":"image/png","data":"aGVsbG8="}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	client.RetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	result, err := client.GenerateImageFromText(context.Background(), "cat", "1K", "1:1", GenerationOptions{})
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if len(result) != 1 || string(result[0].ImageData) != "hello" {
+		t.Fatalf("unexpected results: %+v", result)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 calls, got %d", got)
+	}
+}
+
+func TestDoWithRetry_DoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"bad request"}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	client.RetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	if _, err := client.GenerateImageFromText(context.Background(), "cat", "1K", "1:1", GenerationOptions{}); err == nil {
+		t.Fatalf("expected error")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected 1 call, got %d", got)
+	}
+}
+
+func TestRetryPolicyBackoff_CappedWithJitter(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 400 * time.Millisecond}
+	for n := 1; n <= 5; n++ {
+		delay := policy.backoff(n)
+		if delay < 50*time.Millisecond || delay > 400*time.Millisecond {
+			t.Fatalf("backoff(%d) out of range: %s", n, delay)
+		}
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newStubClient(t *testing.T, status int, body string) *Client {
+	t.Helper()
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeStandard, APIKey: "abc123"})
+	client.RetryPolicy = RetryPolicy{MaxAttempts: 1}
+	client.SetTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}))
+	return client
+}
+
+func TestGenerateImage_ParsesInlineData(t *testing.T) {
+	client := newStubClient(t, http.StatusOK, `{"candidates":[{"content":{"parts":[{"text":"ok"},{"inlineData":{"mimeType":"image/png","data":"aGVsbG8="}}]}}]}`)
+
+	result, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", "1:1")
+	if err != nil {
+		t.Fatalf("GenerateImage failed: %v", err)
+	}
+	if string(result.ImageData) != "hello" {
+		t.Fatalf("unexpected image data: %q", result.ImageData)
+	}
+}
+
+func TestGenerateImage_ParsesMimeType(t *testing.T) {
+	client := newStubClient(t, http.StatusOK, `{"candidates":[{"content":{"parts":[{"inlineData":{"mimeType":"image/jpeg","data":"aGVsbG8="}}]}}]}`)
+
+	result, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", "1:1")
+	if err != nil {
+		t.Fatalf("GenerateImage failed: %v", err)
+	}
+	if result.MimeType != "image/jpeg" {
+		t.Fatalf("MimeType = %q, want image/jpeg", result.MimeType)
+	}
+	if ext := result.FileExt(); ext != ".jpg" {
+		t.Fatalf("FileExt = %q, want .jpg", ext)
+	}
+}
+
+func TestGenerateImage_DefaultsMimeTypeToPNG(t *testing.T) {
+	client := newStubClient(t, http.StatusOK, `{"candidates":[{"content":{"parts":[{"inlineData":{"data":"aGVsbG8="}}]}}]}`)
+
+	result, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", "1:1")
+	if err != nil {
+		t.Fatalf("GenerateImage failed: %v", err)
+	}
+	if result.MimeType != "image/png" || result.FileExt() != ".png" {
+		t.Fatalf("unexpected MimeType %q / ext %q", result.MimeType, result.FileExt())
+	}
+}
+
+func TestGenerateImage_NoImageData(t *testing.T) {
+	client := newStubClient(t, http.StatusOK, `{"candidates":[{"content":{"parts":[{"text":"sorry"}]}}]}`)
+
+	_, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", "1:1")
+	if err == nil || !strings.Contains(err.Error(), "no image data") {
+		t.Fatalf("expected no image data error, got %v", err)
+	}
+}
+
+func TestGenerateImage_ErrorStatus(t *testing.T) {
+	client := newStubClient(t, http.StatusBadRequest, `{"error":{"message":"invalid argument"}}`)
+
+	_, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", "1:1")
+	if err == nil || !strings.Contains(err.Error(), "invalid argument") {
+		t.Fatalf("expected API error with body, got %v", err)
+	}
+}
+
+func TestGenerateImage_HTTPTestServer(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"data":"aGVsbG8="}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeStandard, APIKey: "abc123", BaseURL: server.URL})
+	if _, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", ""); err != nil {
+		t.Fatalf("GenerateImage failed: %v", err)
+	}
+	if !strings.HasSuffix(gotPath, DefaultImageModel+":generateContent") {
+		t.Fatalf("unexpected request path: %s", gotPath)
+	}
+}
+
+func TestGenerateImage_CollectsTextAlongsideImage(t *testing.T) {
+	client := newStubClient(t, http.StatusOK, `{"candidates":[{"content":{"parts":[{"text":"已翻譯"},{"inlineData":{"data":"aGVsbG8="}}]}}]}`)
+
+	result, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", "1:1")
+	if err != nil {
+		t.Fatalf("GenerateImage failed: %v", err)
+	}
+	if result.Text != "已翻譯" {
+		t.Fatalf("expected text part to be collected, got %q", result.Text)
+	}
+}
+
+func TestGenerateImage_TextOnlySurfacesExplanation(t *testing.T) {
+	client := newStubClient(t, http.StatusOK, `{"candidates":[{"content":{"parts":[{"text":"I can't help with that."}]}}]}`)
+
+	_, err := client.GenerateImageFromText(context.Background(), "cat", "2K", "1:1", GenerationOptions{})
+	if err == nil || !strings.Contains(err.Error(), "I can't help with that.") {
+		t.Fatalf("expected explanation in error, got %v", err)
+	}
+}
+
+func TestGenerateImage_ReturnsTypedAPIError(t *testing.T) {
+	client := newStubClient(t, http.StatusTooManyRequests, `{"error":{"message":"quota"}}`)
+
+	_, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", "1:1")
+	if !IsRateLimited(err) {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+	if IsResourceError(err) {
+		t.Fatalf("429 should not be treated as resource error")
+	}
+}
+
+func TestGenerateImage_ClassifiesInvalidImage(t *testing.T) {
+	client := newStubClient(t, http.StatusBadRequest, `{"error":{"code":400,"message":"Unable to process input image. Please retry or report in https://developers.generativeai.google/guide/troubleshooting","status":"INVALID_ARGUMENT"}}`)
+
+	_, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", "1:1")
+	if !IsInvalidImage(err) {
+		t.Fatalf("expected invalid image error, got %v", err)
+	}
+	if IsRateLimited(err) || IsAuthError(err) || IsResourceError(err) {
+		t.Fatalf("invalid image should not match other categories: %v", err)
+	}
+
+	if IsInvalidImage(&APIError{StatusCode: http.StatusBadRequest, Body: `{"error":{"message":"Invalid value at 'generation_config.temperature'"}}`}) {
+		t.Fatal("unrelated 400 should not be an invalid image")
+	}
+	if IsInvalidImage(&APIError{StatusCode: http.StatusBadRequest, Body: `{"error":{"message":"Invalid value at 'generation_config.image_config.aspect_ratio'"}}`}) {
+		t.Fatal("400 that merely mentions image should not be an invalid image")
+	}
+	if !IsInvalidImage(&APIError{StatusCode: http.StatusBadRequest, Body: `{"error":{"message":"Unsupported MIME type: image/heic"}}`}) {
+		t.Fatal("unsupported mime type should be an invalid image")
+	}
+	if !IsModelNotFound(&APIError{StatusCode: http.StatusNotFound, Body: "NOT_FOUND"}) || IsModelNotFound(err) {
+		t.Fatal("404 should be model not found, invalid image should not")
+	}
+	if !IsAuthError(&APIError{StatusCode: http.StatusForbidden, Body: "PERMISSION_DENIED"}) {
+		t.Fatal("403 should be an auth error")
+	}
+}
+
+func TestGenerateImageFromText_ParsesMultipleCandidates(t *testing.T) {
+	var requestBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		// 第二個候選沒有圖片，應被略過
+		w.Write([]byte(`{"candidates":[
+			{"content":{"parts":[{"inlineData":{"data":"b25l"}}]}},
+			{"content":{"parts":[{"text":"blocked"}]}},
+			{"content":{"parts":[{"text":"第三張"},{"inlineData":{"data":"dGhyZWU="}}]}}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	results, err := client.GenerateImageFromText(context.Background(), "cat", "1K", "1:1", GenerationOptions{CandidateCount: 3})
+	if err != nil {
+		t.Fatalf("GenerateImageFromText failed: %v", err)
+	}
+	if len(results) != 2 || string(results[0].ImageData) != "one" || string(results[1].ImageData) != "three" || results[1].Text != "第三張" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	generationConfig, _ := requestBody["generationConfig"].(map[string]interface{})
+	if generationConfig["candidateCount"] != float64(3) {
+		t.Fatalf("expected candidateCount 3, got %v", generationConfig["candidateCount"])
+	}
+}
+
+func TestImageGenerationConfig_OmitsUnsetOverrides(t *testing.T) {
+	config := imageGenerationConfig(map[string]interface{}{"imageSize": "2K"}, GenerationOptions{CandidateCount: 1})
+	for _, key := range []string{"candidateCount", "temperature", "seed"} {
+		if _, ok := config[key]; ok {
+			t.Fatalf("%s should be omitted when not set: %v", key, config)
+		}
+	}
+}
+
+func TestGenerateImageWithContext_SendsTemperatureAndSeed(t *testing.T) {
+	var requestBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"data":"aGVsbG8="}}]}}]}`))
+	}))
+	defer server.Close()
+
+	temperature, seed := 0.0, int64(42)
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	_, err := client.GenerateImageWithContext(context.Background(), []DownloadedImage{{Data: []byte("img"), MimeType: "image/png"}},
+		"translate", "2K", "1:1", GenerationOptions{Temperature: &temperature, Seed: &seed})
+	if err != nil {
+		t.Fatalf("GenerateImageWithContext failed: %v", err)
+	}
+
+	generationConfig, _ := requestBody["generationConfig"].(map[string]interface{})
+	// temperature 為 0 也要送出，代表使用者明確指定
+	if value, ok := generationConfig["temperature"]; !ok || value != float64(0) {
+		t.Fatalf("expected temperature 0, got %v", generationConfig)
+	}
+	if generationConfig["seed"] != float64(42) {
+		t.Fatalf("expected seed 42, got %v", generationConfig["seed"])
+	}
+}
+
+func TestGenerateImage_SendsSystemInstruction(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"data":"aGVsbG8="}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL, SystemInstruction: " always preserve text placement "})
+	images := []DownloadedImage{{Data: []byte("img"), MimeType: "image/png"}}
+	if _, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", "1:1"); err != nil {
+		t.Fatalf("GenerateImage failed: %v", err)
+	}
+	if _, err := client.GenerateImageWithContext(context.Background(), images, "translate", "2K", "1:1", GenerationOptions{}); err != nil {
+		t.Fatalf("GenerateImageWithContext failed: %v", err)
+	}
+	if _, err := client.GenerateImageFromText(context.Background(), "cat", "2K", "1:1", GenerationOptions{}); err != nil {
+		t.Fatalf("GenerateImageFromText failed: %v", err)
+	}
+
+	for i, body := range bodies {
+		instruction, _ := body["systemInstruction"].(map[string]interface{})
+		parts, _ := instruction["parts"].([]interface{})
+		if len(parts) != 1 {
+			t.Fatalf("request %d: expected systemInstruction parts, got %v", i, body["systemInstruction"])
+		}
+		if text := parts[0].(map[string]interface{})["text"]; text != "always preserve text placement" {
+			t.Fatalf("request %d: unexpected system instruction %v", i, text)
+		}
+		// 系統指示不應混進使用者的 contents
+		contents := body["contents"].([]interface{})
+		if len(contents) != 1 {
+			t.Fatalf("request %d: unexpected contents %v", i, contents)
+		}
+	}
+
+	// 未設定時不送出欄位
+	bodies = nil
+	plain := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	if _, err := plain.GenerateImageFromText(context.Background(), "cat", "2K", "1:1", GenerationOptions{}); err != nil {
+		t.Fatalf("GenerateImageFromText failed: %v", err)
+	}
+	if _, ok := bodies[0]["systemInstruction"]; ok {
+		t.Fatal("systemInstruction should be omitted when empty")
+	}
+}
+
+func TestGenerateImageWithContext_ModelPrecedence(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"data":"aGVsbG8="}}]}}]}`))
+	}))
+	defer server.Close()
+
+	images := []DownloadedImage{{Data: []byte("img"), MimeType: "image/png"}}
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL, Model: "service-model"})
+
+	// 沒有 @model 時使用服務設定的模型
+	if _, err := client.GenerateImageWithContext(context.Background(), images, "translate", "2K", "1:1", GenerationOptions{}); err != nil {
+		t.Fatalf("GenerateImageWithContext failed: %v", err)
+	}
+	// @model 優先於服務設定
+	if _, err := client.GenerateImageFromText(context.Background(), "draw", "2K", "1:1", GenerationOptions{Model: "request-model"}); err != nil {
+		t.Fatalf("GenerateImageFromText failed: %v", err)
+	}
+
+	want := []string{"/v1beta/models/service-model:generateContent", "/v1beta/models/request-model:generateContent"}
+	if len(paths) != len(want) {
+		t.Fatalf("expected %d requests, got %v", len(want), paths)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Fatalf("request %d path = %q, want %q", i, paths[i], want[i])
+		}
+	}
+}
+
+func TestResolveImageModel(t *testing.T) {
+	if got := ResolveImageModel("", ""); got != DefaultImageModel {
+		t.Fatalf("expected default model, got %q", got)
+	}
+	if got := ResolveImageModel(" ", "svc"); got != "svc" {
+		t.Fatalf("expected service model, got %q", got)
+	}
+	if got := ResolveImageModel("req", "svc"); got != "req" {
+		t.Fatalf("expected request model, got %q", got)
+	}
+}
+
+func TestEnhancePrompt_UsesTextModel(t *testing.T) {
+	var path string
+	var requestBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"  一隻橘色虎斑貓坐在窗邊，午後暖光，水彩風格 \n"}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	enhanced, err := client.EnhancePrompt(context.Background(), "窗邊的貓")
+	if err != nil {
+		t.Fatalf("EnhancePrompt failed: %v", err)
+	}
+	if enhanced != "一隻橘色虎斑貓坐在窗邊，午後暖光，水彩風格" {
+		t.Fatalf("unexpected enhanced prompt %q", enhanced)
+	}
+	if !strings.Contains(path, DefaultTextModel) {
+		t.Fatalf("expected text model in path, got %s", path)
+	}
+	contents := requestBody["contents"].([]interface{})
+	parts := contents[0].(map[string]interface{})["parts"].([]interface{})
+	if text, _ := parts[0].(map[string]interface{})["text"].(string); !strings.HasSuffix(text, "窗邊的貓") {
+		t.Fatalf("expected original prompt in request, got %q", text)
+	}
+}
+
+func TestEnhancePrompt_EmptyResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"   "}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	if _, err := client.EnhancePrompt(context.Background(), "cat"); err == nil {
+		t.Fatal("expected error for empty enhanced prompt")
+	}
+}
+
+func TestTranslateText_ParsesTextResponse(t *testing.T) {
+	var path string
+	var requestBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"Good morning\n"}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	translated, err := client.TranslateText(context.Background(), "早安", "English")
+	if err != nil {
+		t.Fatalf("TranslateText failed: %v", err)
+	}
+	if translated != "Good morning" {
+		t.Fatalf("unexpected translation %q", translated)
+	}
+	if !strings.Contains(path, DefaultTextModel) {
+		t.Fatalf("expected text model in path, got %s", path)
+	}
+	contents := requestBody["contents"].([]interface{})
+	parts := contents[0].(map[string]interface{})["parts"].([]interface{})
+	text, _ := parts[0].(map[string]interface{})["text"].(string)
+	if !strings.Contains(text, "into English") || !strings.HasSuffix(text, "早安") {
+		t.Fatalf("unexpected translate request %q", text)
+	}
+}
+
+func TestNewClientWithService_ExtractAndTTSModels(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.Contains(r.URL.Path, "my-tts") {
+			w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"mimeType":"audio/L16;rate=24000","data":"AAAA"}}]}}]}`))
+			return
+		}
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"hello"}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL, ExtractModel: " my-flash ", TTSModel: "my-tts"})
+	if _, err := client.ExtractText(context.Background(), []byte("img"), "image/png", "read"); err != nil {
+		t.Fatalf("ExtractText failed: %v", err)
+	}
+	if _, err := client.GenerateTTS(context.Background(), "hello", "Kore"); err != nil {
+		t.Fatalf("GenerateTTS failed: %v", err)
+	}
+	if len(paths) != 2 || !strings.Contains(paths[0], "/models/my-flash:") || !strings.Contains(paths[1], "/models/my-tts:") {
+		t.Fatalf("expected configured models in paths, got %v", paths)
+	}
+
+	// 未設定時使用預設模型
+	if c := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL}); c.textModel != DefaultTextModel || c.ttsModel != DefaultTTSModel {
+		t.Fatalf("expected default models, got %q / %q", c.textModel, c.ttsModel)
+	}
+}
+
+func TestSendImageRequest_FallsBackWhenModelNotFound(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.Contains(r.URL.Path, DefaultImageModel) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"message":"models/gemini-3-pro-image-preview is not found"}}`))
+			return
+		}
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"data":"aGVsbG8="}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	client.SetImageModelFallbacks([]string{DefaultImageModel, "gemini-2.5-flash-image"})
+	results, err := client.GenerateImageFromText(context.Background(), "cat", "2K", "1:1", GenerationOptions{})
+	if err != nil {
+		t.Fatalf("GenerateImageFromText failed: %v", err)
+	}
+	if results[0].Model != "gemini-2.5-flash-image" || !results[0].Fallback {
+		t.Fatalf("expected fallback model result, got model=%q fallback=%v", results[0].Model, results[0].Fallback)
+	}
+	// 與主要模型相同的備援會被略過，只多打一次
+	if len(paths) != 2 || !strings.Contains(paths[1], "/models/gemini-2.5-flash-image:") {
+		t.Fatalf("unexpected requests %v", paths)
+	}
+}
+
+func TestSendImageRequest_NoFallbackForOtherErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"invalid argument"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	client.SetImageModelFallbacks([]string{"gemini-2.5-flash-image"})
+	if _, err := client.GenerateImageFromText(context.Background(), "cat", "2K", "1:1", GenerationOptions{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if requests != 1 {
+		t.Fatalf("expected no fallback request, got %d requests", requests)
+	}
+}
+
+func TestSendImageRequest_RecordsPrimaryModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"data":"aGVsbG8="}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	client.SetImageModelFallbacks([]string{"gemini-2.5-flash-image"})
+	result, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "translate", "2K", "1:1")
+	if err != nil {
+		t.Fatalf("GenerateImage failed: %v", err)
+	}
+	if result.Model != DefaultImageModel || result.Fallback {
+		t.Fatalf("expected primary model result, got model=%q fallback=%v", result.Model, result.Fallback)
+	}
+}
+
+func TestGenerateImageFromText_WrapsPromptWithAffixes(t *testing.T) {
+	var requestBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"data":"aGVsbG8="}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	client.SetPromptAffixes("水彩風格", " 不要加浮水印 ")
+	if _, err := client.GenerateImageFromText(context.Background(), "一隻貓", "2K", "1:1", GenerationOptions{}); err != nil {
+		t.Fatalf("GenerateImageFromText failed: %v", err)
+	}
+
+	contents := requestBody["contents"].([]interface{})
+	parts := contents[0].(map[string]interface{})["parts"].([]interface{})
+	if text := parts[0].(map[string]interface{})["text"]; text != "水彩風格\n\n一隻貓\n\n不要加浮水印" {
+		t.Fatalf("unexpected final prompt %q", text)
+	}
+
+	// 只設定其中一個時不留多餘的分隔
+	client.SetPromptAffixes("", "不要加浮水印")
+	if got := client.WrapPrompt("一隻貓"); got != "一隻貓\n\n不要加浮水印" {
+		t.Fatalf("unexpected prompt with suffix only %q", got)
+	}
+}
+
+func TestSendImageRequest_NoFallbackForRequestedModel(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":404,"message":"models/my-model is not found"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	client.SetImageModelFallbacks([]string{"gemini-2.5-flash-image"})
+	_, err := client.GenerateImageFromText(context.Background(), "cat", "2K", "1:1", GenerationOptions{Model: "my-model"})
+	if !IsModelNotFound(err) {
+		t.Fatalf("expected model not found error, got %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("expected no fallback for @model, got %d requests", requests)
+	}
+}
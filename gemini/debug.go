@@ -0,0 +1,101 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	debugRequestLimit  = 4000
+	debugResponseLimit = 2000
+)
+
+var (
+	// apiKeyQueryPattern URL 中的 key= 參數
+	apiKeyQueryPattern = regexp.MustCompile(`(?i)([?&]key=)[^&\s"']+`)
+	// base64DataPattern JSON 中的圖片/音訊資料，dump 時只保留長度
+	base64DataPattern = regexp.MustCompile(`("data"\s*:\s*")([A-Za-z0-9+/=]{64,})(")`)
+	// sensitiveHeaderPattern 不可原樣輸出的 header
+	sensitiveHeaderPattern = regexp.MustCompile(`(?i)key|auth|cookie|token`)
+)
+
+// DebugDump 收集一次生成中每個 HTTP 請求與回應（已遮蔽金鑰、省略圖片資料），供 @debug 使用
+type DebugDump struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+// String 回傳所有紀錄，依請求順序排列
+func (d *DebugDump) String() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return strings.Join(d.entries, "\n\n")
+}
+
+func (d *DebugDump) record(url string, requestBody []byte, resp *http.Response, responseBody []byte, err error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "→ POST %s\n%s\n", maskAPIKeys(url), truncateDump(elideBase64(string(requestBody)), debugRequestLimit))
+	if resp != nil {
+		fmt.Fprintf(&b, "← %s\n", resp.Status)
+		names := make([]string, 0, len(resp.Header))
+		for name := range resp.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := strings.Join(resp.Header[name], ", ")
+			if sensitiveHeaderPattern.MatchString(name) {
+				value = "***"
+			}
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+		b.WriteString(truncateDump(elideBase64(string(responseBody)), debugResponseLimit))
+	}
+	if err != nil {
+		fmt.Fprintf(&b, "← error: %s", maskAPIKeys(err.Error()))
+	}
+
+	d.mu.Lock()
+	d.entries = append(d.entries, strings.TrimRight(b.String(), "\n"))
+	d.mu.Unlock()
+}
+
+type debugDumpKey struct{}
+
+// withDebugDump 讓這次請求經過的 doOnce 都寫入 dump，dump 為 nil 時不變
+func withDebugDump(ctx context.Context, dump *DebugDump) context.Context {
+	if dump == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, debugDumpKey{}, dump)
+}
+
+func debugDumpFrom(ctx context.Context) *DebugDump {
+	dump, _ := ctx.Value(debugDumpKey{}).(*DebugDump)
+	return dump
+}
+
+// maskAPIKeys 遮蔽 URL 中的 key= 參數
+func maskAPIKeys(s string) string {
+	return apiKeyQueryPattern.ReplaceAllString(s, "${1}***")
+}
+
+func elideBase64(s string) string {
+	return base64DataPattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := base64DataPattern.FindStringSubmatch(match)
+		return fmt.Sprintf("%s<%d 字元 base64 已省略>%s", parts[1], len(parts[2]), parts[3])
+	})
+}
+
+func truncateDump(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + fmt.Sprintf("...（共 %d 字元，已截斷）", len(runes))
+}
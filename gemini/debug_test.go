@@ -0,0 +1,46 @@
+package gemini
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugDump_RecordsRedactedExchange(t *testing.T) {
+	imageData := strings.Repeat("QUFB", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Goog-Api-Key", "leaked")
+		w.Header().Set("X-Request-Id", "req-1")
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"data":"` + imageData + `"}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "secret-key-123", BaseURL: server.URL})
+	dump := &DebugDump{}
+	_, err := client.GenerateImageWithContext(context.Background(), []DownloadedImage{{Data: []byte("img"), MimeType: "image/png"}},
+		"translate", "2K", "1:1", GenerationOptions{Debug: dump})
+	if err != nil {
+		t.Fatalf("GenerateImageWithContext failed: %v", err)
+	}
+
+	text := dump.String()
+	if strings.Contains(text, "secret-key-123") || strings.Contains(text, "leaked") {
+		t.Fatalf("dump should not contain secrets:\n%s", text)
+	}
+	if strings.Contains(text, imageData) {
+		t.Fatalf("dump should elide base64 data:\n%s", text)
+	}
+	for _, want := range []string{"key=***", `"translate"`, "200 OK", "X-Request-Id: req-1", "X-Goog-Api-Key: ***", "400 字元 base64 已省略"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in dump:\n%s", want, text)
+		}
+	}
+}
+
+func TestDebugDump_DisabledByDefault(t *testing.T) {
+	if debugDumpFrom(withDebugDump(context.Background(), nil)) != nil {
+		t.Fatalf("expected no dump without @debug")
+	}
+}
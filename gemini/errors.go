@@ -0,0 +1,91 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// APIError Gemini 回傳非 200 狀態碼時的錯誤
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error: %s", e.Body)
+}
+
+// IsRateLimited 是否為配額/頻率限制（429），換畫質也不會改善
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// invalidImageMessages Gemini 拒絕輸入圖片時的錯誤訊息（小寫），只比對這些，避免其他提到 image 的 400 被誤判
+var invalidImageMessages = []string{
+	"unable to process input image",
+	"unsupported mime type",
+	"provided image is not valid",
+}
+
+// IsInvalidImage 是否因輸入圖片無法處理（格式不支援或檔案損壞）被拒絕，重試不會改善
+func IsInvalidImage(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	body := strings.ToLower(apiErr.Body)
+	for _, msg := range invalidImageMessages {
+		if strings.Contains(body, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsModelNotFound 是否因模型不存在或不支援 generateContent 被拒絕（例如預覽模型下架），換模型才可能成功
+func IsModelNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	body := strings.ToLower(apiErr.Body)
+	return apiErr.StatusCode == http.StatusBadRequest && strings.Contains(body, "model") &&
+		(strings.Contains(body, "not found") || strings.Contains(body, "not supported"))
+}
+
+// IsAuthError 是否因 API Key 無效或沒有權限（401/403）被拒絕
+func IsAuthError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden)
+}
+
+// IsResourceError 是否像是圖片太大或運算資源不足造成的失敗（5xx 或逾時），降低畫質可能有幫助
+func IsResourceError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package gemini
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// DefaultMaxImageDimension 送給 Gemini 的圖片最長邊上限
+const DefaultMaxImageDimension = 2048
+
+// downscaleIfNeeded 最長邊超過 maxDim 時等比例縮小，回傳圖片與對應的 MIME 類型
+// 不需縮小（或 maxDim <= 0）時原樣回傳；PNG 維持 PNG，其他格式輸出為 JPEG
+func downscaleIfNeeded(data []byte, maxDim int) ([]byte, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	mimeType := "image/" + format
+	if maxDim <= 0 || (cfg.Width <= maxDim && cfg.Height <= maxDim) {
+		return data, mimeType, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	width, height := maxDim, cfg.Height*maxDim/cfg.Width
+	if cfg.Height > cfg.Width {
+		width, height = cfg.Width*maxDim/cfg.Height, maxDim
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if format == "png" {
+		err = png.Encode(&buf, dst)
+	} else {
+		mimeType = "image/jpeg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mimeType, nil
+}
+
+// prepareImage 送出前視需要縮小圖片；無法解碼的格式（例如 WebP 貼圖）原樣送出
+func (c *Client) prepareImage(data []byte, mimeType string) ([]byte, string) {
+	scaled, scaledMime, err := downscaleIfNeeded(data, c.maxImageDimension)
+	if err != nil {
+		return data, mimeType
+	}
+	return scaled, scaledMime
+}
@@ -0,0 +1,83 @@
+package gemini
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodeTestPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.White)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDownscaleIfNeeded_ScalesLargestDimension(t *testing.T) {
+	data := encodeTestPNG(t, 400, 1000)
+
+	scaled, mimeType, err := downscaleIfNeeded(data, 200)
+	if err != nil {
+		t.Fatalf("downscaleIfNeeded failed: %v", err)
+	}
+	if mimeType != "image/png" {
+		t.Fatalf("expected png output, got %s", mimeType)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(scaled))
+	if err != nil {
+		t.Fatalf("decode scaled failed: %v", err)
+	}
+	if cfg.Width != 80 || cfg.Height != 200 {
+		t.Fatalf("expected 80x200, got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestDownscaleIfNeeded_JPEGStaysJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 300, 100)), nil); err != nil {
+		t.Fatalf("encode jpeg failed: %v", err)
+	}
+
+	scaled, mimeType, err := downscaleIfNeeded(buf.Bytes(), 150)
+	if err != nil {
+		t.Fatalf("downscaleIfNeeded failed: %v", err)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(scaled))
+	if err != nil {
+		t.Fatalf("expected jpeg output: %v", err)
+	}
+	if mimeType != "image/jpeg" || cfg.Width != 150 || cfg.Height != 50 {
+		t.Fatalf("unexpected output %s %dx%d", mimeType, cfg.Width, cfg.Height)
+	}
+}
+
+func TestDownscaleIfNeeded_KeepsSmallImage(t *testing.T) {
+	data := encodeTestPNG(t, 100, 50)
+
+	out, mimeType, err := downscaleIfNeeded(data, 2048)
+	if err != nil {
+		t.Fatalf("downscaleIfNeeded failed: %v", err)
+	}
+	if !bytes.Equal(out, data) || mimeType != "image/png" {
+		t.Fatalf("expected original bytes to be returned unchanged")
+	}
+}
+
+func TestPrepareImage_PassesThroughUndecodable(t *testing.T) {
+	client := NewClientWithService(ServiceConfig{APIKey: "k"})
+	data := []byte("RIFF....WEBP")
+
+	out, mimeType := client.prepareImage(data, "image/webp")
+	if !bytes.Equal(out, data) || mimeType != "image/webp" {
+		t.Fatalf("expected undecodable image to pass through")
+	}
+}
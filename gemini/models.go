@@ -0,0 +1,123 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// KnownImageModels 服務不支援 models.list（例如只轉發 generateContent 的代理）時顯示的已知圖片模型
+var KnownImageModels = []string{
+	DefaultImageModel,
+	"gemini-2.5-flash-image",
+	"gemini-2.5-flash-image-preview",
+}
+
+// ErrListModelsUnsupported 服務設定為完整 generateContent endpoint，無法推得列表網址
+var ErrListModelsUnsupported = errors.New("service does not support listing models")
+
+// ListModels 查詢目前服務可用的模型名稱（已去掉 models/ 等前綴並排序）
+func (c *Client) ListModels(ctx context.Context) ([]string, error) {
+	listURL, err := c.buildListModelsURL()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", listURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return parseModelList(body)
+}
+
+// buildListModelsURL 依服務類型組出 models.list 網址
+func (c *Client) buildListModelsURL() (string, error) {
+	if strings.TrimSpace(c.apiKey) == "" {
+		return "", fmt.Errorf("service api key is empty")
+	}
+
+	baseURL := strings.TrimSpace(c.baseURL)
+	if strings.Contains(baseURL, ":generateContent") {
+		return "", ErrListModelsUnsupported
+	}
+
+	var endpoint string
+	if normalizeServiceType(c.serviceType) == ServiceTypeVertex {
+		// Publisher 模型列表不分專案與區域，express / full mode 共用
+		if baseURL == "" {
+			baseURL = DefaultVertexBaseURL
+		}
+		endpoint = strings.TrimRight(baseURL, "/") + "/v1beta1/publishers/google/models"
+	} else {
+		if baseURL == "" {
+			baseURL = DefaultGeminiBaseURL
+		}
+		endpoint = strings.TrimRight(baseURL, "/") + "/v1beta/models"
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	query := parsed.Query()
+	query.Set("pageSize", "1000")
+	parsed.RawQuery = query.Encode()
+	return appendAPIKey(parsed.String(), c.apiKey)
+}
+
+// parseModelList 解析 Gemini（models）與 Vertex（publisherModels）兩種回應格式
+func parseModelList(body []byte) ([]string, error) {
+	var result struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+		PublisherModels []struct {
+			Name string `json:"name"`
+		} `json:"publisherModels"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse model list: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, m := range result.Models {
+		add(m.Name)
+	}
+	for _, m := range result.PublisherModels {
+		add(m.Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("model list is empty")
+	}
+	sort.Strings(names)
+	return names, nil
+}
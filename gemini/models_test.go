@@ -0,0 +1,77 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildListModelsURL(t *testing.T) {
+	cases := []struct {
+		service ServiceConfig
+		prefix  string
+	}{
+		{ServiceConfig{Type: ServiceTypeStandard, APIKey: "k"}, "https://generativelanguage.googleapis.com/v1beta/models?"},
+		{ServiceConfig{Type: ServiceTypeCustom, APIKey: "k", BaseURL: "https://proxy.example.com/"}, "https://proxy.example.com/v1beta/models?"},
+		{ServiceConfig{Type: ServiceTypeVertex, APIKey: "k", ProjectID: "p", Location: "us-central1"}, "https://aiplatform.googleapis.com/v1beta1/publishers/google/models?"},
+	}
+	for _, tc := range cases {
+		got, err := NewClientWithService(tc.service).buildListModelsURL()
+		if err != nil {
+			t.Fatalf("buildListModelsURL(%+v) error = %v", tc.service, err)
+		}
+		if !strings.HasPrefix(got, tc.prefix) || !strings.Contains(got, "key=k") {
+			t.Fatalf("buildListModelsURL(%+v) = %q, want prefix %q with key", tc.service, got, tc.prefix)
+		}
+	}
+
+	full := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "k", BaseURL: "https://proxy.example.com/v1/models/x:generateContent"})
+	if _, err := full.buildListModelsURL(); !errors.Is(err, ErrListModelsUnsupported) {
+		t.Fatalf("expected ErrListModelsUnsupported, got %v", err)
+	}
+}
+
+func TestListModels_ParsesAndSorts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/v1beta/models" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"models":[{"name":"models/gemini-3-pro-image-preview"},{"name":"models/gemini-2.5-flash"},{"name":"models/gemini-2.5-flash"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "k", BaseURL: server.URL})
+	models, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	want := []string{"gemini-2.5-flash", "gemini-3-pro-image-preview"}
+	if !reflect.DeepEqual(models, want) {
+		t.Fatalf("ListModels = %v, want %v", models, want)
+	}
+}
+
+func TestListModels_ParsesVertexPublisherModels(t *testing.T) {
+	models, err := parseModelList([]byte(`{"publisherModels":[{"name":"publishers/google/models/imagen-4.0"}]}`))
+	if err != nil || !reflect.DeepEqual(models, []string{"imagen-4.0"}) {
+		t.Fatalf("parseModelList = %v, %v", models, err)
+	}
+}
+
+func TestListModels_ReturnsAPIErrorWhenUnsupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "k", BaseURL: server.URL})
+	_, err := client.ListModels(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 APIError, got %v", err)
+	}
+}
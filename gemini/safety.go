@@ -0,0 +1,111 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 安全等級，對應 safetySettings 的 threshold（越高擋得越多）
+const (
+	SafetyLevelOff    = "OFF"
+	SafetyLevelLow    = "LOW"
+	SafetyLevelMedium = "MEDIUM"
+	SafetyLevelHigh   = "HIGH"
+)
+
+var safetyThresholds = map[string]string{
+	SafetyLevelOff:    "OFF",
+	SafetyLevelLow:    "BLOCK_ONLY_HIGH",
+	SafetyLevelMedium: "BLOCK_MEDIUM_AND_ABOVE",
+	SafetyLevelHigh:   "BLOCK_LOW_AND_ABOVE",
+}
+
+var harmCategories = []string{
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+}
+
+// safetyFinishReasons 代表候選結果因安全政策被擋下的 finishReason
+var safetyFinishReasons = map[string]bool{
+	"SAFETY":             true,
+	"IMAGE_SAFETY":       true,
+	"PROHIBITED_CONTENT": true,
+	"BLOCKLIST":          true,
+	"SPII":               true,
+}
+
+// SafetyThreshold 將安全等級（不分大小寫，空字串視為 OFF）轉為 threshold 字串
+func SafetyThreshold(level string) (string, bool) {
+	level = strings.ToUpper(strings.TrimSpace(level))
+	if level == "" {
+		level = SafetyLevelOff
+	}
+	threshold, ok := safetyThresholds[level]
+	return threshold, ok
+}
+
+// safetySettings 依安全等級建立所有類別的 safetySettings，未知等級沿用 OFF
+func safetySettings(level string) []map[string]interface{} {
+	threshold, ok := SafetyThreshold(level)
+	if !ok {
+		threshold = safetyThresholds[SafetyLevelOff]
+	}
+	settings := make([]map[string]interface{}, 0, len(harmCategories))
+	for _, category := range harmCategories {
+		settings = append(settings, map[string]interface{}{"category": category, "threshold": threshold})
+	}
+	return settings
+}
+
+// SafetyBlockError Gemini 因安全政策拒絕 Prompt 或擋下結果
+type SafetyBlockError struct {
+	Reason     string   // blockReason 或 finishReason
+	Categories []string // 被標記為 blocked 的類別
+}
+
+func (e *SafetyBlockError) Error() string {
+	if len(e.Categories) > 0 {
+		return fmt.Sprintf("blocked by safety filter: %s (%s)", e.Reason, strings.Join(e.Categories, ", "))
+	}
+	return fmt.Sprintf("blocked by safety filter: %s", e.Reason)
+}
+
+// IsSafetyBlocked 是否因安全政策被擋下，重試不會改善
+func IsSafetyBlocked(err error) bool {
+	var safetyErr *SafetyBlockError
+	return errors.As(err, &safetyErr)
+}
+
+// blockedCategories 從 safetyRatings 取出 blocked 的類別
+func blockedCategories(raw interface{}) []string {
+	ratings, _ := raw.([]interface{})
+	var categories []string
+	for _, r := range ratings {
+		rating, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if blocked, _ := rating["blocked"].(bool); blocked {
+			if category, ok := rating["category"].(string); ok {
+				categories = append(categories, category)
+			}
+		}
+	}
+	return categories
+}
+
+// promptBlockError 整個 Prompt 被擋下時回應沒有 candidates，原因在 promptFeedback
+func promptBlockError(result map[string]interface{}) error {
+	feedback, ok := result["promptFeedback"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	reason, _ := feedback["blockReason"].(string)
+	if reason == "" {
+		return nil
+	}
+	return &SafetyBlockError{Reason: reason, Categories: blockedCategories(feedback["safetyRatings"])}
+}
@@ -0,0 +1,77 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSafetySettings_ThresholdVariesByLevel(t *testing.T) {
+	cases := map[string]string{
+		"":       "OFF",
+		"off":    "OFF",
+		"LOW":    "BLOCK_ONLY_HIGH",
+		"medium": "BLOCK_MEDIUM_AND_ABOVE",
+		"HIGH":   "BLOCK_LOW_AND_ABOVE",
+		"bogus":  "OFF",
+	}
+	for level, want := range cases {
+		settings := safetySettings(level)
+		if len(settings) != len(harmCategories) {
+			t.Fatalf("level %q: expected %d categories, got %d", level, len(harmCategories), len(settings))
+		}
+		for _, s := range settings {
+			if s["threshold"] != want {
+				t.Fatalf("level %q: expected threshold %s, got %v", level, want, s["threshold"])
+			}
+		}
+	}
+
+	if _, ok := SafetyThreshold("bogus"); ok {
+		t.Fatalf("expected unknown level to be rejected")
+	}
+}
+
+func TestGenerateImageWithContext_SendsConfiguredSafetyLevel(t *testing.T) {
+	var requestBody struct {
+		SafetySettings []map[string]string `json:"safetySettings"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"inlineData":{"data":"aGVsbG8="}}]}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithService(ServiceConfig{Type: ServiceTypeCustom, APIKey: "abc123", BaseURL: server.URL})
+	client.SetSafetyLevel(SafetyLevelHigh)
+	if _, err := client.GenerateImageWithContext(context.Background(), []DownloadedImage{{Data: []byte("img"), MimeType: "image/png"}}, "p", "2K", "", GenerationOptions{}); err != nil {
+		t.Fatalf("GenerateImageWithContext failed: %v", err)
+	}
+	if len(requestBody.SafetySettings) == 0 || requestBody.SafetySettings[0]["threshold"] != "BLOCK_LOW_AND_ABOVE" {
+		t.Fatalf("unexpected safety settings %v", requestBody.SafetySettings)
+	}
+}
+
+func TestGenerateImage_ReturnsSafetyBlockError(t *testing.T) {
+	cases := map[string]string{
+		"prompt feedback": `{"promptFeedback":{"blockReason":"SAFETY","safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","blocked":true}]}}`,
+		"finish reason":   `{"candidates":[{"finishReason":"IMAGE_SAFETY","safetyRatings":[{"category":"HARM_CATEGORY_HARASSMENT","blocked":true},{"category":"HARM_CATEGORY_HATE_SPEECH"}]}]}`,
+	}
+	for name, body := range cases {
+		client := newStubClient(t, http.StatusOK, body)
+		_, err := client.GenerateImage(context.Background(), []byte("img"), "image/png", "p", "2K", "1:1")
+		if !IsSafetyBlocked(err) {
+			t.Fatalf("%s: expected safety block error, got %v", name, err)
+		}
+		safetyErr := err.(*SafetyBlockError)
+		if len(safetyErr.Categories) != 1 || safetyErr.Categories[0] != "HARM_CATEGORY_HARASSMENT" {
+			t.Fatalf("%s: unexpected categories %v", name, safetyErr.Categories)
+		}
+	}
+
+	if IsSafetyBlocked(&APIError{StatusCode: 500}) {
+		t.Fatalf("API errors should not be treated as safety blocks")
+	}
+}
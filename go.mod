@@ -4,6 +4,7 @@ go 1.22
 
 require (
 	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
+	golang.org/x/image v0.18.0
 	modernc.org/sqlite v1.34.1
 )
 